@@ -0,0 +1,493 @@
+package arp_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/raw/arp"
+	"github.com/mdlayher/raw/ethernet"
+	"github.com/mdlayher/raw/internal/rawtest"
+)
+
+var (
+	clientMAC = net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad}
+	otherMAC  = net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+
+	clientIP = net.IPv4(192, 0, 2, 1).To4()
+)
+
+func TestPacketMarshalUnmarshal(t *testing.T) {
+	p, err := arp.NewPacket(
+		arp.OperationReply,
+		clientMAC, clientIP,
+		otherMAC, net.IPv4(192, 0, 2, 2),
+	)
+	if err != nil {
+		t.Fatalf("failed to create packet: %v", err)
+	}
+
+	b, err := p.MarshalBinary()
+	if err != nil {
+		t.Fatalf("failed to marshal: %v", err)
+	}
+
+	want := []byte{
+		0x00, 0x01,
+		0x08, 0x00,
+		6, 4,
+		0x00, 0x02,
+		0xde, 0xad, 0xbe, 0xef, 0xde, 0xad,
+		192, 0, 2, 1,
+		0x02, 0x00, 0x00, 0x00, 0x00, 0x01,
+		192, 0, 2, 2,
+	}
+	if diff := cmp.Diff(want, b); diff != "" {
+		t.Fatalf("unexpected packet bytes (-want +got):\n%s", diff)
+	}
+
+	var got arp.Packet
+	if err := got.UnmarshalBinary(b); err != nil {
+		t.Fatalf("failed to unmarshal: %v", err)
+	}
+
+	if diff := cmp.Diff(p, &got); diff != "" {
+		t.Fatalf("unexpected packet (-want +got):\n%s", diff)
+	}
+}
+
+func TestPacketUnmarshalErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		b    []byte
+	}{
+		{
+			name: "short header",
+			b:    []byte{0x00, 0x01, 0x08},
+		},
+		{
+			name: "IPv6 protocol length",
+			b:    []byte{0x00, 0x01, 0x86, 0xdd, 6, 16, 0x00, 0x01},
+		},
+		{
+			name: "short addresses",
+			b:    []byte{0x00, 0x01, 0x08, 0x00, 6, 4, 0x00, 0x01, 0xde, 0xad},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var p arp.Packet
+			if err := p.UnmarshalBinary(tt.b); err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+		})
+	}
+}
+
+func TestClientGratuitous(t *testing.T) {
+	c, _, peer := testClient(t)
+
+	if err := c.Gratuitous(arp.OperationReply, clientIP); err != nil {
+		t.Fatalf("failed to send gratuitous ARP: %v", err)
+	}
+
+	f, p := readPacket(t, peer)
+	if diff := cmp.Diff(ethernet.Broadcast, f.Destination); diff != "" {
+		t.Fatalf("unexpected destination (-want +got):\n%s", diff)
+	}
+
+	want := &arp.Packet{
+		HardwareType:       1,
+		ProtocolType:       uint16(ethernet.EtherTypeIPv4),
+		HardwareAddrLength: 6,
+		IPLength:           4,
+		Operation:          arp.OperationReply,
+		SenderHardwareAddr: clientMAC,
+		SenderIP:           clientIP,
+		TargetHardwareAddr: ethernet.Broadcast,
+		TargetIP:           clientIP,
+	}
+	if diff := cmp.Diff(want, p); diff != "" {
+		t.Fatalf("unexpected packet (-want +got):\n%s", diff)
+	}
+}
+
+func TestClientProbeNoConflict(t *testing.T) {
+	c, conn, _ := testClient(t)
+
+	if err := c.Probe(context.Background(), clientIP); err != nil {
+		t.Fatalf("failed to probe: %v", err)
+	}
+
+	frames := conn.Written()
+	if diff := cmp.Diff(3, len(frames)); diff != "" {
+		t.Fatalf("unexpected number of probes (-want +got):\n%s", diff)
+	}
+
+	for _, b := range frames {
+		var f ethernet.Frame
+		if err := f.UnmarshalBinary(b); err != nil {
+			t.Fatalf("failed to unmarshal frame: %v", err)
+		}
+
+		var p arp.Packet
+		if err := p.UnmarshalBinary(f.Payload); err != nil {
+			t.Fatalf("failed to unmarshal packet: %v", err)
+		}
+
+		if !p.SenderIP.Equal(net.IPv4zero) || !p.TargetIP.Equal(clientIP) {
+			t.Fatalf("unexpected probe addresses: %s -> %s", p.SenderIP, p.TargetIP)
+		}
+	}
+}
+
+func TestClientProbeConflict(t *testing.T) {
+	c, _, peer := testClient(t)
+
+	// The peer defends the address as soon as it sees a probe.
+	go func() {
+		if _, p := readPacket(t, peer); p != nil {
+			request(t, peer, p.TargetIP, p.TargetIP)
+		}
+	}()
+
+	err := c.Probe(context.Background(), clientIP)
+
+	var cerr *arp.ConflictError
+	if !errors.As(err, &cerr) {
+		t.Fatalf("expected conflict error, but got: %v", err)
+	}
+
+	want := &arp.ConflictError{
+		IP:           clientIP,
+		HardwareAddr: otherMAC,
+	}
+	if diff := cmp.Diff(want, cerr); diff != "" {
+		t.Fatalf("unexpected conflict (-want +got):\n%s", diff)
+	}
+}
+
+func TestClientAnnounce(t *testing.T) {
+	c, conn, _ := testClient(t)
+
+	if err := c.Announce(context.Background(), clientIP); err != nil {
+		t.Fatalf("failed to announce: %v", err)
+	}
+
+	if diff := cmp.Diff(2, len(conn.Written())); diff != "" {
+		t.Fatalf("unexpected number of announcements (-want +got):\n%s", diff)
+	}
+}
+
+func TestClientProbeContextCanceled(t *testing.T) {
+	c, _, _ := testClient(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := c.Probe(ctx, clientIP); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context canceled, but got: %v", err)
+	}
+}
+
+func TestNewInvalidConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  arp.Config
+	}{
+		{name: "negative probe count", cfg: arp.Config{ProbeNum: -1}},
+		{name: "negative announcement count", cfg: arp.Config{AnnounceNum: -1}},
+		{name: "negative probe wait", cfg: arp.Config{ProbeWait: -1}},
+		{name: "negative announcement interval", cfg: arp.Config{AnnounceInterval: -1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ifi := &net.Interface{MTU: 1500, HardwareAddr: clientMAC}
+			if _, err := arp.New(ifi, rawtest.NewHub().Conn(clientMAC), &tt.cfg); err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+		})
+	}
+}
+
+func TestServerServe(t *testing.T) {
+	var (
+		hostIP  = net.IPv4(192, 0, 2, 10).To4()
+		hostMAC = net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x0a}
+		proxyIP = net.IPv4(198, 51, 100, 20).To4()
+	)
+
+	hub := rawtest.NewHub()
+	peer := hub.Conn(otherMAC)
+	t.Cleanup(func() { peer.Close() })
+
+	ifi := &net.Interface{
+		Name:         "test0",
+		MTU:          1500,
+		HardwareAddr: clientMAC,
+	}
+
+	c := hub.Conn(clientMAC)
+	s, err := arp.NewServer(ifi, c)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	defer s.Close()
+
+	if err := s.Add(hostIP, hostMAC); err != nil {
+		t.Fatalf("failed to add host: %v", err)
+	}
+
+	_, prefix, err := net.ParseCIDR("198.51.100.0/24")
+	if err != nil {
+		t.Fatalf("failed to parse prefix: %v", err)
+	}
+	if err := s.AddPrefix(prefix, nil); err != nil {
+		t.Fatalf("failed to add prefix: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errC := make(chan error, 1)
+	go func() { errC <- s.Serve(ctx) }()
+
+	tests := []struct {
+		name string
+		ip   net.IP
+		mac  net.HardwareAddr
+	}{
+		{
+			name: "host",
+			ip:   hostIP,
+			mac:  hostMAC,
+		},
+		{
+			name: "proxy",
+			ip:   proxyIP,
+			mac:  clientMAC,
+		},
+	}
+
+	peerIP := net.IPv4(192, 0, 2, 2).To4()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request(t, peer, peerIP, tt.ip)
+
+			f, p := readPacket(t, peer)
+			if t.Failed() {
+				t.FailNow()
+			}
+
+			if diff := cmp.Diff(otherMAC, f.Destination); diff != "" {
+				t.Fatalf("unexpected destination (-want +got):\n%s", diff)
+			}
+
+			want := &arp.Packet{
+				HardwareType:       1,
+				ProtocolType:       uint16(ethernet.EtherTypeIPv4),
+				HardwareAddrLength: 6,
+				IPLength:           4,
+				Operation:          arp.OperationReply,
+				SenderHardwareAddr: tt.mac,
+				SenderIP:           tt.ip,
+				TargetHardwareAddr: otherMAC,
+				TargetIP:           peerIP,
+			}
+			if diff := cmp.Diff(want, p); diff != "" {
+				t.Fatalf("unexpected reply (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	// Requests for unknown addresses must not be answered.
+	request(t, peer, peerIP, net.IPv4(203, 0, 113, 1))
+	if err := peer.SetReadDeadline(time.Now().Add(50 * time.Millisecond)); err != nil {
+		t.Fatalf("failed to set deadline: %v", err)
+	}
+	if _, _, err := peer.ReadFrom(make([]byte, 1514)); err == nil {
+		t.Fatal("expected no reply for unknown address")
+	}
+
+	cancel()
+	if err := <-errC; err != nil {
+		t.Fatalf("failed to serve: %v", err)
+	}
+
+	// The connection's read deadline is cleared when Serve returns, so it
+	// remains usable.
+	request(t, peer, peerIP, hostIP)
+	if _, _, err := c.ReadFrom(make([]byte, 1514)); err != nil {
+		t.Fatalf("failed to read after serving: %v", err)
+	}
+}
+
+func TestServerLookup(t *testing.T) {
+	ifi := &net.Interface{HardwareAddr: clientMAC}
+	s, err := arp.NewServer(ifi, rawtest.NewHub().Conn(clientMAC))
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	defer s.Close()
+
+	mustPrefix := func(cidr string) *net.IPNet {
+		_, p, err := net.ParseCIDR(cidr)
+		if err != nil {
+			t.Fatalf("failed to parse prefix: %v", err)
+		}
+		return p
+	}
+
+	if err := s.AddPrefix(mustPrefix("10.0.0.0/8"), nil); err != nil {
+		t.Fatalf("failed to add prefix: %v", err)
+	}
+	if err := s.AddPrefix(mustPrefix("10.1.0.0/16"), otherMAC); err != nil {
+		t.Fatalf("failed to add prefix: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		ip   net.IP
+		mac  net.HardwareAddr
+		ok   bool
+	}{
+		{
+			name: "short prefix",
+			ip:   net.IPv4(10, 2, 0, 1),
+			mac:  clientMAC,
+			ok:   true,
+		},
+		{
+			name: "long prefix",
+			ip:   net.IPv4(10, 1, 0, 1),
+			mac:  otherMAC,
+			ok:   true,
+		},
+		{
+			name: "no match",
+			ip:   net.IPv4(192, 0, 2, 1),
+		},
+		{
+			name: "IPv6",
+			ip:   net.ParseIP("2001:db8::1"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mac, ok := s.Lookup(tt.ip)
+			if diff := cmp.Diff(tt.ok, ok); diff != "" {
+				t.Fatalf("unexpected lookup result (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.mac, mac); diff != "" {
+				t.Fatalf("unexpected hardware address (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	s.RemovePrefix(mustPrefix("10.1.0.0/16"))
+	if mac, _ := s.Lookup(net.IPv4(10, 1, 0, 1)); !bytes.Equal(mac, clientMAC) {
+		t.Fatalf("unexpected hardware address after removal: %s", mac)
+	}
+}
+
+// testClient creates a Client and a peer Conn on the same in-memory segment.
+func testClient(t *testing.T) (*arp.Client, *rawtest.Conn, *rawtest.Conn) {
+	t.Helper()
+
+	hub := rawtest.NewHub()
+	conn := hub.Conn(clientMAC)
+	peer := hub.Conn(otherMAC)
+
+	ifi := &net.Interface{
+		Name:         "test0",
+		MTU:          1500,
+		HardwareAddr: clientMAC,
+	}
+
+	c, err := arp.New(ifi, conn, &arp.Config{
+		ProbeWait:        time.Millisecond,
+		ProbeMin:         time.Millisecond,
+		ProbeMax:         2 * time.Millisecond,
+		AnnounceWait:     50 * time.Millisecond,
+		AnnounceInterval: time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	t.Cleanup(func() {
+		c.Close()
+		peer.Close()
+	})
+
+	return c, conn, peer
+}
+
+// readPacket reads a single ARP packet from c.
+func readPacket(t *testing.T, c net.PacketConn) (*ethernet.Frame, *arp.Packet) {
+	t.Helper()
+
+	if err := c.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Errorf("failed to set deadline: %v", err)
+		return nil, nil
+	}
+
+	b := make([]byte, 1514)
+	n, _, err := c.ReadFrom(b)
+	if err != nil {
+		t.Errorf("failed to read: %v", err)
+		return nil, nil
+	}
+
+	var f ethernet.Frame
+	if err := f.UnmarshalBinary(b[:n]); err != nil {
+		t.Errorf("failed to unmarshal frame: %v", err)
+		return nil, nil
+	}
+
+	var p arp.Packet
+	if err := p.UnmarshalBinary(f.Payload); err != nil {
+		t.Errorf("failed to unmarshal packet: %v", err)
+		return nil, nil
+	}
+
+	return &f, &p
+}
+
+// request sends an ARP request from c, asking for the hardware address of
+// target. If sender and target are equal, the request is an announcement.
+func request(t *testing.T, c net.PacketConn, sender, target net.IP) {
+	t.Helper()
+
+	p, err := arp.NewPacket(arp.OperationRequest, otherMAC, sender, make(net.HardwareAddr, 6), target)
+	if err != nil {
+		t.Errorf("failed to create packet: %v", err)
+		return
+	}
+
+	pb, err := p.MarshalBinary()
+	if err != nil {
+		t.Errorf("failed to marshal packet: %v", err)
+		return
+	}
+
+	fb, err := (&ethernet.Frame{
+		Destination: ethernet.Broadcast,
+		Source:      otherMAC,
+		EtherType:   ethernet.EtherTypeARP,
+		Payload:     pb,
+	}).MarshalBinary()
+	if err != nil {
+		t.Errorf("failed to marshal frame: %v", err)
+		return
+	}
+
+	if _, err := c.WriteTo(fb, nil); err != nil {
+		t.Errorf("failed to write: %v", err)
+	}
+}
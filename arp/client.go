@@ -0,0 +1,396 @@
+// Package arp implements the ARP protocol, as described in RFC 826, on top of
+// a *raw.Conn. It can send gratuitous ARP packets, perform the IPv4 address
+// conflict detection probe and announcement sequences described in RFC 5227,
+// and answer ARP requests on behalf of other hosts, including proxy ARP.
+package arp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/mdlayher/raw"
+	"github.com/mdlayher/raw/ethernet"
+	"github.com/mdlayher/raw/internal/frame"
+)
+
+// Default timing values from RFC 5227, section 1.1.
+const (
+	defaultProbeWait        = 1 * time.Second
+	defaultProbeNum         = 3
+	defaultProbeMin         = 1 * time.Second
+	defaultProbeMax         = 2 * time.Second
+	defaultAnnounceWait     = 2 * time.Second
+	defaultAnnounceNum      = 2
+	defaultAnnounceInterval = 2 * time.Second
+)
+
+// A Config specifies the timing parameters used by a Client. The zero value
+// of any field selects the default value from RFC 5227.
+type Config struct {
+	// ProbeWait is the maximum random delay before the first probe is sent.
+	ProbeWait time.Duration
+
+	// ProbeNum is the number of probes sent.
+	ProbeNum int
+
+	// ProbeMin and ProbeMax are the bounds of the random delay between
+	// probes.
+	ProbeMin, ProbeMax time.Duration
+
+	// AnnounceWait is the time to listen for conflicts after the last probe
+	// is sent.
+	AnnounceWait time.Duration
+
+	// AnnounceNum is the number of announcements sent.
+	AnnounceNum int
+
+	// AnnounceInterval is the delay between announcements.
+	AnnounceInterval time.Duration
+}
+
+// withDefaults returns a copy of c with zero values replaced by defaults.
+func (c Config) withDefaults() (Config, error) {
+	if c.ProbeNum < 0 || c.AnnounceNum < 0 {
+		return c, errors.New("arp: probe and announcement counts must not be negative")
+	}
+
+	durations := []struct {
+		d   *time.Duration
+		def time.Duration
+	}{
+		{&c.ProbeWait, defaultProbeWait},
+		{&c.ProbeMin, defaultProbeMin},
+		{&c.ProbeMax, defaultProbeMax},
+		{&c.AnnounceWait, defaultAnnounceWait},
+		{&c.AnnounceInterval, defaultAnnounceInterval},
+	}
+	for _, d := range durations {
+		switch {
+		case *d.d < 0:
+			return c, errors.New("arp: timing values must not be negative")
+		case *d.d == 0:
+			*d.d = d.def
+		}
+	}
+
+	if c.ProbeNum == 0 {
+		c.ProbeNum = defaultProbeNum
+	}
+	if c.AnnounceNum == 0 {
+		c.AnnounceNum = defaultAnnounceNum
+	}
+
+	return c, nil
+}
+
+// A ConflictError is returned when another host is found to be using an IPv4
+// address.
+type ConflictError struct {
+	// IP is the address in conflict.
+	IP net.IP
+
+	// HardwareAddr is the hardware address of the conflicting host.
+	HardwareAddr net.HardwareAddr
+}
+
+// Error implements error.
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("arp: address %s is in use by %s", e.IP, e.HardwareAddr)
+}
+
+// A Client sends and receives ARP packets on a network interface.
+type Client struct {
+	ifi *net.Interface
+	p   net.PacketConn
+	cfg Config
+
+	// Guards the random number generator.
+	randMu sync.Mutex
+	rand   *rand.Rand
+}
+
+// Dial creates a new Client using the specified network interface. Dial
+// opens a *raw.Conn which receives ARP frames. A nil Config selects the
+// default timing values from RFC 5227.
+func Dial(ifi *net.Interface, cfg *Config) (*Client, error) {
+	p, err := raw.ListenPacket(ifi, uint16(ethernet.EtherTypeARP), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := New(ifi, p, cfg)
+	if err != nil {
+		_ = p.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// New creates a new Client using the specified network interface and
+// net.PacketConn. This allows the caller to define exactly how the
+// connection is created, such as when additional options must be applied
+// to a *raw.Conn. p must send and receive complete Ethernet frames.
+func New(ifi *net.Interface, p net.PacketConn, cfg *Config) (*Client, error) {
+	if len(ifi.HardwareAddr) != 6 {
+		return nil, errInvalidHardwareAddr
+	}
+
+	if cfg == nil {
+		cfg = &Config{}
+	}
+
+	conf, err := cfg.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{
+		ifi:  ifi,
+		p:    p,
+		cfg:  conf,
+		rand: rand.New(rand.NewSource(time.Now().UnixNano())),
+	}, nil
+}
+
+// Close closes the Client's connection.
+func (c *Client) Close() error {
+	return c.p.Close()
+}
+
+// HardwareAddr fetches the hardware address for the interface associated
+// with the Client.
+func (c *Client) HardwareAddr() net.HardwareAddr {
+	return c.ifi.HardwareAddr
+}
+
+// Gratuitous broadcasts a single gratuitous ARP packet for ip, using the
+// specified Operation. Both the sender and target IP addresses are set to ip.
+// Requests carry an all-zeros target hardware address, as recommended by
+// RFC 5227, and replies carry the broadcast address.
+func (c *Client) Gratuitous(op Operation, ip net.IP) error {
+	tha := net.HardwareAddr(make([]byte, 6))
+	if op == OperationReply {
+		tha = ethernet.Broadcast
+	}
+
+	return c.send(op, ip, tha, ip)
+}
+
+// Probe performs RFC 5227 address conflict detection for ip: it waits a
+// random delay, broadcasts ARP probes, and listens for a period after the
+// last probe. If another host claims or probes for ip, a *ConflictError is
+// returned. A nil error indicates that ip appears to be unused, and the
+// caller should follow up with Announce.
+func (c *Client) Probe(ctx context.Context, ip net.IP) error {
+	ip4 := ip.To4()
+	if ip4 == nil {
+		return errInvalidIP
+	}
+
+	delays := []time.Duration{c.random(0, c.cfg.ProbeWait)}
+	for i := 1; i < c.cfg.ProbeNum; i++ {
+		delays = append(delays, c.random(c.cfg.ProbeMin, c.cfg.ProbeMax))
+	}
+
+	send := func() error {
+		// Probes use an all-zeros sender IP so they do not pollute the ARP
+		// caches of other hosts.
+		return c.send(OperationRequest, net.IPv4zero, make(net.HardwareAddr, 6), ip4)
+	}
+
+	conflict := func(p *Packet) bool {
+		if bytes.Equal(p.SenderHardwareAddr, c.ifi.HardwareAddr) {
+			return false
+		}
+
+		// Another host is either using the address, or is simultaneously
+		// probing for it.
+		return p.SenderIP.Equal(ip4) ||
+			(p.SenderIP.Equal(net.IPv4zero) && p.TargetIP.Equal(ip4))
+	}
+
+	return c.exchange(ctx, ip4, delays, c.cfg.AnnounceWait, send, conflict)
+}
+
+// Announce broadcasts RFC 5227 ARP announcements for ip, updating the ARP
+// caches of other hosts on the network. If another host claims ip while the
+// announcements are being sent, a *ConflictError is returned.
+func (c *Client) Announce(ctx context.Context, ip net.IP) error {
+	ip4 := ip.To4()
+	if ip4 == nil {
+		return errInvalidIP
+	}
+
+	delays := []time.Duration{0}
+	for i := 1; i < c.cfg.AnnounceNum; i++ {
+		delays = append(delays, c.cfg.AnnounceInterval)
+	}
+
+	send := func() error {
+		return c.Gratuitous(OperationRequest, ip4)
+	}
+
+	conflict := func(p *Packet) bool {
+		return p.SenderIP.Equal(ip4) &&
+			!bytes.Equal(p.SenderHardwareAddr, c.ifi.HardwareAddr)
+	}
+
+	return c.exchange(ctx, ip4, delays, 0, send, conflict)
+}
+
+// exchange calls send after each of the delays in turn and then waits for
+// linger, while checking all received ARP packets for a conflict with ip.
+func (c *Client) exchange(
+	ctx context.Context,
+	ip net.IP,
+	delays []time.Duration,
+	linger time.Duration,
+	send func() error,
+	conflict func(p *Packet) bool,
+) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	packets, errC, stop := c.receive(ctx)
+	defer stop()
+
+	t := time.NewTimer(delays[0])
+	defer t.Stop()
+
+	for i := 0; ; {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-errC:
+			return err
+		case p := <-packets:
+			if conflict(p) {
+				return &ConflictError{
+					IP:           ip,
+					HardwareAddr: p.SenderHardwareAddr,
+				}
+			}
+		case <-t.C:
+			if i == len(delays) {
+				// Sent all packets and no conflicts were found.
+				return nil
+			}
+
+			if err := send(); err != nil {
+				return err
+			}
+
+			i++
+			next := linger
+			if i < len(delays) {
+				next = delays[i]
+			}
+			t.Reset(next)
+		}
+	}
+}
+
+// receive starts a goroutine which reads ARP packets from the Client's
+// connection until ctx is canceled or the returned function is called.
+func (c *Client) receive(ctx context.Context) (<-chan *Packet, <-chan error, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	stopReads := frame.CancelReads(ctx, c.p)
+
+	var (
+		packets = make(chan *Packet)
+		errC    = make(chan error, 1)
+		wg      sync.WaitGroup
+	)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		b := make([]byte, frame.BufferSize(c.ifi))
+		for {
+			n, _, err := c.p.ReadFrom(b)
+			if err != nil {
+				if ctx.Err() == nil {
+					errC <- err
+				}
+				return
+			}
+
+			p, _, err := parsePacket(b[:n])
+			if err != nil {
+				// Not a valid ARP packet, keep reading.
+				continue
+			}
+
+			select {
+			case packets <- p:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return packets, errC, func() {
+		// Force the pending read to return and wait for the goroutine to
+		// exit before the deadline is cleared.
+		cancel()
+		wg.Wait()
+		stopReads()
+	}
+}
+
+// send broadcasts an ARP packet with the specified parameters, using the
+// Client's hardware address as the sender hardware address.
+func (c *Client) send(op Operation, srcIP net.IP, dstHW net.HardwareAddr, dstIP net.IP) error {
+	p, err := NewPacket(op, c.ifi.HardwareAddr, srcIP, dstHW, dstIP)
+	if err != nil {
+		return err
+	}
+
+	return writePacket(c.p, c.ifi.HardwareAddr, p, ethernet.Broadcast, nil)
+}
+
+// random returns a random duration in the interval [min, max).
+func (c *Client) random(min, max time.Duration) time.Duration {
+	if max <= min {
+		return min
+	}
+
+	c.randMu.Lock()
+	defer c.randMu.Unlock()
+
+	return min + time.Duration(c.rand.Int63n(int64(max-min)))
+}
+
+// writePacket writes an ARP Packet to p in an Ethernet frame addressed to
+// dst, with an optional VLAN tag.
+func writePacket(p net.PacketConn, src net.HardwareAddr, pkt *Packet, dst net.HardwareAddr, vlan *ethernet.VLAN) error {
+	pb, err := pkt.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	f := &ethernet.Frame{
+		Destination: dst,
+		Source:      src,
+		VLAN:        vlan,
+		EtherType:   ethernet.EtherTypeARP,
+		Payload:     pb,
+	}
+
+	fb, err := f.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	_, err = p.WriteTo(fb, &raw.Addr{HardwareAddr: dst})
+	return err
+}
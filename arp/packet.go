@@ -0,0 +1,218 @@
+package arp
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+
+	"github.com/mdlayher/raw/ethernet"
+)
+
+var (
+	// errInvalidHardwareAddr is returned when one or more invalid hardware
+	// addresses are passed to NewPacket.
+	errInvalidHardwareAddr = errors.New("arp: invalid hardware address")
+
+	// errInvalidIP is returned when one or more invalid IPv4 addresses are
+	// passed to NewPacket.
+	errInvalidIP = errors.New("arp: invalid IPv4 address")
+)
+
+// An Operation is an ARP operation, such as request or reply.
+type Operation uint16
+
+// Operation constants which indicate an ARP request or reply.
+const (
+	OperationRequest Operation = 1
+	OperationReply   Operation = 2
+)
+
+// String returns the name of an Operation.
+func (o Operation) String() string {
+	switch o {
+	case OperationRequest:
+		return "request"
+	case OperationReply:
+		return "reply"
+	default:
+		return "unknown"
+	}
+}
+
+const (
+	// hardwareTypeEthernet is the ARP hardware type for Ethernet.
+	hardwareTypeEthernet = 1
+
+	// packetLen is the length of an ARP packet for Ethernet and IPv4.
+	packetLen = 8 + 2*6 + 2*4
+)
+
+// A Packet is a raw ARP packet, as described in RFC 826.
+type Packet struct {
+	// HardwareType specifies an IANA-assigned hardware type, as described
+	// in RFC 826.
+	HardwareType uint16
+
+	// ProtocolType specifies the internetwork address type targeted by this
+	// request. For IPv4 addresses, this value will be the EtherType for
+	// IPv4.
+	ProtocolType uint16
+
+	// HardwareAddrLength specifies the length of the sender and target
+	// hardware addresses included in a Packet.
+	HardwareAddrLength uint8
+
+	// IPLength specifies the length of the sender and target IPv4 addresses
+	// included in a Packet.
+	IPLength uint8
+
+	// Operation specifies the ARP operation being performed, such as request
+	// or reply.
+	Operation Operation
+
+	// SenderHardwareAddr specifies the hardware address of the sender of this
+	// Packet.
+	SenderHardwareAddr net.HardwareAddr
+
+	// SenderIP specifies the IPv4 address of the sender of this Packet.
+	SenderIP net.IP
+
+	// TargetHardwareAddr specifies the hardware address of the target of this
+	// Packet.
+	TargetHardwareAddr net.HardwareAddr
+
+	// TargetIP specifies the IPv4 address of the target of this Packet.
+	TargetIP net.IP
+}
+
+// NewPacket creates a new Packet from an input Operation and hardware/IPv4
+// address values for both a sender and target.
+//
+// If either hardware address is less than 6 bytes in length, or there is a
+// length mismatch between the two, errInvalidHardwareAddr is returned.
+//
+// If either IP address is not an IPv4 address, errInvalidIP is returned.
+func NewPacket(op Operation, srcHW net.HardwareAddr, srcIP net.IP, dstHW net.HardwareAddr, dstIP net.IP) (*Packet, error) {
+	if len(srcHW) < 6 || len(srcHW) != len(dstHW) {
+		return nil, errInvalidHardwareAddr
+	}
+
+	src4, dst4 := srcIP.To4(), dstIP.To4()
+	if src4 == nil || dst4 == nil {
+		return nil, errInvalidIP
+	}
+
+	return &Packet{
+		HardwareType:       hardwareTypeEthernet,
+		ProtocolType:       uint16(ethernet.EtherTypeIPv4),
+		HardwareAddrLength: uint8(len(srcHW)),
+		IPLength:           net.IPv4len,
+		Operation:          op,
+
+		SenderHardwareAddr: srcHW,
+		SenderIP:           src4,
+
+		TargetHardwareAddr: dstHW,
+		TargetIP:           dst4,
+	}, nil
+}
+
+// MarshalBinary allocates a byte slice containing the data from a Packet.
+func (p *Packet) MarshalBinary() ([]byte, error) {
+	// 2 bytes: hardware type
+	// 2 bytes: protocol type
+	// 1 byte : hardware address length
+	// 1 byte : protocol length
+	// 2 bytes: operation
+	// N bytes: source hardware address
+	// N bytes: source protocol address
+	// N bytes: target hardware address
+	// N bytes: target protocol address
+	hl, pl := int(p.HardwareAddrLength), int(p.IPLength)
+	if len(p.SenderHardwareAddr) != hl || len(p.TargetHardwareAddr) != hl {
+		return nil, errInvalidHardwareAddr
+	}
+
+	sip, tip := p.SenderIP.To4(), p.TargetIP.To4()
+	if pl != net.IPv4len || sip == nil || tip == nil {
+		return nil, errInvalidIP
+	}
+
+	b := make([]byte, 8+2*hl+2*pl)
+	binary.BigEndian.PutUint16(b[0:2], p.HardwareType)
+	binary.BigEndian.PutUint16(b[2:4], p.ProtocolType)
+	b[4] = p.HardwareAddrLength
+	b[5] = p.IPLength
+	binary.BigEndian.PutUint16(b[6:8], uint16(p.Operation))
+
+	n := 8
+	n += copy(b[n:], p.SenderHardwareAddr)
+	n += copy(b[n:], sip)
+	n += copy(b[n:], p.TargetHardwareAddr)
+	copy(b[n:], tip)
+
+	return b, nil
+}
+
+// UnmarshalBinary unmarshals a raw byte slice into a Packet. Only IPv4
+// protocol addresses are supported.
+func (p *Packet) UnmarshalBinary(b []byte) error {
+	if len(b) < 8 {
+		return io.ErrUnexpectedEOF
+	}
+
+	p.HardwareType = binary.BigEndian.Uint16(b[0:2])
+	p.ProtocolType = binary.BigEndian.Uint16(b[2:4])
+	p.HardwareAddrLength = b[4]
+	p.IPLength = b[5]
+	p.Operation = Operation(binary.BigEndian.Uint16(b[6:8]))
+
+	if p.IPLength != net.IPv4len {
+		return errInvalidIP
+	}
+
+	hl, pl := int(p.HardwareAddrLength), int(p.IPLength)
+	if len(b) < 8+2*hl+2*pl {
+		return io.ErrUnexpectedEOF
+	}
+
+	// Allocate a single byte slice to contain all addresses so the Packet does
+	// not retain references to the input slice.
+	bb := make([]byte, 2*hl+2*pl)
+	copy(bb, b[8:])
+
+	n := 0
+	p.SenderHardwareAddr = net.HardwareAddr(bb[n : n+hl])
+	n += hl
+	p.SenderIP = net.IP(bb[n : n+pl])
+	n += pl
+	p.TargetHardwareAddr = net.HardwareAddr(bb[n : n+hl])
+	n += hl
+	p.TargetIP = net.IP(bb[n : n+pl])
+
+	return nil
+}
+
+// parsePacket parses an ARP Packet from an Ethernet frame.
+func parsePacket(buf []byte) (*Packet, *ethernet.Frame, error) {
+	var f ethernet.Frame
+	if err := f.UnmarshalBinary(buf); err != nil {
+		return nil, nil, err
+	}
+
+	if f.EtherType != ethernet.EtherTypeARP {
+		return nil, nil, errInvalidARPPacket
+	}
+
+	p := new(Packet)
+	if err := p.UnmarshalBinary(f.Payload); err != nil {
+		return nil, nil, err
+	}
+
+	return p, &f, nil
+}
+
+// errInvalidARPPacket is returned when an Ethernet frame does not contain an
+// ARP packet.
+var errInvalidARPPacket = errors.New("arp: invalid ARP packet")
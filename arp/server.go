@@ -0,0 +1,242 @@
+package arp
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"sort"
+	"sync"
+
+	"github.com/mdlayher/raw"
+	"github.com/mdlayher/raw/ethernet"
+	"github.com/mdlayher/raw/internal/frame"
+)
+
+// A Server answers ARP requests on behalf of a table of IPv4 addresses.
+// Individual addresses and whole prefixes (proxy ARP) may be added to the
+// table at any time, including while the Server is serving requests.
+type Server struct {
+	ifi *net.Interface
+	p   net.PacketConn
+
+	mu       sync.RWMutex
+	hosts    map[string]net.HardwareAddr
+	prefixes []proxyEntry
+}
+
+// A proxyEntry maps an IPv4 prefix to a hardware address.
+type proxyEntry struct {
+	prefix *net.IPNet
+	mac    net.HardwareAddr
+}
+
+// Listen creates a new Server using the specified network interface. Listen
+// opens a *raw.Conn which receives ARP frames.
+func Listen(ifi *net.Interface) (*Server, error) {
+	p, err := raw.ListenPacket(ifi, uint16(ethernet.EtherTypeARP), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := NewServer(ifi, p)
+	if err != nil {
+		_ = p.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// NewServer creates a new Server using the specified network interface and
+// net.PacketConn. p must send and receive complete Ethernet frames.
+func NewServer(ifi *net.Interface, p net.PacketConn) (*Server, error) {
+	if len(ifi.HardwareAddr) != 6 {
+		return nil, errInvalidHardwareAddr
+	}
+
+	return &Server{
+		ifi:   ifi,
+		p:     p,
+		hosts: make(map[string]net.HardwareAddr),
+	}, nil
+}
+
+// Close closes the Server's connection.
+func (s *Server) Close() error {
+	return s.p.Close()
+}
+
+// Add answers ARP requests for ip with mac. If mac is nil, the hardware
+// address of the Server's interface is used.
+func (s *Server) Add(ip net.IP, mac net.HardwareAddr) error {
+	ip4 := ip.To4()
+	if ip4 == nil {
+		return errInvalidIP
+	}
+
+	mac, err := s.hardwareAddr(mac)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.hosts[ip4.String()] = mac
+	return nil
+}
+
+// Remove stops answering ARP requests for ip.
+func (s *Server) Remove(ip net.IP) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.hosts, ip.String())
+}
+
+// AddPrefix answers ARP requests for every address within prefix with mac,
+// performing proxy ARP. If mac is nil, the hardware address of the Server's
+// interface is used. Addresses added with Add take precedence over prefixes,
+// and longer prefixes take precedence over shorter ones.
+func (s *Server) AddPrefix(prefix *net.IPNet, mac net.HardwareAddr) error {
+	ones, bits := prefix.Mask.Size()
+	if bits != 8*net.IPv4len || prefix.IP.To4() == nil {
+		return errInvalidIP
+	}
+
+	mac, err := s.hardwareAddr(mac)
+	if err != nil {
+		return err
+	}
+
+	// Store a normalized copy of the prefix.
+	p := &net.IPNet{
+		IP:   prefix.IP.To4().Mask(prefix.Mask),
+		Mask: net.CIDRMask(ones, bits),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.removePrefix(p)
+	s.prefixes = append(s.prefixes, proxyEntry{prefix: p, mac: mac})
+
+	// Keep the longest prefixes first so the first match is the best match.
+	sort.SliceStable(s.prefixes, func(i, j int) bool {
+		oi, _ := s.prefixes[i].prefix.Mask.Size()
+		oj, _ := s.prefixes[j].prefix.Mask.Size()
+		return oi > oj
+	})
+
+	return nil
+}
+
+// RemovePrefix stops answering ARP requests for prefix.
+func (s *Server) RemovePrefix(prefix *net.IPNet) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.removePrefix(prefix)
+}
+
+// removePrefix removes prefix from the table. The caller must hold s.mu.
+func (s *Server) removePrefix(prefix *net.IPNet) {
+	want := prefix.String()
+
+	out := s.prefixes[:0]
+	for _, e := range s.prefixes {
+		if e.prefix.String() != want {
+			out = append(out, e)
+		}
+	}
+	s.prefixes = out
+}
+
+// Lookup returns the hardware address which the Server would use to answer
+// an ARP request for ip.
+func (s *Server) Lookup(ip net.IP) (net.HardwareAddr, bool) {
+	ip4 := ip.To4()
+	if ip4 == nil {
+		return nil, false
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if mac, ok := s.hosts[ip4.String()]; ok {
+		return mac, true
+	}
+
+	for _, e := range s.prefixes {
+		if e.prefix.Contains(ip4) {
+			return e.mac, true
+		}
+	}
+
+	return nil, false
+}
+
+// Serve answers ARP requests until ctx is canceled or an error occurs. Serve
+// returns nil when ctx is canceled.
+func (s *Server) Serve(ctx context.Context) error {
+	defer frame.CancelReads(ctx, s.p)()
+
+	b := make([]byte, frame.BufferSize(s.ifi))
+	for {
+		n, _, err := s.p.ReadFrom(b)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			return err
+		}
+
+		p, f, err := parsePacket(b[:n])
+		if err != nil {
+			// Not a valid ARP packet, keep reading.
+			continue
+		}
+
+		if err := s.handle(p, f); err != nil {
+			return err
+		}
+	}
+}
+
+// handle answers a single ARP request, if it targets an address known to
+// the Server.
+func (s *Server) handle(p *Packet, f *ethernet.Frame) error {
+	// Only answer requests, and ignore gratuitous ARP announcements.
+	if p.Operation != OperationRequest || p.SenderIP.Equal(p.TargetIP) {
+		return nil
+	}
+
+	mac, ok := s.Lookup(p.TargetIP)
+	if !ok || bytes.Equal(mac, p.SenderHardwareAddr) {
+		return nil
+	}
+
+	reply, err := NewPacket(OperationReply, mac, p.TargetIP, p.SenderHardwareAddr, p.SenderIP)
+	if err != nil {
+		// Malformed request, such as a non-Ethernet hardware address.
+		return nil
+	}
+
+	// Send the reply from the answering hardware address so switches learn
+	// its location, and preserve any VLAN tag from the request.
+	return writePacket(s.p, mac, reply, p.SenderHardwareAddr, f.VLAN)
+}
+
+// hardwareAddr validates mac, or returns the Server's hardware address if mac
+// is nil.
+func (s *Server) hardwareAddr(mac net.HardwareAddr) (net.HardwareAddr, error) {
+	if mac == nil {
+		return s.ifi.HardwareAddr, nil
+	}
+	if len(mac) != 6 {
+		return nil, errInvalidHardwareAddr
+	}
+
+	return mac, nil
+}
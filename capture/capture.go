@@ -0,0 +1,522 @@
+// Package capture writes Ethernet frames to a series of pcapng capture files,
+// rotating to a new file when the current file reaches a size or age limit.
+//
+// A Sink keeps a bounded history of recent traffic: completed files are
+// optionally compressed, and only the most recent are kept. Files are named
+// after the time they were created, in the form:
+//
+//	<prefix>-20060102T150405.000000000Z.pcapng[<extension>]
+//
+// so that they sort in the order they were written. Files in the directory
+// which match this form are subject to the retention limit, including those
+// written by a previous Sink with the same prefix.
+package capture
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/mdlayher/raw/internal/frame"
+	"github.com/mdlayher/raw/pcap"
+	"github.com/mdlayher/raw/pcapng"
+)
+
+const (
+	// timeFormat is the format of the time in a file name.
+	timeFormat = "20060102T150405.000000000Z"
+
+	// extension is the extension of an uncompressed capture file.
+	extension = ".pcapng"
+
+	// tmpExtension is appended to the name of a file while it is compressed.
+	tmpExtension = ".tmp"
+)
+
+// A Compressor compresses completed capture files. Gzip and Zstd are
+// provided, and other formats may be supplied by callers.
+type Compressor struct {
+	// Extension is appended to the name of a compressed file, such as
+	// ".gz".
+	Extension string
+
+	// NewWriter returns an io.WriteCloser which writes compressed data to
+	// w. Close must flush any buffered data to w, but must not close w.
+	NewWriter func(w io.Writer) (io.WriteCloser, error)
+}
+
+// Gzip is a Compressor which compresses files with gzip.
+var Gzip = &Compressor{
+	Extension: ".gz",
+	NewWriter: func(w io.Writer) (io.WriteCloser, error) {
+		return gzip.NewWriter(w), nil
+	},
+}
+
+// Zstd is a Compressor which compresses files with Zstandard. It compresses
+// faster and smaller than Gzip, but its files are less widely supported.
+var Zstd = &Compressor{
+	Extension: ".zst",
+	NewWriter: func(w io.Writer) (io.WriteCloser, error) {
+		return zstd.NewWriter(w)
+	},
+}
+
+// A Config configures a Sink. The zero value of any field selects a default
+// value.
+type Config struct {
+	// Dir is the directory in which files are written. It is created if
+	// it does not exist. If empty, the current directory is used.
+	Dir string
+
+	// Prefix is the prefix of each file name. If empty, "capture" is used.
+	Prefix string
+
+	// MaxSize is the size in bytes after which a new file is started. If
+	// zero, files are not rotated by size.
+	MaxSize int64
+
+	// MaxDuration is the age after which a new file is started. Files are
+	// only rotated when a frame is written, so an idle file may remain
+	// open for longer. If zero, files are not rotated by age.
+	MaxDuration time.Duration
+
+	// MaxFiles is the number of completed files kept, in addition to the
+	// file being written. Older files are removed. If zero, all files are
+	// kept.
+	MaxFiles int
+
+	// Compressor, if set, compresses each file once it is completed.
+	Compressor *Compressor
+
+	// Writer configures each pcapng file. If nil, the pcapng package
+	// defaults are used.
+	Writer *pcapng.Config
+}
+
+// A Sink writes Ethernet frames to rotating pcapng capture files. A Sink is
+// safe for concurrent use.
+type Sink struct {
+	ifi *net.Interface
+	cfg Config
+
+	mu     sync.Mutex
+	closed bool
+	f      *os.File
+	cw     *countWriter
+	w      *pcapng.Writer
+	id     int
+	name   string
+	opened time.Time
+	last   time.Time
+
+	// Completed files are queued, guarded by mu, and compressed and pruned
+	// in the background in the order they were completed. wake is signaled
+	// when a file is queued or the Sink is closed.
+	queue []string
+	wake  chan struct{}
+	wg    sync.WaitGroup
+
+	errMu sync.Mutex
+	err   error
+}
+
+// New creates a Sink which writes frames captured on the specified network
+// interface. The first file is created when the first frame is written. A
+// nil Config selects the default values.
+func New(ifi *net.Interface, cfg *Config) (*Sink, error) {
+	if cfg == nil {
+		cfg = &Config{}
+	}
+
+	conf := *cfg
+	switch {
+	case conf.MaxSize < 0:
+		return nil, fmt.Errorf("capture: invalid maximum size: %d", conf.MaxSize)
+	case conf.MaxDuration < 0:
+		return nil, fmt.Errorf("capture: invalid maximum duration: %v", conf.MaxDuration)
+	case conf.MaxFiles < 0:
+		return nil, fmt.Errorf("capture: invalid maximum files: %d", conf.MaxFiles)
+	case conf.Compressor != nil && (conf.Compressor.Extension == "" || conf.Compressor.NewWriter == nil):
+		return nil, errors.New("capture: compressor must have an extension and NewWriter function")
+	case strings.ContainsRune(conf.Prefix, filepath.Separator):
+		return nil, fmt.Errorf("capture: invalid prefix: %q", conf.Prefix)
+	}
+
+	if conf.Dir == "" {
+		conf.Dir = "."
+	}
+	if conf.Prefix == "" {
+		conf.Prefix = "capture"
+	}
+
+	if err := os.MkdirAll(conf.Dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	s := &Sink{
+		ifi:  ifi,
+		cfg:  conf,
+		wake: make(chan struct{}, 1),
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.finishQueued()
+	}()
+
+	return s, nil
+}
+
+// WritePacket writes an Ethernet frame to the current file, starting a new
+// file first if the current file has reached its size or age limit.
+//
+// If compressing or removing a completed file fails, the error is returned
+// by the next call to WritePacket or Close.
+func (s *Sink) WritePacket(ci pcap.CaptureInfo, data []byte) error {
+	if err := s.takeErr(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return os.ErrClosed
+	}
+
+	if s.f != nil && s.full() {
+		if err := s.complete(); err != nil {
+			return err
+		}
+	}
+	if s.f == nil {
+		if err := s.open(); err != nil {
+			return err
+		}
+	}
+
+	return s.w.WritePacket(pcapng.CaptureInfo{
+		Timestamp:   ci.Timestamp,
+		Length:      ci.Length,
+		InterfaceID: s.id,
+	}, data)
+}
+
+// Capture reads Ethernet frames from p and writes them to the Sink until ctx
+// is canceled or an error occurs. p must receive complete Ethernet frames,
+// such as a *raw.Conn opened with the default configuration. Capture returns
+// nil when ctx is canceled.
+func (s *Sink) Capture(ctx context.Context, p net.PacketConn) error {
+	defer frame.CancelReads(ctx, p)()
+
+	b := make([]byte, frame.BufferSize(s.ifi))
+	for {
+		n, _, err := p.ReadFrom(b)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			return err
+		}
+
+		if err := s.WritePacket(pcap.CaptureInfo{Timestamp: time.Now()}, b[:n]); err != nil {
+			return err
+		}
+	}
+}
+
+// Close completes the current file and waits for all completed files to be
+// compressed and pruned.
+func (s *Sink) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return os.ErrClosed
+	}
+	s.closed = true
+
+	var err error
+	if s.f != nil {
+		err = s.complete()
+	}
+	s.signal()
+	s.mu.Unlock()
+
+	s.wg.Wait()
+
+	if err != nil {
+		return err
+	}
+
+	return s.takeErr()
+}
+
+// full reports whether the current file has reached its size or age limit.
+// The caller must hold s.mu.
+func (s *Sink) full() bool {
+	return (s.cfg.MaxSize > 0 && s.cw.n >= s.cfg.MaxSize) ||
+		(s.cfg.MaxDuration > 0 && time.Since(s.opened) >= s.cfg.MaxDuration)
+}
+
+// open creates a new file. The caller must hold s.mu.
+func (s *Sink) open() error {
+	// Each file must be named after a later time than the previous file so
+	// that the files sort in order.
+	t := time.Now().UTC()
+	if !t.After(s.last) {
+		t = s.last.Add(time.Nanosecond)
+	}
+
+	var (
+		name string
+		f    *os.File
+	)
+	for {
+		name = filepath.Join(s.cfg.Dir, s.cfg.Prefix+"-"+t.Format(timeFormat)+extension)
+
+		var err error
+		f, err = os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return err
+		}
+
+		t = t.Add(time.Nanosecond)
+	}
+
+	cw := &countWriter{w: f}
+	w, err := pcapng.NewWriter(cw, s.cfg.Writer)
+	if err != nil {
+		_ = f.Close()
+		_ = os.Remove(name)
+		return err
+	}
+
+	id, err := w.AddInterface(s.ifi, pcap.LinkTypeEthernet)
+	if err != nil {
+		_ = f.Close()
+		_ = os.Remove(name)
+		return err
+	}
+
+	s.f, s.cw, s.w, s.id = f, cw, w, id
+	s.name, s.opened, s.last = name, time.Now(), t
+	return nil
+}
+
+// complete closes the current file and queues it to be compressed and
+// pruned. The queue is not bounded, so writes never wait for compression,
+// and a backlog only delays compression and pruning. The caller must hold
+// s.mu.
+func (s *Sink) complete() error {
+	err := s.f.Close()
+	s.queue = append(s.queue, s.name)
+	s.f, s.cw, s.w, s.name = nil, nil, nil, ""
+
+	s.signal()
+	return err
+}
+
+// signal wakes finishQueued, if it is not already due to wake.
+func (s *Sink) signal() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// finishQueued compresses and prunes completed files as they are queued,
+// until the Sink is closed and the queue is empty.
+func (s *Sink) finishQueued() {
+	for {
+		s.mu.Lock()
+		names, closed := s.queue, s.closed
+		s.queue = nil
+		s.mu.Unlock()
+
+		for _, name := range names {
+			s.setErr(s.finish(name))
+		}
+
+		// No files are queued after the Sink is closed.
+		if closed {
+			return
+		}
+
+		<-s.wake
+	}
+}
+
+// finish compresses the completed file name, if configured, and removes the
+// oldest completed files beyond the retention limit.
+func (s *Sink) finish(name string) error {
+	if s.cfg.Compressor != nil {
+		if err := s.compress(name); err != nil {
+			return err
+		}
+	}
+
+	if s.cfg.MaxFiles == 0 {
+		return nil
+	}
+
+	return s.prune(s.stamp(filepath.Base(name)))
+}
+
+// compress compresses the file name and replaces it with the compressed
+// file.
+func (s *Sink) compress(name string) error {
+	dst := name + s.cfg.Compressor.Extension
+	tmp := dst + tmpExtension
+
+	if err := s.compressFile(name, tmp); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+
+	if err := os.Rename(tmp, dst); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+
+	return os.Remove(name)
+}
+
+// compressFile writes a compressed copy of src to dst.
+func (s *Sink) compressFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	zw, err := s.cfg.Compressor.NewWriter(out)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(zw, in); err != nil {
+		_ = zw.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	return out.Close()
+}
+
+// prune removes the oldest completed files so that at most MaxFiles remain.
+// Only files created no later than the time stamp newest are considered, so
+// the file being written is never removed.
+func (s *Sink) prune(newest string) error {
+	entries, err := os.ReadDir(s.cfg.Dir)
+	if err != nil {
+		return err
+	}
+
+	var names []string
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() {
+			continue
+		}
+
+		stamp := s.stamp(name)
+		if stamp == "" || stamp > newest {
+			continue
+		}
+
+		names = append(names, name)
+	}
+
+	if len(names) <= s.cfg.MaxFiles {
+		return nil
+	}
+
+	sort.Strings(names)
+	for _, name := range names[:len(names)-s.cfg.MaxFiles] {
+		if err := os.Remove(filepath.Join(s.cfg.Dir, name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// stamp returns the time stamp in the name of a completed file written by a
+// Sink with the same prefix, or the empty string if name is not such a file.
+func (s *Sink) stamp(name string) string {
+	rest := strings.TrimPrefix(name, s.cfg.Prefix+"-")
+	if rest == name || len(rest) < len(timeFormat) || strings.HasSuffix(rest, tmpExtension) {
+		return ""
+	}
+
+	stamp := rest[:len(timeFormat)]
+	if _, err := time.Parse(timeFormat, stamp); err != nil {
+		return ""
+	}
+	if !strings.HasPrefix(rest[len(timeFormat):], extension) {
+		return ""
+	}
+
+	return stamp
+}
+
+// setErr records err to be returned by WritePacket or Close, unless an error
+// is already recorded.
+func (s *Sink) setErr(err error) {
+	if err == nil {
+		return
+	}
+
+	s.errMu.Lock()
+	defer s.errMu.Unlock()
+
+	if s.err == nil {
+		s.err = err
+	}
+}
+
+// takeErr returns and clears the recorded error.
+func (s *Sink) takeErr() error {
+	s.errMu.Lock()
+	defer s.errMu.Unlock()
+
+	err := s.err
+	s.err = nil
+	return err
+}
+
+// A countWriter counts the bytes written to w.
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (w *countWriter) Write(b []byte) (int, error) {
+	n, err := w.w.Write(b)
+	w.n += int64(n)
+	return n, err
+}
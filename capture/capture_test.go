@@ -0,0 +1,475 @@
+package capture_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/klauspost/compress/zstd"
+	"github.com/mdlayher/raw/capture"
+	"github.com/mdlayher/raw/ethernet"
+	"github.com/mdlayher/raw/internal/rawtest"
+	"github.com/mdlayher/raw/pcap"
+	"github.com/mdlayher/raw/pcapng"
+)
+
+var (
+	macA = net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	macB = net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x02}
+
+	ifi = &net.Interface{Index: 1, Name: "eth0", HardwareAddr: macA}
+)
+
+func TestSinkRotateSize(t *testing.T) {
+	frames := testFrames(t, 5)
+
+	tests := []struct {
+		name     string
+		maxFiles int
+		want     [][][]byte
+	}{
+		{
+			name: "keep all",
+			want: [][][]byte{
+				{frames[0]}, {frames[1]}, {frames[2]}, {frames[3]}, {frames[4]},
+			},
+		},
+		{
+			name:     "keep last 2",
+			maxFiles: 2,
+			want:     [][][]byte{{frames[3]}, {frames[4]}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			// Every frame exceeds the size limit, so each is written to its
+			// own file.
+			s, err := capture.New(ifi, &capture.Config{
+				Dir:      dir,
+				MaxSize:  1,
+				MaxFiles: tt.maxFiles,
+			})
+			if err != nil {
+				t.Fatalf("failed to create sink: %v", err)
+			}
+
+			writeFrames(t, s, frames)
+			if err := s.Close(); err != nil {
+				t.Fatalf("failed to close: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.want, readFiles(t, dir)); diff != "" {
+				t.Fatalf("unexpected files (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestSinkRotateDuration(t *testing.T) {
+	dir := t.TempDir()
+	frames := testFrames(t, 3)
+
+	s, err := capture.New(ifi, &capture.Config{
+		Dir:         dir,
+		MaxDuration: 50 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("failed to create sink: %v", err)
+	}
+
+	writeFrames(t, s, frames[:1])
+	time.Sleep(100 * time.Millisecond)
+	writeFrames(t, s, frames[1:])
+
+	if err := s.Close(); err != nil {
+		t.Fatalf("failed to close: %v", err)
+	}
+
+	want := [][][]byte{{frames[0]}, {frames[1], frames[2]}}
+	if diff := cmp.Diff(want, readFiles(t, dir)); diff != "" {
+		t.Fatalf("unexpected files (-want +got):\n%s", diff)
+	}
+}
+
+func TestSinkCompress(t *testing.T) {
+	frames := testFrames(t, 3)
+
+	// An uncompressed "compressor" demonstrates the hook for formats other
+	// than gzip.
+	var calls int
+	copier := &capture.Compressor{
+		Extension: ".copy",
+		NewWriter: func(w io.Writer) (io.WriteCloser, error) {
+			calls++
+			return nopCloser{w}, nil
+		},
+	}
+
+	tests := []struct {
+		name  string
+		c     *capture.Compressor
+		calls int
+	}{
+		{name: "gzip", c: capture.Gzip},
+		{name: "zstd", c: capture.Zstd},
+		{name: "custom", c: copier, calls: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			s, err := capture.New(ifi, &capture.Config{
+				Dir:        dir,
+				Prefix:     "ring",
+				MaxSize:    1,
+				Compressor: tt.c,
+			})
+			if err != nil {
+				t.Fatalf("failed to create sink: %v", err)
+			}
+
+			writeFrames(t, s, frames)
+			if err := s.Close(); err != nil {
+				t.Fatalf("failed to close: %v", err)
+			}
+
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatalf("failed to read directory: %v", err)
+			}
+			for _, e := range entries {
+				if !strings.HasPrefix(e.Name(), "ring-") || !strings.HasSuffix(e.Name(), ".pcapng"+tt.c.Extension) {
+					t.Fatalf("unexpected file name: %q", e.Name())
+				}
+			}
+
+			want := [][][]byte{{frames[0]}, {frames[1]}, {frames[2]}}
+			if diff := cmp.Diff(want, readFiles(t, dir)); diff != "" {
+				t.Fatalf("unexpected files (-want +got):\n%s", diff)
+			}
+			if tt.calls != 0 && calls != tt.calls {
+				t.Fatalf("unexpected number of compressor calls: %d", calls)
+			}
+		})
+	}
+}
+
+func TestSinkSlowCompressor(t *testing.T) {
+	// The compressor blocks until released, so every completed file remains
+	// queued while frames are written.
+	release := make(chan struct{})
+	blocking := &capture.Compressor{
+		Extension: ".copy",
+		NewWriter: func(w io.Writer) (io.WriteCloser, error) {
+			<-release
+			return nopCloser{w}, nil
+		},
+	}
+
+	dir := t.TempDir()
+	s, err := capture.New(ifi, &capture.Config{
+		Dir:        dir,
+		MaxSize:    1,
+		Compressor: blocking,
+	})
+	if err != nil {
+		t.Fatalf("failed to create sink: %v", err)
+	}
+
+	// Each frame completes the previous file, so writes must not wait for
+	// the compressor.
+	frames := testFrames(t, 64)
+	errC := make(chan error, 1)
+	go func() {
+		for _, f := range frames {
+			if err := s.WritePacket(pcap.CaptureInfo{Timestamp: time.Now()}, f); err != nil {
+				errC <- err
+				return
+			}
+		}
+		errC <- nil
+	}()
+
+	select {
+	case err := <-errC:
+		if err != nil {
+			t.Fatalf("failed to write: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("writes blocked on the compressor")
+	}
+
+	close(release)
+	if err := s.Close(); err != nil {
+		t.Fatalf("failed to close: %v", err)
+	}
+
+	if got := len(readDir(t, dir)); got != len(frames) {
+		t.Fatalf("expected %d files, but got %d", len(frames), got)
+	}
+}
+
+func TestSinkPrunePrevious(t *testing.T) {
+	dir := t.TempDir()
+
+	// Files from a previous Sink with the same prefix are subject to the
+	// retention limit, but unrelated files are not.
+	for _, name := range []string{
+		"capture-20000101T000000.000000000Z.pcapng.gz",
+		"capture-20000101T000001.000000000Z.pcapng",
+		"capture-notes.txt",
+		"other-20000101T000000.000000000Z.pcapng",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatalf("failed to write file: %v", err)
+		}
+	}
+
+	s, err := capture.New(ifi, &capture.Config{
+		Dir:      dir,
+		MaxFiles: 2,
+	})
+	if err != nil {
+		t.Fatalf("failed to create sink: %v", err)
+	}
+
+	writeFrames(t, s, testFrames(t, 1))
+	if err := s.Close(); err != nil {
+		t.Fatalf("failed to close: %v", err)
+	}
+
+	// The newest previous file and the new file remain.
+	got := readDir(t, dir)
+	if len(got) != 4 || !strings.HasPrefix(got[1], "capture-20") {
+		t.Fatalf("unexpected files: %v", got)
+	}
+	got[1] = "new"
+
+	want := []string{
+		"capture-20000101T000001.000000000Z.pcapng",
+		"new",
+		"capture-notes.txt",
+		"other-20000101T000000.000000000Z.pcapng",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected files (-want +got):\n%s", diff)
+	}
+}
+
+func TestSinkCapture(t *testing.T) {
+	dir := t.TempDir()
+	frames := testFrames(t, 3)
+
+	hub := rawtest.NewHub()
+	p := hub.Conn(macA)
+	peer := hub.Conn(macB)
+
+	s, err := capture.New(ifi, &capture.Config{Dir: dir})
+	if err != nil {
+		t.Fatalf("failed to create sink: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errC := make(chan error, 1)
+	go func() {
+		errC <- s.Capture(ctx, p)
+	}()
+
+	for _, f := range frames {
+		if _, err := peer.WriteTo(f, nil); err != nil {
+			t.Fatalf("failed to write frame: %v", err)
+		}
+	}
+
+	// Wait for the frames to be consumed before stopping the capture.
+	for i := 0; i < 100; i++ {
+		if files := readDir(t, dir); len(files) == 1 && len(readFile(t, filepath.Join(dir, files[0]))) == len(frames) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	if err := <-errC; err != nil {
+		t.Fatalf("failed to capture: %v", err)
+	}
+
+	// p must remain usable once Capture returns.
+	if _, err := peer.WriteTo(frames[0], nil); err != nil {
+		t.Fatalf("failed to write frame: %v", err)
+	}
+	if _, _, err := p.ReadFrom(make([]byte, 1500)); err != nil {
+		t.Fatalf("failed to read after capturing: %v", err)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatalf("failed to close: %v", err)
+	}
+
+	if diff := cmp.Diff([][][]byte{frames}, readFiles(t, dir)); diff != "" {
+		t.Fatalf("unexpected files (-want +got):\n%s", diff)
+	}
+}
+
+func TestSinkClosed(t *testing.T) {
+	s, err := capture.New(ifi, &capture.Config{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("failed to create sink: %v", err)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatalf("failed to close: %v", err)
+	}
+
+	if err := s.WritePacket(pcap.CaptureInfo{}, testFrames(t, 1)[0]); !errors.Is(err, os.ErrClosed) {
+		t.Fatalf("expected os.ErrClosed, but got: %v", err)
+	}
+	if err := s.Close(); !errors.Is(err, os.ErrClosed) {
+		t.Fatalf("expected os.ErrClosed, but got: %v", err)
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  *capture.Config
+	}{
+		{name: "size", cfg: &capture.Config{MaxSize: -1}},
+		{name: "duration", cfg: &capture.Config{MaxDuration: -1}},
+		{name: "files", cfg: &capture.Config{MaxFiles: -1}},
+		{name: "compressor", cfg: &capture.Config{Compressor: &capture.Compressor{Extension: ".gz"}}},
+		{name: "prefix", cfg: &capture.Config{Prefix: "a/b"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.Dir = t.TempDir()
+			if _, err := capture.New(ifi, tt.cfg); err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+		})
+	}
+}
+
+// writeFrames writes frames to s.
+func writeFrames(t *testing.T, s *capture.Sink, frames [][]byte) {
+	t.Helper()
+
+	for _, f := range frames {
+		if err := s.WritePacket(pcap.CaptureInfo{Timestamp: time.Now()}, f); err != nil {
+			t.Fatalf("failed to write packet: %v", err)
+		}
+	}
+}
+
+// readDir returns the sorted names of the files in dir.
+func readDir(t *testing.T, dir string) []string {
+	t.Helper()
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("failed to read directory: %v", err)
+	}
+
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// readFiles returns the frames in each capture file in dir, in name order.
+func readFiles(t *testing.T, dir string) [][][]byte {
+	t.Helper()
+
+	var files [][][]byte
+	for _, name := range readDir(t, dir) {
+		files = append(files, readFile(t, filepath.Join(dir, name)))
+	}
+
+	return files
+}
+
+// readFile returns the frames in a capture file, which may be compressed.
+func readFile(t *testing.T, name string) [][]byte {
+	t.Helper()
+
+	b, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatalf("failed to read file: %v", err)
+	}
+
+	var r io.Reader = bytes.NewReader(b)
+	if strings.HasSuffix(name, ".gz") {
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			t.Fatalf("failed to create gzip reader: %v", err)
+		}
+		r = zr
+	}
+	if strings.HasSuffix(name, ".zst") {
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			t.Fatalf("failed to create zstd reader: %v", err)
+		}
+		defer zr.Close()
+		r = zr
+	}
+
+	pr, err := pcapng.NewReader(r)
+	if err != nil {
+		t.Fatalf("failed to create reader: %v", err)
+	}
+
+	var frames [][]byte
+	for {
+		_, data, err := pr.ReadPacket()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("failed to read packet: %v", err)
+		}
+
+		frames = append(frames, data)
+	}
+
+	if diff := cmp.Diff(ifi.Name, pr.Interfaces()[0].Name); diff != "" {
+		t.Fatalf("unexpected interface (-want +got):\n%s", diff)
+	}
+
+	return frames
+}
+
+func testFrames(t *testing.T, n int) [][]byte {
+	t.Helper()
+
+	frames := make([][]byte, 0, n)
+	for i := 0; i < n; i++ {
+		frames = append(frames, rawtest.Frame(t, macA, macB, ethernet.EtherTypeIPv4, []byte{byte(i)}))
+	}
+
+	return frames
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
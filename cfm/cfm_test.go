@@ -0,0 +1,381 @@
+package cfm_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/raw/cfm"
+	"github.com/mdlayher/raw/internal/rawtest"
+)
+
+var (
+	clientMAC = net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	serverMAC = net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x02}
+)
+
+func TestMessageMarshalParse(t *testing.T) {
+	maid, err := cfm.NewMAID("example", "ma1")
+	if err != nil {
+		t.Fatalf("failed to create MAID: %v", err)
+	}
+
+	data := []cfm.TLV{{Type: cfm.TLVTypeData, Value: []byte("hello")}}
+
+	tests := []struct {
+		name string
+		m    cfm.Message
+	}{
+		{
+			name: "continuity check",
+			m: &cfm.ContinuityCheck{
+				RDI:      true,
+				Interval: cfm.CCMInterval1s,
+				Sequence: 10,
+				MEPID:    100,
+				MAID:     maid,
+				TLVs:     []cfm.TLV{{Type: cfm.TLVTypePortStatus, Value: []byte{2}}},
+			},
+		},
+		{
+			name: "loopback message",
+			m:    &cfm.LoopbackMessage{TransactionID: 1, TLVs: data},
+		},
+		{
+			name: "loopback reply",
+			m:    &cfm.LoopbackReply{TransactionID: 1, TLVs: data},
+		},
+		{
+			name: "linktrace message",
+			m: &cfm.LinktraceMessage{
+				UseFDBOnly:    true,
+				TransactionID: 2,
+				TTL:           64,
+				OriginalAddr:  clientMAC,
+				TargetAddr:    serverMAC,
+			},
+		},
+		{
+			name: "linktrace reply",
+			m: &cfm.LinktraceReply{
+				UseFDBOnly:    true,
+				Forwarded:     true,
+				TerminalMEP:   true,
+				TransactionID: 2,
+				TTL:           63,
+				RelayAction:   cfm.RelayHit,
+				TLVs:          data,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := cfm.MarshalMessage(5, tt.m)
+			if err != nil {
+				t.Fatalf("failed to marshal: %v", err)
+			}
+
+			// Trailing Ethernet padding must be ignored.
+			b = append(b, make([]byte, 8)...)
+
+			level, m, err := cfm.ParseMessage(b)
+			if err != nil {
+				t.Fatalf("failed to parse: %v", err)
+			}
+
+			if diff := cmp.Diff(uint8(5), level); diff != "" {
+				t.Fatalf("unexpected level (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.m, m); diff != "" {
+				t.Fatalf("unexpected message (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestParseMessageError(t *testing.T) {
+	tests := []struct {
+		name string
+		b    []byte
+	}{
+		{
+			name: "short header",
+			b:    []byte{0x00, 0x03},
+		},
+		{
+			name: "bad version",
+			b:    []byte{0x01, 0x03, 0x00, 0x04, 0, 0, 0, 1, 0},
+		},
+		{
+			name: "unknown opcode",
+			b:    []byte{0x00, 0xff, 0x00, 0x00, 0},
+		},
+		{
+			name: "short fields",
+			b:    []byte{0x00, 0x03, 0x00, 0x04, 0, 0},
+		},
+		{
+			name: "missing end TLV",
+			b:    []byte{0x00, 0x03, 0x00, 0x04, 0, 0, 0, 1},
+		},
+		{
+			name: "truncated TLV",
+			b:    []byte{0x00, 0x03, 0x00, 0x04, 0, 0, 0, 1, 3, 0, 4, 'a'},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := cfm.ParseMessage(tt.b); err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+		})
+	}
+}
+
+func TestNewMAID(t *testing.T) {
+	maid, err := cfm.NewMAID("", "vlan10")
+	if err != nil {
+		t.Fatalf("failed to create MAID: %v", err)
+	}
+
+	want := []byte{1, 2, 6, 'v', 'l', 'a', 'n', '1', '0', 0}
+	if diff := cmp.Diff(want, maid[:len(want)]); diff != "" {
+		t.Fatalf("unexpected MAID (-want +got):\n%s", diff)
+	}
+
+	if _, err := cfm.NewMAID("", ""); err == nil {
+		t.Fatal("expected empty name error, but none occurred")
+	}
+}
+
+func TestClientLoopback(t *testing.T) {
+	c := testClientServer(t, &cfm.Config{Level: 3, Data: []byte("data")}, 3)
+
+	for _, dst := range []net.HardwareAddr{serverMAC, cfm.CCMGroupAddr(3)} {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		rtt, err := c.Loopback(ctx, dst)
+		cancel()
+		if err != nil {
+			t.Fatalf("failed loopback to %s: %v", dst, err)
+		}
+		if rtt <= 0 {
+			t.Fatalf("unexpected round trip time: %s", rtt)
+		}
+	}
+}
+
+func TestClientPing(t *testing.T) {
+	c := testClientServer(t, &cfm.Config{Level: 3}, 3)
+
+	s, err := c.Ping(context.Background(), serverMAC, 3, 20*time.Millisecond)
+	if err != nil {
+		t.Fatalf("failed to ping: %v", err)
+	}
+
+	if s.Sent != 3 || s.Received != 3 || s.Loss() != 0 {
+		t.Fatalf("unexpected statistics: %s", s)
+	}
+	if s.Min <= 0 || s.Min > s.Mean || s.Mean > s.Max {
+		t.Fatalf("inconsistent round trip times: %s", s)
+	}
+}
+
+func TestClientPingInvalidInterval(t *testing.T) {
+	c := testClientServer(t, &cfm.Config{Level: 3}, 3)
+
+	for _, interval := range []time.Duration{0, -time.Second} {
+		if _, err := c.Ping(context.Background(), serverMAC, 0, interval); err == nil {
+			t.Fatalf("expected invalid interval %s error, but none occurred", interval)
+		}
+	}
+}
+
+func TestClientPingLevelMismatch(t *testing.T) {
+	// The Server ignores messages at a different level.
+	c := testClientServer(t, &cfm.Config{Level: 2}, 3)
+
+	s, err := c.Ping(context.Background(), serverMAC, 2, 20*time.Millisecond)
+	if err != nil {
+		t.Fatalf("failed to ping: %v", err)
+	}
+
+	if s.Sent != 2 || s.Received != 0 || s.Loss() != 1 {
+		t.Fatalf("unexpected statistics: %s", s)
+	}
+}
+
+func TestClientLinktrace(t *testing.T) {
+	c := testClientServer(t, &cfm.Config{Level: 3, LinktraceTimeout: time.Second}, 3)
+
+	hops, err := c.Linktrace(context.Background(), serverMAC)
+	if err != nil {
+		t.Fatalf("failed to linktrace: %v", err)
+	}
+
+	if len(hops) != 1 {
+		t.Fatalf("expected 1 hop, but got %d", len(hops))
+	}
+
+	want := cfm.Hop{
+		HardwareAddr: serverMAC,
+		Reply: &cfm.LinktraceReply{
+			TerminalMEP: true,
+			TTL:         63,
+			RelayAction: cfm.RelayHit,
+		},
+	}
+
+	ignore := cmp.FilterPath(func(p cmp.Path) bool {
+		return p.Last().String() == ".TransactionID"
+	}, cmp.Ignore())
+	if diff := cmp.Diff(want, hops[0], ignore); diff != "" {
+		t.Fatalf("unexpected hop (-want +got):\n%s", diff)
+	}
+}
+
+func TestClientLinktraceCanceledBeforeDeadline(t *testing.T) {
+	conn := &deadlineConn{Conn: rawtest.NewHub().Conn(clientMAC)}
+	c, err := cfm.New(
+		&net.Interface{MTU: 1500, HardwareAddr: clientMAC},
+		conn,
+		&cfm.Config{LinktraceTimeout: time.Hour},
+	)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	// Cancel just before the linktrace timeout is set, and give the
+	// cancellation time to expire the deadline which the timeout replaces.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	conn.onDeadline = func(d time.Time) {
+		if d.After(time.Now()) {
+			cancel()
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	errC := make(chan error, 1)
+	go func() {
+		_, err := c.Linktrace(ctx, serverMAC)
+		errC <- err
+	}()
+
+	select {
+	case err := <-errC:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected context canceled, but got: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Linktrace did not return after cancellation")
+	}
+}
+
+func TestClientLinktraceContextDeadline(t *testing.T) {
+	c, err := cfm.New(
+		&net.Interface{MTU: 1500, HardwareAddr: clientMAC},
+		rawtest.NewHub().Conn(clientMAC),
+		&cfm.Config{LinktraceTimeout: time.Hour},
+	)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	// No maintenance points reply, so the context deadline must be reported
+	// rather than treated as the end of the linktrace timeout.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if _, err := c.Linktrace(ctx, serverMAC); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context deadline exceeded, but got: %v", err)
+	}
+}
+
+func TestServerServeClearsReadDeadline(t *testing.T) {
+	hub := rawtest.NewHub()
+	sc := hub.Conn(serverMAC)
+
+	s, err := cfm.NewServer(&net.Interface{MTU: 1500, HardwareAddr: serverMAC}, sc, nil)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	defer s.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := s.Serve(ctx); err != nil {
+		t.Fatalf("failed to serve: %v", err)
+	}
+
+	// The connection must remain usable once Serve returns.
+	c, err := cfm.New(&net.Interface{MTU: 1500, HardwareAddr: clientMAC}, hub.Conn(clientMAC), nil)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	defer c.Close()
+
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, _ = c.Loopback(ctx, serverMAC)
+
+	if _, _, err := sc.ReadFrom(make([]byte, 1500)); err != nil {
+		t.Fatalf("failed to read after serving: %v", err)
+	}
+}
+
+// testClientServer creates a Client with cfg and a Server at level on the
+// same in-memory segment.
+func testClientServer(t *testing.T, cfg *cfm.Config, level uint8) *cfm.Client {
+	t.Helper()
+
+	hub := rawtest.NewHub()
+
+	c, err := cfm.New(&net.Interface{MTU: 1500, HardwareAddr: clientMAC}, hub.Conn(clientMAC), cfg)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	s, err := cfm.NewServer(
+		&net.Interface{MTU: 1500, HardwareAddr: serverMAC},
+		hub.Conn(serverMAC),
+		&cfm.Config{Level: level},
+	)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- s.Serve(ctx) }()
+
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("failed to serve: %v", err)
+		}
+
+		s.Close()
+		c.Close()
+	})
+
+	return c
+}
+
+// A deadlineConn calls onDeadline before each read deadline is set.
+type deadlineConn struct {
+	*rawtest.Conn
+	onDeadline func(t time.Time)
+}
+
+func (c *deadlineConn) SetReadDeadline(t time.Time) error {
+	if c.onDeadline != nil {
+		c.onDeadline(t)
+	}
+
+	return c.Conn.SetReadDeadline(t)
+}
@@ -0,0 +1,421 @@
+package cfm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mdlayher/raw"
+	"github.com/mdlayher/raw/ethernet"
+	"github.com/mdlayher/raw/internal/frame"
+)
+
+// Default values used when a Config field is zero.
+const (
+	defaultLinktraceTTL     = 64
+	defaultLinktraceTimeout = 5 * time.Second
+)
+
+// A Config specifies the parameters used by a Client or Server. The zero
+// value of any field selects a default value.
+type Config struct {
+	// Level is the maintenance domain level, 0-7. Messages received at any
+	// other level are ignored.
+	Level uint8
+
+	// Data, if set, is sent in a Data TLV in each loopback message, so that
+	// larger frames can be tested.
+	Data []byte
+
+	// LinktraceTTL is the initial TTL of linktrace messages. If zero, 64 is
+	// used.
+	LinktraceTTL uint8
+
+	// LinktraceTimeout is the time to wait for linktrace replies. If zero,
+	// the 5 seconds specified by IEEE 802.1ag is used.
+	LinktraceTimeout time.Duration
+}
+
+// withDefaults returns a copy of c with zero values replaced by defaults.
+func (c Config) withDefaults() (Config, error) {
+	if c.Level > maxLevel {
+		return c, errInvalidLevel
+	}
+
+	if c.LinktraceTTL == 0 {
+		c.LinktraceTTL = defaultLinktraceTTL
+	}
+	if c.LinktraceTimeout == 0 {
+		c.LinktraceTimeout = defaultLinktraceTimeout
+	}
+
+	return c, nil
+}
+
+// Statistics summarizes the round trip times measured by Ping.
+type Statistics struct {
+	// Sent and Received are the number of loopback messages sent and
+	// loopback replies received.
+	Sent, Received int
+
+	// Round trip time statistics for the received replies.
+	Min, Max, Mean, StdDev time.Duration
+
+	// sum and sumSquares accumulate round trip times in nanoseconds.
+	sum, sumSquares float64
+}
+
+// Loss returns the fraction of loopback messages which did not receive a
+// reply, from 0 to 1.
+func (s *Statistics) Loss() float64 {
+	if s.Sent == 0 {
+		return 0
+	}
+
+	return float64(s.Sent-s.Received) / float64(s.Sent)
+}
+
+// String returns a summary of the Statistics in the style of ping.
+func (s *Statistics) String() string {
+	return fmt.Sprintf("%d sent, %d received, %.1f%% loss, rtt min/avg/max/stddev = %s/%s/%s/%s",
+		s.Sent, s.Received, 100*s.Loss(), s.Min, s.Mean, s.Max, s.StdDev)
+}
+
+// observe records the round trip time of a received reply.
+func (s *Statistics) observe(rtt time.Duration) {
+	s.Received++
+	if s.Received == 1 || rtt < s.Min {
+		s.Min = rtt
+	}
+	if rtt > s.Max {
+		s.Max = rtt
+	}
+
+	f := float64(rtt)
+	s.sum += f
+	s.sumSquares += f * f
+
+	n := float64(s.Received)
+	mean := s.sum / n
+	s.Mean = time.Duration(mean)
+	s.StdDev = time.Duration(math.Sqrt(math.Max(0, s.sumSquares/n-mean*mean)))
+}
+
+// A Hop is a maintenance point which answered a linktrace message.
+type Hop struct {
+	// HardwareAddr is the source address of the reply.
+	HardwareAddr net.HardwareAddr
+
+	Reply *LinktraceReply
+}
+
+// A Client sends loopback and linktrace messages on a network interface.
+// A Client performs one operation at a time; concurrent calls are
+// serialized.
+type Client struct {
+	ifi *net.Interface
+	p   net.PacketConn
+	cfg Config
+
+	mu sync.Mutex
+	id uint32
+}
+
+// Dial creates a new Client using the specified network interface. Dial
+// opens a *raw.Conn which receives CFM frames. A nil Config selects the
+// default values.
+func Dial(ifi *net.Interface, cfg *Config) (*Client, error) {
+	p, err := raw.ListenPacket(ifi, uint16(ethernet.EtherTypeCFM), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := New(ifi, p, cfg)
+	if err != nil {
+		_ = p.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// New creates a new Client using the specified network interface and
+// net.PacketConn. p must send and receive complete Ethernet frames.
+func New(ifi *net.Interface, p net.PacketConn, cfg *Config) (*Client, error) {
+	if len(ifi.HardwareAddr) != 6 {
+		return nil, fmt.Errorf("cfm: invalid hardware address: %q", ifi.HardwareAddr)
+	}
+
+	if cfg == nil {
+		cfg = &Config{}
+	}
+
+	c, err := cfg.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{
+		ifi: ifi,
+		p:   p,
+		cfg: c,
+		// Start from a random transaction ID so that replies to a previous
+		// Client are not mistaken for replies to this one.
+		id: rand.New(rand.NewSource(time.Now().UnixNano())).Uint32(),
+	}, nil
+}
+
+// Close closes the Client's connection.
+func (c *Client) Close() error {
+	return c.p.Close()
+}
+
+// Loopback sends a loopback message to dst and waits for a loopback reply
+// until ctx is canceled, returning the round trip time. dst is normally the
+// address of a maintenance point, but may also be CCMGroupAddr for the
+// Client's level, in which case the first reply is used.
+func (c *Client) Loopback(ctx context.Context, dst net.HardwareAddr) (time.Duration, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	rtt, _, err := c.loopback(ctx, dst)
+	return rtt, err
+}
+
+// Ping sends count loopback messages to dst, one per interval, and returns
+// statistics about the replies. Each message waits at most interval for its
+// reply, so interval must be greater than zero. If count is zero or less, Ping
+// continues until ctx is canceled. When ctx is canceled, Ping returns the
+// statistics collected so far along with ctx.Err().
+func (c *Client) Ping(ctx context.Context, dst net.HardwareAddr, count int, interval time.Duration) (*Statistics, error) {
+	if interval <= 0 {
+		return nil, errInvalidInterval
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var s Statistics
+	for i := 0; count <= 0 || i < count; i++ {
+		start := time.Now()
+
+		pctx, cancel := context.WithTimeout(ctx, interval)
+		rtt, sent, err := c.loopback(pctx, dst)
+		cancel()
+
+		if sent {
+			s.Sent++
+		}
+
+		switch {
+		case err == nil:
+			s.observe(rtt)
+		case ctx.Err() != nil:
+			return &s, ctx.Err()
+		case errors.Is(err, context.DeadlineExceeded):
+			// No reply within the interval.
+		default:
+			return &s, err
+		}
+
+		if count > 0 && i == count-1 {
+			break
+		}
+
+		// Wait for the remainder of the interval before the next message.
+		t := time.NewTimer(interval - time.Since(start))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return &s, ctx.Err()
+		case <-t.C:
+		}
+	}
+
+	return &s, nil
+}
+
+// loopback implements Loopback, and also reports whether the loopback
+// message was sent. The caller must hold c.mu.
+func (c *Client) loopback(ctx context.Context, dst net.HardwareAddr) (time.Duration, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, false, err
+	}
+
+	c.id++
+	lbm := &LoopbackMessage{TransactionID: c.id}
+	if len(c.cfg.Data) > 0 {
+		lbm.TLVs = []TLV{{Type: TLVTypeData, Value: c.cfg.Data}}
+	}
+
+	var rtt time.Duration
+	sent, err := c.exchange(ctx, 0, dst, lbm, func(start time.Time, _ net.HardwareAddr, m Message) bool {
+		lbr, ok := m.(*LoopbackReply)
+		if !ok || lbr.TransactionID != lbm.TransactionID {
+			return false
+		}
+
+		rtt = time.Since(start)
+		return true
+	})
+	if err != nil {
+		return 0, sent, err
+	}
+
+	return rtt, true, nil
+}
+
+// Linktrace multicasts a linktrace message toward target and collects the
+// replies from each maintenance point along the path, ordered from nearest
+// to farthest. Linktrace returns when target replies or when the configured
+// timeout elapses. If ctx is canceled, the replies received so far are
+// returned along with ctx.Err().
+func (c *Client) Linktrace(ctx context.Context, target net.HardwareAddr) ([]Hop, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	c.id++
+	ltm := &LinktraceMessage{
+		TransactionID: c.id,
+		TTL:           c.cfg.LinktraceTTL,
+		OriginalAddr:  c.ifi.HardwareAddr,
+		TargetAddr:    target,
+	}
+
+	var hops []Hop
+	_, err := c.exchange(ctx, c.cfg.LinktraceTimeout, LTMGroupAddr(c.cfg.Level), ltm,
+		func(_ time.Time, src net.HardwareAddr, m Message) bool {
+			ltr, ok := m.(*LinktraceReply)
+			if !ok || ltr.TransactionID != ltm.TransactionID {
+				return false
+			}
+
+			hops = append(hops, Hop{
+				HardwareAddr: append(net.HardwareAddr(nil), src...),
+				Reply:        ltr,
+			})
+
+			return ltr.RelayAction == RelayHit
+		},
+	)
+
+	// Nearer maintenance points reply with a higher TTL.
+	sort.SliceStable(hops, func(i, j int) bool {
+		return hops[i].Reply.TTL > hops[j].Reply.TTL
+	})
+
+	// context.DeadlineExceeded is also a timeout, so ctx must be checked
+	// before the configured timeout.
+	switch {
+	case err == nil:
+		return hops, nil
+	case ctx.Err() != nil:
+		return hops, ctx.Err()
+	case frame.IsTimeout(err):
+		return hops, nil
+	default:
+		return nil, err
+	}
+}
+
+// exchange sends m to dst and passes received messages to fn until it
+// returns true, timeout elapses, or ctx is canceled. A zero timeout waits
+// until ctx is canceled. exchange also reports whether m was sent.
+func (c *Client) exchange(
+	ctx context.Context,
+	timeout time.Duration,
+	dst net.HardwareAddr,
+	m Message,
+	fn func(start time.Time, src net.HardwareAddr, m Message) bool,
+) (bool, error) {
+	defer frame.CancelReads(ctx, c.p)()
+
+	if timeout > 0 {
+		if err := c.p.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+			return false, err
+		}
+
+		// The deadline may have replaced the one set when ctx was canceled.
+		if err := ctx.Err(); err != nil {
+			return false, err
+		}
+	}
+
+	start := time.Now()
+	if err := writeMessage(c.p, c.ifi.HardwareAddr, dst, nil, c.cfg.Level, m); err != nil {
+		return false, err
+	}
+
+	b := make([]byte, frame.BufferSize(c.ifi))
+	for {
+		n, _, err := c.p.ReadFrom(b)
+		if err != nil {
+			if ctx.Err() != nil {
+				return true, ctx.Err()
+			}
+
+			return true, err
+		}
+
+		f, level, rm, err := parseFrame(b[:n])
+		if err != nil || level != c.cfg.Level || !bytes.Equal(f.Destination, c.ifi.HardwareAddr) {
+			continue
+		}
+
+		if fn(start, f.Source, rm) {
+			return true, nil
+		}
+	}
+}
+
+// writeMessage writes a Message at the specified level to p in an Ethernet
+// frame addressed to dst, with an optional VLAN tag.
+func writeMessage(p net.PacketConn, src, dst net.HardwareAddr, vlan *ethernet.VLAN, level uint8, m Message) error {
+	mb, err := MarshalMessage(level, m)
+	if err != nil {
+		return err
+	}
+
+	fb, err := (&ethernet.Frame{
+		Destination: dst,
+		Source:      src,
+		VLAN:        vlan,
+		EtherType:   ethernet.EtherTypeCFM,
+		Payload:     mb,
+	}).MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	_, err = p.WriteTo(fb, &raw.Addr{HardwareAddr: dst})
+	return err
+}
+
+// parseFrame parses a CFM Message and its level from an Ethernet frame.
+func parseFrame(b []byte) (*ethernet.Frame, uint8, Message, error) {
+	var f ethernet.Frame
+	if err := f.UnmarshalBinary(b); err != nil {
+		return nil, 0, nil, err
+	}
+	if f.EtherType != ethernet.EtherTypeCFM {
+		return nil, 0, nil, errors.New("cfm: not a CFM frame")
+	}
+
+	level, m, err := ParseMessage(f.Payload)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+
+	return &f, level, m, nil
+}
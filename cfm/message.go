@@ -0,0 +1,558 @@
+// Package cfm implements IEEE 802.1ag Connectivity Fault Management on top
+// of a *raw.Conn. It provides continuity check, loopback, and linktrace
+// messages, a Client which measures layer 2 reachability and round trip time
+// to a maintenance end point, and a Server which answers loopback and
+// linktrace messages.
+package cfm
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+)
+
+var (
+	// errInvalidLevel is returned when a maintenance domain level is out of
+	// range.
+	errInvalidLevel = errors.New("cfm: maintenance domain level must be 0-7")
+
+	// errInvalidTLV is returned when a TLV is malformed.
+	errInvalidTLV = errors.New("cfm: invalid TLV")
+
+	// errInvalidInterval is returned when a ping interval is not positive.
+	errInvalidInterval = errors.New("cfm: ping interval must be greater than zero")
+)
+
+const (
+	// headerLen is the length of the common CFM header.
+	headerLen = 4
+
+	// version is the CFM protocol version implemented by this package.
+	version = 0
+
+	// maxLevel is the highest maintenance domain level.
+	maxLevel = 7
+)
+
+// An OpCode identifies the type of a CFM Message.
+type OpCode uint8
+
+// OpCode values for the messages supported by this package.
+const (
+	OpCodeContinuityCheck  OpCode = 1
+	OpCodeLoopbackReply    OpCode = 2
+	OpCodeLoopbackMessage  OpCode = 3
+	OpCodeLinktraceReply   OpCode = 4
+	OpCodeLinktraceMessage OpCode = 5
+)
+
+// String returns the name of an OpCode.
+func (o OpCode) String() string {
+	switch o {
+	case OpCodeContinuityCheck:
+		return "CCM"
+	case OpCodeLoopbackReply:
+		return "LBR"
+	case OpCodeLoopbackMessage:
+		return "LBM"
+	case OpCodeLinktraceReply:
+		return "LTR"
+	case OpCodeLinktraceMessage:
+		return "LTM"
+	default:
+		return fmt.Sprintf("unknown(%d)", uint8(o))
+	}
+}
+
+// A TLVType is the type of a CFM TLV.
+type TLVType uint8
+
+// TLVType values defined by IEEE 802.1ag.
+const (
+	TLVTypeEnd                  TLVType = 0
+	TLVTypeSenderID             TLVType = 1
+	TLVTypePortStatus           TLVType = 2
+	TLVTypeData                 TLVType = 3
+	TLVTypeInterfaceStatus      TLVType = 4
+	TLVTypeReplyIngress         TLVType = 5
+	TLVTypeReplyEgress          TLVType = 6
+	TLVTypeLTMEgressIdentifier  TLVType = 7
+	TLVTypeLTREgressIdentifier  TLVType = 8
+	TLVTypeOrganizationSpecific TLVType = 31
+)
+
+// A TLV is a raw CFM type-length-value structure which follows the fixed
+// fields of a Message.
+type TLV struct {
+	Type  TLVType
+	Value []byte
+}
+
+// A Message is a CFM protocol data unit.
+type Message interface {
+	// OpCode returns the OpCode of the Message.
+	OpCode() OpCode
+
+	// marshal returns the flags, the fixed fields which follow the common
+	// header, and the TLVs of the Message. unmarshal is its inverse.
+	marshal() (flags uint8, fields []byte, tlvs []TLV, err error)
+	unmarshal(flags uint8, fields []byte, tlvs []TLV) error
+}
+
+// MarshalMessage marshals a Message at the specified maintenance domain level
+// into its binary form.
+func MarshalMessage(level uint8, m Message) ([]byte, error) {
+	if level > maxLevel {
+		return nil, errInvalidLevel
+	}
+
+	flags, fields, tlvs, err := m.marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, headerLen, headerLen+len(fields)+1)
+	b[0] = level<<5 | version
+	b[1] = uint8(m.OpCode())
+	b[2] = flags
+	b[3] = uint8(len(fields))
+	b = append(b, fields...)
+
+	for _, t := range tlvs {
+		if t.Type == TLVTypeEnd || len(t.Value) > 0xffff {
+			return nil, errInvalidTLV
+		}
+
+		var h [3]byte
+		h[0] = uint8(t.Type)
+		binary.BigEndian.PutUint16(h[1:3], uint16(len(t.Value)))
+		b = append(b, h[:]...)
+		b = append(b, t.Value...)
+	}
+
+	return append(b, uint8(TLVTypeEnd)), nil
+}
+
+// ParseMessage parses a Message and its maintenance domain level from its
+// binary form. Any trailing Ethernet padding after the end TLV is ignored.
+func ParseMessage(b []byte) (uint8, Message, error) {
+	if len(b) < headerLen {
+		return 0, nil, io.ErrUnexpectedEOF
+	}
+
+	level, ver := b[0]>>5, b[0]&0x1f
+	if ver != version {
+		return 0, nil, fmt.Errorf("cfm: unsupported version: %d", ver)
+	}
+
+	var m Message
+	switch op := OpCode(b[1]); op {
+	case OpCodeContinuityCheck:
+		m = new(ContinuityCheck)
+	case OpCodeLoopbackReply:
+		m = new(LoopbackReply)
+	case OpCodeLoopbackMessage:
+		m = new(LoopbackMessage)
+	case OpCodeLinktraceReply:
+		m = new(LinktraceReply)
+	case OpCodeLinktraceMessage:
+		m = new(LinktraceMessage)
+	default:
+		return 0, nil, fmt.Errorf("cfm: unsupported opcode: %s", op)
+	}
+
+	off := headerLen + int(b[3])
+	if len(b) < off {
+		return 0, nil, io.ErrUnexpectedEOF
+	}
+
+	tlvs, err := parseTLVs(b[off:])
+	if err != nil {
+		return 0, nil, err
+	}
+
+	// Fields are copied so that b may be reused.
+	fields := make([]byte, off-headerLen)
+	copy(fields, b[headerLen:off])
+
+	if err := m.unmarshal(b[2], fields, tlvs); err != nil {
+		return 0, nil, err
+	}
+
+	return level, m, nil
+}
+
+// parseTLVs parses TLVs from b until the end TLV.
+func parseTLVs(b []byte) ([]TLV, error) {
+	var tlvs []TLV
+	for {
+		if len(b) < 1 {
+			return nil, io.ErrUnexpectedEOF
+		}
+
+		t := TLVType(b[0])
+		if t == TLVTypeEnd {
+			return tlvs, nil
+		}
+
+		if len(b) < 3 {
+			return nil, io.ErrUnexpectedEOF
+		}
+		l := int(binary.BigEndian.Uint16(b[1:3]))
+		if len(b) < 3+l {
+			return nil, io.ErrUnexpectedEOF
+		}
+
+		v := make([]byte, l)
+		copy(v, b[3:3+l])
+		b = b[3+l:]
+
+		tlvs = append(tlvs, TLV{Type: t, Value: v})
+	}
+}
+
+// CCMGroupAddr returns the multicast address to which continuity check
+// messages and multicast loopback messages are sent at the specified
+// maintenance domain level.
+func CCMGroupAddr(level uint8) net.HardwareAddr {
+	return net.HardwareAddr{0x01, 0x80, 0xc2, 0x00, 0x00, 0x30 | level&maxLevel}
+}
+
+// LTMGroupAddr returns the multicast address to which linktrace messages are
+// sent at the specified maintenance domain level.
+func LTMGroupAddr(level uint8) net.HardwareAddr {
+	return net.HardwareAddr{0x01, 0x80, 0xc2, 0x00, 0x00, 0x38 | level&maxLevel}
+}
+
+// A CCMInterval is the transmission interval encoded in a ContinuityCheck.
+type CCMInterval uint8
+
+// CCMInterval values defined by IEEE 802.1ag.
+const (
+	CCMIntervalInvalid CCMInterval = iota
+	CCMInterval3ms
+	CCMInterval10ms
+	CCMInterval100ms
+	CCMInterval1s
+	CCMInterval10s
+	CCMInterval1m
+	CCMInterval10m
+)
+
+// maidLen is the length of a maintenance association identifier.
+const maidLen = 48
+
+// A MAID is a maintenance association identifier.
+type MAID [maidLen]byte
+
+// NewMAID creates a MAID from a maintenance domain name and a short
+// maintenance association name, both encoded as character strings. If md is
+// empty, the MAID indicates that no maintenance domain name is present.
+func NewMAID(md, ma string) (MAID, error) {
+	const (
+		formatNone   = 1
+		formatString = 4
+		maString     = 2
+	)
+
+	var b []byte
+	if md == "" {
+		b = append(b, formatNone)
+	} else {
+		b = append(b, formatString, uint8(len(md)))
+		b = append(b, md...)
+	}
+
+	b = append(b, maString, uint8(len(ma)))
+	b = append(b, ma...)
+
+	var id MAID
+	if len(md) > 43 || len(ma) == 0 || len(b) > maidLen {
+		return id, errors.New("cfm: maintenance domain and association names are too long or empty")
+	}
+
+	copy(id[:], b)
+	return id, nil
+}
+
+var _ Message = &ContinuityCheck{}
+
+// A ContinuityCheck is a continuity check message, multicast periodically by
+// a maintenance end point to announce its presence.
+type ContinuityCheck struct {
+	// RDI is the remote defect indication.
+	RDI bool
+
+	// Interval is the period at which the message is transmitted.
+	Interval CCMInterval
+
+	// Sequence is incremented for each message sent.
+	Sequence uint32
+
+	// MEPID identifies the sending maintenance end point, a 13-bit value.
+	MEPID uint16
+
+	// MAID identifies the maintenance association.
+	MAID MAID
+
+	TLVs []TLV
+}
+
+// ccmFieldsLen is the length of the fixed fields of a ContinuityCheck,
+// including the fields reserved for ITU-T Y.1731.
+const ccmFieldsLen = 4 + 2 + maidLen + 16
+
+// OpCode implements Message.
+func (cc *ContinuityCheck) OpCode() OpCode { return OpCodeContinuityCheck }
+
+func (cc *ContinuityCheck) marshal() (uint8, []byte, []TLV, error) {
+	if cc.MEPID > 0x1fff || cc.Interval > CCMInterval10m {
+		return 0, nil, nil, errors.New("cfm: invalid continuity check MEP ID or interval")
+	}
+
+	flags := uint8(cc.Interval)
+	if cc.RDI {
+		flags |= 0x80
+	}
+
+	b := make([]byte, ccmFieldsLen)
+	binary.BigEndian.PutUint32(b[0:4], cc.Sequence)
+	binary.BigEndian.PutUint16(b[4:6], cc.MEPID)
+	copy(b[6:6+maidLen], cc.MAID[:])
+
+	return flags, b, cc.TLVs, nil
+}
+
+func (cc *ContinuityCheck) unmarshal(flags uint8, b []byte, tlvs []TLV) error {
+	if len(b) < 6+maidLen {
+		return io.ErrUnexpectedEOF
+	}
+
+	*cc = ContinuityCheck{
+		RDI:      flags&0x80 != 0,
+		Interval: CCMInterval(flags & 0x07),
+		Sequence: binary.BigEndian.Uint32(b[0:4]),
+		MEPID:    binary.BigEndian.Uint16(b[4:6]) & 0x1fff,
+		TLVs:     tlvs,
+	}
+	copy(cc.MAID[:], b[6:6+maidLen])
+
+	return nil
+}
+
+var _ Message = &LoopbackMessage{}
+
+// A LoopbackMessage requests a LoopbackReply from a maintenance point, in
+// the same way as an ICMP echo request.
+type LoopbackMessage struct {
+	TransactionID uint32
+	TLVs          []TLV
+}
+
+// OpCode implements Message.
+func (lbm *LoopbackMessage) OpCode() OpCode { return OpCodeLoopbackMessage }
+
+func (lbm *LoopbackMessage) marshal() (uint8, []byte, []TLV, error) {
+	return 0, marshalTransactionID(lbm.TransactionID), lbm.TLVs, nil
+}
+
+func (lbm *LoopbackMessage) unmarshal(_ uint8, b []byte, tlvs []TLV) error {
+	id, err := parseTransactionID(b)
+	if err != nil {
+		return err
+	}
+
+	*lbm = LoopbackMessage{TransactionID: id, TLVs: tlvs}
+	return nil
+}
+
+var _ Message = &LoopbackReply{}
+
+// A LoopbackReply answers a LoopbackMessage, echoing its transaction ID and
+// TLVs.
+type LoopbackReply struct {
+	TransactionID uint32
+	TLVs          []TLV
+}
+
+// OpCode implements Message.
+func (lbr *LoopbackReply) OpCode() OpCode { return OpCodeLoopbackReply }
+
+func (lbr *LoopbackReply) marshal() (uint8, []byte, []TLV, error) {
+	return 0, marshalTransactionID(lbr.TransactionID), lbr.TLVs, nil
+}
+
+func (lbr *LoopbackReply) unmarshal(_ uint8, b []byte, tlvs []TLV) error {
+	id, err := parseTransactionID(b)
+	if err != nil {
+		return err
+	}
+
+	*lbr = LoopbackReply{TransactionID: id, TLVs: tlvs}
+	return nil
+}
+
+var _ Message = &LinktraceMessage{}
+
+// A LinktraceMessage is multicast toward a target hardware address, and is
+// answered with a LinktraceReply by each maintenance point along the path, in
+// the same way as traceroute.
+type LinktraceMessage struct {
+	// UseFDBOnly indicates that only the filtering database may be used to
+	// forward the message.
+	UseFDBOnly bool
+
+	TransactionID uint32
+
+	// TTL is decremented by each maintenance point which forwards the
+	// message.
+	TTL uint8
+
+	// OriginalAddr is the address of the maintenance end point which
+	// originated the message, and TargetAddr is the address being traced.
+	OriginalAddr net.HardwareAddr
+	TargetAddr   net.HardwareAddr
+
+	TLVs []TLV
+}
+
+// OpCode implements Message.
+func (ltm *LinktraceMessage) OpCode() OpCode { return OpCodeLinktraceMessage }
+
+func (ltm *LinktraceMessage) marshal() (uint8, []byte, []TLV, error) {
+	if len(ltm.OriginalAddr) != 6 || len(ltm.TargetAddr) != 6 {
+		return 0, nil, nil, fmt.Errorf("cfm: invalid linktrace addresses: %q -> %q",
+			ltm.OriginalAddr, ltm.TargetAddr)
+	}
+
+	var flags uint8
+	if ltm.UseFDBOnly {
+		flags |= 0x80
+	}
+
+	b := make([]byte, 4+1+6+6)
+	binary.BigEndian.PutUint32(b[0:4], ltm.TransactionID)
+	b[4] = ltm.TTL
+	copy(b[5:11], ltm.OriginalAddr)
+	copy(b[11:17], ltm.TargetAddr)
+
+	return flags, b, ltm.TLVs, nil
+}
+
+func (ltm *LinktraceMessage) unmarshal(flags uint8, b []byte, tlvs []TLV) error {
+	if len(b) < 17 {
+		return io.ErrUnexpectedEOF
+	}
+
+	*ltm = LinktraceMessage{
+		UseFDBOnly:    flags&0x80 != 0,
+		TransactionID: binary.BigEndian.Uint32(b[0:4]),
+		TTL:           b[4],
+		OriginalAddr:  net.HardwareAddr(b[5:11]),
+		TargetAddr:    net.HardwareAddr(b[11:17]),
+		TLVs:          tlvs,
+	}
+
+	return nil
+}
+
+// A RelayAction indicates how a maintenance point handled a
+// LinktraceMessage.
+type RelayAction uint8
+
+// RelayAction values defined by IEEE 802.1ag.
+const (
+	// RelayHit indicates that the target address was reached.
+	RelayHit RelayAction = 1
+
+	// RelayFDB indicates that the egress port was found in the filtering
+	// database.
+	RelayFDB RelayAction = 2
+
+	// RelayMPDB indicates that the egress port was found in the maintenance
+	// point database.
+	RelayMPDB RelayAction = 3
+)
+
+var _ Message = &LinktraceReply{}
+
+// A LinktraceReply answers a LinktraceMessage.
+type LinktraceReply struct {
+	// UseFDBOnly is copied from the LinktraceMessage.
+	UseFDBOnly bool
+
+	// Forwarded indicates that the LinktraceMessage was relayed further.
+	Forwarded bool
+
+	// TerminalMEP indicates that the reply was sent by a maintenance end
+	// point.
+	TerminalMEP bool
+
+	TransactionID uint32
+
+	// TTL is the TTL of the LinktraceMessage decremented by one. The reply
+	// with the highest TTL is sent by the nearest maintenance point.
+	TTL uint8
+
+	RelayAction RelayAction
+	TLVs        []TLV
+}
+
+// OpCode implements Message.
+func (ltr *LinktraceReply) OpCode() OpCode { return OpCodeLinktraceReply }
+
+func (ltr *LinktraceReply) marshal() (uint8, []byte, []TLV, error) {
+	var flags uint8
+	if ltr.UseFDBOnly {
+		flags |= 0x80
+	}
+	if ltr.Forwarded {
+		flags |= 0x40
+	}
+	if ltr.TerminalMEP {
+		flags |= 0x20
+	}
+
+	b := make([]byte, 4+1+1)
+	binary.BigEndian.PutUint32(b[0:4], ltr.TransactionID)
+	b[4] = ltr.TTL
+	b[5] = uint8(ltr.RelayAction)
+
+	return flags, b, ltr.TLVs, nil
+}
+
+func (ltr *LinktraceReply) unmarshal(flags uint8, b []byte, tlvs []TLV) error {
+	if len(b) < 6 {
+		return io.ErrUnexpectedEOF
+	}
+
+	*ltr = LinktraceReply{
+		UseFDBOnly:    flags&0x80 != 0,
+		Forwarded:     flags&0x40 != 0,
+		TerminalMEP:   flags&0x20 != 0,
+		TransactionID: binary.BigEndian.Uint32(b[0:4]),
+		TTL:           b[4],
+		RelayAction:   RelayAction(b[5]),
+		TLVs:          tlvs,
+	}
+
+	return nil
+}
+
+// marshalTransactionID marshals the fixed fields of a loopback message.
+func marshalTransactionID(id uint32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, id)
+	return b
+}
+
+// parseTransactionID parses the fixed fields of a loopback message.
+func parseTransactionID(b []byte) (uint32, error) {
+	if len(b) < 4 {
+		return 0, io.ErrUnexpectedEOF
+	}
+
+	return binary.BigEndian.Uint32(b[0:4]), nil
+}
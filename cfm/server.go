@@ -0,0 +1,135 @@
+package cfm
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/mdlayher/raw"
+	"github.com/mdlayher/raw/ethernet"
+	"github.com/mdlayher/raw/internal/frame"
+)
+
+// A Server is a maintenance end point which answers loopback messages and
+// linktrace messages targeting its hardware address.
+type Server struct {
+	ifi *net.Interface
+	p   net.PacketConn
+	cfg Config
+}
+
+// Listen creates a new Server using the specified network interface. Listen
+// opens a *raw.Conn which receives CFM frames, and enables promiscuous mode
+// so that frames sent to the CFM multicast addresses are delivered. A nil
+// Config selects the default values.
+func Listen(ifi *net.Interface, cfg *Config) (*Server, error) {
+	c, err := raw.ListenPacket(ifi, uint16(ethernet.EtherTypeCFM), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.SetPromiscuous(true); err != nil {
+		_ = c.Close()
+		return nil, err
+	}
+
+	s, err := NewServer(ifi, c, cfg)
+	if err != nil {
+		_ = c.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// NewServer creates a new Server using the specified network interface and
+// net.PacketConn. p must send and receive complete Ethernet frames.
+func NewServer(ifi *net.Interface, p net.PacketConn, cfg *Config) (*Server, error) {
+	if len(ifi.HardwareAddr) != 6 {
+		return nil, fmt.Errorf("cfm: invalid hardware address: %q", ifi.HardwareAddr)
+	}
+
+	if cfg == nil {
+		cfg = &Config{}
+	}
+
+	c, err := cfg.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Server{
+		ifi: ifi,
+		p:   p,
+		cfg: c,
+	}, nil
+}
+
+// Close closes the Server's connection.
+func (s *Server) Close() error {
+	return s.p.Close()
+}
+
+// Serve answers loopback and linktrace messages at the Server's level until
+// ctx is canceled or an error occurs. Serve returns nil when ctx is canceled.
+func (s *Server) Serve(ctx context.Context) error {
+	defer frame.CancelReads(ctx, s.p)()
+
+	b := make([]byte, frame.BufferSize(s.ifi))
+	for {
+		n, _, err := s.p.ReadFrom(b)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			return err
+		}
+
+		f, level, m, err := parseFrame(b[:n])
+		if err != nil || level != s.cfg.Level || bytes.Equal(f.Source, s.ifi.HardwareAddr) {
+			continue
+		}
+
+		dst, reply := s.reply(f, m)
+		if reply == nil {
+			continue
+		}
+
+		// Replies are always unicast and keep the VLAN of the request.
+		if err := writeMessage(s.p, s.ifi.HardwareAddr, dst, f.VLAN, level, reply); err != nil {
+			return err
+		}
+	}
+}
+
+// reply returns the reply to m and its destination, if m requires a reply.
+func (s *Server) reply(f *ethernet.Frame, m Message) (net.HardwareAddr, Message) {
+	switch m := m.(type) {
+	case *LoopbackMessage:
+		if !bytes.Equal(f.Destination, s.ifi.HardwareAddr) &&
+			!bytes.Equal(f.Destination, CCMGroupAddr(s.cfg.Level)) {
+			return nil, nil
+		}
+
+		return f.Source, &LoopbackReply{
+			TransactionID: m.TransactionID,
+			TLVs:          m.TLVs,
+		}
+	case *LinktraceMessage:
+		if m.TTL == 0 || !bytes.Equal(m.TargetAddr, s.ifi.HardwareAddr) {
+			return nil, nil
+		}
+
+		return m.OriginalAddr, &LinktraceReply{
+			UseFDBOnly:    m.UseFDBOnly,
+			TerminalMEP:   true,
+			TransactionID: m.TransactionID,
+			TTL:           m.TTL - 1,
+			RelayAction:   RelayHit,
+		}
+	default:
+		return nil, nil
+	}
+}
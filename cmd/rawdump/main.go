@@ -0,0 +1,351 @@
+// Command rawdump prints a summary of the Ethernet frames received by a raw
+// socket, and optionally writes them to a pcap capture file.
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/mdlayher/raw"
+	"github.com/mdlayher/raw/ethernet"
+	"github.com/mdlayher/raw/internal/ethertype"
+	"github.com/mdlayher/raw/internal/frame"
+	"github.com/mdlayher/raw/pcap"
+	"golang.org/x/net/bpf"
+)
+
+func main() {
+	var (
+		ifiFlag   = flag.String("i", "", "network interface used to capture frames")
+		promFlag  = flag.Bool("p", false, "enable promiscuous mode")
+		etFlag    = flag.String("e", "", "capture only a comma-separated list of EtherTypes, by name (such as arp or ipv6) or number")
+		hostFlag  = flag.String("host", "", "capture only frames sent to or from a hardware address")
+		srcFlag   = flag.String("src", "", "capture only frames sent from a hardware address")
+		dstFlag   = flag.String("dst", "", "capture only frames sent to a hardware address")
+		vlanFlag  = flag.Int("vlan", -1, "capture only frames with an IEEE 802.1Q VLAN tag carrying an ID")
+		countFlag = flag.Int("c", 0, "exit after capturing count frames")
+		writeFlag = flag.String("w", "", "write frames to a pcap file instead of printing summaries")
+	)
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s -i <interface> [flags]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *ifiFlag == "" || flag.NArg() != 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ets, err := parseEtherTypes(*etFlag)
+	if err != nil {
+		log.Fatalf("failed to parse EtherTypes: %v", err)
+	}
+
+	f := filter{vlan: *vlanFlag}
+	for _, a := range []struct {
+		addr *net.HardwareAddr
+		s    string
+	}{
+		{&f.host, *hostFlag},
+		{&f.src, *srcFlag},
+		{&f.dst, *dstFlag},
+	} {
+		if *a.addr, err = parseMAC(a.s); err != nil {
+			log.Fatalf("failed to parse hardware address: %v", err)
+		}
+	}
+	if f.vlan < -1 || f.vlan > 0x0fff {
+		log.Fatalf("invalid VLAN ID: %d", f.vlan)
+	}
+
+	ifi, err := net.InterfaceByName(*ifiFlag)
+	if err != nil {
+		log.Fatalf("failed to get interface %q: %v", *ifiFlag, err)
+	}
+
+	// A single EtherType is selected by the socket itself, exactly as by
+	// programs which use package raw. Otherwise, all frames are captured and
+	// filtered by BPF, along with any other filters.
+	proto := uint16(raw.ProtocolAll)
+	if len(ets) == 1 {
+		proto = uint16(ets[0])
+	} else {
+		f.etherTypes = ets
+	}
+
+	prog, err := f.assemble()
+	if err != nil {
+		log.Fatalf("failed to assemble BPF filter: %v", err)
+	}
+
+	// On Linux, the initial filter also drops frames which arrive before
+	// SetBPF is called.
+	c, err := raw.ListenPacket(ifi, proto, &raw.Config{Filter: prog})
+	if err != nil {
+		log.Fatalf("failed to open raw socket: %v", err)
+	}
+	defer c.Close()
+
+	if prog != nil {
+		if err := c.SetBPF(prog); err != nil {
+			log.Fatalf("failed to attach BPF filter: %v", err)
+		}
+	}
+
+	if *promFlag {
+		if err := c.SetPromiscuous(true); err != nil {
+			log.Fatalf("failed to enable promiscuous mode: %v", err)
+		}
+	}
+
+	var pw *pcap.Writer
+	if *writeFlag != "" {
+		f, err := os.Create(*writeFlag)
+		if err != nil {
+			log.Fatalf("failed to create capture file: %v", err)
+		}
+		defer f.Close()
+
+		pw, err = pcap.NewWriter(f, pcap.LinkTypeEthernet, &pcap.Config{Nanoseconds: true})
+		if err != nil {
+			log.Fatalf("failed to write capture file header: %v", err)
+		}
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	go func() {
+		<-ctx.Done()
+		// Unblock the pending read.
+		_ = c.SetReadDeadline(time.Unix(1, 0))
+	}()
+
+	b := make([]byte, frame.BufferSize(ifi))
+	var n int
+	for *countFlag <= 0 || n < *countFlag {
+		l, _, err := c.ReadFrom(b)
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+
+			log.Fatalf("failed to read frame: %v", err)
+		}
+		now := time.Now()
+		n++
+
+		if pw != nil {
+			if err := pw.WritePacket(pcap.CaptureInfo{Timestamp: now}, b[:l]); err != nil {
+				log.Fatalf("failed to write capture file: %v", err)
+			}
+			continue
+		}
+
+		fmt.Println(summary(now, b[:l]))
+	}
+
+	stats, err := c.Stats()
+	if err != nil && !errors.Is(err, raw.ErrNotImplemented) {
+		log.Fatalf("failed to get statistics: %v", err)
+	}
+
+	if stats != nil {
+		log.Printf("%d frames captured, %d dropped by kernel", n, stats.Drops)
+	} else {
+		log.Printf("%d frames captured", n)
+	}
+}
+
+// summary returns a one-line summary of the Ethernet frame b, received at t.
+func summary(t time.Time, b []byte) string {
+	var f ethernet.Frame
+	if err := f.UnmarshalBinary(b); err != nil {
+		return fmt.Sprintf("%s malformed frame, length %d", t.Format("15:04:05.000000"), len(b))
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s %s > %s", t.Format("15:04:05.000000"), f.Source, f.Destination)
+	if f.VLAN != nil {
+		fmt.Fprintf(&sb, ", vlan %d, p %d", f.VLAN.ID, f.VLAN.Priority)
+		if f.VLAN.DropEligible {
+			sb.WriteString(", DEI")
+		}
+	}
+
+	// Values in the EtherType position no larger than 1500 are IEEE 802.3
+	// length fields.
+	if f.EtherType <= 1500 {
+		fmt.Fprintf(&sb, ", 802.3 length %d", f.EtherType)
+	} else {
+		fmt.Fprintf(&sb, ", ethertype %s (%#04x)", f.EtherType, uint16(f.EtherType))
+	}
+
+	fmt.Fprintf(&sb, ", length %d", len(b))
+	return sb.String()
+}
+
+// parseEtherTypes parses a comma-separated list of EtherType names or
+// numbers.
+func parseEtherTypes(s string) ([]ethernet.EtherType, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	var ets []ethernet.EtherType
+	for _, v := range strings.Split(s, ",") {
+		et, err := ethertype.Parse(v)
+		if err != nil {
+			return nil, err
+		}
+		if et <= 1500 {
+			// IEEE 802.3 length fields vary by frame.
+			return nil, fmt.Errorf("invalid EtherType %q", v)
+		}
+
+		ets = append(ets, et)
+	}
+
+	return ets, nil
+}
+
+// parseMAC parses s as an Ethernet hardware address, if it is not empty.
+func parseMAC(s string) (net.HardwareAddr, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	mac, err := net.ParseMAC(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(mac) != 6 {
+		return nil, fmt.Errorf("invalid Ethernet hardware address %q", s)
+	}
+
+	return mac, nil
+}
+
+// A filter selects the frames which are captured. A frame must match each
+// field which is set.
+type filter struct {
+	// etherTypes are compared with the EtherType of a frame, or the
+	// EtherType encapsulated by its VLAN tag.
+	etherTypes []ethernet.EtherType
+
+	// host is compared with both the source and destination addresses.
+	host, src, dst net.HardwareAddr
+
+	// vlan is the VLAN ID of tagged frames, or -1 to accept any frame.
+	vlan int
+}
+
+// assemble assembles a BPF program which accepts frames matching f, or
+// returns nil if f accepts every frame.
+//
+// The program inspects VLAN tags in the frame itself, so it cannot match tags
+// which are removed by the network interface, as with VLAN offload on Linux.
+func (f *filter) assemble() ([]bpf.RawInstruction, error) {
+	// Jump offsets are limited to 255 instructions.
+	n := len(f.etherTypes)
+	if n > 100 {
+		return nil, fmt.Errorf("too many EtherTypes: %d", n)
+	}
+
+	// Each comparison which must match jumps to the final instruction, which
+	// rejects the frame, if it does not. The jumps are resolved once the
+	// length of the program is known.
+	var (
+		prog    []bpf.Instruction
+		rejects []int
+	)
+	mustEqual := func(val uint32) {
+		rejects = append(rejects, len(prog))
+		prog = append(prog, bpf.JumpIf{Cond: bpf.JumpEqual, Val: val})
+	}
+
+	hi := func(mac net.HardwareAddr) uint32 { return binary.BigEndian.Uint32(mac[0:4]) }
+	lo := func(mac net.HardwareAddr) uint32 { return uint32(binary.BigEndian.Uint16(mac[4:6])) }
+
+	// mac compares the hardware address at off with addr.
+	mac := func(off uint32, addr net.HardwareAddr) {
+		prog = append(prog, bpf.LoadAbsolute{Off: off, Size: 4})
+		mustEqual(hi(addr))
+		prog = append(prog, bpf.LoadAbsolute{Off: off + 4, Size: 2})
+		mustEqual(lo(addr))
+	}
+
+	if f.host != nil {
+		// Skip the source comparison if the destination matches.
+		prog = append(prog,
+			bpf.LoadAbsolute{Off: 0, Size: 4},
+			bpf.JumpIf{Cond: bpf.JumpEqual, Val: hi(f.host), SkipFalse: 2},
+			bpf.LoadAbsolute{Off: 4, Size: 2},
+			bpf.JumpIf{Cond: bpf.JumpEqual, Val: lo(f.host), SkipTrue: 4},
+		)
+		mac(6, f.host)
+	}
+	if f.dst != nil {
+		mac(0, f.dst)
+	}
+	if f.src != nil {
+		mac(6, f.src)
+	}
+
+	if f.vlan >= 0 {
+		prog = append(prog, bpf.LoadAbsolute{Off: 12, Size: 2})
+		mustEqual(uint32(ethernet.EtherTypeVLAN))
+		prog = append(prog,
+			bpf.LoadAbsolute{Off: 14, Size: 2},
+			bpf.ALUOpConstant{Op: bpf.ALUOpAnd, Val: 0x0fff},
+		)
+		mustEqual(uint32(f.vlan))
+	}
+
+	if n > 0 {
+		// Compare the EtherType, then the EtherType encapsulated by a VLAN
+		// tag, skipping the remaining comparisons on a match.
+		prog = append(prog, bpf.LoadAbsolute{Off: 12, Size: 2})
+		for i, et := range f.etherTypes {
+			prog = append(prog, bpf.JumpIf{Cond: bpf.JumpEqual, Val: uint32(et), SkipTrue: uint8(2*n + 1 - i)})
+		}
+		mustEqual(uint32(ethernet.EtherTypeVLAN))
+		prog = append(prog, bpf.LoadAbsolute{Off: 16, Size: 2})
+		for i, et := range f.etherTypes[:n-1] {
+			prog = append(prog, bpf.JumpIf{Cond: bpf.JumpEqual, Val: uint32(et), SkipTrue: uint8(n - 1 - i)})
+		}
+		mustEqual(uint32(f.etherTypes[n-1]))
+	}
+
+	if len(prog) == 0 {
+		return nil, nil
+	}
+
+	prog = append(prog,
+		bpf.RetConstant{Val: 0xffffffff},
+		bpf.RetConstant{Val: 0},
+	)
+	for _, i := range rejects {
+		skip := len(prog) - i - 2
+		if skip > 255 {
+			return nil, errors.New("too many filters")
+		}
+
+		j := prog[i].(bpf.JumpIf)
+		j.SkipFalse = uint8(skip)
+		prog[i] = j
+	}
+
+	return bpf.Assemble(prog)
+}
@@ -0,0 +1,140 @@
+// Command rawreplay transmits the Ethernet frames in a pcap or pcapng capture
+// file using a raw socket.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/mdlayher/raw"
+	"github.com/mdlayher/raw/replay"
+)
+
+func main() {
+	var (
+		ifiFlag   = flag.String("i", "", "network interface used to transmit frames")
+		speedFlag = flag.Float64("speed", 1, "multiplier for the original timing of the capture")
+		rateFlag  = flag.Float64("rate", 0, "transmit a fixed number of frames per second, ignoring the original timing")
+		floodFlag = flag.Bool("flood", false, "transmit frames as quickly as possible")
+		loopFlag  = flag.Int("loop", 1, "number of times to replay the capture; 0 replays until interrupted")
+		srcFlag   = flag.String("smac", "", "rewrite the source hardware address of every frame")
+		dstFlag   = flag.String("dmac", "", "rewrite the destination hardware address of every frame")
+		mapFlag   = flag.String("map", "", "rewrite hardware addresses, as a comma-separated list of old=new pairs")
+	)
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s -i <interface> [flags] <capture file>\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *ifiFlag == "" || flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	cfg := &replay.Config{
+		Speed: *speedFlag,
+		Rate:  *rateFlag,
+		Loop:  *loopFlag,
+	}
+
+	switch {
+	case *floodFlag && *rateFlag != 0:
+		log.Fatal("-flood and -rate are mutually exclusive")
+	case *floodFlag:
+		cfg.Timing = replay.TimingNone
+	case *rateFlag != 0:
+		cfg.Timing = replay.TimingRate
+	}
+
+	if *loopFlag == 0 {
+		cfg.Loop = -1
+	}
+
+	var err error
+	if cfg.Source, err = parseMAC(*srcFlag); err != nil {
+		log.Fatalf("failed to parse source hardware address: %v", err)
+	}
+	if cfg.Destination, err = parseMAC(*dstFlag); err != nil {
+		log.Fatalf("failed to parse destination hardware address: %v", err)
+	}
+	if cfg.Rewrite, err = parseMap(*mapFlag); err != nil {
+		log.Fatalf("failed to parse hardware address map: %v", err)
+	}
+
+	f, err := os.Open(flag.Arg(0))
+	if err != nil {
+		log.Fatalf("failed to open capture file: %v", err)
+	}
+	defer f.Close()
+
+	ifi, err := net.InterfaceByName(*ifiFlag)
+	if err != nil {
+		log.Fatalf("failed to get interface %q: %v", *ifiFlag, err)
+	}
+
+	// Protocol 0 receives no frames, which suits a connection used only to
+	// transmit.
+	c, err := raw.ListenPacket(ifi, 0, nil)
+	if err != nil {
+		log.Fatalf("failed to open raw socket: %v", err)
+	}
+	defer c.Close()
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	stats, err := replay.Replay(ctx, c, f, cfg)
+	if stats != nil {
+		log.Printf("sent %d frames (%d bytes) on %s, skipped %d packets, %d errors",
+			stats.Frames, stats.Bytes, ifi.Name, stats.Skipped, stats.Errors)
+	}
+	if err != nil && !errors.Is(err, context.Canceled) {
+		log.Fatalf("failed to replay capture: %v", err)
+	}
+}
+
+// parseMAC parses s as a hardware address, if it is not empty.
+func parseMAC(s string) (net.HardwareAddr, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	return net.ParseMAC(s)
+}
+
+// parseMap parses a comma-separated list of old=new hardware address pairs.
+func parseMap(s string) (map[string]net.HardwareAddr, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	m := make(map[string]net.HardwareAddr)
+	for _, pair := range strings.Split(s, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid pair %q", pair)
+		}
+
+		from, err := net.ParseMAC(kv[0])
+		if err != nil {
+			return nil, err
+		}
+		to, err := net.ParseMAC(kv[1])
+		if err != nil {
+			return nil, err
+		}
+
+		m[from.String()] = to
+	}
+
+	return m, nil
+}
@@ -0,0 +1,221 @@
+// Command rawsend sends hand-crafted Ethernet frames using a raw socket.
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/mdlayher/raw"
+	"github.com/mdlayher/raw/ethernet"
+	"github.com/mdlayher/raw/internal/ethertype"
+)
+
+func main() {
+	var (
+		ifiFlag   = flag.String("i", "", "network interface used to send frames")
+		dstFlag   = flag.String("d", "", "destination hardware address (default broadcast)")
+		srcFlag   = flag.String("s", "", "source hardware address (default the interface's address)")
+		etFlag    = flag.String("e", "", "EtherType, by name (such as arp or ipv6) or number")
+		vlanFlag  = flag.Int("vlan", -1, "optional IEEE 802.1Q VLAN ID")
+		priFlag   = flag.Uint("pri", 0, "IEEE 802.1Q priority, used with -vlan")
+		hexFlag   = flag.String("x", "", "payload, in hexadecimal")
+		fileFlag  = flag.String("f", "", "file containing the payload")
+		stdinFlag = flag.Bool("stdin", false, "read complete frames in hexadecimal from stdin, one per line, instead of building a frame from flags")
+		countFlag = flag.Int("n", 1, "number of times to send the frames; 0 sends until interrupted")
+		rateFlag  = flag.Float64("rate", 0, "frames sent per second (default as quickly as possible)")
+	)
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s -i <interface> [flags]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	// The rate must be low enough that frames are sent at least a
+	// nanosecond apart.
+	var interval time.Duration
+	if *rateFlag > 0 {
+		interval = time.Duration(float64(time.Second) / *rateFlag)
+	}
+	badRate := *rateFlag < 0 || math.IsNaN(*rateFlag) || (*rateFlag > 0 && interval <= 0)
+
+	if *ifiFlag == "" || flag.NArg() != 0 || *countFlag < 0 || badRate {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ifi, err := net.InterfaceByName(*ifiFlag)
+	if err != nil {
+		log.Fatalf("failed to get interface %q: %v", *ifiFlag, err)
+	}
+
+	var frames [][]byte
+	if *stdinFlag {
+		frames, err = readFrames(os.Stdin)
+		if err != nil {
+			log.Fatalf("failed to read frames: %v", err)
+		}
+		if len(frames) == 0 {
+			log.Fatal("no frames read from stdin")
+		}
+	} else {
+		f, err := buildFrame(ifi, *dstFlag, *srcFlag, *etFlag, *vlanFlag, *priFlag, *hexFlag, *fileFlag)
+		if err != nil {
+			log.Fatalf("failed to build frame: %v", err)
+		}
+
+		frames = [][]byte{f}
+	}
+
+	// Protocol 0 receives no frames, which suits a connection used only to
+	// transmit.
+	c, err := raw.ListenPacket(ifi, 0, nil)
+	if err != nil {
+		log.Fatalf("failed to open raw socket: %v", err)
+	}
+	defer c.Close()
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	var tick <-chan time.Time
+	if interval > 0 {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		tick = t.C
+	}
+
+	var sent int
+	for i := 0; *countFlag == 0 || i < *countFlag; i++ {
+		for _, f := range frames {
+			if tick != nil && sent > 0 {
+				select {
+				case <-tick:
+				case <-ctx.Done():
+				}
+			}
+			if ctx.Err() != nil {
+				log.Printf("sent %d frames on %s", sent, ifi.Name)
+				return
+			}
+
+			if _, err := c.WriteTo(f, &raw.Addr{HardwareAddr: f[0:6]}); err != nil {
+				log.Fatalf("failed to send frame: %v", err)
+			}
+			sent++
+		}
+	}
+
+	log.Printf("sent %d frames on %s", sent, ifi.Name)
+}
+
+// buildFrame builds an Ethernet frame from the command line flags.
+func buildFrame(ifi *net.Interface, dst, src, et string, vlan int, pri uint, payload, file string) ([]byte, error) {
+	f := &ethernet.Frame{
+		Destination: ethernet.Broadcast,
+		Source:      ifi.HardwareAddr,
+	}
+
+	var err error
+	if dst != "" {
+		if f.Destination, err = net.ParseMAC(dst); err != nil {
+			return nil, fmt.Errorf("invalid destination hardware address: %v", err)
+		}
+	}
+	if src != "" {
+		if f.Source, err = net.ParseMAC(src); err != nil {
+			return nil, fmt.Errorf("invalid source hardware address: %v", err)
+		}
+	}
+	if len(f.Destination) != 6 {
+		return nil, fmt.Errorf("invalid destination hardware address: %q", f.Destination)
+	}
+	if len(f.Source) != 6 {
+		// Interfaces such as loopback have no hardware address.
+		return nil, fmt.Errorf("invalid source hardware address %q, specify one with -s", f.Source)
+	}
+
+	if et == "" {
+		return nil, errors.New("an EtherType must be specified with -e")
+	}
+	if f.EtherType, err = ethertype.Parse(et); err != nil {
+		return nil, err
+	}
+
+	if vlan >= 0 {
+		if vlan > 0x0fff || pri > 7 {
+			return nil, fmt.Errorf("invalid VLAN %d with priority %d", vlan, pri)
+		}
+
+		f.VLAN = &ethernet.VLAN{ID: uint16(vlan), Priority: uint8(pri)}
+	}
+
+	switch {
+	case payload != "" && file != "":
+		return nil, errors.New("-x and -f are mutually exclusive")
+	case payload != "":
+		if f.Payload, err = parseHex(payload); err != nil {
+			return nil, fmt.Errorf("invalid payload: %v", err)
+		}
+	case file != "":
+		if f.Payload, err = os.ReadFile(file); err != nil {
+			return nil, err
+		}
+	}
+
+	return f.MarshalBinary()
+}
+
+// readFrames reads complete Ethernet frames in hexadecimal from r, one per
+// line. Empty lines and lines beginning with '#' are ignored.
+func readFrames(r io.Reader) ([][]byte, error) {
+	var frames [][]byte
+
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 1<<20)
+	for line := 1; s.Scan(); line++ {
+		text := strings.TrimSpace(s.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		f, err := parseHex(text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		if len(f) < 14 {
+			return nil, fmt.Errorf("line %d: frame is too short: %d bytes", line, len(f))
+		}
+
+		frames = append(frames, f)
+	}
+
+	return frames, s.Err()
+}
+
+// parseHex decodes a hexadecimal string, ignoring whitespace and the ':'
+// and '-' separators.
+func parseHex(s string) ([]byte, error) {
+	s = strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '\t', ':', '-':
+			return -1
+		default:
+			return r
+		}
+	}, s)
+
+	return hex.DecodeString(strings.TrimPrefix(s, "0x"))
+}
@@ -0,0 +1,79 @@
+// Command wol sends Wake-on-LAN magic packets using a raw socket.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+
+	"github.com/mdlayher/raw/wol"
+)
+
+func main() {
+	var (
+		ifiFlag      = flag.String("i", "", "network interface used to send magic packets")
+		passwordFlag = flag.String("p", "", "optional SecureOn password, as a hardware or IPv4 address")
+		dstFlag      = flag.String("d", "", "destination hardware address (default broadcast)")
+		udpFlag      = flag.Bool("udp", false, "send the magic packet in a UDP datagram")
+		addrFlag     = flag.String("addr", fmt.Sprintf("255.255.255.255:%d", wol.Port), "destination address for -udp")
+	)
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s -i <interface> [flags] <target MAC>\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *ifiFlag == "" || flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	target, err := net.ParseMAC(flag.Arg(0))
+	if err != nil {
+		log.Fatalf("failed to parse target hardware address: %v", err)
+	}
+
+	password, err := wol.ParsePassword(*passwordFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var dst net.HardwareAddr
+	if *dstFlag != "" {
+		dst, err = net.ParseMAC(*dstFlag)
+		if err != nil {
+			log.Fatalf("failed to parse destination hardware address: %v", err)
+		}
+	}
+
+	ifi, err := net.InterfaceByName(*ifiFlag)
+	if err != nil {
+		log.Fatalf("failed to get interface %q: %v", *ifiFlag, err)
+	}
+
+	c, err := wol.Dial(ifi)
+	if err != nil {
+		log.Fatalf("failed to open raw socket: %v", err)
+	}
+	defer c.Close()
+
+	if *udpFlag {
+		var addr *net.UDPAddr
+		addr, err = net.ResolveUDPAddr("udp4", *addrFlag)
+		if err != nil {
+			log.Fatalf("failed to resolve UDP address: %v", err)
+		}
+
+		err = c.WakeUDP(dst, addr, target, password)
+	} else {
+		err = c.Wake(dst, target, password)
+	}
+	if err != nil {
+		log.Fatalf("failed to send magic packet: %v", err)
+	}
+
+	log.Printf("sent magic packet for %s on %s", target, ifi.Name)
+}
@@ -0,0 +1,489 @@
+package dhcp4
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/mdlayher/raw"
+	"github.com/mdlayher/raw/ethernet"
+	"github.com/mdlayher/raw/internal/frame"
+)
+
+var (
+	// ErrNAK is returned when a server rejects a request with a DHCPNAK. The
+	// caller should discard any lease and acquire a new one.
+	ErrNAK = errors.New("dhcp4: server rejected request with DHCPNAK")
+
+	// errNoResponse is returned when no server responds to a request.
+	errNoResponse = errors.New("dhcp4: no response from server")
+)
+
+// Default retransmission values from RFC 2131, section 4.1.
+const (
+	defaultRetransmit  = 4 * time.Second
+	maxRetransmit      = 64 * time.Second
+	defaultMaxAttempts = 4
+)
+
+// defaultRequestedOptions are the options requested by a Client when
+// Config.RequestedOptions is empty.
+var defaultRequestedOptions = []OptionCode{
+	OptionSubnetMask,
+	OptionRouter,
+	OptionDomainNameServer,
+	OptionDomainName,
+	OptionBroadcastAddress,
+	OptionIPAddressLeaseTime,
+	OptionRenewalTimeValue,
+	OptionRebindingTimeValue,
+}
+
+// A Config specifies optional parameters for a Client.
+type Config struct {
+	// ClientID is sent in the Client Identifier option, if set.
+	ClientID []byte
+
+	// Hostname is sent in the Host Name option, if set.
+	Hostname string
+
+	// RequestedOptions are sent in the Parameter Request List option. If
+	// empty, a default list of common options is requested.
+	RequestedOptions []OptionCode
+
+	// Broadcast asks servers to broadcast their replies. This is only
+	// necessary for servers which cannot deliver unicast replies to a
+	// client without an IPv4 address.
+	Broadcast bool
+
+	// Retransmit is the initial time to wait for a reply before a request is
+	// retransmitted. The delay doubles on each attempt, up to 64 seconds. If
+	// zero, the default from RFC 2131 is used.
+	Retransmit time.Duration
+
+	// MaxAttempts is the number of times a request is sent before giving up.
+	// If zero, a default value is used.
+	MaxAttempts int
+}
+
+// A Lease is an IPv4 address lease obtained from a DHCP server.
+type Lease struct {
+	// IP is the leased IPv4 address.
+	IP net.IP
+
+	// ServerID and ServerHardwareAddr identify the server, or the relay
+	// agent, which granted the lease. They are used to unicast renewal and
+	// release messages.
+	ServerID           net.IP
+	ServerHardwareAddr net.HardwareAddr
+
+	// Common configuration parameters from the server.
+	SubnetMask net.IPMask
+	Routers    []net.IP
+	DNSServers []net.IP
+
+	// Duration is the lease time. RenewalTime (T1) and RebindingTime (T2)
+	// are relative to Acquired and default to 50% and 87.5% of the lease time.
+	Duration      time.Duration
+	RenewalTime   time.Duration
+	RebindingTime time.Duration
+	Acquired      time.Time
+
+	// ACK is the DHCPACK which granted the lease, for access to options not
+	// otherwise exposed by Lease.
+	ACK *Message
+}
+
+// RenewAt returns the time at which the lease should be renewed.
+func (l *Lease) RenewAt() time.Time { return l.Acquired.Add(l.RenewalTime) }
+
+// RebindAt returns the time at which the lease should be rebound.
+func (l *Lease) RebindAt() time.Time { return l.Acquired.Add(l.RebindingTime) }
+
+// Expires returns the time at which the lease expires.
+func (l *Lease) Expires() time.Time { return l.Acquired.Add(l.Duration) }
+
+// A Client is a DHCPv4 client which sends and receives messages as Ethernet
+// frames.
+type Client struct {
+	ifi *net.Interface
+	p   net.PacketConn
+	cfg Config
+}
+
+// Dial creates a new Client using the specified network interface. Dial
+// opens a *raw.Conn which receives IPv4 UDP datagrams addressed to the DHCP
+// client port. A nil Config selects the default values.
+func Dial(ifi *net.Interface, cfg *Config) (*Client, error) {
+	p, err := listen(ifi, ClientPort)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := New(ifi, p, cfg)
+	if err != nil {
+		_ = p.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// New creates a new Client using the specified network interface and
+// net.PacketConn. p must send and receive complete Ethernet frames.
+func New(ifi *net.Interface, p net.PacketConn, cfg *Config) (*Client, error) {
+	if len(ifi.HardwareAddr) != 6 {
+		return nil, errors.New("dhcp4: interface must have an Ethernet hardware address")
+	}
+
+	if cfg == nil {
+		cfg = &Config{}
+	}
+
+	switch {
+	case cfg.Retransmit < 0:
+		return nil, errors.New("dhcp4: retransmission delay must not be negative")
+	case cfg.MaxAttempts < 0:
+		return nil, errors.New("dhcp4: maximum attempts must not be negative")
+	}
+
+	c := &Client{
+		ifi: ifi,
+		p:   p,
+		cfg: *cfg,
+	}
+
+	if c.cfg.Retransmit == 0 {
+		c.cfg.Retransmit = defaultRetransmit
+	}
+	if c.cfg.MaxAttempts == 0 {
+		c.cfg.MaxAttempts = defaultMaxAttempts
+	}
+	if len(c.cfg.RequestedOptions) == 0 {
+		c.cfg.RequestedOptions = defaultRequestedOptions
+	}
+
+	return c, nil
+}
+
+// Close closes the Client's connection.
+func (c *Client) Close() error {
+	return c.p.Close()
+}
+
+// Acquire obtains a new lease by performing the DHCPDISCOVER, DHCPOFFER,
+// DHCPREQUEST, and DHCPACK exchange. The first offer received is accepted.
+// If the server rejects the request, ErrNAK is returned.
+func (c *Client) Acquire(ctx context.Context) (*Lease, error) {
+	discover := c.newMessage(Discover)
+	offer, err := c.exchange(ctx, discover, c.local(nil), broadcast(), func(p *packet) bool {
+		return p.m.Type() == Offer
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	serverID, ok := offer.m.Options.IP(OptionServerIdentifier)
+	if !ok {
+		serverID = offer.src.ip
+	}
+
+	// Select the offered address by including the server identifier in a
+	// broadcast request, reusing the same transaction ID.
+	request := c.newMessage(Request)
+	request.TransactionID = discover.TransactionID
+	request.Options.AddIPs(OptionRequestedIPAddress, offer.m.YourIP)
+	request.Options.AddIPs(OptionServerIdentifier, serverID)
+
+	return c.request(ctx, request, c.local(nil), broadcast())
+}
+
+// Renew extends a lease by unicasting a DHCPREQUEST to the server which
+// granted it, as done in the RENEWING state.
+func (c *Client) Renew(ctx context.Context, l *Lease) (*Lease, error) {
+	request := c.newMessage(Request)
+	request.ClientIP = l.IP
+
+	dst := endpoint{
+		hw:   l.ServerHardwareAddr,
+		ip:   l.ServerID,
+		port: ServerPort,
+	}
+	if dst.hw == nil {
+		dst.hw = ethernet.Broadcast
+	}
+
+	return c.request(ctx, request, c.local(l.IP), dst)
+}
+
+// Rebind extends a lease by broadcasting a DHCPREQUEST to any server, as
+// done in the REBINDING state when the original server is unreachable.
+func (c *Client) Rebind(ctx context.Context, l *Lease) (*Lease, error) {
+	request := c.newMessage(Request)
+	request.ClientIP = l.IP
+
+	return c.request(ctx, request, c.local(l.IP), broadcast())
+}
+
+// Release relinquishes a lease by unicasting a DHCPRELEASE to the server
+// which granted it. The server does not reply.
+func (c *Client) Release(l *Lease) error {
+	release := c.newMessage(Release)
+	release.ClientIP = l.IP
+	release.Options.AddIPs(OptionServerIdentifier, l.ServerID)
+
+	dst := endpoint{
+		hw:   l.ServerHardwareAddr,
+		ip:   l.ServerID,
+		port: ServerPort,
+	}
+	if dst.hw == nil {
+		dst.hw = ethernet.Broadcast
+	}
+
+	return c.send(release, c.local(l.IP), dst)
+}
+
+// Decline informs the server which granted a lease that its address is
+// already in use, such as after a failed ARP probe. The server does not
+// reply.
+func (c *Client) Decline(l *Lease) error {
+	decline := c.newMessage(Decline)
+	decline.Options.AddIPs(OptionRequestedIPAddress, l.IP)
+	decline.Options.AddIPs(OptionServerIdentifier, l.ServerID)
+
+	return c.send(decline, c.local(nil), broadcast())
+}
+
+// request sends a DHCPREQUEST and processes the resulting DHCPACK or
+// DHCPNAK.
+func (c *Client) request(ctx context.Context, m *Message, src, dst endpoint) (*Lease, error) {
+	p, err := c.exchange(ctx, m, src, dst, func(p *packet) bool {
+		t := p.m.Type()
+		return t == ACK || t == NAK
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if p.m.Type() == NAK {
+		return nil, ErrNAK
+	}
+
+	return newLease(p, time.Now()), nil
+}
+
+// exchange sends m and waits for a matching reply, retransmitting m with
+// exponential backoff until a reply arrives or the maximum number of
+// attempts is reached.
+func (c *Client) exchange(ctx context.Context, m *Message, src, dst endpoint, match func(p *packet) bool) (*packet, error) {
+	defer frame.CancelReads(ctx, c.p)()
+
+	start := time.Now()
+	delay := c.cfg.Retransmit
+
+	for i := 0; i < c.cfg.MaxAttempts; i++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		m.Secs = uint16(time.Since(start) / time.Second)
+		if err := c.send(m, src, dst); err != nil {
+			return nil, err
+		}
+
+		if err := c.p.SetReadDeadline(time.Now().Add(jitter(delay))); err != nil {
+			return nil, err
+		}
+
+		// The deadline may have replaced the one set when ctx was canceled.
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		p, err := c.wait(m, match)
+		switch {
+		case err == nil:
+			return p, nil
+		case ctx.Err() != nil:
+			return nil, ctx.Err()
+		case frame.IsTimeout(err):
+			// Try again with a longer delay.
+			delay *= 2
+			if delay > maxRetransmit {
+				delay = maxRetransmit
+			}
+		default:
+			return nil, err
+		}
+	}
+
+	return nil, errNoResponse
+}
+
+// wait reads replies until one matches the transaction of m and the match
+// function, or the read deadline is exceeded.
+func (c *Client) wait(m *Message, match func(p *packet) bool) (*packet, error) {
+	b := make([]byte, frame.BufferSize(c.ifi))
+	for {
+		n, _, err := c.p.ReadFrom(b)
+		if err != nil {
+			return nil, err
+		}
+
+		p, err := parseFrame(b[:n], ClientPort)
+		if err != nil {
+			continue
+		}
+
+		ok := p.m.Operation == BootReply &&
+			p.m.TransactionID == m.TransactionID &&
+			bytes.Equal(p.m.ClientHardwareAddr, c.ifi.HardwareAddr) &&
+			match(p)
+		if ok {
+			return p, nil
+		}
+	}
+}
+
+// send sends m from src to dst.
+func (c *Client) send(m *Message, src, dst endpoint) error {
+	b, err := marshalFrame(src, dst, nil, m)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.p.WriteTo(b, &raw.Addr{HardwareAddr: dst.hw})
+	return err
+}
+
+// newMessage creates a Message of the specified type with a new transaction
+// ID and the options configured for the Client.
+func (c *Client) newMessage(t MessageType) *Message {
+	m := &Message{
+		Operation:          BootRequest,
+		TransactionID:      transactionID(),
+		Broadcast:          c.cfg.Broadcast,
+		ClientHardwareAddr: c.ifi.HardwareAddr,
+	}
+
+	m.Options.Add(OptionMessageType, []byte{uint8(t)})
+	if len(c.cfg.ClientID) > 0 {
+		m.Options.Add(OptionClientIdentifier, c.cfg.ClientID)
+	}
+
+	// Releases and declines carry no configuration requests.
+	if t == Release || t == Decline {
+		return m
+	}
+
+	if c.cfg.Hostname != "" {
+		m.Options.Add(OptionHostName, []byte(c.cfg.Hostname))
+	}
+
+	prl := make([]byte, 0, len(c.cfg.RequestedOptions))
+	for _, o := range c.cfg.RequestedOptions {
+		prl = append(prl, uint8(o))
+	}
+	m.Options.Add(OptionParameterRequestList, prl)
+
+	if mtu := c.ifi.MTU; mtu >= 576 && mtu <= 0xffff {
+		b := make([]byte, 2)
+		binary.BigEndian.PutUint16(b, uint16(mtu))
+		m.Options.Add(OptionMaximumMessageSize, b)
+	}
+
+	return m
+}
+
+// local returns the Client's endpoint using the source address ip, or the
+// unspecified address if ip is nil.
+func (c *Client) local(ip net.IP) endpoint {
+	if ip == nil {
+		ip = net.IPv4zero
+	}
+
+	return endpoint{
+		hw:   c.ifi.HardwareAddr,
+		ip:   ip,
+		port: ClientPort,
+	}
+}
+
+// broadcast returns the endpoint used to reach all servers.
+func broadcast() endpoint {
+	return endpoint{
+		hw:   ethernet.Broadcast,
+		ip:   net.IPv4bcast,
+		port: ServerPort,
+	}
+}
+
+// newLease creates a Lease from a DHCPACK packet received at now.
+func newLease(p *packet, now time.Time) *Lease {
+	o := p.m.Options
+
+	l := &Lease{
+		IP:                 p.m.YourIP,
+		ServerHardwareAddr: p.src.hw,
+		Acquired:           now,
+		ACK:                p.m,
+	}
+
+	l.ServerID, _ = o.IP(OptionServerIdentifier)
+	if l.ServerID == nil {
+		l.ServerID = p.src.ip
+	}
+
+	if mask, ok := o.Get(OptionSubnetMask); ok && len(mask) == net.IPv4len {
+		l.SubnetMask = net.IPMask(mask)
+	}
+	l.Routers, _ = o.IPs(OptionRouter)
+	l.DNSServers, _ = o.IPs(OptionDomainNameServer)
+
+	l.Duration, _ = o.Duration(OptionIPAddressLeaseTime)
+	l.RenewalTime, _ = o.Duration(OptionRenewalTimeValue)
+	l.RebindingTime, _ = o.Duration(OptionRebindingTimeValue)
+
+	// Default T1 and T2 values from RFC 2131, section 4.4.5.
+	if l.RenewalTime == 0 {
+		l.RenewalTime = l.Duration / 2
+	}
+	if l.RebindingTime == 0 {
+		l.RebindingTime = l.Duration * 7 / 8
+	}
+
+	return l
+}
+
+// transactionID returns a random transaction ID.
+func transactionID() uint32 {
+	var b [4]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		// Fall back to a time-based value; uniqueness is all that matters.
+		return uint32(time.Now().UnixNano())
+	}
+
+	return binary.BigEndian.Uint32(b[:])
+}
+
+// jitter randomizes d by up to one quarter in either direction, so that
+// clients do not retransmit in lockstep.
+func jitter(d time.Duration) time.Duration {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return d
+	}
+
+	q := int64(d / 4)
+	if q <= 0 {
+		return d
+	}
+
+	r := int64(binary.BigEndian.Uint64(b[:]) % uint64(2*q))
+	return d - time.Duration(q) + time.Duration(r)
+}
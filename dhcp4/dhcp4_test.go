@@ -0,0 +1,581 @@
+package dhcp4
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/raw/ethernet"
+	"github.com/mdlayher/raw/internal/rawtest"
+	"golang.org/x/net/bpf"
+)
+
+var (
+	clientMAC = net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad}
+	serverMAC = net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+
+	serverIP = net.IPv4(192, 0, 2, 1).To4()
+	leaseIP  = net.IPv4(192, 0, 2, 100).To4()
+)
+
+func TestMessageMarshalUnmarshal(t *testing.T) {
+	m := &Message{
+		Operation:          BootReply,
+		Hops:               1,
+		TransactionID:      0xdeadbeef,
+		Secs:               3,
+		Broadcast:          true,
+		ClientIP:           net.IPv4zero.To4(),
+		YourIP:             leaseIP,
+		ServerIP:           serverIP,
+		GatewayIP:          net.IPv4(192, 0, 2, 254).To4(),
+		ClientHardwareAddr: clientMAC,
+		ServerName:         "server",
+		BootFile:           "pxelinux.0",
+		Options: Options{
+			{Code: OptionMessageType, Data: []byte{uint8(Offer)}},
+			{Code: OptionSubnetMask, Data: []byte{255, 255, 255, 0}},
+		},
+	}
+
+	b, err := m.MarshalBinary()
+	if err != nil {
+		t.Fatalf("failed to marshal: %v", err)
+	}
+
+	if diff := cmp.Diff(minMessageLen, len(b)); diff != "" {
+		t.Fatalf("unexpected message length (-want +got):\n%s", diff)
+	}
+
+	var got Message
+	if err := got.UnmarshalBinary(b); err != nil {
+		t.Fatalf("failed to unmarshal: %v", err)
+	}
+
+	if diff := cmp.Diff(m, &got); diff != "" {
+		t.Fatalf("unexpected message (-want +got):\n%s", diff)
+	}
+}
+
+func TestParseOptions(t *testing.T) {
+	b := []byte{
+		// Pad.
+		0,
+		// Split domain name server option, concatenated per RFC 3396.
+		6, 4, 192, 0, 2, 1,
+		53, 1, 5,
+		6, 4, 192, 0, 2, 2,
+		// End, followed by ignored padding.
+		255, 0, 0,
+	}
+
+	o, err := parseOptions(b)
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+
+	ips, ok := o.IPs(OptionDomainNameServer)
+	if !ok {
+		t.Fatal("domain name server option not found")
+	}
+
+	want := []net.IP{serverIP, net.IPv4(192, 0, 2, 2).To4()}
+	if diff := cmp.Diff(want, ips); diff != "" {
+		t.Fatalf("unexpected addresses (-want +got):\n%s", diff)
+	}
+
+	if _, err := parseOptions([]byte{6, 4, 192}); err == nil {
+		t.Fatal("expected truncated option error, but none occurred")
+	}
+}
+
+func TestPortFilter(t *testing.T) {
+	vm, err := bpf.NewVM(portFilter(ClientPort))
+	if err != nil {
+		t.Fatalf("failed to create VM: %v", err)
+	}
+
+	m := &Message{
+		Operation:          BootReply,
+		ClientHardwareAddr: clientMAC,
+	}
+
+	tests := []struct {
+		name string
+		port uint16
+		ok   bool
+	}{
+		{
+			name: "client port",
+			port: ClientPort,
+			ok:   true,
+		},
+		{
+			name: "server port",
+			port: ServerPort,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := marshalFrame(
+				endpoint{hw: serverMAC, ip: serverIP, port: ServerPort},
+				endpoint{hw: clientMAC, ip: leaseIP, port: tt.port},
+				nil, m,
+			)
+			if err != nil {
+				t.Fatalf("failed to marshal frame: %v", err)
+			}
+
+			n, err := vm.Run(b)
+			if err != nil {
+				t.Fatalf("failed to run filter: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.ok, n > 0); diff != "" {
+				t.Fatalf("unexpected filter result (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestNewInvalidConfig(t *testing.T) {
+	ifi := &net.Interface{MTU: 1500, HardwareAddr: clientMAC}
+
+	for _, cfg := range []*Config{
+		{Retransmit: -time.Second},
+		{MaxAttempts: -1},
+	} {
+		if _, err := New(ifi, rawtest.NewHub().Conn(clientMAC), cfg); err == nil {
+			t.Fatalf("expected an error for %+v, but none occurred", cfg)
+		}
+	}
+}
+
+func TestClientAcquireRenewRelease(t *testing.T) {
+	c, server := testClient(t)
+
+	go serve(t, server, ACK)
+
+	l, err := c.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("failed to acquire lease: %v", err)
+	}
+
+	want := &Lease{
+		IP:                 leaseIP,
+		ServerID:           serverIP,
+		ServerHardwareAddr: serverMAC,
+		SubnetMask:         net.IPv4Mask(255, 255, 255, 0),
+		Routers:            []net.IP{serverIP},
+		Duration:           time.Hour,
+		RenewalTime:        30 * time.Minute,
+		RebindingTime:      time.Hour * 7 / 8,
+	}
+
+	ignore := cmp.FilterPath(func(p cmp.Path) bool {
+		s := p.String()
+		return s == "Acquired" || s == "ACK"
+	}, cmp.Ignore())
+	if diff := cmp.Diff(want, l, ignore); diff != "" {
+		t.Fatalf("unexpected lease (-want +got):\n%s", diff)
+	}
+
+	renewed, err := c.Renew(context.Background(), l)
+	if err != nil {
+		t.Fatalf("failed to renew lease: %v", err)
+	}
+	if !renewed.IP.Equal(leaseIP) {
+		t.Fatalf("unexpected renewed address: %s", renewed.IP)
+	}
+
+	if err := c.Release(renewed); err != nil {
+		t.Fatalf("failed to release lease: %v", err)
+	}
+
+	// The renewal and release must have been unicast to the server.
+	frames := c.p.(*rawtest.Conn).Written()
+	for _, b := range frames[len(frames)-2:] {
+		p, err := parseFrame(b, ServerPort)
+		if err != nil {
+			t.Fatalf("failed to parse frame: %v", err)
+		}
+
+		if !p.dst.ip.Equal(serverIP) || p.dst.hw.String() != serverMAC.String() {
+			t.Fatalf("%s was not unicast to server: %s/%s", p.m.Type(), p.dst.ip, p.dst.hw)
+		}
+		if !p.src.ip.Equal(leaseIP) || !p.m.ClientIP.Equal(leaseIP) {
+			t.Fatalf("%s did not use leased address: %s/%s", p.m.Type(), p.src.ip, p.m.ClientIP)
+		}
+	}
+}
+
+func TestClientAcquireNAK(t *testing.T) {
+	c, server := testClient(t)
+
+	go serve(t, server, NAK)
+
+	if _, err := c.Acquire(context.Background()); !errors.Is(err, ErrNAK) {
+		t.Fatalf("expected ErrNAK, but got: %v", err)
+	}
+}
+
+func TestClientAcquireNoResponse(t *testing.T) {
+	c, _ := testClient(t)
+
+	if _, err := c.Acquire(context.Background()); !errors.Is(err, errNoResponse) {
+		t.Fatalf("expected no response error, but got: %v", err)
+	}
+}
+
+func TestClientAcquireContextCanceled(t *testing.T) {
+	c, _ := testClient(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := c.Acquire(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context canceled, but got: %v", err)
+	}
+}
+
+func TestClientAcquireCanceledDuringWrite(t *testing.T) {
+	conn := rawtest.NewHub().Conn(clientMAC)
+	c, err := New(
+		&net.Interface{MTU: 1500, HardwareAddr: clientMAC},
+		conn,
+		&Config{Retransmit: time.Hour},
+	)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	defer c.Close()
+
+	// Cancel while the discover is written, and give the cancellation time
+	// to expire the deadline before Acquire sets its own.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	conn.OnWrite(func() {
+		cancel()
+		time.Sleep(10 * time.Millisecond)
+	})
+
+	errC := make(chan error, 1)
+	go func() {
+		_, err := c.Acquire(ctx)
+		errC <- err
+	}()
+
+	select {
+	case err := <-errC:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected context canceled, but got: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Acquire did not return after cancellation")
+	}
+}
+
+// testClient creates a Client and a server Conn on the same in-memory
+// segment.
+func testClient(t *testing.T) (*Client, *rawtest.Conn) {
+	t.Helper()
+
+	hub := rawtest.NewHub()
+	server := hub.Conn(serverMAC)
+
+	c, err := New(
+		&net.Interface{MTU: 1500, HardwareAddr: clientMAC},
+		hub.Conn(clientMAC),
+		&Config{
+			Retransmit:  20 * time.Millisecond,
+			MaxAttempts: 2,
+		},
+	)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	t.Cleanup(func() {
+		c.Close()
+		server.Close()
+	})
+
+	return c, server
+}
+
+// serve answers client requests on conn with offers, and answers requests
+// with the specified reply type, until conn is closed.
+func serve(t *testing.T, conn *rawtest.Conn, reply MessageType) {
+	b := make([]byte, 1514)
+	for {
+		n, _, err := conn.ReadFrom(b)
+		if err != nil {
+			return
+		}
+
+		p, err := parseFrame(b[:n], ServerPort)
+		if err != nil {
+			t.Errorf("failed to parse frame: %v", err)
+			return
+		}
+
+		var typ MessageType
+		switch p.m.Type() {
+		case Discover:
+			typ = Offer
+		case Request:
+			typ = reply
+		default:
+			continue
+		}
+
+		m := &Message{
+			Operation:          BootReply,
+			TransactionID:      p.m.TransactionID,
+			YourIP:             leaseIP,
+			ClientHardwareAddr: p.m.ClientHardwareAddr,
+		}
+		m.Options.Add(OptionMessageType, []byte{uint8(typ)})
+		m.Options.AddIPs(OptionServerIdentifier, serverIP)
+		m.Options.Add(OptionSubnetMask, net.IPv4Mask(255, 255, 255, 0))
+		m.Options.AddIPs(OptionRouter, serverIP)
+		m.Options.AddDuration(OptionIPAddressLeaseTime, time.Hour)
+
+		fb, err := marshalFrame(
+			endpoint{hw: serverMAC, ip: serverIP, port: ServerPort},
+			endpoint{hw: ethernet.Broadcast, ip: net.IPv4bcast, port: ClientPort},
+			nil, m,
+		)
+		if err != nil {
+			t.Errorf("failed to marshal frame: %v", err)
+			return
+		}
+
+		if _, err := conn.WriteTo(fb, nil); err != nil {
+			t.Errorf("failed to write frame: %v", err)
+			return
+		}
+	}
+}
+
+func TestServerAcquireRenewRelease(t *testing.T) {
+	hub := rawtest.NewHub()
+	s := testServer(t, hub)
+
+	c1 := testHubClient(t, hub, clientMAC)
+	c2 := testHubClient(t, hub, net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0x00, 0x02})
+
+	l1, err := c1.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("failed to acquire first lease: %v", err)
+	}
+	l2, err := c2.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("failed to acquire second lease: %v", err)
+	}
+
+	want := []net.IP{leaseIP, net.IPv4(192, 0, 2, 101).To4()}
+	if diff := cmp.Diff(want, []net.IP{l1.IP, l2.IP}); diff != "" {
+		t.Fatalf("unexpected leased addresses (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(net.IPv4Mask(255, 255, 255, 0), l1.SubnetMask); diff != "" {
+		t.Fatalf("unexpected subnet mask (-want +got):\n%s", diff)
+	}
+
+	// Without the broadcast flag, every reply must be unicast to the client's
+	// hardware address and leased IP address.
+	for _, b := range s.p.(*rawtest.Conn).Written() {
+		p, err := parseFrame(b, ClientPort)
+		if err != nil {
+			t.Fatalf("failed to parse frame: %v", err)
+		}
+
+		if p.dst.hw.String() != p.m.ClientHardwareAddr.String() || !p.dst.ip.Equal(p.m.YourIP) {
+			t.Fatalf("%s was not unicast to client: %s/%s", p.m.Type(), p.dst.ip, p.dst.hw)
+		}
+	}
+
+	// A client which acquires again keeps its address.
+	again, err := c1.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("failed to reacquire lease: %v", err)
+	}
+	if !again.IP.Equal(l1.IP) {
+		t.Fatalf("unexpected reacquired address: %s", again.IP)
+	}
+
+	if _, err := c1.Renew(context.Background(), again); err != nil {
+		t.Fatalf("failed to renew lease: %v", err)
+	}
+
+	if err := c1.Release(again); err != nil {
+		t.Fatalf("failed to release lease: %v", err)
+	}
+
+	// Wait for the server to process the release.
+	var leases []ServerLease
+	for i := 0; i < 100; i++ {
+		if leases = s.Leases(); len(leases) == 1 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if len(leases) != 1 || !leases[0].IP.Equal(l2.IP) {
+		t.Fatalf("unexpected leases after release: %v", leases)
+	}
+}
+
+func TestServerHandleRequest(t *testing.T) {
+	s := testServer(t, rawtest.NewHub())
+
+	request := func(ciaddr, requested, serverID net.IP) *Message {
+		m := &Message{
+			Operation:          BootRequest,
+			ClientIP:           ciaddr,
+			ClientHardwareAddr: clientMAC,
+		}
+		m.Options.Add(OptionMessageType, []byte{uint8(Request)})
+		if requested != nil {
+			m.Options.AddIPs(OptionRequestedIPAddress, requested)
+		}
+		if serverID != nil {
+			m.Options.AddIPs(OptionServerIdentifier, serverID)
+		}
+		return m
+	}
+
+	tests := []struct {
+		name string
+		m    *Message
+		want MessageType
+	}{
+		{
+			name: "init-reboot outside pool",
+			m:    request(nil, net.IPv4(198, 51, 100, 1), nil),
+			want: NAK,
+		},
+		{
+			name: "init-reboot unknown client",
+			m:    request(nil, leaseIP, nil),
+		},
+		{
+			name: "selecting without offer",
+			m:    request(nil, leaseIP, serverIP),
+			want: NAK,
+		},
+		{
+			name: "selecting other server",
+			m:    request(nil, leaseIP, net.IPv4(192, 0, 2, 2)),
+		},
+		{
+			name: "renewing unknown lease",
+			m:    request(leaseIP, nil, nil),
+			want: NAK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got MessageType
+			if r := s.handle(tt.m); r != nil {
+				got = r.Type()
+			}
+
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Fatalf("unexpected reply type (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestServerDecline(t *testing.T) {
+	s := testServer(t, rawtest.NewHub())
+
+	discover := &Message{
+		Operation:          BootRequest,
+		ClientHardwareAddr: clientMAC,
+	}
+	discover.Options.Add(OptionMessageType, []byte{uint8(Discover)})
+
+	offer := s.handle(discover)
+	if offer == nil || !offer.YourIP.Equal(leaseIP) {
+		t.Fatalf("unexpected offer: %+v", offer)
+	}
+
+	decline := &Message{
+		Operation:          BootRequest,
+		ClientHardwareAddr: clientMAC,
+	}
+	decline.Options.Add(OptionMessageType, []byte{uint8(Decline)})
+	decline.Options.AddIPs(OptionRequestedIPAddress, leaseIP)
+	s.handle(decline)
+
+	// The declined address must not be offered again.
+	offer = s.handle(discover)
+	if offer == nil || offer.YourIP.Equal(leaseIP) {
+		t.Fatalf("unexpected offer after decline: %+v", offer)
+	}
+}
+
+// testServer creates a Server on hub which leases a small pool and serves
+// until the test completes.
+func testServer(t *testing.T, hub *rawtest.Hub) *Server {
+	t.Helper()
+
+	s, err := NewServer(
+		&net.Interface{MTU: 1500, HardwareAddr: serverMAC},
+		hub.Conn(serverMAC),
+		ServerConfig{
+			ServerIP:   serverIP,
+			PoolStart:  leaseIP,
+			PoolEnd:    net.IPv4(192, 0, 2, 110),
+			SubnetMask: net.IPv4Mask(255, 255, 255, 0),
+			Routers:    []net.IP{serverIP},
+		},
+	)
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- s.Serve(ctx) }()
+
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("failed to serve: %v", err)
+		}
+		s.Close()
+
+		// Serve clears the read deadline when it returns, so the connection
+		// reports that it is closed rather than timing out.
+		if _, _, err := s.p.ReadFrom(make([]byte, 1)); !errors.Is(err, net.ErrClosed) {
+			t.Errorf("expected net.ErrClosed after serving, but got: %v", err)
+		}
+	})
+
+	return s
+}
+
+// testHubClient creates a Client with the specified hardware address on hub.
+func testHubClient(t *testing.T, hub *rawtest.Hub, mac net.HardwareAddr) *Client {
+	t.Helper()
+
+	c, err := New(
+		&net.Interface{MTU: 1500, HardwareAddr: mac},
+		hub.Conn(mac),
+		&Config{Retransmit: 50 * time.Millisecond},
+	)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+
+	return c
+}
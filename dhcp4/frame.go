@@ -0,0 +1,167 @@
+package dhcp4
+
+import (
+	"errors"
+	"math"
+	"net"
+
+	"github.com/mdlayher/raw"
+	"github.com/mdlayher/raw/ethernet"
+	"github.com/mdlayher/raw/inet"
+	"golang.org/x/net/bpf"
+)
+
+// UDP ports used by DHCPv4 clients and servers.
+const (
+	ClientPort = 68
+	ServerPort = 67
+)
+
+// ttl is the IPv4 time to live used for all outgoing packets.
+const ttl = 64
+
+// errNotDHCP is returned when a frame does not carry a DHCP message for the
+// expected port.
+var errNotDHCP = errors.New("dhcp4: not a DHCP message")
+
+// An endpoint is the link and network layer address of one side of a DHCP
+// exchange.
+type endpoint struct {
+	hw   net.HardwareAddr
+	ip   net.IP
+	port uint16
+}
+
+// A packet is a received Message along with its addressing information.
+type packet struct {
+	m        *Message
+	src, dst endpoint
+	vlan     *ethernet.VLAN
+}
+
+// listen opens a *raw.Conn on ifi which receives IPv4 UDP datagrams
+// addressed to port.
+func listen(ifi *net.Interface, port uint16) (net.PacketConn, error) {
+	filter, err := bpf.Assemble(portFilter(port))
+	if err != nil {
+		return nil, err
+	}
+
+	return raw.ListenPacket(ifi, uint16(ethernet.EtherTypeIPv4), &raw.Config{
+		Filter: filter,
+	})
+}
+
+// portFilter returns a BPF filter which accepts unfragmented IPv4 UDP
+// datagrams addressed to port.
+func portFilter(port uint16) []bpf.Instruction {
+	const (
+		ethLen     = 14
+		protoOff   = ethLen + 9
+		fragOff    = ethLen + 6
+		dstPortOff = ethLen + 2
+	)
+
+	return []bpf.Instruction{
+		// The IPv4 protocol must be UDP.
+		bpf.LoadAbsolute{Off: protoOff, Size: 1},
+		bpf.JumpIf{Cond: bpf.JumpNotEqual, Val: uint32(inet.ProtocolUDP), SkipTrue: 6},
+		// Only the first fragment carries the UDP header.
+		bpf.LoadAbsolute{Off: fragOff, Size: 2},
+		bpf.JumpIf{Cond: bpf.JumpBitsSet, Val: 0x1fff, SkipTrue: 4},
+		// Skip the variable length IPv4 header and check the destination port.
+		bpf.LoadMemShift{Off: ethLen},
+		bpf.LoadIndirect{Off: dstPortOff, Size: 2},
+		bpf.JumpIf{Cond: bpf.JumpNotEqual, Val: uint32(port), SkipTrue: 1},
+		bpf.RetConstant{Val: math.MaxUint16},
+		bpf.RetConstant{Val: 0},
+	}
+}
+
+// marshalFrame marshals m into an Ethernet frame carrying an IPv4 UDP
+// datagram from src to dst.
+func marshalFrame(src, dst endpoint, vlan *ethernet.VLAN, m *Message) ([]byte, error) {
+	mb, err := m.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	ub, err := (&inet.UDPHeader{
+		SourcePort:      src.port,
+		DestinationPort: dst.port,
+	}).Marshal(mb, src.ip, dst.ip)
+	if err != nil {
+		return nil, err
+	}
+
+	ipb, err := (&inet.IPv4Header{
+		TTL:         ttl,
+		Protocol:    inet.ProtocolUDP,
+		Source:      src.ip,
+		Destination: dst.ip,
+	}).Marshal(ub)
+	if err != nil {
+		return nil, err
+	}
+
+	return (&ethernet.Frame{
+		Destination: dst.hw,
+		Source:      src.hw,
+		VLAN:        vlan,
+		EtherType:   ethernet.EtherTypeIPv4,
+		Payload:     ipb,
+	}).MarshalBinary()
+}
+
+// parseFrame parses a DHCP message addressed to port from an Ethernet frame.
+func parseFrame(b []byte, port uint16) (*packet, error) {
+	var f ethernet.Frame
+	if err := f.UnmarshalBinary(b); err != nil {
+		return nil, err
+	}
+	if f.EtherType != ethernet.EtherTypeIPv4 {
+		return nil, errNotDHCP
+	}
+
+	iph, ipp, err := inet.ParseIPv4(f.Payload)
+	if err != nil {
+		return nil, err
+	}
+	if iph.Protocol != inet.ProtocolUDP || iph.FragmentOffset != 0 || iph.Flags&inet.MoreFragments != 0 {
+		return nil, errNotDHCP
+	}
+
+	uh, up, err := inet.ParseUDP(ipp, iph.Source, iph.Destination)
+	if err != nil {
+		return nil, err
+	}
+	if uh.DestinationPort != port {
+		return nil, errNotDHCP
+	}
+
+	m := new(Message)
+	if err := m.UnmarshalBinary(up); err != nil {
+		return nil, err
+	}
+
+	hw := func(b net.HardwareAddr) net.HardwareAddr {
+		out := make(net.HardwareAddr, len(b))
+		copy(out, b)
+		return out
+	}
+
+	return &packet{
+		m: m,
+		src: endpoint{
+			hw:   hw(f.Source),
+			ip:   iph.Source,
+			port: uh.SourcePort,
+		},
+		dst: endpoint{
+			hw:   hw(f.Destination),
+			ip:   iph.Destination,
+			port: uh.DestinationPort,
+		},
+		vlan: f.VLAN,
+	}, nil
+}
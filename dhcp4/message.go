@@ -0,0 +1,232 @@
+// Package dhcp4 implements DHCPv4, as described in RFC 2131, on top of a
+// *raw.Conn. Because messages are sent and received as complete Ethernet
+// frames, the Client can obtain a lease on an interface which has no IPv4
+// address configured and before the kernel IP stack is usable on it.
+package dhcp4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+)
+
+var (
+	// errInvalidMessage is returned when a Message is malformed.
+	errInvalidMessage = errors.New("dhcp4: invalid message")
+
+	// magicCookie is the value which precedes the options in a Message.
+	magicCookie = [4]byte{99, 130, 83, 99}
+)
+
+const (
+	// headerLen is the length of the fixed fields of a Message, including the
+	// magic cookie.
+	headerLen = 240
+
+	// minMessageLen is the minimum length of a BOOTP message. Shorter
+	// messages are padded, because some servers and relays reject them.
+	minMessageLen = 300
+
+	// flagBroadcast is the broadcast bit of the flags field.
+	flagBroadcast = 0x8000
+
+	// hardwareTypeEthernet is the BOOTP hardware type for Ethernet.
+	hardwareTypeEthernet = 1
+)
+
+// An OpCode is a BOOTP message operation code.
+type OpCode uint8
+
+// OpCode values for BOOTP requests and replies.
+const (
+	BootRequest OpCode = 1
+	BootReply   OpCode = 2
+)
+
+// A MessageType is a DHCP message type, carried in the DHCP Message Type
+// option.
+type MessageType uint8
+
+// MessageType values from RFC 2132, section 9.6.
+const (
+	Discover MessageType = 1
+	Offer    MessageType = 2
+	Request  MessageType = 3
+	Decline  MessageType = 4
+	ACK      MessageType = 5
+	NAK      MessageType = 6
+	Release  MessageType = 7
+	Inform   MessageType = 8
+)
+
+// String returns the name of a MessageType.
+func (t MessageType) String() string {
+	switch t {
+	case Discover:
+		return "DHCPDISCOVER"
+	case Offer:
+		return "DHCPOFFER"
+	case Request:
+		return "DHCPREQUEST"
+	case Decline:
+		return "DHCPDECLINE"
+	case ACK:
+		return "DHCPACK"
+	case NAK:
+		return "DHCPNAK"
+	case Release:
+		return "DHCPRELEASE"
+	case Inform:
+		return "DHCPINFORM"
+	default:
+		return fmt.Sprintf("unknown(%d)", uint8(t))
+	}
+}
+
+// A Message is a DHCPv4 message, as described in RFC 2131, section 2.
+type Message struct {
+	Operation     OpCode
+	Hops          uint8
+	TransactionID uint32
+	Secs          uint16
+	Broadcast     bool
+
+	ClientIP  net.IP
+	YourIP    net.IP
+	ServerIP  net.IP
+	GatewayIP net.IP
+
+	// ClientHardwareAddr must be an Ethernet hardware address.
+	ClientHardwareAddr net.HardwareAddr
+
+	ServerName string
+	BootFile   string
+
+	Options Options
+}
+
+// Type returns the value of the DHCP Message Type option, or zero if the
+// option is not present.
+func (m *Message) Type() MessageType {
+	b, ok := m.Options.Get(OptionMessageType)
+	if !ok || len(b) != 1 {
+		return 0
+	}
+
+	return MessageType(b[0])
+}
+
+// MarshalBinary allocates a byte slice containing the data from a Message.
+func (m *Message) MarshalBinary() ([]byte, error) {
+	if len(m.ClientHardwareAddr) != 6 {
+		return nil, fmt.Errorf("dhcp4: invalid client hardware address: %q", m.ClientHardwareAddr)
+	}
+	if len(m.ServerName) > 63 || len(m.BootFile) > 127 {
+		return nil, errInvalidMessage
+	}
+
+	ob, err := m.Options.marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	n := headerLen + len(ob)
+	if n < minMessageLen {
+		n = minMessageLen
+	}
+
+	b := make([]byte, n)
+	b[0] = uint8(m.Operation)
+	b[1] = hardwareTypeEthernet
+	b[2] = uint8(len(m.ClientHardwareAddr))
+	b[3] = m.Hops
+	binary.BigEndian.PutUint32(b[4:8], m.TransactionID)
+	binary.BigEndian.PutUint16(b[8:10], m.Secs)
+	if m.Broadcast {
+		binary.BigEndian.PutUint16(b[10:12], flagBroadcast)
+	}
+
+	addrs := []net.IP{m.ClientIP, m.YourIP, m.ServerIP, m.GatewayIP}
+	for i, ip := range addrs {
+		if ip == nil {
+			continue
+		}
+
+		ip4 := ip.To4()
+		if ip4 == nil {
+			return nil, fmt.Errorf("dhcp4: invalid IPv4 address: %s", ip)
+		}
+		copy(b[12+4*i:16+4*i], ip4)
+	}
+
+	copy(b[28:44], m.ClientHardwareAddr)
+	copy(b[44:108], m.ServerName)
+	copy(b[108:236], m.BootFile)
+	copy(b[236:240], magicCookie[:])
+	copy(b[headerLen:], ob)
+
+	return b, nil
+}
+
+// UnmarshalBinary unmarshals a raw byte slice into a Message.
+func (m *Message) UnmarshalBinary(b []byte) error {
+	if len(b) < headerLen {
+		return io.ErrUnexpectedEOF
+	}
+
+	if b[1] != hardwareTypeEthernet || b[2] != 6 {
+		return fmt.Errorf("dhcp4: unsupported hardware type %d with length %d", b[1], b[2])
+	}
+	if !bytes.Equal(b[236:240], magicCookie[:]) {
+		return errInvalidMessage
+	}
+
+	opts, err := parseOptions(b[headerLen:])
+	if err != nil {
+		return err
+	}
+
+	ip := func(i int) net.IP {
+		return copyIP(b[12+4*i : 16+4*i])
+	}
+
+	chaddr := make(net.HardwareAddr, 6)
+	copy(chaddr, b[28:34])
+
+	*m = Message{
+		Operation:          OpCode(b[0]),
+		Hops:               b[3],
+		TransactionID:      binary.BigEndian.Uint32(b[4:8]),
+		Secs:               binary.BigEndian.Uint16(b[8:10]),
+		Broadcast:          binary.BigEndian.Uint16(b[10:12])&flagBroadcast != 0,
+		ClientIP:           ip(0),
+		YourIP:             ip(1),
+		ServerIP:           ip(2),
+		GatewayIP:          ip(3),
+		ClientHardwareAddr: chaddr,
+		ServerName:         cString(b[44:108]),
+		BootFile:           cString(b[108:236]),
+		Options:            opts,
+	}
+
+	return nil
+}
+
+// cString returns the NUL-terminated string stored in b.
+func cString(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i != -1 {
+		b = b[:i]
+	}
+
+	return string(b)
+}
+
+// copyIP returns a copy of the IPv4 address in b.
+func copyIP(b []byte) net.IP {
+	ip := make(net.IP, net.IPv4len)
+	copy(ip, b)
+	return ip
+}
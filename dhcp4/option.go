@@ -0,0 +1,187 @@
+package dhcp4
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// An OptionCode is a DHCP option code, as described in RFC 2132.
+type OptionCode uint8
+
+// OptionCode values commonly used by clients and servers.
+const (
+	OptionPad                   OptionCode = 0
+	OptionSubnetMask            OptionCode = 1
+	OptionRouter                OptionCode = 3
+	OptionDomainNameServer      OptionCode = 6
+	OptionHostName              OptionCode = 12
+	OptionDomainName            OptionCode = 15
+	OptionBroadcastAddress      OptionCode = 28
+	OptionRequestedIPAddress    OptionCode = 50
+	OptionIPAddressLeaseTime    OptionCode = 51
+	OptionMessageType           OptionCode = 53
+	OptionServerIdentifier      OptionCode = 54
+	OptionParameterRequestList  OptionCode = 55
+	OptionMessage               OptionCode = 56
+	OptionMaximumMessageSize    OptionCode = 57
+	OptionRenewalTimeValue      OptionCode = 58
+	OptionRebindingTimeValue    OptionCode = 59
+	OptionVendorClassIdentifier OptionCode = 60
+	OptionClientIdentifier      OptionCode = 61
+	OptionTFTPServerName        OptionCode = 66
+	OptionBootfileName          OptionCode = 67
+	OptionEnd                   OptionCode = 255
+)
+
+// An Option is a single DHCP option.
+type Option struct {
+	Code OptionCode
+	Data []byte
+}
+
+// Options is an ordered list of DHCP options.
+type Options []Option
+
+// Get returns the data of the first option with the specified code.
+func (o Options) Get(code OptionCode) ([]byte, bool) {
+	for _, opt := range o {
+		if opt.Code == code {
+			return opt.Data, true
+		}
+	}
+
+	return nil, false
+}
+
+// Add appends an option with the specified code and data.
+func (o *Options) Add(code OptionCode, data []byte) {
+	*o = append(*o, Option{Code: code, Data: data})
+}
+
+// Set replaces the data of any option with the specified code, or appends
+// a new option if none exists.
+func (o *Options) Set(code OptionCode, data []byte) {
+	for i := range *o {
+		if (*o)[i].Code == code {
+			(*o)[i].Data = data
+			return
+		}
+	}
+
+	o.Add(code, data)
+}
+
+// IP returns the first IPv4 address stored in the option with the specified
+// code.
+func (o Options) IP(code OptionCode) (net.IP, bool) {
+	ips, ok := o.IPs(code)
+	if !ok {
+		return nil, false
+	}
+
+	return ips[0], true
+}
+
+// IPs returns the list of IPv4 addresses stored in the option with the
+// specified code.
+func (o Options) IPs(code OptionCode) ([]net.IP, bool) {
+	b, ok := o.Get(code)
+	if !ok || len(b) == 0 || len(b)%net.IPv4len != 0 {
+		return nil, false
+	}
+
+	ips := make([]net.IP, 0, len(b)/net.IPv4len)
+	for i := 0; i < len(b); i += net.IPv4len {
+		ips = append(ips, copyIP(b[i:i+net.IPv4len]))
+	}
+
+	return ips, true
+}
+
+// Duration returns the time value in seconds stored in the option with the
+// specified code.
+func (o Options) Duration(code OptionCode) (time.Duration, bool) {
+	b, ok := o.Get(code)
+	if !ok || len(b) != 4 {
+		return 0, false
+	}
+
+	return time.Duration(binary.BigEndian.Uint32(b)) * time.Second, true
+}
+
+// AddIPs appends an option containing a list of IPv4 addresses.
+func (o *Options) AddIPs(code OptionCode, ips ...net.IP) {
+	b := make([]byte, 0, net.IPv4len*len(ips))
+	for _, ip := range ips {
+		b = append(b, ip.To4()...)
+	}
+
+	o.Add(code, b)
+}
+
+// AddDuration appends an option containing a time value in seconds.
+func (o *Options) AddDuration(code OptionCode, d time.Duration) {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, uint32(d/time.Second))
+	o.Add(code, b)
+}
+
+// marshal produces the binary form of Options, terminated by an end option.
+func (o Options) marshal() ([]byte, error) {
+	var b []byte
+	for _, opt := range o {
+		if opt.Code == OptionPad || opt.Code == OptionEnd {
+			return nil, fmt.Errorf("dhcp4: option code %d may not be used directly", opt.Code)
+		}
+		if len(opt.Data) > 255 {
+			return nil, fmt.Errorf("dhcp4: option %d too long: %d bytes", opt.Code, len(opt.Data))
+		}
+
+		b = append(b, uint8(opt.Code), uint8(len(opt.Data)))
+		b = append(b, opt.Data...)
+	}
+
+	return append(b, uint8(OptionEnd)), nil
+}
+
+// parseOptions parses Options from b. Options which appear multiple times are
+// concatenated, as described in RFC 3396.
+func parseOptions(b []byte) (Options, error) {
+	var (
+		o     Options
+		index = make(map[OptionCode]int)
+	)
+
+	for len(b) > 0 {
+		code := OptionCode(b[0])
+		switch code {
+		case OptionPad:
+			b = b[1:]
+			continue
+		case OptionEnd:
+			return o, nil
+		}
+
+		if len(b) < 2 || len(b) < 2+int(b[1]) {
+			return nil, io.ErrUnexpectedEOF
+		}
+
+		data := make([]byte, b[1])
+		copy(data, b[2:2+int(b[1])])
+		b = b[2+int(b[1]):]
+
+		if i, ok := index[code]; ok {
+			o[i].Data = append(o[i].Data, data...)
+			continue
+		}
+
+		index[code] = len(o)
+		o = append(o, Option{Code: code, Data: data})
+	}
+
+	// Some implementations omit the end option.
+	return o, nil
+}
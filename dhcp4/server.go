@@ -0,0 +1,506 @@
+package dhcp4
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mdlayher/raw"
+	"github.com/mdlayher/raw/ethernet"
+	"github.com/mdlayher/raw/internal/frame"
+)
+
+const (
+	// defaultLeaseDuration is the lease time used when
+	// ServerConfig.LeaseDuration is zero.
+	defaultLeaseDuration = 1 * time.Hour
+
+	// offerHold is the time an offered address is reserved for a client
+	// before it may be offered to another client.
+	offerHold = 1 * time.Minute
+)
+
+// A ServerConfig specifies the address pool and configuration parameters
+// served by a Server.
+type ServerConfig struct {
+	// ServerIP is the address of the server, sent as the server identifier
+	// and used as the source address of replies. It is required, but need
+	// not be configured on the interface.
+	ServerIP net.IP
+
+	// PoolStart and PoolEnd specify the inclusive range of addresses
+	// leased to clients.
+	PoolStart, PoolEnd net.IP
+
+	// Configuration parameters sent to clients, if set.
+	SubnetMask net.IPMask
+	Routers    []net.IP
+	DNSServers []net.IP
+	DomainName string
+
+	// LeaseDuration is the lease time granted to clients. If zero, a default
+	// of one hour is used.
+	LeaseDuration time.Duration
+
+	// NextServer and BootFile are sent in the siaddr and file fields for
+	// network boot clients, if set.
+	NextServer net.IP
+	BootFile   string
+
+	// Options are additional options sent in every offer and
+	// acknowledgement.
+	Options Options
+}
+
+// A ServerLease is an address binding maintained by a Server.
+type ServerLease struct {
+	IP           net.IP
+	HardwareAddr net.HardwareAddr
+	Expires      time.Time
+}
+
+// A binding is the internal state of an address in the pool.
+type binding struct {
+	ip      uint32
+	key     string
+	hw      net.HardwareAddr
+	expires time.Time
+
+	// offered is true until the client requests the offered address.
+	offered bool
+
+	// declined is true if a client reported the address as in use.
+	declined bool
+}
+
+// A Server is a DHCPv4 server which serves leases from a pool of addresses,
+// sending and receiving messages as Ethernet frames. Because replies are
+// built at layer 2, they can be unicast directly to the hardware address of
+// a client which has no IPv4 address yet.
+type Server struct {
+	ifi *net.Interface
+	p   net.PacketConn
+	cfg ServerConfig
+
+	start, end uint32
+	serverIP   uint32
+
+	// now is the time source, replaced in tests.
+	now func() time.Time
+
+	mu       sync.Mutex
+	bindings map[uint32]*binding
+	byKey    map[string]*binding
+}
+
+// Listen creates a new Server using the specified network interface and
+// configuration. Listen opens a *raw.Conn which receives IPv4 UDP datagrams
+// addressed to the DHCP server port.
+func Listen(ifi *net.Interface, cfg ServerConfig) (*Server, error) {
+	p, err := listen(ifi, ServerPort)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := NewServer(ifi, p, cfg)
+	if err != nil {
+		_ = p.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// NewServer creates a new Server using the specified network interface,
+// net.PacketConn, and configuration. p must send and receive complete
+// Ethernet frames.
+func NewServer(ifi *net.Interface, p net.PacketConn, cfg ServerConfig) (*Server, error) {
+	if len(ifi.HardwareAddr) != 6 {
+		return nil, errors.New("dhcp4: interface must have an Ethernet hardware address")
+	}
+
+	sip, start, end := cfg.ServerIP.To4(), cfg.PoolStart.To4(), cfg.PoolEnd.To4()
+	if sip == nil || start == nil || end == nil {
+		return nil, errors.New("dhcp4: server address and pool must be IPv4 addresses")
+	}
+	if ipToUint32(start) > ipToUint32(end) {
+		return nil, errors.New("dhcp4: pool start must not be after pool end")
+	}
+
+	if cfg.LeaseDuration == 0 {
+		cfg.LeaseDuration = defaultLeaseDuration
+	}
+
+	return &Server{
+		ifi:      ifi,
+		p:        p,
+		cfg:      cfg,
+		start:    ipToUint32(start),
+		end:      ipToUint32(end),
+		serverIP: ipToUint32(sip),
+		now:      time.Now,
+		bindings: make(map[uint32]*binding),
+		byKey:    make(map[string]*binding),
+	}, nil
+}
+
+// Close closes the Server's connection.
+func (s *Server) Close() error {
+	return s.p.Close()
+}
+
+// Leases returns the active leases granted by the Server, ordered by IP
+// address. Outstanding offers and declined addresses are not included.
+func (s *Server) Leases() []ServerLease {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+
+	var out []ServerLease
+	for _, b := range s.bindings {
+		if b.offered || b.declined || !now.Before(b.expires) {
+			continue
+		}
+
+		out = append(out, ServerLease{
+			IP:           uint32ToIP(b.ip),
+			HardwareAddr: b.hw,
+			Expires:      b.expires,
+		})
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return ipToUint32(out[i].IP) < ipToUint32(out[j].IP)
+	})
+
+	return out
+}
+
+// Serve answers DHCP requests until ctx is canceled or an error occurs.
+// Serve returns nil when ctx is canceled.
+func (s *Server) Serve(ctx context.Context) error {
+	defer frame.CancelReads(ctx, s.p)()
+
+	b := make([]byte, frame.BufferSize(s.ifi))
+	for {
+		n, _, err := s.p.ReadFrom(b)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			return err
+		}
+
+		p, err := parseFrame(b[:n], ServerPort)
+		if err != nil || p.m.Operation != BootRequest {
+			continue
+		}
+
+		reply := s.handle(p.m)
+		if reply == nil {
+			continue
+		}
+
+		if err := s.send(p, reply); err != nil {
+			return err
+		}
+	}
+}
+
+// handle processes a client message and returns the reply, if any.
+func (s *Server) handle(m *Message) *Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := clientKey(m)
+
+	switch m.Type() {
+	case Discover:
+		b := s.allocate(key, m)
+		if b == nil {
+			// Pool exhausted.
+			return nil
+		}
+
+		return s.reply(m, Offer, uint32ToIP(b.ip))
+	case Request:
+		return s.handleRequest(key, m)
+	case Release:
+		if b, ok := s.byKey[key]; ok && b.ip == ipToUint32(m.ClientIP) {
+			s.remove(b)
+		}
+	case Decline:
+		s.decline(key, m)
+	case Inform:
+		return s.reply(m, ACK, nil)
+	}
+
+	return nil
+}
+
+// handleRequest processes a DHCPREQUEST in any client state.
+func (s *Server) handleRequest(key string, m *Message) *Message {
+	now := s.now()
+	b := s.byKey[key]
+
+	requested, hasRequested := m.Options.IP(OptionRequestedIPAddress)
+	serverID, hasServerID := m.Options.IP(OptionServerIdentifier)
+
+	switch {
+	case hasServerID:
+		// SELECTING: the client chose an offer.
+		if ipToUint32(serverID) != s.serverIP {
+			// Another server's offer was chosen, so release our reservation.
+			if b != nil && b.offered {
+				s.remove(b)
+			}
+			return nil
+		}
+
+		if !hasRequested || b == nil || b.ip != ipToUint32(requested) {
+			return s.reply(m, NAK, nil)
+		}
+	case hasRequested:
+		// INIT-REBOOT: the client is verifying a previously allocated address.
+		if !s.inPool(ipToUint32(requested)) {
+			return s.reply(m, NAK, nil)
+		}
+		if b == nil {
+			// No record of this client, so remain silent as RFC 2131 requires.
+			return nil
+		}
+		if b.ip != ipToUint32(requested) {
+			return s.reply(m, NAK, nil)
+		}
+	default:
+		// RENEWING or REBINDING: the client is extending its lease.
+		if b == nil || b.ip != ipToUint32(m.ClientIP) || !now.Before(b.expires) {
+			return s.reply(m, NAK, nil)
+		}
+	}
+
+	b.offered = false
+	b.expires = now.Add(s.cfg.LeaseDuration)
+
+	return s.reply(m, ACK, uint32ToIP(b.ip))
+}
+
+// allocate finds or creates a binding for a client, honoring its requested
+// address when possible. The caller must hold s.mu.
+func (s *Server) allocate(key string, m *Message) *binding {
+	now := s.now()
+	hold := func(b *binding) *binding {
+		if b.offered || !now.Before(b.expires) {
+			b.offered = true
+			b.expires = now.Add(offerHold)
+		}
+		return b
+	}
+
+	if b, ok := s.byKey[key]; ok {
+		return hold(b)
+	}
+
+	candidates := make([]uint32, 0, 1)
+	if ip, ok := m.Options.IP(OptionRequestedIPAddress); ok {
+		candidates = append(candidates, ipToUint32(ip))
+	}
+
+	for _, ip := range candidates {
+		if s.available(ip, now) {
+			return hold(s.bind(ip, key, m.ClientHardwareAddr))
+		}
+	}
+
+	for ip := s.start; ip <= s.end && ip >= s.start; ip++ {
+		if s.available(ip, now) {
+			return hold(s.bind(ip, key, m.ClientHardwareAddr))
+		}
+	}
+
+	return nil
+}
+
+// available reports whether ip may be bound to a new client. The caller must
+// hold s.mu.
+func (s *Server) available(ip uint32, now time.Time) bool {
+	if !s.inPool(ip) || ip == s.serverIP {
+		return false
+	}
+
+	b, ok := s.bindings[ip]
+	return !ok || !now.Before(b.expires)
+}
+
+// bind creates a new binding, replacing any expired binding for the same
+// address. The caller must hold s.mu.
+func (s *Server) bind(ip uint32, key string, hw net.HardwareAddr) *binding {
+	if old, ok := s.bindings[ip]; ok {
+		s.remove(old)
+	}
+
+	b := &binding{
+		ip:  ip,
+		key: key,
+		hw:  append(net.HardwareAddr(nil), hw...),
+	}
+
+	s.bindings[ip] = b
+	s.byKey[key] = b
+	return b
+}
+
+// remove deletes a binding. The caller must hold s.mu.
+func (s *Server) remove(b *binding) {
+	delete(s.bindings, b.ip)
+	if s.byKey[b.key] == b {
+		delete(s.byKey, b.key)
+	}
+}
+
+// decline marks the address declined by a client as unusable for one lease
+// duration. The caller must hold s.mu.
+func (s *Server) decline(key string, m *Message) {
+	ip, ok := m.Options.IP(OptionRequestedIPAddress)
+	if !ok {
+		return
+	}
+
+	b, ok := s.byKey[key]
+	if !ok || b.ip != ipToUint32(ip) {
+		return
+	}
+
+	// Detach the address from the client so it will be offered another.
+	delete(s.byKey, key)
+	b.key = ""
+	b.offered = false
+	b.declined = true
+	b.expires = s.now().Add(s.cfg.LeaseDuration)
+}
+
+// inPool reports whether ip is within the Server's address pool.
+func (s *Server) inPool(ip uint32) bool {
+	return ip >= s.start && ip <= s.end
+}
+
+// reply builds a reply of the specified type to m, assigning yiaddr.
+func (s *Server) reply(m *Message, t MessageType, yiaddr net.IP) *Message {
+	r := &Message{
+		Operation:          BootReply,
+		TransactionID:      m.TransactionID,
+		Broadcast:          m.Broadcast,
+		GatewayIP:          m.GatewayIP,
+		ClientHardwareAddr: m.ClientHardwareAddr,
+	}
+
+	r.Options.Add(OptionMessageType, []byte{uint8(t)})
+	r.Options.AddIPs(OptionServerIdentifier, s.cfg.ServerIP)
+
+	if t == NAK {
+		return r
+	}
+
+	r.YourIP = yiaddr
+	r.ServerIP = s.cfg.NextServer
+	r.BootFile = s.cfg.BootFile
+	if t == ACK && m.Type() == Inform {
+		// DHCPINFORM replies echo ciaddr and carry no lease.
+		r.ClientIP = m.ClientIP
+	} else {
+		d := s.cfg.LeaseDuration
+		r.Options.AddDuration(OptionIPAddressLeaseTime, d)
+		r.Options.AddDuration(OptionRenewalTimeValue, d/2)
+		r.Options.AddDuration(OptionRebindingTimeValue, d*7/8)
+	}
+
+	if s.cfg.SubnetMask != nil {
+		r.Options.Add(OptionSubnetMask, []byte(s.cfg.SubnetMask))
+	}
+	if len(s.cfg.Routers) > 0 {
+		r.Options.AddIPs(OptionRouter, s.cfg.Routers...)
+	}
+	if len(s.cfg.DNSServers) > 0 {
+		r.Options.AddIPs(OptionDomainNameServer, s.cfg.DNSServers...)
+	}
+	if s.cfg.DomainName != "" {
+		r.Options.Add(OptionDomainName, []byte(s.cfg.DomainName))
+	}
+	for _, o := range s.cfg.Options {
+		r.Options.Set(o.Code, o.Data)
+	}
+
+	return r
+}
+
+// send addresses a reply according to RFC 2131, section 4.1, and sends it.
+func (s *Server) send(p *packet, reply *Message) error {
+	src := endpoint{
+		hw:   s.ifi.HardwareAddr,
+		ip:   s.cfg.ServerIP,
+		port: ServerPort,
+	}
+
+	var dst endpoint
+	switch {
+	case !isZero(p.m.GatewayIP):
+		// Reply to the relay agent which forwarded the request.
+		dst = endpoint{hw: p.src.hw, ip: p.m.GatewayIP, port: ServerPort}
+	case reply.Type() == NAK:
+		dst = endpoint{hw: ethernet.Broadcast, ip: net.IPv4bcast, port: ClientPort}
+	case !isZero(p.m.ClientIP):
+		dst = endpoint{hw: p.m.ClientHardwareAddr, ip: p.m.ClientIP, port: ClientPort}
+	case p.m.Broadcast:
+		dst = endpoint{hw: ethernet.Broadcast, ip: net.IPv4bcast, port: ClientPort}
+	default:
+		// Unicast to the client's hardware address and its new IP address,
+		// which a kernel IP stack could not do without an ARP entry.
+		dst = endpoint{hw: p.m.ClientHardwareAddr, ip: reply.YourIP, port: ClientPort}
+	}
+
+	b, err := marshalFrame(src, dst, p.vlan, reply)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.p.WriteTo(b, &raw.Addr{HardwareAddr: dst.hw})
+	return err
+}
+
+// clientKey identifies a client by its client identifier option, or its
+// hardware address if the option is not present.
+func clientKey(m *Message) string {
+	if id, ok := m.Options.Get(OptionClientIdentifier); ok && len(id) > 0 {
+		return "id:" + string(id)
+	}
+
+	return "hw:" + m.ClientHardwareAddr.String()
+}
+
+// isZero reports whether ip is nil or the unspecified IPv4 address.
+func isZero(ip net.IP) bool {
+	return ip == nil || ip.Equal(net.IPv4zero)
+}
+
+// ipToUint32 converts an IPv4 address to an integer.
+func ipToUint32(ip net.IP) uint32 {
+	ip4 := ip.To4()
+	if ip4 == nil {
+		return 0
+	}
+
+	return binary.BigEndian.Uint32(ip4)
+}
+
+// uint32ToIP converts an integer to an IPv4 address.
+func uint32ToIP(v uint32) net.IP {
+	ip := make(net.IP, net.IPv4len)
+	binary.BigEndian.PutUint32(ip, v)
+	return ip
+}
@@ -0,0 +1,260 @@
+// Package eapol implements IEEE 802.1X EAP over LAN frames and a minimal
+// supplicant, on top of a *raw.Conn. The supplicant answers EAP identity
+// requests and authenticates using EAP-MD5, as described in RFC 3748.
+package eapol
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+)
+
+// PAEGroupAddr is the port access entity group address, to which EAPOL frames
+// are sent by default. It is not forwarded by IEEE 802.1D bridges.
+var PAEGroupAddr = net.HardwareAddr{0x01, 0x80, 0xc2, 0x00, 0x00, 0x03}
+
+const (
+	// pduHeaderLen is the length of an EAPOL PDU header.
+	pduHeaderLen = 4
+
+	// eapHeaderLen is the length of an EAP packet header without a type.
+	eapHeaderLen = 4
+)
+
+// errInvalidEAP is returned when an EAP packet is malformed.
+var errInvalidEAP = errors.New("eapol: invalid EAP packet")
+
+// A Version is an EAPOL protocol version.
+type Version uint8
+
+// Version values defined by each revision of IEEE 802.1X.
+const (
+	Version2001 Version = 1
+	Version2004 Version = 2
+	Version2010 Version = 3
+)
+
+// A Type is the type of an EAPOL PDU.
+type Type uint8
+
+// Type values defined by IEEE 802.1X.
+const (
+	TypeEAPPacket Type = 0
+	TypeStart     Type = 1
+	TypeLogoff    Type = 2
+	TypeKey       Type = 3
+	TypeASFAlert  Type = 4
+)
+
+// String returns the name of a Type.
+func (t Type) String() string {
+	switch t {
+	case TypeEAPPacket:
+		return "EAP-Packet"
+	case TypeStart:
+		return "EAPOL-Start"
+	case TypeLogoff:
+		return "EAPOL-Logoff"
+	case TypeKey:
+		return "EAPOL-Key"
+	case TypeASFAlert:
+		return "EAPOL-Encapsulated-ASF-Alert"
+	default:
+		return fmt.Sprintf("unknown(%d)", uint8(t))
+	}
+}
+
+// A PDU is an EAPOL protocol data unit, carried in an Ethernet frame with
+// EtherType EAPOL.
+type PDU struct {
+	Version Version
+	Type    Type
+
+	// Body is the body of the PDU, such as a marshaled EAP or Key. Start and
+	// Logoff PDUs have no body.
+	Body []byte
+}
+
+// MarshalBinary allocates a byte slice and marshals a PDU into binary form.
+func (p *PDU) MarshalBinary() ([]byte, error) {
+	if len(p.Body) > 0xffff {
+		return nil, fmt.Errorf("eapol: PDU body too long: %d bytes", len(p.Body))
+	}
+
+	b := make([]byte, pduHeaderLen+len(p.Body))
+	b[0] = uint8(p.Version)
+	b[1] = uint8(p.Type)
+	binary.BigEndian.PutUint16(b[2:4], uint16(len(p.Body)))
+	copy(b[4:], p.Body)
+
+	return b, nil
+}
+
+// UnmarshalBinary unmarshals a byte slice into a PDU. Any trailing Ethernet
+// padding is removed, and Body refers to the input slice.
+func (p *PDU) UnmarshalBinary(b []byte) error {
+	if len(b) < pduHeaderLen {
+		return io.ErrUnexpectedEOF
+	}
+
+	l := int(binary.BigEndian.Uint16(b[2:4]))
+	if len(b) < pduHeaderLen+l {
+		return io.ErrUnexpectedEOF
+	}
+
+	*p = PDU{
+		Version: Version(b[0]),
+		Type:    Type(b[1]),
+		Body:    b[pduHeaderLen : pduHeaderLen+l],
+	}
+
+	return nil
+}
+
+// A Code is the code of an EAP packet.
+type Code uint8
+
+// Code values defined by RFC 3748.
+const (
+	CodeRequest  Code = 1
+	CodeResponse Code = 2
+	CodeSuccess  Code = 3
+	CodeFailure  Code = 4
+)
+
+// String returns the name of a Code.
+func (c Code) String() string {
+	switch c {
+	case CodeRequest:
+		return "Request"
+	case CodeResponse:
+		return "Response"
+	case CodeSuccess:
+		return "Success"
+	case CodeFailure:
+		return "Failure"
+	default:
+		return fmt.Sprintf("unknown(%d)", uint8(c))
+	}
+}
+
+// An EAPType is the type of an EAP request or response.
+type EAPType uint8
+
+// EAPType values defined by RFC 3748 and commonly used by authenticators.
+const (
+	EAPTypeIdentity     EAPType = 1
+	EAPTypeNotification EAPType = 2
+	EAPTypeNak          EAPType = 3
+	EAPTypeMD5Challenge EAPType = 4
+	EAPTypeTLS          EAPType = 13
+	EAPTypeTTLS         EAPType = 21
+	EAPTypePEAP         EAPType = 25
+)
+
+// An EAP is an Extensible Authentication Protocol packet.
+type EAP struct {
+	Code       Code
+	Identifier uint8
+
+	// Type and Data are only present in requests and responses.
+	Type EAPType
+	Data []byte
+}
+
+// hasType reports whether packets with Code c carry a type.
+func (c Code) hasType() bool {
+	return c == CodeRequest || c == CodeResponse
+}
+
+// MarshalBinary allocates a byte slice and marshals an EAP packet into binary
+// form.
+func (e *EAP) MarshalBinary() ([]byte, error) {
+	n := eapHeaderLen
+	if e.Code.hasType() {
+		n += 1 + len(e.Data)
+	} else if len(e.Data) > 0 {
+		return nil, fmt.Errorf("eapol: EAP %s may not carry data", e.Code)
+	}
+	if n > 0xffff {
+		return nil, errInvalidEAP
+	}
+
+	b := make([]byte, n)
+	b[0] = uint8(e.Code)
+	b[1] = e.Identifier
+	binary.BigEndian.PutUint16(b[2:4], uint16(n))
+	if e.Code.hasType() {
+		b[4] = uint8(e.Type)
+		copy(b[5:], e.Data)
+	}
+
+	return b, nil
+}
+
+// UnmarshalBinary unmarshals a byte slice into an EAP packet. Data refers to
+// the input slice.
+func (e *EAP) UnmarshalBinary(b []byte) error {
+	if len(b) < eapHeaderLen {
+		return io.ErrUnexpectedEOF
+	}
+
+	l := int(binary.BigEndian.Uint16(b[2:4]))
+	if l < eapHeaderLen || len(b) < l {
+		return errInvalidEAP
+	}
+
+	*e = EAP{
+		Code:       Code(b[0]),
+		Identifier: b[1],
+	}
+
+	if !e.Code.hasType() {
+		return nil
+	}
+	if l < eapHeaderLen+1 {
+		return errInvalidEAP
+	}
+
+	e.Type = EAPType(b[4])
+	e.Data = b[5:l]
+	return nil
+}
+
+// A KeyDescriptorType identifies the format of an EAPOL-Key body.
+type KeyDescriptorType uint8
+
+// KeyDescriptorType values defined by IEEE 802.1X and IEEE 802.11.
+const (
+	KeyDescriptorRC4 KeyDescriptorType = 1
+	KeyDescriptorRSN KeyDescriptorType = 2
+	KeyDescriptorWPA KeyDescriptorType = 254
+)
+
+// A Key is the body of an EAPOL-Key PDU. The descriptor is not interpreted.
+type Key struct {
+	DescriptorType KeyDescriptorType
+	Descriptor     []byte
+}
+
+// MarshalBinary allocates a byte slice and marshals a Key into binary form.
+func (k *Key) MarshalBinary() ([]byte, error) {
+	return append([]byte{uint8(k.DescriptorType)}, k.Descriptor...), nil
+}
+
+// UnmarshalBinary unmarshals a byte slice into a Key. Descriptor refers to
+// the input slice.
+func (k *Key) UnmarshalBinary(b []byte) error {
+	if len(b) < 1 {
+		return io.ErrUnexpectedEOF
+	}
+
+	*k = Key{
+		DescriptorType: KeyDescriptorType(b[0]),
+		Descriptor:     b[1:],
+	}
+
+	return nil
+}
@@ -0,0 +1,406 @@
+package eapol_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/raw/eapol"
+	"github.com/mdlayher/raw/ethernet"
+	"github.com/mdlayher/raw/internal/rawtest"
+)
+
+var (
+	suppMAC = net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	authMAC = net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x02}
+)
+
+func TestPDUMarshalUnmarshal(t *testing.T) {
+	eap := &eapol.EAP{
+		Code:       eapol.CodeRequest,
+		Identifier: 1,
+		Type:       eapol.EAPTypeMD5Challenge,
+		Data:       []byte{4, 0xde, 0xad, 0xbe, 0xef},
+	}
+
+	eb, err := eap.MarshalBinary()
+	if err != nil {
+		t.Fatalf("failed to marshal EAP: %v", err)
+	}
+
+	want := &eapol.PDU{
+		Version: eapol.Version2004,
+		Type:    eapol.TypeEAPPacket,
+		Body:    eb,
+	}
+
+	pb, err := want.MarshalBinary()
+	if err != nil {
+		t.Fatalf("failed to marshal PDU: %v", err)
+	}
+
+	// Ethernet padding must be removed.
+	pb = append(pb, make([]byte, 16)...)
+
+	got := new(eapol.PDU)
+	if err := got.UnmarshalBinary(pb); err != nil {
+		t.Fatalf("failed to unmarshal PDU: %v", err)
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected PDU (-want +got):\n%s", diff)
+	}
+
+	gotEAP := new(eapol.EAP)
+	if err := gotEAP.UnmarshalBinary(got.Body); err != nil {
+		t.Fatalf("failed to unmarshal EAP: %v", err)
+	}
+
+	if diff := cmp.Diff(eap, gotEAP); diff != "" {
+		t.Fatalf("unexpected EAP (-want +got):\n%s", diff)
+	}
+}
+
+func TestEAPMarshalUnmarshal(t *testing.T) {
+	tests := []struct {
+		name string
+		e    *eapol.EAP
+		b    []byte
+	}{
+		{
+			name: "identity response",
+			e: &eapol.EAP{
+				Code:       eapol.CodeResponse,
+				Identifier: 7,
+				Type:       eapol.EAPTypeIdentity,
+				Data:       []byte("user"),
+			},
+			b: []byte{2, 7, 0, 9, 1, 'u', 's', 'e', 'r'},
+		},
+		{
+			name: "success",
+			e: &eapol.EAP{
+				Code:       eapol.CodeSuccess,
+				Identifier: 8,
+			},
+			b: []byte{3, 8, 0, 4},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := tt.e.MarshalBinary()
+			if err != nil {
+				t.Fatalf("failed to marshal: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.b, b); diff != "" {
+				t.Fatalf("unexpected bytes (-want +got):\n%s", diff)
+			}
+
+			e := new(eapol.EAP)
+			if err := e.UnmarshalBinary(b); err != nil {
+				t.Fatalf("failed to unmarshal: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.e, e); diff != "" {
+				t.Fatalf("unexpected EAP (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestEAPUnmarshalError(t *testing.T) {
+	tests := []struct {
+		name string
+		b    []byte
+	}{
+		{
+			name: "short",
+			b:    []byte{1, 1, 0},
+		},
+		{
+			name: "length too short",
+			b:    []byte{1, 1, 0, 3},
+		},
+		{
+			name: "length too long",
+			b:    []byte{1, 1, 0, 10, 1},
+		},
+		{
+			name: "request without type",
+			b:    []byte{1, 1, 0, 4},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := new(eapol.EAP).UnmarshalBinary(tt.b); err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+		})
+	}
+}
+
+func TestSupplicantAuthenticate(t *testing.T) {
+	tests := []struct {
+		name      string
+		password  string
+		methods   []eapol.EAPType
+		malformed bool
+		ok        bool
+	}{
+		{
+			name:     "success",
+			password: "secret",
+			methods:  []eapol.EAPType{eapol.EAPTypeMD5Challenge},
+			ok:       true,
+		},
+		{
+			name:     "wrong password",
+			password: "guess",
+			methods:  []eapol.EAPType{eapol.EAPTypeMD5Challenge},
+		},
+		{
+			name:     "nak",
+			password: "secret",
+			methods:  []eapol.EAPType{eapol.EAPTypePEAP, eapol.EAPTypeMD5Challenge},
+			ok:       true,
+		},
+		{
+			name:      "malformed challenge",
+			password:  "secret",
+			methods:   []eapol.EAPType{eapol.EAPTypeMD5Challenge},
+			malformed: true,
+			ok:        true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hub := rawtest.NewHub()
+			s := testSupplicant(t, hub, &eapol.Config{
+				Identity: "user",
+				Password: tt.password,
+			})
+
+			go testAuthenticator(hub.Conn(authMAC), "user", "secret", tt.methods, tt.malformed)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			err := s.Authenticate(ctx)
+			if tt.ok && err != nil {
+				t.Fatalf("failed to authenticate: %v", err)
+			}
+			if !tt.ok && !errors.Is(err, eapol.ErrFailure) {
+				t.Fatalf("expected ErrFailure, but got: %v", err)
+			}
+		})
+	}
+}
+
+func TestNewInvalidConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  *eapol.Config
+	}{
+		{
+			name: "start period",
+			cfg:  &eapol.Config{StartPeriod: -time.Second},
+		},
+		{
+			name: "max start",
+			cfg:  &eapol.Config{MaxStart: -1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ifi := &net.Interface{MTU: 1500, HardwareAddr: suppMAC}
+			if _, err := eapol.New(ifi, rawtest.NewHub().Conn(suppMAC), tt.cfg); err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+		})
+	}
+}
+
+func TestSupplicantNoAuthenticator(t *testing.T) {
+	hub := rawtest.NewHub()
+	s := testSupplicant(t, hub, &eapol.Config{
+		StartPeriod: 10 * time.Millisecond,
+		MaxStart:    2,
+	})
+
+	// Observe the frames sent by the supplicant.
+	auth := hub.Conn(authMAC)
+
+	if err := s.Authenticate(context.Background()); err == nil {
+		t.Fatal("expected an error, but none occurred")
+	}
+
+	var types []eapol.Type
+	for i := 0; i < 2; i++ {
+		p, _, err := readPDU(auth)
+		if err != nil {
+			t.Fatalf("failed to read PDU: %v", err)
+		}
+
+		types = append(types, p.Type)
+	}
+
+	if diff := cmp.Diff([]eapol.Type{eapol.TypeStart, eapol.TypeStart}, types); diff != "" {
+		t.Fatalf("unexpected PDU types (-want +got):\n%s", diff)
+	}
+}
+
+func TestSupplicantContextCanceled(t *testing.T) {
+	hub := rawtest.NewHub()
+	s := testSupplicant(t, hub, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if err := s.Authenticate(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context deadline exceeded, but got: %v", err)
+	}
+}
+
+func testSupplicant(t *testing.T, hub *rawtest.Hub, cfg *eapol.Config) *eapol.Supplicant {
+	t.Helper()
+
+	s, err := eapol.New(&net.Interface{MTU: 1500, HardwareAddr: suppMAC}, hub.Conn(suppMAC), cfg)
+	if err != nil {
+		t.Fatalf("failed to create supplicant: %v", err)
+	}
+	t.Cleanup(func() { _ = s.Close() })
+
+	return s
+}
+
+// testAuthenticator runs a minimal EAP-MD5 authenticator on c, proposing
+// each of methods in turn until the supplicant accepts one. If malformed is
+// set, each MD5-Challenge is preceded by one with an invalid value size.
+func testAuthenticator(c *rawtest.Conn, identity, password string, methods []eapol.EAPType, malformed bool) {
+	defer c.Close()
+
+	var (
+		id        uint8
+		challenge = []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08}
+	)
+
+	send := func(e *eapol.EAP) {
+		id++
+		e.Identifier = id
+
+		eb, _ := e.MarshalBinary()
+		pb, _ := (&eapol.PDU{
+			Version: eapol.Version2004,
+			Type:    eapol.TypeEAPPacket,
+			Body:    eb,
+		}).MarshalBinary()
+		fb, _ := (&ethernet.Frame{
+			Destination: eapol.PAEGroupAddr,
+			Source:      authMAC,
+			EtherType:   ethernet.EtherTypeEAPOL,
+			Payload:     pb,
+		}).MarshalBinary()
+
+		_, _ = c.WriteTo(fb, nil)
+	}
+
+	propose := func() {
+		m := methods[0]
+		methods = methods[1:]
+
+		data := []byte{0}
+		if m == eapol.EAPTypeMD5Challenge {
+			if malformed {
+				bad := append([]byte{0xff}, challenge...)
+				send(&eapol.EAP{Code: eapol.CodeRequest, Type: m, Data: bad})
+			}
+
+			data = append([]byte{uint8(len(challenge))}, challenge...)
+		}
+
+		send(&eapol.EAP{Code: eapol.CodeRequest, Type: m, Data: data})
+	}
+
+	for {
+		p, e, err := readPDU(c)
+		if err != nil {
+			return
+		}
+
+		if p.Type == eapol.TypeStart {
+			send(&eapol.EAP{Code: eapol.CodeRequest, Type: eapol.EAPTypeIdentity})
+			continue
+		}
+		if e == nil || e.Code != eapol.CodeResponse || e.Identifier != id {
+			continue
+		}
+
+		switch e.Type {
+		case eapol.EAPTypeIdentity:
+			if string(e.Data) != identity {
+				send(&eapol.EAP{Code: eapol.CodeFailure})
+				return
+			}
+
+			propose()
+		case eapol.EAPTypeNak:
+			if len(methods) == 0 {
+				send(&eapol.EAP{Code: eapol.CodeFailure})
+				return
+			}
+
+			propose()
+		case eapol.EAPTypeMD5Challenge:
+			want := eapol.MD5Response(id, password, challenge)
+			if len(e.Data) < 1+len(want) || !bytes.Equal(e.Data[1:1+len(want)], want) {
+				send(&eapol.EAP{Code: eapol.CodeFailure})
+				return
+			}
+
+			send(&eapol.EAP{Code: eapol.CodeSuccess})
+			return
+		}
+	}
+}
+
+// readPDU reads an EAPOL PDU and its EAP packet, if any, from c.
+func readPDU(c *rawtest.Conn) (*eapol.PDU, *eapol.EAP, error) {
+	if err := c.SetReadDeadline(time.Now().Add(time.Second)); err != nil {
+		return nil, nil, err
+	}
+
+	b := make([]byte, 1518)
+	n, _, err := c.ReadFrom(b)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var f ethernet.Frame
+	if err := f.UnmarshalBinary(b[:n]); err != nil {
+		return nil, nil, err
+	}
+
+	p := new(eapol.PDU)
+	if err := p.UnmarshalBinary(f.Payload); err != nil {
+		return nil, nil, err
+	}
+	if p.Type != eapol.TypeEAPPacket {
+		return p, nil, nil
+	}
+
+	e := new(eapol.EAP)
+	if err := e.UnmarshalBinary(p.Body); err != nil {
+		return nil, nil, err
+	}
+
+	return p, e, nil
+}
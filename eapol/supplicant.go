@@ -0,0 +1,330 @@
+package eapol
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/mdlayher/raw"
+	"github.com/mdlayher/raw/ethernet"
+	"github.com/mdlayher/raw/internal/frame"
+)
+
+// Default values from IEEE 802.1X.
+const (
+	defaultStartPeriod = 30 * time.Second
+	defaultMaxStart    = 3
+)
+
+var (
+	// ErrFailure is returned when the authenticator rejects the supplicant.
+	ErrFailure = errors.New("eapol: authentication failed")
+
+	// errNoAuthenticator is returned when no authenticator responds.
+	errNoAuthenticator = errors.New("eapol: no response from authenticator")
+)
+
+// A Config specifies the credentials and timing used by a Supplicant. The
+// zero value of any field other than the credentials selects a default
+// value.
+type Config struct {
+	// Identity is sent in response to identity requests.
+	Identity string
+
+	// Password is used to answer EAP-MD5 challenges.
+	Password string
+
+	// Version is the EAPOL version sent. If zero, Version2004 is used.
+	Version Version
+
+	// Destination is the address EAPOL frames are sent to. If nil,
+	// PAEGroupAddr is used.
+	Destination net.HardwareAddr
+
+	// StartPeriod is the time to wait for a request from the authenticator
+	// before sending another EAPOL-Start. If zero, 30 seconds is used.
+	StartPeriod time.Duration
+
+	// MaxStart is the number of EAPOL-Start PDUs sent before giving up. If
+	// zero, 3 is used.
+	MaxStart int
+}
+
+// A Supplicant authenticates a network interface using IEEE 802.1X.
+type Supplicant struct {
+	ifi *net.Interface
+	p   net.PacketConn
+	cfg Config
+}
+
+// Dial creates a new Supplicant using the specified network interface. Dial
+// opens a *raw.Conn which receives EAPOL frames, and enables promiscuous mode
+// so that frames sent to PAEGroupAddr are delivered. A nil Config selects the
+// default values and empty credentials.
+func Dial(ifi *net.Interface, cfg *Config) (*Supplicant, error) {
+	c, err := raw.ListenPacket(ifi, uint16(ethernet.EtherTypeEAPOL), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.SetPromiscuous(true); err != nil {
+		_ = c.Close()
+		return nil, err
+	}
+
+	s, err := New(ifi, c, cfg)
+	if err != nil {
+		_ = c.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// New creates a new Supplicant using the specified network interface and
+// net.PacketConn. p must send and receive complete Ethernet frames.
+func New(ifi *net.Interface, p net.PacketConn, cfg *Config) (*Supplicant, error) {
+	if len(ifi.HardwareAddr) != 6 {
+		return nil, fmt.Errorf("eapol: invalid hardware address: %q", ifi.HardwareAddr)
+	}
+
+	if cfg == nil {
+		cfg = &Config{}
+	}
+
+	switch {
+	case cfg.StartPeriod < 0:
+		return nil, fmt.Errorf("eapol: invalid start period: %s", cfg.StartPeriod)
+	case cfg.MaxStart < 0:
+		return nil, fmt.Errorf("eapol: invalid maximum EAPOL-Start count: %d", cfg.MaxStart)
+	}
+
+	c := *cfg
+	if c.Version == 0 {
+		c.Version = Version2004
+	}
+	if c.Destination == nil {
+		c.Destination = PAEGroupAddr
+	}
+	if c.StartPeriod == 0 {
+		c.StartPeriod = defaultStartPeriod
+	}
+	if c.MaxStart == 0 {
+		c.MaxStart = defaultMaxStart
+	}
+
+	return &Supplicant{
+		ifi: ifi,
+		p:   p,
+		cfg: c,
+	}, nil
+}
+
+// Close closes the Supplicant's connection.
+func (s *Supplicant) Close() error {
+	return s.p.Close()
+}
+
+// Authenticate sends EAPOL-Start and answers EAP requests from the
+// authenticator until authentication succeeds, fails, or ctx is canceled.
+// Identity and EAP-MD5 requests are answered with the configured
+// credentials, and requests for any other method are answered with a Nak
+// proposing EAP-MD5. If the authenticator rejects the credentials,
+// ErrFailure is returned.
+func (s *Supplicant) Authenticate(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	defer frame.CancelReads(ctx, s.p)()
+
+	// Send EAPOL-Start whenever the authenticator is silent for a start
+	// period, up to the configured limit.
+	for starts := 0; ; starts++ {
+		if starts == s.cfg.MaxStart {
+			return errNoAuthenticator
+		}
+
+		if err := s.send(TypeStart, nil); err != nil {
+			return err
+		}
+
+		err := s.converse(ctx)
+		switch {
+		case err == nil:
+			return nil
+		case ctx.Err() != nil:
+			return ctx.Err()
+		case !frame.IsTimeout(err):
+			return err
+		}
+	}
+}
+
+// Logoff sends an EAPOL-Logoff, returning the port to the unauthorized
+// state.
+func (s *Supplicant) Logoff() error {
+	return s.send(TypeLogoff, nil)
+}
+
+// converse answers EAP requests until authentication completes or no request
+// arrives within a start period.
+func (s *Supplicant) converse(ctx context.Context) error {
+	if err := s.extendDeadline(ctx); err != nil {
+		return err
+	}
+
+	b := make([]byte, frame.BufferSize(s.ifi))
+	for {
+		n, _, err := s.p.ReadFrom(b)
+		if err != nil {
+			return err
+		}
+
+		e, err := s.parseFrame(b[:n])
+		if err != nil {
+			continue
+		}
+
+		switch e.Code {
+		case CodeSuccess:
+			return nil
+		case CodeFailure:
+			return ErrFailure
+		case CodeRequest:
+		default:
+			continue
+		}
+
+		err = s.respond(e)
+		switch {
+		case errors.Is(err, errInvalidEAP):
+			// Drop the malformed request and keep waiting.
+			continue
+		case err != nil:
+			return err
+		}
+
+		if err := s.extendDeadline(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+// extendDeadline sets the read deadline one start period from now, unless ctx
+// has been canceled.
+func (s *Supplicant) extendDeadline(ctx context.Context) error {
+	if err := s.p.SetReadDeadline(time.Now().Add(s.cfg.StartPeriod)); err != nil {
+		return err
+	}
+
+	// The deadline may have replaced the one set when ctx was canceled.
+	return ctx.Err()
+}
+
+// respond answers an EAP request.
+func (s *Supplicant) respond(req *EAP) error {
+	res := &EAP{
+		Code:       CodeResponse,
+		Identifier: req.Identifier,
+		Type:       req.Type,
+	}
+
+	switch req.Type {
+	case EAPTypeIdentity:
+		res.Data = []byte(s.cfg.Identity)
+	case EAPTypeNotification:
+		// Notifications are acknowledged with an empty response.
+	case EAPTypeMD5Challenge:
+		if len(req.Data) < 1 || len(req.Data) < 1+int(req.Data[0]) {
+			return errInvalidEAP
+		}
+
+		challenge := req.Data[1 : 1+int(req.Data[0])]
+		sum := MD5Response(req.Identifier, s.cfg.Password, challenge)
+
+		res.Data = append([]byte{uint8(len(sum))}, sum...)
+		res.Data = append(res.Data, s.cfg.Identity...)
+	default:
+		// Propose EAP-MD5 instead.
+		res.Type = EAPTypeNak
+		res.Data = []byte{uint8(EAPTypeMD5Challenge)}
+	}
+
+	eb, err := res.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	return s.send(TypeEAPPacket, eb)
+}
+
+// MD5Response computes the response to an EAP-MD5 challenge, as described in
+// RFC 3748, section 5.4.
+func MD5Response(id uint8, password string, challenge []byte) []byte {
+	h := md5.New()
+	h.Write([]byte{id})
+	h.Write([]byte(password))
+	h.Write(challenge)
+	return h.Sum(nil)
+}
+
+// send sends an EAPOL PDU with the specified type and body.
+func (s *Supplicant) send(t Type, body []byte) error {
+	pb, err := (&PDU{
+		Version: s.cfg.Version,
+		Type:    t,
+		Body:    body,
+	}).MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	fb, err := (&ethernet.Frame{
+		Destination: s.cfg.Destination,
+		Source:      s.ifi.HardwareAddr,
+		EtherType:   ethernet.EtherTypeEAPOL,
+		Payload:     pb,
+	}).MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	_, err = s.p.WriteTo(fb, &raw.Addr{HardwareAddr: s.cfg.Destination})
+	return err
+}
+
+// parseFrame parses an EAP packet addressed to the Supplicant from an
+// Ethernet frame.
+func (s *Supplicant) parseFrame(b []byte) (*EAP, error) {
+	var f ethernet.Frame
+	if err := f.UnmarshalBinary(b); err != nil {
+		return nil, err
+	}
+
+	ok := f.EtherType == ethernet.EtherTypeEAPOL &&
+		!bytes.Equal(f.Source, s.ifi.HardwareAddr) &&
+		(bytes.Equal(f.Destination, s.ifi.HardwareAddr) || bytes.Equal(f.Destination, s.cfg.Destination))
+	if !ok {
+		return nil, errInvalidEAP
+	}
+
+	var p PDU
+	if err := p.UnmarshalBinary(f.Payload); err != nil {
+		return nil, err
+	}
+	if p.Type != TypeEAPPacket {
+		return nil, errInvalidEAP
+	}
+
+	e := new(EAP)
+	if err := e.UnmarshalBinary(p.Body); err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
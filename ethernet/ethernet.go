@@ -0,0 +1,195 @@
+// Package ethernet implements marshaling and unmarshaling of IEEE 802.3
+// Ethernet II frames, for use with the frames sent and received by a
+// *raw.Conn.
+package ethernet
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+)
+
+var (
+	// Broadcast is the Ethernet broadcast hardware address.
+	Broadcast = net.HardwareAddr{0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+
+	// errInvalidVLAN is returned when a VLAN tag is invalid.
+	errInvalidVLAN = errors.New("ethernet: invalid VLAN")
+)
+
+const (
+	// headerLen is the length of an Ethernet header without a VLAN tag.
+	headerLen = 6 + 6 + 2
+
+	// vlanLen is the length of an IEEE 802.1Q VLAN tag.
+	vlanLen = 4
+
+	// minPayload is the minimum payload length of an Ethernet frame. Payloads
+	// shorter than this are padded with zeros when marshaled.
+	minPayload = 46
+)
+
+// An EtherType is a value used to identify an upper layer protocol
+// encapsulated in a Frame.
+type EtherType uint16
+
+// Common EtherType values frequently used in a Frame.
+const (
+	EtherTypeIPv4          EtherType = 0x0800
+	EtherTypeARP           EtherType = 0x0806
+	EtherTypeWOL           EtherType = 0x0842
+	EtherTypeVLAN          EtherType = 0x8100
+	EtherTypeIPv6          EtherType = 0x86dd
+	EtherTypeSlowProtocols EtherType = 0x8809
+	EtherTypeEAPOL         EtherType = 0x888e
+	EtherTypeLLDP          EtherType = 0x88cc
+	EtherTypePTP           EtherType = 0x88f7
+	EtherTypeCFM           EtherType = 0x8902
+)
+
+// String returns the conventional name of an EtherType, or its hexadecimal
+// value if the name is not known.
+func (e EtherType) String() string {
+	switch e {
+	case EtherTypeIPv4:
+		return "IPv4"
+	case EtherTypeARP:
+		return "ARP"
+	case EtherTypeWOL:
+		return "WOL"
+	case EtherTypeVLAN:
+		return "VLAN"
+	case EtherTypeIPv6:
+		return "IPv6"
+	case EtherTypeSlowProtocols:
+		return "Slow Protocols"
+	case EtherTypeEAPOL:
+		return "EAPOL"
+	case EtherTypeLLDP:
+		return "LLDP"
+	case EtherTypePTP:
+		return "PTP"
+	case EtherTypeCFM:
+		return "CFM"
+	default:
+		return fmt.Sprintf("%#04x", uint16(e))
+	}
+}
+
+// A VLAN is an IEEE 802.1Q Virtual LAN tag.
+type VLAN struct {
+	// Priority Code Point, a 3-bit value.
+	Priority uint8
+
+	// Drop Eligible Indicator.
+	DropEligible bool
+
+	// VLAN identifier, a 12-bit value.
+	ID uint16
+}
+
+// A Frame is an IEEE 802.3 Ethernet II frame.
+type Frame struct {
+	// Destination and Source are the hardware addresses of the frame.
+	Destination net.HardwareAddr
+	Source      net.HardwareAddr
+
+	// VLAN is an optional IEEE 802.1Q tag. If nil, the frame is untagged.
+	VLAN *VLAN
+
+	// EtherType identifies the protocol carried in Payload.
+	EtherType EtherType
+
+	// Payload is the data carried by the frame.
+	Payload []byte
+}
+
+// MarshalBinary allocates a byte slice and marshals a Frame into binary form.
+// Payloads shorter than the Ethernet minimum are padded with zeros.
+func (f *Frame) MarshalBinary() ([]byte, error) {
+	if len(f.Destination) != 6 || len(f.Source) != 6 {
+		return nil, fmt.Errorf("ethernet: invalid hardware addresses: %q -> %q",
+			f.Destination, f.Source)
+	}
+
+	n := headerLen
+	if f.VLAN != nil {
+		if f.VLAN.Priority > 7 || f.VLAN.ID > 0x0fff {
+			return nil, errInvalidVLAN
+		}
+
+		n += vlanLen
+	}
+
+	pl := len(f.Payload)
+	if pl < minPayload {
+		pl = minPayload
+	}
+
+	b := make([]byte, n+pl)
+	copy(b[0:6], f.Destination)
+	copy(b[6:12], f.Source)
+
+	i := 12
+	if f.VLAN != nil {
+		binary.BigEndian.PutUint16(b[i:i+2], uint16(EtherTypeVLAN))
+		binary.BigEndian.PutUint16(b[i+2:i+4], f.VLAN.tci())
+		i += vlanLen
+	}
+
+	binary.BigEndian.PutUint16(b[i:i+2], uint16(f.EtherType))
+	copy(b[n:], f.Payload)
+
+	return b, nil
+}
+
+// UnmarshalBinary unmarshals a byte slice into a Frame. Payload refers to the
+// input slice and any trailing padding is left in place, because its length
+// can only be determined by the upper layer protocol.
+func (f *Frame) UnmarshalBinary(b []byte) error {
+	if len(b) < headerLen {
+		return io.ErrUnexpectedEOF
+	}
+
+	f.Destination = net.HardwareAddr(b[0:6])
+	f.Source = net.HardwareAddr(b[6:12])
+	f.VLAN = nil
+
+	i := 12
+	et := EtherType(binary.BigEndian.Uint16(b[i : i+2]))
+	if et == EtherTypeVLAN {
+		if len(b) < headerLen+vlanLen {
+			return io.ErrUnexpectedEOF
+		}
+
+		f.VLAN = parseTCI(binary.BigEndian.Uint16(b[i+2 : i+4]))
+		i += vlanLen
+		et = EtherType(binary.BigEndian.Uint16(b[i : i+2]))
+	}
+
+	f.EtherType = et
+	f.Payload = b[i+2:]
+
+	return nil
+}
+
+// tci produces the Tag Control Information for a VLAN.
+func (v *VLAN) tci() uint16 {
+	tci := uint16(v.Priority)<<13 | v.ID
+	if v.DropEligible {
+		tci |= 1 << 12
+	}
+
+	return tci
+}
+
+// parseTCI parses Tag Control Information into a VLAN.
+func parseTCI(tci uint16) *VLAN {
+	return &VLAN{
+		Priority:     uint8(tci >> 13),
+		DropEligible: tci&(1<<12) != 0,
+		ID:           tci & 0x0fff,
+	}
+}
@@ -0,0 +1,113 @@
+package ethernet_test
+
+import (
+	"net"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/raw/ethernet"
+)
+
+func TestFrameMarshalUnmarshal(t *testing.T) {
+	var (
+		dst = net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad}
+		src = net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	)
+
+	tests := []struct {
+		name string
+		f    *ethernet.Frame
+		b    []byte
+	}{
+		{
+			name: "untagged",
+			f: &ethernet.Frame{
+				Destination: dst,
+				Source:      src,
+				EtherType:   ethernet.EtherTypeIPv4,
+				Payload:     make([]byte, 46),
+			},
+			b: append([]byte{
+				0xde, 0xad, 0xbe, 0xef, 0xde, 0xad,
+				0x02, 0x00, 0x00, 0x00, 0x00, 0x01,
+				0x08, 0x00,
+			}, make([]byte, 46)...),
+		},
+		{
+			name: "VLAN tagged",
+			f: &ethernet.Frame{
+				Destination: dst,
+				Source:      src,
+				VLAN: &ethernet.VLAN{
+					Priority:     5,
+					DropEligible: true,
+					ID:           100,
+				},
+				EtherType: ethernet.EtherTypeARP,
+				Payload:   make([]byte, 46),
+			},
+			b: append([]byte{
+				0xde, 0xad, 0xbe, 0xef, 0xde, 0xad,
+				0x02, 0x00, 0x00, 0x00, 0x00, 0x01,
+				0x81, 0x00,
+				0xb0, 0x64,
+				0x08, 0x06,
+			}, make([]byte, 46)...),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := tt.f.MarshalBinary()
+			if err != nil {
+				t.Fatalf("failed to marshal: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.b, b); diff != "" {
+				t.Fatalf("unexpected frame bytes (-want +got):\n%s", diff)
+			}
+
+			var f ethernet.Frame
+			if err := f.UnmarshalBinary(b); err != nil {
+				t.Fatalf("failed to unmarshal: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.f, &f); diff != "" {
+				t.Fatalf("unexpected frame (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestFrameMarshalPadding(t *testing.T) {
+	f := &ethernet.Frame{
+		Destination: ethernet.Broadcast,
+		Source:      net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01},
+		EtherType:   ethernet.EtherTypeARP,
+		Payload:     []byte{0x01},
+	}
+
+	b, err := f.MarshalBinary()
+	if err != nil {
+		t.Fatalf("failed to marshal: %v", err)
+	}
+
+	if diff := cmp.Diff(60, len(b)); diff != "" {
+		t.Fatalf("unexpected frame length (-want +got):\n%s", diff)
+	}
+}
+
+func TestFrameErrors(t *testing.T) {
+	bad := &ethernet.Frame{
+		Destination: ethernet.Broadcast,
+		Source:      net.HardwareAddr{0x02},
+	}
+	if _, err := bad.MarshalBinary(); err == nil {
+		t.Fatal("expected invalid source address error, but none occurred")
+	}
+
+	var f ethernet.Frame
+	if err := f.UnmarshalBinary(make([]byte, 13)); err == nil {
+		t.Fatal("expected short frame error, but none occurred")
+	}
+}
@@ -0,0 +1,458 @@
+package fragment
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/mdlayher/raw"
+	"github.com/mdlayher/raw/ethernet"
+	"github.com/mdlayher/raw/internal/frame"
+)
+
+// Default configuration values.
+const (
+	defaultMaxMessageSize    = 1 << 20
+	defaultReassemblyTimeout = 5 * time.Second
+	defaultReassemblyMemory  = 4 << 20
+
+	// slotSize is the memory charged for each fragment of an incomplete
+	// message, whether or not it has arrived: the size of a slice header on
+	// 64-bit platforms.
+	slotSize = 24
+)
+
+// A Config configures a Conn. The zero value of any field selects a default
+// value.
+type Config struct {
+	// MaxMessageSize is the largest message which may be sent or received.
+	// If zero, 1 MiB is used.
+	MaxMessageSize int
+
+	// ReassemblyTimeout is the time allowed for all fragments of a message
+	// to arrive after the first. If zero, 5 seconds is used.
+	ReassemblyTimeout time.Duration
+
+	// ReassemblyMemory is the number of bytes of incomplete messages which
+	// may be held, including the bookkeeping for each of their fragments. If
+	// zero, 4 MiB is used.
+	ReassemblyMemory int
+}
+
+// Stats contains statistics about message reassembly.
+type Stats struct {
+	// Reassembled is the number of messages reassembled from fragments.
+	Reassembled uint64
+
+	// Timeouts is the number of incomplete messages discarded because
+	// their fragments did not arrive in time.
+	Timeouts uint64
+
+	// Evictions is the number of incomplete messages discarded to stay
+	// within the memory limit.
+	Evictions uint64
+
+	// Dropped is the number of fragments discarded because they were
+	// malformed, inconsistent with earlier fragments of their message, or
+	// belonged to a message which was too large.
+	Dropped uint64
+}
+
+var _ net.PacketConn = &Conn{}
+
+// A Conn is a net.PacketConn which sends and receives messages of up to
+// Config.MaxMessageSize bytes. Unlike a *raw.Conn, the data read from and
+// written to a Conn does not include an Ethernet header, and its addresses
+// are *raw.Addr values.
+type Conn struct {
+	ifi       *net.Interface
+	p         net.PacketConn
+	etherType ethernet.EtherType
+	cfg       Config
+
+	wmu sync.Mutex
+	id  uint32
+
+	mu      sync.Mutex
+	partial map[partialKey]*partial
+	order   []*partial
+	memory  int
+	stats   Stats
+}
+
+// A partialKey identifies a message being reassembled.
+type partialKey struct {
+	src string
+	id  uint32
+}
+
+// A partial is a message being reassembled.
+type partial struct {
+	key      partialKey
+	frags    [][]byte
+	received int
+	size     int
+	memory   int
+	expires  time.Time
+	done     bool
+}
+
+// ListenPacket creates a new Conn using the specified network interface and
+// EtherType. ListenPacket opens a *raw.Conn which receives frames with the
+// EtherType. A nil Config selects the default values.
+func ListenPacket(ifi *net.Interface, etherType ethernet.EtherType, cfg *Config) (*Conn, error) {
+	p, err := raw.ListenPacket(ifi, uint16(etherType), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := New(ifi, p, etherType, cfg)
+	if err != nil {
+		_ = p.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// New creates a new Conn using the specified network interface,
+// net.PacketConn, and EtherType. p must send and receive complete Ethernet
+// frames.
+func New(ifi *net.Interface, p net.PacketConn, etherType ethernet.EtherType, cfg *Config) (*Conn, error) {
+	if len(ifi.HardwareAddr) != 6 {
+		return nil, fmt.Errorf("fragment: invalid hardware address: %q", ifi.HardwareAddr)
+	}
+	if etherType <= 1500 {
+		return nil, fmt.Errorf("fragment: invalid EtherType: %s", etherType)
+	}
+
+	if cfg == nil {
+		cfg = &Config{}
+	}
+
+	conf := *cfg
+	if conf.MaxMessageSize == 0 {
+		conf.MaxMessageSize = defaultMaxMessageSize
+	}
+	if conf.ReassemblyTimeout == 0 {
+		conf.ReassemblyTimeout = defaultReassemblyTimeout
+	}
+	if conf.ReassemblyMemory == 0 {
+		conf.ReassemblyMemory = defaultReassemblyMemory
+	}
+
+	c := &Conn{
+		ifi:       ifi,
+		p:         p,
+		etherType: etherType,
+		cfg:       conf,
+		partial:   make(map[partialKey]*partial),
+	}
+
+	if max := c.maxPayload() * maxFragments; conf.MaxMessageSize > max {
+		return nil, fmt.Errorf("fragment: maximum message size exceeds %d bytes", max)
+	}
+
+	// Start from a random message ID so that fragments of messages sent
+	// before a restart are unlikely to match new messages.
+	var idb [4]byte
+	if _, err := rand.Read(idb[:]); err != nil {
+		return nil, err
+	}
+	c.id = binary.BigEndian.Uint32(idb[:])
+
+	return c, nil
+}
+
+// ReadFrom implements the net.PacketConn ReadFrom method. ReadFrom returns
+// the next complete message and the *raw.Addr which sent it. If b is too
+// small to hold the message, the message is truncated and io.ErrShortBuffer
+// is returned.
+func (c *Conn) ReadFrom(b []byte) (int, net.Addr, error) {
+	buf := make([]byte, frame.BufferSize(c.ifi))
+	for {
+		n, _, err := c.p.ReadFrom(buf)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		src, msg, ok := c.receive(buf[:n], time.Now())
+		if !ok {
+			continue
+		}
+
+		n = copy(b, msg)
+		if n < len(msg) {
+			err = io.ErrShortBuffer
+		}
+
+		return n, &raw.Addr{HardwareAddr: src}, err
+	}
+}
+
+// WriteTo implements the net.PacketConn WriteTo method. addr must be a
+// *raw.Addr. b is sent in as many fragments as are necessary.
+func (c *Conn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	ra, ok := addr.(*raw.Addr)
+	if !ok || len(ra.HardwareAddr) != 6 {
+		return 0, fmt.Errorf("fragment: invalid address: %v", addr)
+	}
+	if len(b) > c.cfg.MaxMessageSize {
+		return 0, fmt.Errorf("fragment: message too long: %d bytes", len(b))
+	}
+
+	max := c.maxPayload()
+	count := (len(b) + max - 1) / max
+	if count == 0 {
+		// An empty message is sent as a single empty fragment.
+		count = 1
+	}
+
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	c.id++
+	for i := 0; i < count; i++ {
+		end := (i + 1) * max
+		if end > len(b) {
+			end = len(b)
+		}
+
+		fb, err := (&fragment{
+			Index:   uint16(i),
+			Count:   uint16(count),
+			ID:      c.id,
+			Payload: b[i*max : end],
+		}).MarshalBinary()
+		if err != nil {
+			return 0, err
+		}
+
+		fb, err = (&ethernet.Frame{
+			Destination: ra.HardwareAddr,
+			Source:      c.ifi.HardwareAddr,
+			EtherType:   c.etherType,
+			Payload:     fb,
+		}).MarshalBinary()
+		if err != nil {
+			return 0, err
+		}
+
+		if _, err := c.p.WriteTo(fb, ra); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(b), nil
+}
+
+// Close closes the Conn's connection.
+func (c *Conn) Close() error {
+	return c.p.Close()
+}
+
+// LocalAddr returns the local network address.
+func (c *Conn) LocalAddr() net.Addr {
+	return c.p.LocalAddr()
+}
+
+// SetDeadline implements the net.PacketConn SetDeadline method.
+func (c *Conn) SetDeadline(t time.Time) error {
+	return c.p.SetDeadline(t)
+}
+
+// SetReadDeadline implements the net.PacketConn SetReadDeadline method.
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	return c.p.SetReadDeadline(t)
+}
+
+// SetWriteDeadline implements the net.PacketConn SetWriteDeadline method.
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	return c.p.SetWriteDeadline(t)
+}
+
+// Stats returns statistics about message reassembly.
+func (c *Conn) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.stats
+}
+
+// receive processes a frame received at now, and returns a message and its
+// source if the frame completed one.
+func (c *Conn) receive(b []byte, now time.Time) (net.HardwareAddr, []byte, bool) {
+	var f ethernet.Frame
+	if err := f.UnmarshalBinary(b); err != nil {
+		return nil, nil, false
+	}
+
+	ok := f.EtherType == c.etherType &&
+		len(f.Source) == 6 &&
+		!bytes.Equal(f.Source, c.ifi.HardwareAddr) &&
+		(f.Destination[0]&0x01 != 0 || bytes.Equal(f.Destination, c.ifi.HardwareAddr))
+	if !ok {
+		return nil, nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.expire(now)
+
+	var frag fragment
+	if err := frag.UnmarshalBinary(f.Payload); err != nil {
+		c.stats.Dropped++
+		return nil, nil, false
+	}
+
+	src := append(net.HardwareAddr(nil), f.Source...)
+	if frag.Count == 1 {
+		// Unfragmented messages need no reassembly.
+		if len(frag.Payload) > c.cfg.MaxMessageSize {
+			c.stats.Dropped++
+			return nil, nil, false
+		}
+
+		c.stats.Reassembled++
+		return src, append([]byte(nil), frag.Payload...), true
+	}
+
+	key := partialKey{src: src.String(), id: frag.ID}
+	p, ok := c.partial[key]
+	if !ok {
+		// Messages which could not fit are rejected before any memory is
+		// used, assuming each fragment is as large as the first.
+		if int(frag.Count) > c.maxFragments() || int(frag.Count-1)*len(frag.Payload) > c.cfg.MaxMessageSize {
+			c.stats.Dropped++
+			return nil, nil, false
+		}
+
+		// The fragment table is charged against the memory limit, so that
+		// many messages with empty fragments cannot exhaust it.
+		slots := int(frag.Count) * slotSize
+		c.reserve(slots, nil)
+		if c.memory+slots > c.cfg.ReassemblyMemory {
+			c.stats.Dropped++
+			return nil, nil, false
+		}
+
+		p = &partial{
+			key:     key,
+			frags:   make([][]byte, frag.Count),
+			memory:  slots,
+			expires: now.Add(c.cfg.ReassemblyTimeout),
+		}
+		c.partial[key] = p
+		c.order = append(c.order, p)
+		c.memory += slots
+	}
+
+	switch {
+	case int(frag.Count) != len(p.frags), p.size+len(frag.Payload) > c.cfg.MaxMessageSize:
+		c.stats.Dropped++
+		c.remove(p)
+		return nil, nil, false
+	case p.frags[frag.Index] != nil:
+		// A duplicate.
+		return nil, nil, false
+	}
+
+	c.reserve(len(frag.Payload), p)
+	if p.done {
+		// p itself was evicted to make room.
+		return nil, nil, false
+	}
+
+	// A fragment with an empty payload is stored as an empty, non-nil slice
+	// so that it is counted as received.
+	p.frags[frag.Index] = append(make([]byte, 0, len(frag.Payload)), frag.Payload...)
+	p.received++
+	p.size += len(frag.Payload)
+	p.memory += len(frag.Payload)
+	c.memory += len(frag.Payload)
+
+	if p.received < len(p.frags) {
+		return nil, nil, false
+	}
+
+	c.remove(p)
+	c.stats.Reassembled++
+
+	msg := make([]byte, 0, p.size)
+	for _, fb := range p.frags {
+		msg = append(msg, fb...)
+	}
+
+	return src, msg, true
+}
+
+// expire discards incomplete messages whose timeout passed before now. The
+// caller must hold c.mu.
+func (c *Conn) expire(now time.Time) {
+	// All messages have the same timeout, so order is also expiry order.
+	for len(c.order) > 0 {
+		p := c.order[0]
+		if !p.done && now.Before(p.expires) {
+			return
+		}
+
+		if !p.done {
+			c.stats.Timeouts++
+			c.remove(p)
+		}
+		c.order = c.order[1:]
+	}
+}
+
+// reserve evicts the oldest incomplete messages until n more bytes fit within
+// the memory limit. If p must be evicted, it is marked done. p may be nil when
+// reserving memory for a new message. The caller must hold c.mu.
+func (c *Conn) reserve(n int, p *partial) {
+	for i := 0; c.memory+n > c.cfg.ReassemblyMemory && i < len(c.order); i++ {
+		old := c.order[i]
+		if old.done {
+			continue
+		}
+
+		c.stats.Evictions++
+		c.remove(old)
+		if old == p {
+			return
+		}
+	}
+}
+
+// remove discards the incomplete message p and the memory it used. The caller
+// must hold c.mu.
+func (c *Conn) remove(p *partial) {
+	if p.done {
+		return
+	}
+
+	p.done = true
+	c.memory -= p.memory
+	delete(c.partial, p.key)
+}
+
+// maxFragments returns the largest number of fragments in a message of at
+// most MaxMessageSize bytes.
+func (c *Conn) maxFragments() int {
+	max := c.maxPayload()
+	return (c.cfg.MaxMessageSize + max - 1) / max
+}
+
+// maxPayload returns the largest payload carried in a single fragment.
+func (c *Conn) maxPayload() int {
+	mtu := c.ifi.MTU
+	if mtu <= 0 {
+		mtu = 1500
+	}
+
+	return mtu - headerLen
+}
@@ -0,0 +1,88 @@
+// Package fragment implements a net.PacketConn which sends messages larger
+// than an interface's MTU over a user-chosen EtherType, by splitting them
+// into numbered fragments and reassembling the fragments on receipt.
+//
+// Reassembly is bounded: incomplete messages are discarded after a timeout,
+// and the oldest incomplete messages are evicted when the memory they use
+// exceeds a limit. Fragments are not retransmitted, so the loss of any
+// fragment causes the loss of its message.
+package fragment
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+const (
+	// headerLen is the length of a fragment header.
+	headerLen = 12
+
+	// version is the fragment format version implemented by this package.
+	version = 1
+
+	// maxFragments is the largest number of fragments in a message.
+	maxFragments = 0xffff
+)
+
+// errInvalidFragment is returned when a fragment is malformed.
+var errInvalidFragment = errors.New("fragment: invalid fragment")
+
+// A fragment is a numbered piece of a message.
+//
+// The binary form is a version, a reserved byte, the index of the fragment
+// and the number of fragments in the message, the message ID, and the
+// payload length, followed by the payload.
+type fragment struct {
+	Index   uint16
+	Count   uint16
+	ID      uint32
+	Payload []byte
+}
+
+// MarshalBinary allocates a byte slice and marshals a fragment into binary
+// form.
+func (f *fragment) MarshalBinary() ([]byte, error) {
+	if len(f.Payload) > 0xffff || f.Index >= f.Count {
+		return nil, errInvalidFragment
+	}
+
+	b := make([]byte, headerLen+len(f.Payload))
+	b[0] = version
+	binary.BigEndian.PutUint16(b[2:4], f.Index)
+	binary.BigEndian.PutUint16(b[4:6], f.Count)
+	binary.BigEndian.PutUint32(b[6:10], f.ID)
+	binary.BigEndian.PutUint16(b[10:12], uint16(len(f.Payload)))
+	copy(b[headerLen:], f.Payload)
+
+	return b, nil
+}
+
+// UnmarshalBinary unmarshals a byte slice into a fragment. Any trailing
+// Ethernet padding is removed, and Payload refers to the input slice.
+func (f *fragment) UnmarshalBinary(b []byte) error {
+	if len(b) < headerLen {
+		return io.ErrUnexpectedEOF
+	}
+	if b[0] != version {
+		return errInvalidFragment
+	}
+
+	l := int(binary.BigEndian.Uint16(b[10:12]))
+	if len(b) < headerLen+l {
+		return io.ErrUnexpectedEOF
+	}
+
+	*f = fragment{
+		Index:   binary.BigEndian.Uint16(b[2:4]),
+		Count:   binary.BigEndian.Uint16(b[4:6]),
+		ID:      binary.BigEndian.Uint32(b[6:10]),
+		Payload: b[headerLen : headerLen+l],
+	}
+
+	if f.Index >= f.Count {
+		return errInvalidFragment
+	}
+
+	return nil
+}
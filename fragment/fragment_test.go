@@ -0,0 +1,303 @@
+package fragment_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/raw"
+	"github.com/mdlayher/raw/ethernet"
+	"github.com/mdlayher/raw/fragment"
+	"github.com/mdlayher/raw/internal/rawtest"
+)
+
+const etherType ethernet.EtherType = 0x88b7
+
+var (
+	macA = net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	macB = net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x02}
+)
+
+func TestConnRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		size int
+	}{
+		{name: "empty", size: 0},
+		{name: "single", size: 100},
+		{name: "exact", size: 1500 - 12},
+		{name: "two", size: 1500 - 12 + 1},
+		{name: "large", size: 256 * 1024},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hub := rawtest.NewHub()
+			a := testConn(t, hub.Conn(macA), macA, nil)
+			b := testConn(t, hub.Conn(macB), macB, nil)
+
+			want := make([]byte, tt.size)
+			rand.Read(want)
+
+			n, err := a.WriteTo(want, &raw.Addr{HardwareAddr: macB})
+			if err != nil {
+				t.Fatalf("failed to write: %v", err)
+			}
+			if n != len(want) {
+				t.Fatalf("unexpected write length: %d", n)
+			}
+
+			got, addr := rawtest.ReadMessage(t, b)
+			if !bytes.Equal(want, got) {
+				t.Fatalf("unexpected message: got %d bytes, want %d bytes", len(got), len(want))
+			}
+			if diff := cmp.Diff(macA, addr.(*raw.Addr).HardwareAddr); diff != "" {
+				t.Fatalf("unexpected source (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestConnReorderedDuplicate(t *testing.T) {
+	hub := rawtest.NewHub()
+	p := hub.Conn(macA)
+	b := testConn(t, hub.Conn(macB), macB, nil)
+
+	// Fragments arrive out of order, with duplicates and interleaved with a
+	// second message.
+	rawtest.WriteFrames(t, p,
+		frame(macA, macB, 1, 2, 3, []byte("baz")),
+		frame(macA, macB, 1, 0, 3, []byte("foo")),
+		frame(macA, macB, 2, 1, 2, []byte("world")),
+		frame(macA, macB, 1, 0, 3, []byte("foo")),
+		frame(macA, macB, 1, 1, 3, []byte("bar")),
+		frame(macA, macB, 2, 0, 2, []byte("hello")),
+	)
+
+	for _, want := range []string{"foobarbaz", "helloworld"} {
+		got, _ := rawtest.ReadMessage(t, b)
+		if diff := cmp.Diff(want, string(got)); diff != "" {
+			t.Fatalf("unexpected message (-want +got):\n%s", diff)
+		}
+	}
+}
+
+func TestConnReassemblyTimeout(t *testing.T) {
+	hub := rawtest.NewHub()
+	p := hub.Conn(macA)
+	b := testConn(t, hub.Conn(macB), macB, &fragment.Config{
+		ReassemblyTimeout: 20 * time.Millisecond,
+	})
+
+	rawtest.WriteFrames(t, p, frame(macA, macB, 1, 0, 2, []byte("stale")))
+	if _, err := rawtest.Read(b, 50*time.Millisecond); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, but got: %v", err)
+	}
+
+	// The first fragment has expired, so the second cannot complete the
+	// message.
+	rawtest.WriteFrames(t, p,
+		frame(macA, macB, 1, 1, 2, []byte("message")),
+		frame(macA, macB, 2, 0, 1, []byte("fresh")),
+	)
+
+	got, _ := rawtest.ReadMessage(t, b)
+	if diff := cmp.Diff("fresh", string(got)); diff != "" {
+		t.Fatalf("unexpected message (-want +got):\n%s", diff)
+	}
+
+	if diff := cmp.Diff(uint64(1), b.Stats().Timeouts); diff != "" {
+		t.Fatalf("unexpected timeouts (-want +got):\n%s", diff)
+	}
+}
+
+func TestConnReassemblyMemory(t *testing.T) {
+	hub := rawtest.NewHub()
+	p := hub.Conn(macA)
+	// Two incomplete messages fit, each with a 60 byte fragment and a table
+	// for two fragments.
+	b := testConn(t, hub.Conn(macB), macB, &fragment.Config{
+		ReassemblyMemory: 270,
+	})
+
+	payload := bytes.Repeat([]byte{0xff}, 60)
+	rawtest.WriteFrames(t, p,
+		frame(macA, macB, 1, 0, 2, payload),
+		frame(macA, macB, 2, 0, 2, payload),
+		// Evicts message 1.
+		frame(macA, macB, 3, 0, 2, payload),
+		// Evicts message 2, after which message 3 fits.
+		frame(macA, macB, 3, 1, 2, payload),
+		// Message 1 starts again, and cannot complete.
+		frame(macA, macB, 1, 1, 2, payload),
+	)
+
+	got, _ := rawtest.ReadMessage(t, b)
+	if diff := cmp.Diff(append(payload, payload...), got); diff != "" {
+		t.Fatalf("unexpected message (-want +got):\n%s", diff)
+	}
+
+	if _, err := rawtest.Read(b, 20*time.Millisecond); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, but got: %v", err)
+	}
+
+	want := fragment.Stats{Reassembled: 1, Evictions: 2}
+	if diff := cmp.Diff(want, b.Stats()); diff != "" {
+		t.Fatalf("unexpected stats (-want +got):\n%s", diff)
+	}
+}
+
+func TestConnMaxMessageSize(t *testing.T) {
+	hub := rawtest.NewHub()
+	p := hub.Conn(macA)
+	b := testConn(t, hub.Conn(macB), macB, &fragment.Config{
+		MaxMessageSize: 2000,
+	})
+
+	if _, err := b.WriteTo(make([]byte, 2001), &raw.Addr{HardwareAddr: macA}); err == nil {
+		t.Fatal("expected an error writing a long message, but none occurred")
+	}
+
+	rawtest.WriteFrames(t, p,
+		// Too many fragments to possibly fit.
+		frame(macA, macB, 1, 0, 10, make([]byte, 60)),
+		// Two fragments which exceed the limit together.
+		frame(macA, macB, 2, 0, 2, make([]byte, 1200)),
+		frame(macA, macB, 2, 1, 2, make([]byte, 1200)),
+		frame(macA, macB, 3, 0, 1, []byte("ok")),
+	)
+
+	got, _ := rawtest.ReadMessage(t, b)
+	if diff := cmp.Diff("ok", string(got)); diff != "" {
+		t.Fatalf("unexpected message (-want +got):\n%s", diff)
+	}
+
+	if diff := cmp.Diff(uint64(2), b.Stats().Dropped); diff != "" {
+		t.Fatalf("unexpected drops (-want +got):\n%s", diff)
+	}
+}
+
+func TestConnReassemblyMemoryEmptyFragments(t *testing.T) {
+	hub := rawtest.NewHub()
+	p := hub.Conn(macA)
+	b := testConn(t, hub.Conn(macB), macB, &fragment.Config{
+		ReassemblyMemory: 64 << 10,
+	})
+
+	// More fragments than any message of the default maximum size needs.
+	rawtest.WriteFrames(t, p, frame(macA, macB, 0, 0, 0xffff, nil))
+
+	// Empty fragments of the largest allowed messages, 705 fragments of 1488
+	// bytes, still consume memory for their fragment tables, so only three
+	// fit at once.
+	const n = 100
+	for i := 0; i < n; i++ {
+		rawtest.WriteFrames(t, p, frame(macA, macB, uint32(i+1), 0, 705, nil))
+	}
+	rawtest.WriteFrames(t, p, frame(macA, macB, n+1, 0, 1, []byte("ok")))
+
+	got, _ := rawtest.ReadMessage(t, b)
+	if diff := cmp.Diff("ok", string(got)); diff != "" {
+		t.Fatalf("unexpected message (-want +got):\n%s", diff)
+	}
+
+	want := fragment.Stats{Reassembled: 1, Evictions: n - 3, Dropped: 1}
+	if diff := cmp.Diff(want, b.Stats()); diff != "" {
+		t.Fatalf("unexpected stats (-want +got):\n%s", diff)
+	}
+}
+
+func TestConnShortBuffer(t *testing.T) {
+	hub := rawtest.NewHub()
+	a := testConn(t, hub.Conn(macA), macA, nil)
+	b := testConn(t, hub.Conn(macB), macB, nil)
+
+	if _, err := a.WriteTo([]byte("hello world"), &raw.Addr{HardwareAddr: macB}); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+
+	buf := make([]byte, 5)
+	n, _, err := b.ReadFrom(buf)
+	if !errors.Is(err, io.ErrShortBuffer) {
+		t.Fatalf("expected io.ErrShortBuffer, but got: %v", err)
+	}
+	if diff := cmp.Diff("hello", string(buf[:n])); diff != "" {
+		t.Fatalf("unexpected message (-want +got):\n%s", diff)
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	tests := []struct {
+		name      string
+		ifi       *net.Interface
+		etherType ethernet.EtherType
+		cfg       *fragment.Config
+	}{
+		{
+			name:      "hardware address",
+			ifi:       &net.Interface{MTU: 1500},
+			etherType: etherType,
+		},
+		{
+			name:      "EtherType",
+			ifi:       &net.Interface{MTU: 1500, HardwareAddr: macA},
+			etherType: 1500,
+		},
+		{
+			name:      "message size",
+			ifi:       &net.Interface{MTU: 1500, HardwareAddr: macA},
+			etherType: etherType,
+			cfg:       &fragment.Config{MaxMessageSize: 1 << 30},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := fragment.New(tt.ifi, rawtest.NewHub().Conn(macA), tt.etherType, tt.cfg); err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+		})
+	}
+}
+
+func testConn(t *testing.T, p net.PacketConn, mac net.HardwareAddr, cfg *fragment.Config) *fragment.Conn {
+	t.Helper()
+
+	c, err := fragment.New(&net.Interface{MTU: 1500, HardwareAddr: mac}, p, etherType, cfg)
+	if err != nil {
+		t.Fatalf("failed to create conn: %v", err)
+	}
+	t.Cleanup(func() { _ = c.Close() })
+
+	return c
+}
+
+// frame builds an Ethernet frame carrying a single fragment.
+func frame(src, dst net.HardwareAddr, id uint32, index, count uint16, payload []byte) []byte {
+	b := make([]byte, 12+len(payload))
+	b[0] = 1
+	binary.BigEndian.PutUint16(b[2:4], index)
+	binary.BigEndian.PutUint16(b[4:6], count)
+	binary.BigEndian.PutUint32(b[6:10], id)
+	binary.BigEndian.PutUint16(b[10:12], uint16(len(payload)))
+	copy(b[12:], payload)
+
+	fb, err := (&ethernet.Frame{
+		Destination: dst,
+		Source:      src,
+		EtherType:   etherType,
+		Payload:     b,
+	}).MarshalBinary()
+	if err != nil {
+		panic(err)
+	}
+
+	return fb
+}
@@ -6,8 +6,10 @@ go 1.17
 
 require (
 	github.com/google/go-cmp v0.5.6
+	github.com/klauspost/compress v1.15.15
 	github.com/mdlayher/packet v0.0.0-20220221164757-67998ac0ff93
-	golang.org/x/net v0.0.0-20190503192946-f4e77d36d62c
+	golang.org/x/crypto v0.0.0-20220214200702-86341886e292
+	golang.org/x/net v0.0.0-20211112202133-69e39bad7dc2
 	golang.org/x/sys v0.0.0-20220209214540-3681064d5158
 )
 
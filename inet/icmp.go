@@ -0,0 +1,141 @@
+package inet
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+)
+
+// ICMPHeaderLen is the length of the ICMP and ICMPv6 type, code, and
+// checksum fields.
+const ICMPHeaderLen = 4
+
+// Common ICMP and ICMPv6 message types.
+const (
+	ICMPTypeEchoReply     = 0
+	ICMPTypeEchoRequest   = 8
+	ICMPv6TypeEchoRequest = 128
+	ICMPv6TypeEchoReply   = 129
+)
+
+// An ICMPMessage is an ICMP or ICMPv6 message, as described in RFC 792 and
+// RFC 4443.
+type ICMPMessage struct {
+	Type uint8
+	Code uint8
+
+	// Body is the remainder of the message following the checksum field,
+	// such as the output of Echo.MarshalBinary.
+	Body []byte
+}
+
+// MarshalICMP produces an ICMP message for IPv4, computing its checksum.
+func (m *ICMPMessage) MarshalICMP() []byte {
+	b := m.marshal()
+	binary.BigEndian.PutUint16(b[2:4], Checksum(b))
+	return b
+}
+
+// MarshalICMPv6 produces an ICMPv6 message, computing its checksum over the
+// IPv6 pseudo-header formed from src and dst.
+func (m *ICMPMessage) MarshalICMPv6(src, dst net.IP) ([]byte, error) {
+	if !isIPv6(src) || !isIPv6(dst) {
+		return nil, errInvalidIPv6
+	}
+
+	b := m.marshal()
+	csum, err := PseudoHeaderChecksum(ProtocolICMPv6, src, dst, b)
+	if err != nil {
+		return nil, err
+	}
+	binary.BigEndian.PutUint16(b[2:4], csum)
+
+	return b, nil
+}
+
+// marshal produces an ICMP message with a zero checksum.
+func (m *ICMPMessage) marshal() []byte {
+	b := make([]byte, ICMPHeaderLen+len(m.Body))
+	b[0] = m.Type
+	b[1] = m.Code
+	copy(b[ICMPHeaderLen:], m.Body)
+
+	return b
+}
+
+// ParseICMP parses an ICMP message for IPv4 from b, verifying its checksum.
+// Body refers to the input slice.
+func ParseICMP(b []byte) (*ICMPMessage, error) {
+	if len(b) < ICMPHeaderLen {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if Checksum(b) != 0 {
+		return nil, errChecksum
+	}
+
+	return parseICMP(b), nil
+}
+
+// ParseICMPv6 parses an ICMPv6 message from b, verifying its checksum using
+// the IPv6 pseudo-header formed from src and dst. Body refers to the input
+// slice.
+func ParseICMPv6(b []byte, src, dst net.IP) (*ICMPMessage, error) {
+	if len(b) < ICMPHeaderLen {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if !isIPv6(src) || !isIPv6(dst) {
+		return nil, errInvalidIPv6
+	}
+
+	csum, err := PseudoHeaderChecksum(ProtocolICMPv6, src, dst, b)
+	if err != nil {
+		return nil, err
+	}
+	if csum != 0 {
+		return nil, errChecksum
+	}
+
+	return parseICMP(b), nil
+}
+
+// parseICMP parses an ICMP message without verifying its checksum.
+func parseICMP(b []byte) *ICMPMessage {
+	return &ICMPMessage{
+		Type: b[0],
+		Code: b[1],
+		Body: b[ICMPHeaderLen:],
+	}
+}
+
+// An Echo is the body of an ICMP or ICMPv6 echo request or reply.
+type Echo struct {
+	ID   uint16
+	Seq  uint16
+	Data []byte
+}
+
+// MarshalBinary allocates a byte slice containing the data from an Echo.
+func (e *Echo) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 4+len(e.Data))
+	binary.BigEndian.PutUint16(b[0:2], e.ID)
+	binary.BigEndian.PutUint16(b[2:4], e.Seq)
+	copy(b[4:], e.Data)
+
+	return b, nil
+}
+
+// UnmarshalBinary unmarshals a byte slice into an Echo. Data refers to the
+// input slice.
+func (e *Echo) UnmarshalBinary(b []byte) error {
+	if len(b) < 4 {
+		return io.ErrUnexpectedEOF
+	}
+
+	*e = Echo{
+		ID:   binary.BigEndian.Uint16(b[0:2]),
+		Seq:  binary.BigEndian.Uint16(b[2:4]),
+		Data: b[4:],
+	}
+
+	return nil
+}
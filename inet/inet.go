@@ -0,0 +1,99 @@
+// Package inet implements lightweight IPv4, IPv6, UDP, ICMP, and ICMPv6
+// header encoding and decoding, including checksum computation.
+//
+// These types allow callers to build complete frames for *raw.Conn.WriteTo
+// on interfaces which have no IP address configured, by wrapping the output
+// of this package in an ethernet.Frame.
+package inet
+
+import (
+	"errors"
+	"net"
+)
+
+var (
+	// errInvalidIPv4 and errInvalidIPv6 are returned when an IP address does
+	// not match the header's address family.
+	errInvalidIPv4 = errors.New("inet: invalid IPv4 address")
+	errInvalidIPv6 = errors.New("inet: invalid IPv6 address")
+
+	// errChecksum is returned when a checksum is invalid.
+	errChecksum = errors.New("inet: invalid checksum")
+)
+
+// A Protocol is an IP protocol number, used in the IPv4 protocol and IPv6
+// next header fields.
+type Protocol uint8
+
+// Protocol values supported by this package.
+const (
+	ProtocolICMP   Protocol = 1
+	ProtocolTCP    Protocol = 6
+	ProtocolUDP    Protocol = 17
+	ProtocolICMPv6 Protocol = 58
+)
+
+// Checksum computes the Internet checksum of b, as described in RFC 1071.
+// When b contains a valid checksum field, the result is zero.
+func Checksum(b []byte) uint16 {
+	return fold(sum(0, b))
+}
+
+// PseudoHeaderChecksum computes the Internet checksum of the upper layer
+// packet b, including the IPv4 or IPv6 pseudo-header formed from proto and
+// the addresses src and dst, as described in RFC 768 and RFC 8200. The
+// address family is determined by src and dst, which must match.
+func PseudoHeaderChecksum(proto Protocol, src, dst net.IP, b []byte) (uint16, error) {
+	var s uint32
+	switch {
+	case src.To4() != nil && dst.To4() != nil:
+		s = sum(s, src.To4())
+		s = sum(s, dst.To4())
+	case isIPv6(src) && isIPv6(dst):
+		s = sum(s, src)
+		s = sum(s, dst)
+	default:
+		return 0, errors.New("inet: mismatched or invalid pseudo-header addresses")
+	}
+
+	// The upper layer length is 16 bits for IPv4 and 32 bits for IPv6, but the
+	// sum is the same for any valid length.
+	s += uint32(len(b)) >> 16
+	s += uint32(len(b)) & 0xffff
+	s += uint32(proto)
+
+	return fold(sum(s, b)), nil
+}
+
+// sum adds b to the running one's complement sum s.
+func sum(s uint32, b []byte) uint32 {
+	for i := 0; i+1 < len(b); i += 2 {
+		s += uint32(b[i])<<8 | uint32(b[i+1])
+	}
+	if len(b)%2 == 1 {
+		s += uint32(b[len(b)-1]) << 8
+	}
+
+	return s
+}
+
+// fold folds a running sum into 16 bits and returns its complement.
+func fold(s uint32) uint16 {
+	for s > 0xffff {
+		s = s>>16 + s&0xffff
+	}
+
+	return ^uint16(s)
+}
+
+// isIPv6 reports whether ip is an IPv6 address.
+func isIPv6(ip net.IP) bool {
+	return len(ip) == net.IPv6len && ip.To4() == nil
+}
+
+// copyIP returns a copy of the IP address in b.
+func copyIP(b []byte) net.IP {
+	ip := make(net.IP, len(b))
+	copy(ip, b)
+	return ip
+}
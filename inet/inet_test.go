@@ -0,0 +1,263 @@
+package inet_test
+
+import (
+	"net"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/raw/inet"
+)
+
+func TestIPv4HeaderChecksum(t *testing.T) {
+	// The example IPv4 header from the Wikipedia article on the IPv4 header
+	// checksum, with a known checksum of 0xb861.
+	h := &inet.IPv4Header{
+		ID:          0,
+		Flags:       inet.DontFragment,
+		TTL:         64,
+		Protocol:    inet.ProtocolUDP,
+		Source:      net.IPv4(192, 168, 0, 1),
+		Destination: net.IPv4(192, 168, 0, 199),
+	}
+
+	b, err := h.Marshal(make([]byte, 0x73-inet.IPv4HeaderLen))
+	if err != nil {
+		t.Fatalf("failed to marshal: %v", err)
+	}
+
+	want := []byte{
+		0x45, 0x00, 0x00, 0x73,
+		0x00, 0x00, 0x40, 0x00,
+		0x40, 0x11, 0xb8, 0x61,
+		0xc0, 0xa8, 0x00, 0x01,
+		0xc0, 0xa8, 0x00, 0xc7,
+	}
+	if diff := cmp.Diff(want, b[:inet.IPv4HeaderLen]); diff != "" {
+		t.Fatalf("unexpected header bytes (-want +got):\n%s", diff)
+	}
+}
+
+func TestIPv4MarshalParse(t *testing.T) {
+	h := &inet.IPv4Header{
+		TOS:         0x10,
+		ID:          0x1234,
+		Flags:       inet.MoreFragments,
+		TTL:         1,
+		Protocol:    inet.ProtocolICMP,
+		Source:      net.IPv4(192, 0, 2, 1).To4(),
+		Destination: net.IPv4(198, 51, 100, 1).To4(),
+		Options:     []byte{0x94, 0x04, 0x00, 0x00},
+	}
+	payload := []byte("hello")
+
+	b, err := h.Marshal(payload)
+	if err != nil {
+		t.Fatalf("failed to marshal: %v", err)
+	}
+
+	// Simulate Ethernet padding, which must be trimmed.
+	b = append(b, make([]byte, 16)...)
+
+	got, gotPayload, err := inet.ParseIPv4(b)
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+
+	if diff := cmp.Diff(h, got); diff != "" {
+		t.Fatalf("unexpected header (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(payload, gotPayload); diff != "" {
+		t.Fatalf("unexpected payload (-want +got):\n%s", diff)
+	}
+
+	// Corrupt the TTL, invalidating the checksum.
+	b[8]++
+	if _, _, err := inet.ParseIPv4(b); err == nil {
+		t.Fatal("expected checksum error, but none occurred")
+	}
+}
+
+func TestIPv6MarshalParse(t *testing.T) {
+	h := &inet.IPv6Header{
+		TrafficClass: 0xb8,
+		FlowLabel:    0xabcde,
+		NextHeader:   inet.ProtocolUDP,
+		HopLimit:     64,
+		Source:       net.ParseIP("2001:db8::1"),
+		Destination:  net.ParseIP("2001:db8::2"),
+	}
+	payload := []byte("hello")
+
+	b, err := h.Marshal(payload)
+	if err != nil {
+		t.Fatalf("failed to marshal: %v", err)
+	}
+
+	got, gotPayload, err := inet.ParseIPv6(append(b, 0, 0, 0))
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+
+	if diff := cmp.Diff(h, got); diff != "" {
+		t.Fatalf("unexpected header (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(payload, gotPayload); diff != "" {
+		t.Fatalf("unexpected payload (-want +got):\n%s", diff)
+	}
+}
+
+func TestUDPMarshalParse(t *testing.T) {
+	tests := []struct {
+		name     string
+		src, dst net.IP
+	}{
+		{
+			name: "IPv4",
+			src:  net.IPv4(192, 0, 2, 1),
+			dst:  net.IPv4bcast,
+		},
+		{
+			name: "IPv6",
+			src:  net.ParseIP("fe80::1"),
+			dst:  net.ParseIP("ff02::1:2"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &inet.UDPHeader{
+				SourcePort:      68,
+				DestinationPort: 67,
+			}
+			payload := []byte("hello, world")
+
+			b, err := h.Marshal(payload, tt.src, tt.dst)
+			if err != nil {
+				t.Fatalf("failed to marshal: %v", err)
+			}
+
+			got, gotPayload, err := inet.ParseUDP(b, tt.src, tt.dst)
+			if err != nil {
+				t.Fatalf("failed to parse: %v", err)
+			}
+
+			if diff := cmp.Diff(h, got); diff != "" {
+				t.Fatalf("unexpected header (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(payload, gotPayload); diff != "" {
+				t.Fatalf("unexpected payload (-want +got):\n%s", diff)
+			}
+
+			// Corrupt the payload, invalidating the checksum.
+			b[len(b)-1]++
+			if _, _, err := inet.ParseUDP(b, tt.src, tt.dst); err == nil {
+				t.Fatal("expected checksum error, but none occurred")
+			}
+		})
+	}
+}
+
+func TestUDPParseNoChecksum(t *testing.T) {
+	b := []byte{
+		0x00, 0x44, 0x00, 0x43,
+		0x00, 0x09, 0x00, 0x00,
+		0xff,
+	}
+
+	// Zero checksums are permitted for IPv4, but not for IPv6.
+	if _, _, err := inet.ParseUDP(b, net.IPv4zero, net.IPv4bcast); err != nil {
+		t.Fatalf("failed to parse IPv4 datagram: %v", err)
+	}
+	if _, _, err := inet.ParseUDP(b, net.IPv6loopback, net.IPv6loopback); err == nil {
+		t.Fatal("expected IPv6 checksum error, but none occurred")
+	}
+}
+
+func TestICMPEcho(t *testing.T) {
+	echo := &inet.Echo{
+		ID:   1,
+		Seq:  2,
+		Data: []byte("ping"),
+	}
+
+	body, err := echo.MarshalBinary()
+	if err != nil {
+		t.Fatalf("failed to marshal echo: %v", err)
+	}
+
+	var (
+		src = net.ParseIP("2001:db8::1")
+		dst = net.ParseIP("2001:db8::2")
+	)
+
+	tests := []struct {
+		name  string
+		m     *inet.ICMPMessage
+		build func(m *inet.ICMPMessage) ([]byte, error)
+		parse func(b []byte) (*inet.ICMPMessage, error)
+	}{
+		{
+			name: "ICMP",
+			m: &inet.ICMPMessage{
+				Type: inet.ICMPTypeEchoRequest,
+				Body: body,
+			},
+			build: func(m *inet.ICMPMessage) ([]byte, error) {
+				return m.MarshalICMP(), nil
+			},
+			parse: inet.ParseICMP,
+		},
+		{
+			name: "ICMPv6",
+			m: &inet.ICMPMessage{
+				Type: inet.ICMPv6TypeEchoRequest,
+				Body: body,
+			},
+			build: func(m *inet.ICMPMessage) ([]byte, error) {
+				return m.MarshalICMPv6(src, dst)
+			},
+			parse: func(b []byte) (*inet.ICMPMessage, error) {
+				return inet.ParseICMPv6(b, src, dst)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := tt.build(tt.m)
+			if err != nil {
+				t.Fatalf("failed to marshal: %v", err)
+			}
+
+			m, err := tt.parse(b)
+			if err != nil {
+				t.Fatalf("failed to parse: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.m, m); diff != "" {
+				t.Fatalf("unexpected message (-want +got):\n%s", diff)
+			}
+
+			var got inet.Echo
+			if err := got.UnmarshalBinary(m.Body); err != nil {
+				t.Fatalf("failed to unmarshal echo: %v", err)
+			}
+
+			if diff := cmp.Diff(echo, &got); diff != "" {
+				t.Fatalf("unexpected echo (-want +got):\n%s", diff)
+			}
+
+			b[len(b)-1]++
+			if _, err := tt.parse(b); err == nil {
+				t.Fatal("expected checksum error, but none occurred")
+			}
+		})
+	}
+}
+
+func TestPseudoHeaderChecksumMismatch(t *testing.T) {
+	_, err := inet.PseudoHeaderChecksum(inet.ProtocolUDP, net.IPv4(192, 0, 2, 1), net.IPv6loopback, nil)
+	if err == nil {
+		t.Fatal("expected an error, but none occurred")
+	}
+}
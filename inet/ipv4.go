@@ -0,0 +1,117 @@
+package inet
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+)
+
+// IPv4HeaderLen is the length of an IPv4 header without options.
+const IPv4HeaderLen = 20
+
+// IPv4Flags are the flags of an IPv4 header.
+type IPv4Flags uint8
+
+// Possible IPv4Flags values.
+const (
+	MoreFragments IPv4Flags = 1 << 0
+	DontFragment  IPv4Flags = 1 << 1
+)
+
+// An IPv4Header is an IPv4 header, as described in RFC 791.
+type IPv4Header struct {
+	TOS            uint8
+	ID             uint16
+	Flags          IPv4Flags
+	FragmentOffset uint16
+	TTL            uint8
+	Protocol       Protocol
+	Source         net.IP
+	Destination    net.IP
+
+	// Options are the raw bytes of any IPv4 options. The length of Options
+	// must be a multiple of 4 bytes.
+	Options []byte
+}
+
+// Marshal produces an IPv4 packet carrying payload, computing the total
+// length and header checksum fields.
+func (h *IPv4Header) Marshal(payload []byte) ([]byte, error) {
+	src, dst := h.Source.To4(), h.Destination.To4()
+	if src == nil || dst == nil {
+		return nil, errInvalidIPv4
+	}
+
+	if len(h.Options)%4 != 0 || len(h.Options) > 40 {
+		return nil, fmt.Errorf("inet: invalid IPv4 options length: %d", len(h.Options))
+	}
+	if h.FragmentOffset > 0x1fff {
+		return nil, fmt.Errorf("inet: invalid IPv4 fragment offset: %d", h.FragmentOffset)
+	}
+
+	hl := IPv4HeaderLen + len(h.Options)
+	if hl+len(payload) > 0xffff {
+		return nil, errors.New("inet: IPv4 packet too large")
+	}
+
+	b := make([]byte, hl+len(payload))
+	b[0] = 4<<4 | uint8(hl/4)
+	b[1] = h.TOS
+	binary.BigEndian.PutUint16(b[2:4], uint16(len(b)))
+	binary.BigEndian.PutUint16(b[4:6], h.ID)
+	binary.BigEndian.PutUint16(b[6:8], uint16(h.Flags&0x7)<<13|h.FragmentOffset)
+	b[8] = h.TTL
+	b[9] = uint8(h.Protocol)
+	copy(b[12:16], src)
+	copy(b[16:20], dst)
+	copy(b[20:hl], h.Options)
+
+	binary.BigEndian.PutUint16(b[10:12], Checksum(b[:hl]))
+	copy(b[hl:], payload)
+
+	return b, nil
+}
+
+// ParseIPv4 parses an IPv4 packet from b, verifying its header checksum. It
+// returns the header and the payload, with any trailing link layer padding
+// removed. The payload refers to the input slice.
+func ParseIPv4(b []byte) (*IPv4Header, []byte, error) {
+	if len(b) < IPv4HeaderLen {
+		return nil, nil, io.ErrUnexpectedEOF
+	}
+
+	if v := b[0] >> 4; v != 4 {
+		return nil, nil, fmt.Errorf("inet: invalid IPv4 version: %d", v)
+	}
+
+	hl := int(b[0]&0x0f) * 4
+	tl := int(binary.BigEndian.Uint16(b[2:4]))
+	if hl < IPv4HeaderLen || tl < hl || len(b) < tl {
+		return nil, nil, io.ErrUnexpectedEOF
+	}
+
+	if Checksum(b[:hl]) != 0 {
+		return nil, nil, errChecksum
+	}
+
+	frag := binary.BigEndian.Uint16(b[6:8])
+	h := &IPv4Header{
+		TOS:            b[1],
+		ID:             binary.BigEndian.Uint16(b[4:6]),
+		Flags:          IPv4Flags(frag >> 13),
+		FragmentOffset: frag & 0x1fff,
+		TTL:            b[8],
+		Protocol:       Protocol(b[9]),
+		Source:         copyIP(b[12:16]),
+		Destination:    copyIP(b[16:20]),
+	}
+
+	if hl > IPv4HeaderLen {
+		h.Options = make([]byte, hl-IPv4HeaderLen)
+		copy(h.Options, b[IPv4HeaderLen:hl])
+	}
+
+	return h, b[hl:tl], nil
+}
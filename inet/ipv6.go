@@ -0,0 +1,81 @@
+package inet
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+)
+
+// IPv6HeaderLen is the length of a fixed IPv6 header.
+const IPv6HeaderLen = 40
+
+// An IPv6Header is a fixed IPv6 header, as described in RFC 8200. Extension
+// headers are not interpreted, and are treated as part of the payload.
+type IPv6Header struct {
+	TrafficClass uint8
+
+	// FlowLabel is a 20-bit value.
+	FlowLabel   uint32
+	NextHeader  Protocol
+	HopLimit    uint8
+	Source      net.IP
+	Destination net.IP
+}
+
+// Marshal produces an IPv6 packet carrying payload, computing the payload
+// length field.
+func (h *IPv6Header) Marshal(payload []byte) ([]byte, error) {
+	if !isIPv6(h.Source) || !isIPv6(h.Destination) {
+		return nil, errInvalidIPv6
+	}
+
+	if h.FlowLabel > 0xfffff {
+		return nil, fmt.Errorf("inet: invalid IPv6 flow label: %#x", h.FlowLabel)
+	}
+	if len(payload) > 0xffff {
+		return nil, errors.New("inet: IPv6 payload too large")
+	}
+
+	b := make([]byte, IPv6HeaderLen+len(payload))
+	binary.BigEndian.PutUint32(b[0:4], 6<<28|uint32(h.TrafficClass)<<20|h.FlowLabel)
+	binary.BigEndian.PutUint16(b[4:6], uint16(len(payload)))
+	b[6] = uint8(h.NextHeader)
+	b[7] = h.HopLimit
+	copy(b[8:24], h.Source)
+	copy(b[24:40], h.Destination)
+	copy(b[40:], payload)
+
+	return b, nil
+}
+
+// ParseIPv6 parses an IPv6 packet from b. It returns the header and the
+// payload, with any trailing link layer padding removed. The payload refers
+// to the input slice.
+func ParseIPv6(b []byte) (*IPv6Header, []byte, error) {
+	if len(b) < IPv6HeaderLen {
+		return nil, nil, io.ErrUnexpectedEOF
+	}
+
+	vtf := binary.BigEndian.Uint32(b[0:4])
+	if v := vtf >> 28; v != 6 {
+		return nil, nil, fmt.Errorf("inet: invalid IPv6 version: %d", v)
+	}
+
+	pl := int(binary.BigEndian.Uint16(b[4:6]))
+	if len(b) < IPv6HeaderLen+pl {
+		return nil, nil, io.ErrUnexpectedEOF
+	}
+
+	h := &IPv6Header{
+		TrafficClass: uint8(vtf >> 20),
+		FlowLabel:    vtf & 0xfffff,
+		NextHeader:   Protocol(b[6]),
+		HopLimit:     b[7],
+		Source:       copyIP(b[8:24]),
+		Destination:  copyIP(b[24:40]),
+	}
+
+	return h, b[IPv6HeaderLen : IPv6HeaderLen+pl], nil
+}
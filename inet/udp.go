@@ -0,0 +1,81 @@
+package inet
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+)
+
+// UDPHeaderLen is the length of a UDP header.
+const UDPHeaderLen = 8
+
+// A UDPHeader is a UDP header, as described in RFC 768.
+type UDPHeader struct {
+	SourcePort      uint16
+	DestinationPort uint16
+}
+
+// Marshal produces a UDP datagram carrying payload, computing the length
+// field and the checksum over the pseudo-header formed from the IPv4 or IPv6
+// addresses src and dst.
+func (h *UDPHeader) Marshal(payload []byte, src, dst net.IP) ([]byte, error) {
+	if UDPHeaderLen+len(payload) > 0xffff {
+		return nil, errors.New("inet: UDP datagram too large")
+	}
+
+	b := make([]byte, UDPHeaderLen+len(payload))
+	binary.BigEndian.PutUint16(b[0:2], h.SourcePort)
+	binary.BigEndian.PutUint16(b[2:4], h.DestinationPort)
+	binary.BigEndian.PutUint16(b[4:6], uint16(len(b)))
+	copy(b[UDPHeaderLen:], payload)
+
+	csum, err := PseudoHeaderChecksum(ProtocolUDP, src, dst, b)
+	if err != nil {
+		return nil, err
+	}
+
+	// A computed checksum of zero is transmitted as all ones, because zero
+	// indicates that no checksum was computed.
+	if csum == 0 {
+		csum = 0xffff
+	}
+	binary.BigEndian.PutUint16(b[6:8], csum)
+
+	return b, nil
+}
+
+// ParseUDP parses a UDP datagram from b, verifying its checksum using the
+// pseudo-header formed from the IPv4 or IPv6 addresses src and dst. It
+// returns the header and the payload, which refers to the input slice.
+//
+// A zero checksum is accepted for IPv4, where the checksum is optional, but
+// rejected for IPv6.
+func ParseUDP(b []byte, src, dst net.IP) (*UDPHeader, []byte, error) {
+	if len(b) < UDPHeaderLen {
+		return nil, nil, io.ErrUnexpectedEOF
+	}
+
+	l := int(binary.BigEndian.Uint16(b[4:6]))
+	if l < UDPHeaderLen || len(b) < l {
+		return nil, nil, io.ErrUnexpectedEOF
+	}
+	b = b[:l]
+
+	if binary.BigEndian.Uint16(b[6:8]) != 0 || src.To4() == nil {
+		csum, err := PseudoHeaderChecksum(ProtocolUDP, src, dst, b)
+		if err != nil {
+			return nil, nil, err
+		}
+		if csum != 0 {
+			return nil, nil, errChecksum
+		}
+	}
+
+	h := &UDPHeader{
+		SourcePort:      binary.BigEndian.Uint16(b[0:2]),
+		DestinationPort: binary.BigEndian.Uint16(b[2:4]),
+	}
+
+	return h, b[UDPHeaderLen:], nil
+}
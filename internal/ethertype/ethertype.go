@@ -0,0 +1,41 @@
+// Package ethertype parses the EtherType names and numbers accepted by the
+// commands in this module.
+package ethertype
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/mdlayher/raw/ethernet"
+)
+
+// names maps the lowercase names of common EtherTypes to their values.
+var names = map[string]ethernet.EtherType{
+	"ipv4":  ethernet.EtherTypeIPv4,
+	"arp":   ethernet.EtherTypeARP,
+	"wol":   ethernet.EtherTypeWOL,
+	"vlan":  ethernet.EtherTypeVLAN,
+	"ipv6":  ethernet.EtherTypeIPv6,
+	"slow":  ethernet.EtherTypeSlowProtocols,
+	"eapol": ethernet.EtherTypeEAPOL,
+	"lldp":  ethernet.EtherTypeLLDP,
+	"ptp":   ethernet.EtherTypePTP,
+	"cfm":   ethernet.EtherTypeCFM,
+}
+
+// Parse parses an EtherType name, such as arp or ipv6, or number. Numbers no
+// larger than 1500 are permitted, and are IEEE 802.3 length fields rather
+// than EtherTypes.
+func Parse(s string) (ethernet.EtherType, error) {
+	if et, ok := names[strings.ToLower(s)]; ok {
+		return et, nil
+	}
+
+	n, err := strconv.ParseUint(s, 0, 16)
+	if err != nil {
+		return 0, fmt.Errorf("invalid EtherType %q", s)
+	}
+
+	return ethernet.EtherType(n), nil
+}
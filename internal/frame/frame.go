@@ -0,0 +1,56 @@
+// Package frame provides helpers shared by packages which read Ethernet
+// frames from a net.PacketConn.
+package frame
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// BufferSize returns a read buffer size large enough for any Ethernet frame
+// received on ifi.
+func BufferSize(ifi *net.Interface) int {
+	mtu := ifi.MTU
+	if mtu <= 0 {
+		mtu = 1500
+	}
+
+	// Ethernet header with an optional VLAN tag.
+	return mtu + 14 + 4
+}
+
+// IsTimeout reports whether err is a timeout.
+func IsTimeout(err error) bool {
+	var nerr net.Error
+	return errors.As(err, &nerr) && nerr.Timeout()
+}
+
+// CancelReads unblocks reads from p once ctx is canceled by setting a read
+// deadline in the past. The returned function must be called when reading is
+// complete. It waits for CancelReads to stop watching ctx, so the deadline
+// cannot be expired afterward, and clears the read deadline so that p may be
+// used for future operations.
+func CancelReads(ctx context.Context, p net.PacketConn) (stop func()) {
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+		select {
+		case <-ctx.Done():
+			// Unblock the pending read.
+			_ = p.SetReadDeadline(time.Unix(1, 0))
+		case <-done:
+		}
+	}()
+
+	return func() {
+		close(done)
+		wg.Wait()
+		_ = p.SetReadDeadline(time.Time{})
+	}
+}
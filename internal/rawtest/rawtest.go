@@ -0,0 +1,346 @@
+// Package rawtest provides an in-memory Ethernet segment for testing code
+// which is built on top of a *raw.Conn, without requiring privileges or
+// network interfaces.
+package rawtest
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mdlayher/raw"
+	"github.com/mdlayher/raw/ethernet"
+	"github.com/mdlayher/raw/pcap"
+)
+
+// queueLen is the number of frames which may be queued for a Conn before
+// additional frames are dropped, as a real network would.
+const queueLen = 1024
+
+// A Hub is a shared Ethernet segment which forwards frames between the Conns
+// attached to it.
+type Hub struct {
+	mu    sync.Mutex
+	conns []*Conn
+}
+
+// NewHub creates an empty Hub.
+func NewHub() *Hub {
+	return &Hub{}
+}
+
+// Conn attaches a new Conn to the Hub using the input hardware address.
+func (h *Hub) Conn(mac net.HardwareAddr) *Conn {
+	c := &Conn{
+		hub:     h,
+		mac:     mac,
+		rx:      make(chan []byte, queueLen),
+		done:    make(chan struct{}),
+		changed: make(chan struct{}),
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.conns = append(h.conns, c)
+
+	return c
+}
+
+// forward delivers a frame from src to all other Conns which would accept it.
+func (h *Hub) forward(src *Conn, b []byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, c := range h.conns {
+		if c == src || !c.accepts(b) {
+			continue
+		}
+
+		// Every recipient receives its own copy of the frame.
+		cb := make([]byte, len(b))
+		copy(cb, b)
+
+		select {
+		case c.rx <- cb:
+		default:
+			// Queue is full, drop the frame.
+		}
+	}
+}
+
+var _ net.PacketConn = &Conn{}
+
+// A Conn is an in-memory net.PacketConn attached to a Hub. Frames written to a
+// Conn must include an Ethernet header, just as they would for a *raw.Conn
+// opened with the default configuration.
+type Conn struct {
+	hub *Hub
+	mac net.HardwareAddr
+
+	rx        chan []byte
+	done      chan struct{}
+	closeOnce sync.Once
+
+	mu sync.Mutex
+	// Closed and replaced whenever the read deadline changes.
+	changed      chan struct{}
+	rdeadline    time.Time
+	promiscuous  bool
+	closed       bool
+	writeHistory [][]byte
+	onWrite      func()
+}
+
+// ReadFrom implements the net.PacketConn ReadFrom method.
+func (c *Conn) ReadFrom(b []byte) (int, net.Addr, error) {
+	for {
+		c.mu.Lock()
+		deadline, changed := c.rdeadline, c.changed
+		c.mu.Unlock()
+
+		var (
+			t       *time.Timer
+			timeout <-chan time.Time
+		)
+		if !deadline.IsZero() {
+			d := time.Until(deadline)
+			if d <= 0 {
+				return 0, nil, os.ErrDeadlineExceeded
+			}
+
+			t = time.NewTimer(d)
+			timeout = t.C
+		}
+
+		stop := func() {
+			if t != nil {
+				t.Stop()
+			}
+		}
+
+		select {
+		case frame := <-c.rx:
+			stop()
+			n := copy(b, frame)
+
+			var src net.HardwareAddr
+			if len(frame) >= 12 {
+				src = net.HardwareAddr(frame[6:12])
+			}
+
+			return n, &raw.Addr{HardwareAddr: src}, nil
+		case <-c.done:
+			stop()
+			return 0, nil, net.ErrClosed
+		case <-timeout:
+			return 0, nil, os.ErrDeadlineExceeded
+		case <-changed:
+			// Deadline updated, recompute the timeout.
+			stop()
+		}
+	}
+}
+
+// WriteTo implements the net.PacketConn WriteTo method. The frame is forwarded
+// by the Hub according to the destination address in its Ethernet header.
+func (c *Conn) WriteTo(b []byte, _ net.Addr) (int, error) {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return 0, net.ErrClosed
+	}
+
+	cb := make([]byte, len(b))
+	copy(cb, b)
+	c.writeHistory = append(c.writeHistory, cb)
+	onWrite := c.onWrite
+	c.mu.Unlock()
+
+	if onWrite != nil {
+		onWrite()
+	}
+
+	c.hub.forward(c, b)
+	return len(b), nil
+}
+
+// OnWrite sets a function which is called each time a frame is written to the
+// Conn, before the frame is forwarded. It allows tests to act at a precise
+// point in an exchange. A nil function removes the hook.
+func (c *Conn) OnWrite(fn func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.onWrite = fn
+}
+
+// Written returns a copy of every frame written to the Conn, in order.
+func (c *Conn) Written() [][]byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	out := make([][]byte, len(c.writeHistory))
+	copy(out, c.writeHistory)
+	return out
+}
+
+// Close closes the connection.
+func (c *Conn) Close() error {
+	c.closeOnce.Do(func() {
+		c.mu.Lock()
+		c.closed = true
+		c.mu.Unlock()
+
+		close(c.done)
+	})
+
+	return nil
+}
+
+// LocalAddr returns the local network address.
+func (c *Conn) LocalAddr() net.Addr {
+	return &raw.Addr{HardwareAddr: c.mac}
+}
+
+// SetDeadline implements the net.PacketConn SetDeadline method.
+func (c *Conn) SetDeadline(t time.Time) error {
+	return c.SetReadDeadline(t)
+}
+
+// SetReadDeadline implements the net.PacketConn SetReadDeadline method.
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.rdeadline = t
+	close(c.changed)
+	c.changed = make(chan struct{})
+
+	return nil
+}
+
+// SetWriteDeadline implements the net.PacketConn SetWriteDeadline method.
+// Writes never block, so the deadline is ignored.
+func (c *Conn) SetWriteDeadline(_ time.Time) error {
+	return nil
+}
+
+// SetPromiscuous enables or disables the reception of unicast frames which
+// are not addressed to the Conn.
+func (c *Conn) SetPromiscuous(b bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.promiscuous = b
+	return nil
+}
+
+// accepts reports whether the Conn would receive the frame b.
+func (c *Conn) accepts(b []byte) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return false
+	}
+	if c.promiscuous || len(b) < 6 {
+		return true
+	}
+
+	dst := net.HardwareAddr(b[0:6])
+
+	// Group addresses (broadcast and multicast) have the least significant bit
+	// of the first octet set.
+	return dst[0]&0x01 != 0 || bytes.Equal(dst, c.mac)
+}
+
+// Frame returns an Ethernet frame from src to dst with the specified
+// EtherType and payload, failing the test on error.
+func Frame(t *testing.T, dst, src net.HardwareAddr, et ethernet.EtherType, payload []byte) []byte {
+	t.Helper()
+
+	b, err := (&ethernet.Frame{
+		Destination: dst,
+		Source:      src,
+		EtherType:   et,
+		Payload:     payload,
+	}).MarshalBinary()
+	if err != nil {
+		t.Fatalf("failed to marshal frame: %v", err)
+	}
+
+	return b
+}
+
+// PcapFile returns an Ethernet pcap capture file containing frames, with
+// timestamps which begin at an arbitrary time and advance by interval,
+// failing the test on error.
+func PcapFile(t *testing.T, interval time.Duration, frames ...[]byte) *bytes.Reader {
+	t.Helper()
+
+	var buf bytes.Buffer
+	w, err := pcap.NewWriter(&buf, pcap.LinkTypeEthernet, nil)
+	if err != nil {
+		t.Fatalf("failed to create writer: %v", err)
+	}
+
+	ts := time.Unix(1000, 0)
+	for _, f := range frames {
+		if err := w.WritePacket(pcap.CaptureInfo{Timestamp: ts}, f); err != nil {
+			t.Fatalf("failed to write packet: %v", err)
+		}
+		ts = ts.Add(interval)
+	}
+
+	return bytes.NewReader(buf.Bytes())
+}
+
+// WriteFrames writes each frame to p, failing the test on error.
+func WriteFrames(t *testing.T, p net.PacketConn, frames ...[]byte) {
+	t.Helper()
+
+	for _, f := range frames {
+		if _, err := p.WriteTo(f, nil); err != nil {
+			t.Fatalf("failed to write: %v", err)
+		}
+	}
+}
+
+// maxMessage is the size of the buffers used to read messages.
+const maxMessage = 1 << 20
+
+// Read reads a message from c, waiting at most d.
+func Read(c net.PacketConn, d time.Duration) ([]byte, error) {
+	if err := c.SetReadDeadline(time.Now().Add(d)); err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, maxMessage)
+	n, _, err := c.ReadFrom(b)
+	if err != nil {
+		return nil, err
+	}
+
+	return b[:n], nil
+}
+
+// ReadMessage reads a message and its source from c, failing the test if none
+// arrives within 5 seconds.
+func ReadMessage(t *testing.T, c net.PacketConn) ([]byte, net.Addr) {
+	t.Helper()
+
+	if err := c.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatalf("failed to set deadline: %v", err)
+	}
+
+	b := make([]byte, maxMessage)
+	n, addr, err := c.ReadFrom(b)
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+
+	return b[:n], addr
+}
@@ -0,0 +1,402 @@
+package l2rpc
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/mdlayher/raw"
+	"github.com/mdlayher/raw/ethernet"
+	"github.com/mdlayher/raw/internal/frame"
+)
+
+// Default Config values.
+const (
+	defaultTimeout               = 5 * time.Second
+	defaultMaxConcurrentRequests = 64
+)
+
+// ErrClosed is returned by Call when the Conn is closed.
+var ErrClosed = errors.New("l2rpc: use of closed connection")
+
+// A Handler answers requests received by a Conn.
+type Handler interface {
+	// ServeL2RPC returns the response to req, received from src. If
+	// ServeL2RPC returns an error, its text is sent to the caller as an
+	// *Error instead of a response.
+	ServeL2RPC(src net.HardwareAddr, req []byte) ([]byte, error)
+}
+
+// The HandlerFunc type allows the use of an ordinary function as a Handler.
+type HandlerFunc func(src net.HardwareAddr, req []byte) ([]byte, error)
+
+// ServeL2RPC implements Handler.
+func (fn HandlerFunc) ServeL2RPC(src net.HardwareAddr, req []byte) ([]byte, error) {
+	return fn(src, req)
+}
+
+// A Config configures a Conn. The zero value of any field selects a default
+// value.
+type Config struct {
+	// Timeout is the time to wait for a response to a request whose
+	// context has no deadline. If zero, 5 seconds is used.
+	Timeout time.Duration
+
+	// Handler answers incoming requests, each in its own goroutine. If nil,
+	// incoming requests are ignored.
+	Handler Handler
+
+	// MaxConcurrentRequests is the maximum number of Handler invocations
+	// in progress at once. Requests received while the limit is reached
+	// are dropped, and their callers time out. If zero, 64 is used.
+	MaxConcurrentRequests int
+}
+
+// A Conn sends requests and receives responses over a single EtherType. A
+// Conn is safe for concurrent use.
+type Conn struct {
+	ifi       *net.Interface
+	p         net.PacketConn
+	etherType ethernet.EtherType
+	cfg       Config
+
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+
+	// Holds a token for each Handler invocation in progress.
+	sem chan struct{}
+
+	mu      sync.Mutex
+	id      uint32
+	pending map[uint32]*call
+	err     error
+}
+
+// A call is an outstanding request.
+type call struct {
+	dst net.HardwareAddr
+	res chan *message
+}
+
+// Dial creates a new Conn using the specified network interface and
+// EtherType. Dial opens a *raw.Conn which receives frames with the
+// EtherType. A nil Config selects the default values.
+func Dial(ifi *net.Interface, etherType ethernet.EtherType, cfg *Config) (*Conn, error) {
+	p, err := raw.ListenPacket(ifi, uint16(etherType), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := New(ifi, p, etherType, cfg)
+	if err != nil {
+		_ = p.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// New creates a new Conn using the specified network interface,
+// net.PacketConn, and EtherType. p must send and receive complete Ethernet
+// frames. The Conn reads from p until it is closed.
+func New(ifi *net.Interface, p net.PacketConn, etherType ethernet.EtherType, cfg *Config) (*Conn, error) {
+	if len(ifi.HardwareAddr) != 6 {
+		return nil, fmt.Errorf("l2rpc: invalid hardware address: %q", ifi.HardwareAddr)
+	}
+	if etherType <= 1500 {
+		return nil, fmt.Errorf("l2rpc: invalid EtherType: %s", etherType)
+	}
+
+	if cfg == nil {
+		cfg = &Config{}
+	}
+
+	if cfg.MaxConcurrentRequests < 0 {
+		return nil, fmt.Errorf("l2rpc: invalid maximum concurrent requests: %d", cfg.MaxConcurrentRequests)
+	}
+
+	conf := *cfg
+	if conf.Timeout == 0 {
+		conf.Timeout = defaultTimeout
+	}
+	if conf.MaxConcurrentRequests == 0 {
+		conf.MaxConcurrentRequests = defaultMaxConcurrentRequests
+	}
+
+	// Start from a random message ID so that responses to requests sent
+	// before a restart are unlikely to match new requests.
+	var idb [4]byte
+	if _, err := rand.Read(idb[:]); err != nil {
+		return nil, err
+	}
+
+	c := &Conn{
+		ifi:       ifi,
+		p:         p,
+		etherType: etherType,
+		cfg:       conf,
+		sem:       make(chan struct{}, conf.MaxConcurrentRequests),
+		id:        binary.BigEndian.Uint32(idb[:]),
+		pending:   make(map[uint32]*call),
+	}
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		c.readLoop()
+	}()
+
+	return c, nil
+}
+
+// Close closes the Conn's connection. Outstanding calls return ErrClosed.
+// Close does not wait for Handler invocations to return.
+func (c *Conn) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		c.mu.Lock()
+		c.err = ErrClosed
+		c.mu.Unlock()
+
+		err = c.p.Close()
+		c.wg.Wait()
+	})
+
+	return err
+}
+
+// MaxPayload returns the largest request or response payload which fits in a
+// single frame.
+func (c *Conn) MaxPayload() int {
+	mtu := c.ifi.MTU
+	if mtu <= 0 {
+		mtu = 1500
+	}
+
+	return mtu - headerLen
+}
+
+// Call sends req to dst and waits for the response, until ctx is canceled or
+// the configured timeout elapses if ctx has no deadline. If dst is a group
+// address, the first response is returned. If the remote Handler returns an
+// error, Call returns an *Error.
+func (c *Conn) Call(ctx context.Context, dst net.HardwareAddr, req []byte) ([]byte, error) {
+	if len(dst) != 6 {
+		return nil, fmt.Errorf("l2rpc: invalid destination address: %q", dst)
+	}
+	if len(req) > c.MaxPayload() {
+		return nil, errTooLong(len(req))
+	}
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.cfg.Timeout)
+		defer cancel()
+	}
+
+	cl := &call{
+		dst: dst,
+		res: make(chan *message, 1),
+	}
+
+	c.mu.Lock()
+	if c.err != nil {
+		err := c.err
+		c.mu.Unlock()
+		return nil, err
+	}
+
+	// Skip IDs which are still in use after wrapping around.
+	c.id++
+	for c.pending[c.id] != nil {
+		c.id++
+	}
+	id := c.id
+	c.pending[id] = cl
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		delete(c.pending, id)
+	}()
+
+	if err := c.send(dst, &message{ID: id, Payload: req}); err != nil {
+		return nil, err
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case m, ok := <-cl.res:
+		if !ok {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			return nil, c.err
+		}
+
+		if m.Flags&flagError != 0 {
+			return nil, &Error{Message: string(m.Payload)}
+		}
+
+		return m.Payload, nil
+	}
+}
+
+// readLoop receives frames until the connection is closed, delivering
+// responses to outstanding calls and requests to the Handler.
+func (c *Conn) readLoop() {
+	var err error
+	defer func() {
+		// Fail all outstanding calls with the first error, which is
+		// ErrClosed if the Conn was closed.
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		if c.err == nil {
+			c.err = err
+		}
+		for id, cl := range c.pending {
+			close(cl.res)
+			delete(c.pending, id)
+		}
+	}()
+
+	b := make([]byte, frame.BufferSize(c.ifi))
+	for {
+		var n int
+		n, _, err = c.p.ReadFrom(b)
+		if err != nil {
+			return
+		}
+
+		src, m, perr := c.parseFrame(b[:n])
+		if perr != nil {
+			continue
+		}
+
+		if m.Flags&flagResponse != 0 {
+			c.respond(src, m)
+			continue
+		}
+
+		if c.cfg.Handler == nil {
+			continue
+		}
+
+		select {
+		case c.sem <- struct{}{}:
+			// The payload refers to b, which is reused.
+			m.Payload = append([]byte(nil), m.Payload...)
+			go func() {
+				defer func() { <-c.sem }()
+				c.handle(src, m)
+			}()
+		default:
+			// Too many requests are in progress. Blocking here would also
+			// delay responses to outstanding calls, so drop the request.
+		}
+	}
+}
+
+// respond delivers a response from src to its outstanding call, if any.
+func (c *Conn) respond(src net.HardwareAddr, m *message) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cl, ok := c.pending[m.ID]
+	if !ok {
+		return
+	}
+
+	// Responses to a unicast request must come from its destination.
+	if cl.dst[0]&0x01 == 0 && !bytes.Equal(cl.dst, src) {
+		return
+	}
+
+	m.Payload = append([]byte(nil), m.Payload...)
+	select {
+	case cl.res <- m:
+	default:
+		// A response was already delivered.
+	}
+}
+
+// handle answers a request from src using the Handler.
+func (c *Conn) handle(src net.HardwareAddr, req *message) {
+	res := &message{
+		Flags: flagResponse,
+		ID:    req.ID,
+	}
+
+	b, err := c.cfg.Handler.ServeL2RPC(src, req.Payload)
+	switch {
+	case err != nil:
+		res.Flags |= flagError
+		res.Payload = []byte(err.Error())
+	case len(b) > c.MaxPayload():
+		res.Flags |= flagError
+		res.Payload = []byte(errTooLong(len(b)).Error())
+	default:
+		res.Payload = b
+	}
+
+	if n := c.MaxPayload(); len(res.Payload) > n {
+		// Error messages are truncated to fit in a frame.
+		res.Payload = res.Payload[:n]
+	}
+
+	// The caller times out if the response cannot be sent.
+	_ = c.send(src, res)
+}
+
+// send sends m to dst.
+func (c *Conn) send(dst net.HardwareAddr, m *message) error {
+	mb, err := m.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	fb, err := (&ethernet.Frame{
+		Destination: dst,
+		Source:      c.ifi.HardwareAddr,
+		EtherType:   c.etherType,
+		Payload:     mb,
+	}).MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	_, err = c.p.WriteTo(fb, &raw.Addr{HardwareAddr: dst})
+	return err
+}
+
+// parseFrame parses a message and its source address from an Ethernet frame.
+func (c *Conn) parseFrame(b []byte) (net.HardwareAddr, *message, error) {
+	var f ethernet.Frame
+	if err := f.UnmarshalBinary(b); err != nil {
+		return nil, nil, err
+	}
+
+	ok := f.EtherType == c.etherType &&
+		len(f.Source) == 6 &&
+		!bytes.Equal(f.Source, c.ifi.HardwareAddr) &&
+		(f.Destination[0]&0x01 != 0 || bytes.Equal(f.Destination, c.ifi.HardwareAddr))
+	if !ok {
+		return nil, nil, errInvalidMessage
+	}
+
+	m := new(message)
+	if err := m.UnmarshalBinary(f.Payload); err != nil {
+		return nil, nil, err
+	}
+
+	// Copy the source so that b may be reused.
+	return append(net.HardwareAddr(nil), f.Source...), m, nil
+}
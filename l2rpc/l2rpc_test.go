@@ -0,0 +1,254 @@
+package l2rpc_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mdlayher/raw/ethernet"
+	"github.com/mdlayher/raw/internal/rawtest"
+	"github.com/mdlayher/raw/l2rpc"
+)
+
+const etherType ethernet.EtherType = 0x88b5
+
+var (
+	clientMAC = net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	serverMAC = net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x02}
+)
+
+func TestConnCall(t *testing.T) {
+	hub := rawtest.NewHub()
+	testConn(t, hub, serverMAC, &l2rpc.Config{
+		Handler: l2rpc.HandlerFunc(func(src net.HardwareAddr, req []byte) ([]byte, error) {
+			if !bytes.Equal(src, clientMAC) {
+				return nil, fmt.Errorf("unexpected source: %s", src)
+			}
+
+			return append([]byte("hello, "), req...), nil
+		}),
+	})
+	c := testConn(t, hub, clientMAC, nil)
+
+	// Broadcast requests are answered as well.
+	for _, dst := range []net.HardwareAddr{serverMAC, ethernet.Broadcast} {
+		res, err := c.Call(context.Background(), dst, []byte("world"))
+		if err != nil {
+			t.Fatalf("failed to call %s: %v", dst, err)
+		}
+
+		if string(res) != "hello, world" {
+			t.Fatalf("unexpected response: %q", res)
+		}
+	}
+}
+
+func TestConnCallConcurrent(t *testing.T) {
+	hub := rawtest.NewHub()
+	testConn(t, hub, serverMAC, &l2rpc.Config{
+		Handler: l2rpc.HandlerFunc(func(_ net.HardwareAddr, req []byte) ([]byte, error) {
+			// Respond out of order.
+			time.Sleep(time.Duration(rand.Intn(20)) * time.Millisecond)
+			return req, nil
+		}),
+	})
+	c := testConn(t, hub, clientMAC, nil)
+
+	const n = 32
+	var wg sync.WaitGroup
+	errC := make(chan error, n)
+
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			req := []byte(fmt.Sprintf("request %d", i))
+			res, err := c.Call(context.Background(), serverMAC, req)
+			if err != nil {
+				errC <- err
+				return
+			}
+			if !bytes.Equal(req, res) {
+				errC <- fmt.Errorf("mismatched response %q for request %q", res, req)
+			}
+		}(i)
+	}
+
+	wg.Wait()
+	close(errC)
+
+	for err := range errC {
+		t.Fatalf("failed to call: %v", err)
+	}
+}
+
+func TestConnMaxConcurrentRequests(t *testing.T) {
+	const max = 2
+
+	var (
+		mu      sync.Mutex
+		running int
+		peak    int
+	)
+
+	release := make(chan struct{})
+	hub := rawtest.NewHub()
+	testConn(t, hub, serverMAC, &l2rpc.Config{
+		MaxConcurrentRequests: max,
+		Handler: l2rpc.HandlerFunc(func(_ net.HardwareAddr, req []byte) ([]byte, error) {
+			mu.Lock()
+			running++
+			if running > peak {
+				peak = running
+			}
+			mu.Unlock()
+
+			<-release
+
+			mu.Lock()
+			running--
+			mu.Unlock()
+
+			return req, nil
+		}),
+	})
+	c := testConn(t, hub, clientMAC, &l2rpc.Config{Timeout: 50 * time.Millisecond})
+
+	// Flood the blocked Handler; requests beyond the limit are dropped.
+	const n = 16
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = c.Call(context.Background(), serverMAC, nil)
+		}()
+	}
+	wg.Wait()
+
+	mu.Lock()
+	got := peak
+	mu.Unlock()
+	if got != max {
+		t.Fatalf("expected %d concurrent requests, but got %d", max, got)
+	}
+
+	// Once the Handler returns, new requests are answered again. A request
+	// may still be dropped until the blocked invocations have finished.
+	close(release)
+	var err error
+	for i := 0; i < 10; i++ {
+		if _, err = c.Call(context.Background(), serverMAC, nil); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		t.Fatalf("failed to call after release: %v", err)
+	}
+}
+
+func TestNewInvalidConfig(t *testing.T) {
+	ifi := &net.Interface{MTU: 1500, HardwareAddr: clientMAC}
+	cfg := &l2rpc.Config{MaxConcurrentRequests: -1}
+
+	if _, err := l2rpc.New(ifi, rawtest.NewHub().Conn(clientMAC), etherType, cfg); err == nil {
+		t.Fatal("expected an error, but none occurred")
+	}
+}
+
+func TestConnCallRemoteError(t *testing.T) {
+	hub := rawtest.NewHub()
+	testConn(t, hub, serverMAC, &l2rpc.Config{
+		Handler: l2rpc.HandlerFunc(func(_ net.HardwareAddr, _ []byte) ([]byte, error) {
+			return nil, errors.New("no such method")
+		}),
+	})
+	c := testConn(t, hub, clientMAC, nil)
+
+	_, err := c.Call(context.Background(), serverMAC, []byte("foo"))
+
+	var rerr *l2rpc.Error
+	if !errors.As(err, &rerr) {
+		t.Fatalf("expected remote error, but got: %v", err)
+	}
+	if rerr.Message != "no such method" {
+		t.Fatalf("unexpected remote error message: %q", rerr.Message)
+	}
+}
+
+func TestConnCallTimeout(t *testing.T) {
+	hub := rawtest.NewHub()
+
+	// No Handler, so requests are ignored.
+	testConn(t, hub, serverMAC, nil)
+	c := testConn(t, hub, clientMAC, &l2rpc.Config{Timeout: 20 * time.Millisecond})
+
+	if _, err := c.Call(context.Background(), serverMAC, nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, but got: %v", err)
+	}
+
+	// A context deadline takes precedence over the configured timeout.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if _, err := c.Call(ctx, serverMAC, nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, but got: %v", err)
+	}
+	if d := time.Since(start); d >= 20*time.Millisecond {
+		t.Fatalf("context deadline was not used, call took %s", d)
+	}
+}
+
+func TestConnClose(t *testing.T) {
+	hub := rawtest.NewHub()
+	testConn(t, hub, serverMAC, nil)
+	c := testConn(t, hub, clientMAC, &l2rpc.Config{Timeout: 5 * time.Second})
+
+	errC := make(chan error, 1)
+	go func() {
+		_, err := c.Call(context.Background(), serverMAC, nil)
+		errC <- err
+	}()
+
+	// Give the call time to be sent before closing.
+	time.Sleep(20 * time.Millisecond)
+	if err := c.Close(); err != nil {
+		t.Fatalf("failed to close: %v", err)
+	}
+
+	if err := <-errC; !errors.Is(err, l2rpc.ErrClosed) {
+		t.Fatalf("expected ErrClosed, but got: %v", err)
+	}
+	if _, err := c.Call(context.Background(), serverMAC, nil); !errors.Is(err, l2rpc.ErrClosed) {
+		t.Fatalf("expected ErrClosed after close, but got: %v", err)
+	}
+}
+
+func TestConnCallTooLong(t *testing.T) {
+	hub := rawtest.NewHub()
+	c := testConn(t, hub, clientMAC, nil)
+
+	if _, err := c.Call(context.Background(), serverMAC, make([]byte, c.MaxPayload()+1)); err == nil {
+		t.Fatal("expected an error, but none occurred")
+	}
+}
+
+func testConn(t *testing.T, hub *rawtest.Hub, mac net.HardwareAddr, cfg *l2rpc.Config) *l2rpc.Conn {
+	t.Helper()
+
+	c, err := l2rpc.New(&net.Interface{MTU: 1500, HardwareAddr: mac}, hub.Conn(mac), etherType, cfg)
+	if err != nil {
+		t.Fatalf("failed to create conn: %v", err)
+	}
+	t.Cleanup(func() { _ = c.Close() })
+
+	return c
+}
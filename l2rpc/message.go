@@ -0,0 +1,104 @@
+// Package l2rpc implements request/response messaging over a user-chosen
+// EtherType on top of a *raw.Conn, for control-plane traffic between hosts
+// on a layer 2 segment without IP.
+//
+// Each request carries a message ID which is echoed in its response, so that
+// a Conn may have many concurrent outstanding requests, each with its own
+// timeout. A Conn answers incoming requests with its Handler.
+package l2rpc
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	// headerLen is the length of a message header.
+	headerLen = 8
+
+	// version is the message format version implemented by this package.
+	version = 1
+)
+
+// flags are the flags carried in a message header.
+type flags uint8
+
+const (
+	// flagResponse marks a response to a request.
+	flagResponse flags = 1 << 0
+
+	// flagError marks a response whose payload is an error string.
+	flagError flags = 1 << 1
+)
+
+// errInvalidMessage is returned when a message is malformed.
+var errInvalidMessage = errors.New("l2rpc: invalid message")
+
+// A message is a request or response.
+//
+// The binary form is a version, flags, the payload length, and the message ID,
+// followed by the payload. The length allows Ethernet padding to be removed.
+type message struct {
+	Flags   flags
+	ID      uint32
+	Payload []byte
+}
+
+// MarshalBinary allocates a byte slice and marshals a message into binary
+// form.
+func (m *message) MarshalBinary() ([]byte, error) {
+	if len(m.Payload) > 0xffff {
+		return nil, errTooLong(len(m.Payload))
+	}
+
+	b := make([]byte, headerLen+len(m.Payload))
+	b[0] = version
+	b[1] = uint8(m.Flags)
+	binary.BigEndian.PutUint16(b[2:4], uint16(len(m.Payload)))
+	binary.BigEndian.PutUint32(b[4:8], m.ID)
+	copy(b[headerLen:], m.Payload)
+
+	return b, nil
+}
+
+// UnmarshalBinary unmarshals a byte slice into a message. Payload refers to
+// the input slice.
+func (m *message) UnmarshalBinary(b []byte) error {
+	if len(b) < headerLen {
+		return io.ErrUnexpectedEOF
+	}
+	if b[0] != version {
+		return errInvalidMessage
+	}
+
+	l := int(binary.BigEndian.Uint16(b[2:4]))
+	if len(b) < headerLen+l {
+		return io.ErrUnexpectedEOF
+	}
+
+	*m = message{
+		Flags:   flags(b[1]),
+		ID:      binary.BigEndian.Uint32(b[4:8]),
+		Payload: b[headerLen : headerLen+l],
+	}
+
+	return nil
+}
+
+// An Error is an error returned by a remote Handler.
+type Error struct {
+	Message string
+}
+
+// Error implements error.
+func (e *Error) Error() string {
+	return "l2rpc: remote error: " + e.Message
+}
+
+// errTooLong returns an error for a payload of n bytes which does not fit in
+// a frame.
+func errTooLong(n int) error {
+	return fmt.Errorf("l2rpc: payload too long: %d bytes", n)
+}
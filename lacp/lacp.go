@@ -0,0 +1,305 @@
+// Package lacp implements IEEE 802.3ad Link Aggregation Control Protocol and
+// marker protocol PDUs, carried in slow protocols frames, and a Monitor which
+// passively reports the actor and partner state of each aggregated port
+// observed on a *raw.Conn.
+package lacp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+)
+
+// SlowProtocolsAddr is the multicast address to which slow protocols PDUs are
+// sent. It is not forwarded by IEEE 802.1D bridges.
+var SlowProtocolsAddr = net.HardwareAddr{0x01, 0x80, 0xc2, 0x00, 0x00, 0x02}
+
+const (
+	// pduLen is the length of both LACPDUs and marker PDUs, including the
+	// trailing reserved bytes.
+	pduLen = 110
+
+	// Lengths of the TLVs in each PDU.
+	infoLen      = 20
+	collectorLen = 16
+	markerLen    = 16
+
+	// version is the only LACP and marker protocol version.
+	version = 1
+)
+
+var (
+	// errInvalidPDU is returned when a PDU is malformed.
+	errInvalidPDU = errors.New("lacp: invalid PDU")
+)
+
+// A Subtype identifies the slow protocol carried in a frame.
+type Subtype uint8
+
+// Subtype values for the protocols supported by this package.
+const (
+	SubtypeLACP   Subtype = 1
+	SubtypeMarker Subtype = 2
+)
+
+// String returns the name of a Subtype.
+func (s Subtype) String() string {
+	switch s {
+	case SubtypeLACP:
+		return "LACP"
+	case SubtypeMarker:
+		return "marker"
+	default:
+		return fmt.Sprintf("unknown(%d)", uint8(s))
+	}
+}
+
+// A PDU is a slow protocols PDU supported by this package: an *LACPDU or a
+// *Marker.
+type PDU interface {
+	Subtype() Subtype
+	MarshalBinary() ([]byte, error)
+	UnmarshalBinary(b []byte) error
+}
+
+var (
+	_ PDU = &LACPDU{}
+	_ PDU = &Marker{}
+)
+
+// ParsePDU parses an LACPDU or marker PDU from the payload of a slow
+// protocols frame.
+func ParsePDU(b []byte) (PDU, error) {
+	if len(b) < 1 {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	var p PDU
+	switch s := Subtype(b[0]); s {
+	case SubtypeLACP:
+		p = new(LACPDU)
+	case SubtypeMarker:
+		p = new(Marker)
+	default:
+		return nil, fmt.Errorf("lacp: unsupported slow protocol subtype: %s", s)
+	}
+
+	if err := p.UnmarshalBinary(b); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// State is the state of an actor or partner port.
+type State uint8
+
+// State values defined by IEEE 802.3ad.
+const (
+	StateActivity        State = 1 << 0
+	StateTimeout         State = 1 << 1
+	StateAggregation     State = 1 << 2
+	StateSynchronization State = 1 << 3
+	StateCollecting      State = 1 << 4
+	StateDistributing    State = 1 << 5
+	StateDefaulted       State = 1 << 6
+	StateExpired         State = 1 << 7
+)
+
+// stateNames are the names of each State bit, in order.
+var stateNames = [...]string{
+	"activity",
+	"timeout",
+	"aggregation",
+	"synchronization",
+	"collecting",
+	"distributing",
+	"defaulted",
+	"expired",
+}
+
+// String returns the names of the bits set in s, separated by commas.
+func (s State) String() string {
+	var names []string
+	for i, n := range stateNames {
+		if s&(1<<i) != 0 {
+			names = append(names, n)
+		}
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+
+	return strings.Join(names, ",")
+}
+
+// An Info describes the actor or partner of an LACPDU.
+type Info struct {
+	SystemPriority uint16
+	System         net.HardwareAddr
+	Key            uint16
+	PortPriority   uint16
+	Port           uint16
+	State          State
+}
+
+func (i Info) marshal(b []byte) {
+	binary.BigEndian.PutUint16(b[0:2], i.SystemPriority)
+	copy(b[2:8], i.System)
+	binary.BigEndian.PutUint16(b[8:10], i.Key)
+	binary.BigEndian.PutUint16(b[10:12], i.PortPriority)
+	binary.BigEndian.PutUint16(b[12:14], i.Port)
+	b[14] = uint8(i.State)
+}
+
+func parseInfo(b []byte) Info {
+	system := make(net.HardwareAddr, 6)
+	copy(system, b[2:8])
+
+	return Info{
+		SystemPriority: binary.BigEndian.Uint16(b[0:2]),
+		System:         system,
+		Key:            binary.BigEndian.Uint16(b[8:10]),
+		PortPriority:   binary.BigEndian.Uint16(b[10:12]),
+		Port:           binary.BigEndian.Uint16(b[12:14]),
+		State:          State(b[14]),
+	}
+}
+
+// An LACPDU is a Link Aggregation Control Protocol data unit.
+type LACPDU struct {
+	Actor   Info
+	Partner Info
+
+	// CollectorMaxDelay is the maximum delay, in tens of microseconds, that
+	// the actor's frame collector may impose.
+	CollectorMaxDelay uint16
+}
+
+// Subtype implements PDU.
+func (*LACPDU) Subtype() Subtype { return SubtypeLACP }
+
+// MarshalBinary allocates a byte slice and marshals an LACPDU into binary
+// form.
+func (p *LACPDU) MarshalBinary() ([]byte, error) {
+	for _, i := range []Info{p.Actor, p.Partner} {
+		if l := len(i.System); l != 0 && l != 6 {
+			return nil, fmt.Errorf("lacp: invalid system address: %q", i.System)
+		}
+	}
+
+	b := make([]byte, pduLen)
+	b[0] = uint8(SubtypeLACP)
+	b[1] = version
+
+	// Actor, partner, and collector information TLVs, followed by a
+	// terminator and reserved bytes.
+	b[2], b[3] = 1, infoLen
+	p.Actor.marshal(b[4:22])
+	b[22], b[23] = 2, infoLen
+	p.Partner.marshal(b[24:42])
+	b[42], b[43] = 3, collectorLen
+	binary.BigEndian.PutUint16(b[44:46], p.CollectorMaxDelay)
+
+	return b, nil
+}
+
+// UnmarshalBinary unmarshals a byte slice into an LACPDU. Any trailing
+// Ethernet padding is ignored.
+func (p *LACPDU) UnmarshalBinary(b []byte) error {
+	// The reserved bytes need not be present.
+	if len(b) < 2+infoLen*2+collectorLen {
+		return io.ErrUnexpectedEOF
+	}
+	if Subtype(b[0]) != SubtypeLACP {
+		return errInvalidPDU
+	}
+
+	// Later versions must be accepted, as long as the TLVs are in place.
+	ok := b[1] >= version &&
+		b[2] == 1 && b[3] == infoLen &&
+		b[22] == 2 && b[23] == infoLen &&
+		b[42] == 3 && b[43] == collectorLen
+	if !ok {
+		return errInvalidPDU
+	}
+
+	*p = LACPDU{
+		Actor:             parseInfo(b[4:22]),
+		Partner:           parseInfo(b[24:42]),
+		CollectorMaxDelay: binary.BigEndian.Uint16(b[44:46]),
+	}
+
+	return nil
+}
+
+// A Marker is a marker protocol PDU, used to flush frames from a link before
+// moving conversations to another link in the aggregation.
+type Marker struct {
+	// Response distinguishes a marker response from a marker.
+	Response bool
+
+	RequesterPort   uint16
+	RequesterSystem net.HardwareAddr
+	TransactionID   uint32
+}
+
+// Subtype implements PDU.
+func (*Marker) Subtype() Subtype { return SubtypeMarker }
+
+// MarshalBinary allocates a byte slice and marshals a Marker into binary
+// form.
+func (m *Marker) MarshalBinary() ([]byte, error) {
+	if l := len(m.RequesterSystem); l != 0 && l != 6 {
+		return nil, fmt.Errorf("lacp: invalid system address: %q", m.RequesterSystem)
+	}
+
+	b := make([]byte, pduLen)
+	b[0] = uint8(SubtypeMarker)
+	b[1] = version
+
+	b[2], b[3] = 1, markerLen
+	if m.Response {
+		b[2] = 2
+	}
+	binary.BigEndian.PutUint16(b[4:6], m.RequesterPort)
+	copy(b[6:12], m.RequesterSystem)
+	binary.BigEndian.PutUint32(b[12:16], m.TransactionID)
+
+	return b, nil
+}
+
+// UnmarshalBinary unmarshals a byte slice into a Marker. Any trailing
+// Ethernet padding is ignored.
+func (m *Marker) UnmarshalBinary(b []byte) error {
+	if len(b) < 2+markerLen {
+		return io.ErrUnexpectedEOF
+	}
+	if Subtype(b[0]) != SubtypeMarker || b[1] < version || b[3] != markerLen {
+		return errInvalidPDU
+	}
+
+	var response bool
+	switch b[2] {
+	case 1:
+	case 2:
+		response = true
+	default:
+		return errInvalidPDU
+	}
+
+	system := make(net.HardwareAddr, 6)
+	copy(system, b[6:12])
+
+	*m = Marker{
+		Response:        response,
+		RequesterPort:   binary.BigEndian.Uint16(b[4:6]),
+		RequesterSystem: system,
+		TransactionID:   binary.BigEndian.Uint32(b[12:16]),
+	}
+
+	return nil
+}
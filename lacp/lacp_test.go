@@ -0,0 +1,315 @@
+package lacp_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/raw"
+	"github.com/mdlayher/raw/ethernet"
+	"github.com/mdlayher/raw/internal/rawtest"
+	"github.com/mdlayher/raw/lacp"
+)
+
+var (
+	systemA = net.HardwareAddr{0x00, 0x00, 0x5e, 0x00, 0x53, 0x0a}
+	systemB = net.HardwareAddr{0x00, 0x00, 0x5e, 0x00, 0x53, 0x0b}
+)
+
+func TestLACPDUUnmarshal(t *testing.T) {
+	// An LACPDU as sent by the Linux bonding driver, with Ethernet padding.
+	b := []byte{
+		0x01, 0x01,
+		0x01, 0x14,
+		0xff, 0xff, 0x00, 0x00, 0x5e, 0x00, 0x53, 0x0a,
+		0x00, 0x0f, 0x00, 0xff, 0x00, 0x01, 0x3d, 0x00, 0x00, 0x00,
+		0x02, 0x14,
+		0x80, 0x00, 0x00, 0x00, 0x5e, 0x00, 0x53, 0x0b,
+		0x00, 0x21, 0x80, 0x00, 0x00, 0x05, 0x3f, 0x00, 0x00, 0x00,
+		0x03, 0x10,
+		0x00, 0x05, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00,
+	}
+	b = append(b, make([]byte, 50+4)...)
+
+	want := &lacp.LACPDU{
+		Actor: lacp.Info{
+			SystemPriority: 0xffff,
+			System:         systemA,
+			Key:            15,
+			PortPriority:   255,
+			Port:           1,
+			State: lacp.StateActivity | lacp.StateAggregation |
+				lacp.StateSynchronization | lacp.StateCollecting | lacp.StateDistributing,
+		},
+		Partner: lacp.Info{
+			SystemPriority: 32768,
+			System:         systemB,
+			Key:            33,
+			PortPriority:   32768,
+			Port:           5,
+			State: lacp.StateActivity | lacp.StateTimeout | lacp.StateAggregation |
+				lacp.StateSynchronization | lacp.StateCollecting | lacp.StateDistributing,
+		},
+		CollectorMaxDelay: 5,
+	}
+
+	p, err := lacp.ParsePDU(b)
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+
+	if diff := cmp.Diff(want, p); diff != "" {
+		t.Fatalf("unexpected LACPDU (-want +got):\n%s", diff)
+	}
+
+	out, err := p.MarshalBinary()
+	if err != nil {
+		t.Fatalf("failed to marshal: %v", err)
+	}
+
+	if diff := cmp.Diff(b[:110], out); diff != "" {
+		t.Fatalf("unexpected bytes (-want +got):\n%s", diff)
+	}
+}
+
+func TestMarkerMarshalUnmarshal(t *testing.T) {
+	tests := []struct {
+		name string
+		m    *lacp.Marker
+	}{
+		{
+			name: "marker",
+			m: &lacp.Marker{
+				RequesterPort:   1,
+				RequesterSystem: systemA,
+				TransactionID:   0xdeadbeef,
+			},
+		},
+		{
+			name: "response",
+			m: &lacp.Marker{
+				Response:        true,
+				RequesterPort:   2,
+				RequesterSystem: systemB,
+				TransactionID:   1,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := tt.m.MarshalBinary()
+			if err != nil {
+				t.Fatalf("failed to marshal: %v", err)
+			}
+			if len(b) != 110 {
+				t.Fatalf("unexpected marker length: %d", len(b))
+			}
+
+			p, err := lacp.ParsePDU(b)
+			if err != nil {
+				t.Fatalf("failed to parse: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.m, p); diff != "" {
+				t.Fatalf("unexpected marker (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestParsePDUError(t *testing.T) {
+	valid, err := (&lacp.LACPDU{}).MarshalBinary()
+	if err != nil {
+		t.Fatalf("failed to marshal: %v", err)
+	}
+
+	badTLV := append([]byte(nil), valid...)
+	badTLV[23] = 0x10
+
+	tests := []struct {
+		name string
+		b    []byte
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name: "unknown subtype",
+			b:    []byte{0x03, 0x01},
+		},
+		{
+			name: "short LACPDU",
+			b:    valid[:40],
+		},
+		{
+			name: "bad partner TLV length",
+			b:    badTLV,
+		},
+		{
+			name: "bad marker TLV type",
+			b:    append([]byte{0x02, 0x01, 0x03, 0x10}, make([]byte, 14)...),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := lacp.ParsePDU(tt.b); err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+		})
+	}
+}
+
+func TestStateString(t *testing.T) {
+	tests := []struct {
+		s    lacp.State
+		want string
+	}{
+		{s: 0, want: "none"},
+		{s: lacp.StateActivity | lacp.StateTimeout, want: "activity,timeout"},
+		{s: lacp.StateDefaulted | lacp.StateExpired, want: "defaulted,expired"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.s.String(); got != tt.want {
+			t.Fatalf("unexpected string for %#02x: %q", uint8(tt.s), got)
+		}
+	}
+}
+
+func TestMonitor(t *testing.T) {
+	hub := rawtest.NewHub()
+	port := hub.Conn(net.HardwareAddr{0x00, 0x00, 0x5e, 0x00, 0x53, 0x01})
+	defer port.Close()
+
+	mac := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	m := lacp.New(&net.Interface{MTU: 1500, HardwareAddr: mac}, hub.Conn(mac))
+	defer m.Close()
+
+	events := make(chan lacp.Event, 16)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- m.Run(ctx, func(e lacp.Event) { events <- e }) }()
+
+	lacpdu := func(state lacp.State) *lacp.LACPDU {
+		return &lacp.LACPDU{
+			Actor: lacp.Info{
+				SystemPriority: 32768,
+				System:         systemA,
+				Key:            1,
+				Port:           1,
+				State:          state,
+			},
+			Partner: lacp.Info{
+				SystemPriority: 32768,
+				System:         systemB,
+				Key:            1,
+				Port:           2,
+				State:          lacp.StateActivity | lacp.StateTimeout,
+			},
+		}
+	}
+
+	const sync = lacp.StateActivity | lacp.StateAggregation | lacp.StateSynchronization
+	pdus := []lacp.PDU{
+		lacpdu(lacp.StateActivity | lacp.StateAggregation),
+		lacpdu(lacp.StateActivity | lacp.StateAggregation),
+		&lacp.Marker{RequesterPort: 1, RequesterSystem: systemA},
+		lacpdu(sync),
+	}
+	for _, p := range pdus {
+		writePDU(t, port, p)
+	}
+
+	want := []lacp.EventType{lacp.EventPortAdded, lacp.EventPortChanged}
+
+	var got []lacp.EventType
+	var last lacp.Event
+	for range want {
+		select {
+		case e := <-events:
+			got = append(got, e.Type)
+			last = e
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for events, got: %v", got)
+		}
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected events (-want +got):\n%s", diff)
+	}
+	if last.Previous == nil || last.Previous.Actor.State != lacp.StateActivity|lacp.StateAggregation {
+		t.Fatalf("unexpected previous port: %+v", last.Previous)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("failed to run monitor: %v", err)
+	}
+
+	ports := m.Ports()
+	if len(ports) != 1 {
+		t.Fatalf("expected 1 port, but got %d", len(ports))
+	}
+
+	p := ports[0]
+	if p.Actor.State != sync || p.HardwareAddr.String() != "00:00:5e:00:53:01" {
+		t.Fatalf("unexpected port: %+v", p)
+	}
+
+	// The partner requested the short timeout.
+	if d := p.Expires.Sub(p.Updated); d != 3*time.Second {
+		t.Fatalf("unexpected expiry duration: %s", d)
+	}
+}
+
+func TestMonitorRunClearsReadDeadline(t *testing.T) {
+	hub := rawtest.NewHub()
+	port := hub.Conn(net.HardwareAddr{0x00, 0x00, 0x5e, 0x00, 0x53, 0x01})
+	defer port.Close()
+
+	mac := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	c := hub.Conn(mac)
+	m := lacp.New(&net.Interface{MTU: 1500, HardwareAddr: mac}, c)
+	defer m.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := m.Run(ctx, nil); err != nil {
+		t.Fatalf("failed to run monitor: %v", err)
+	}
+
+	// The connection must remain usable once Run returns.
+	writePDU(t, port, &lacp.Marker{RequesterPort: 1, RequesterSystem: systemA})
+	if _, _, err := c.ReadFrom(make([]byte, 1500)); err != nil {
+		t.Fatalf("failed to read after running monitor: %v", err)
+	}
+}
+
+// writePDU writes p in a slow protocols frame.
+func writePDU(t *testing.T, conn *rawtest.Conn, p lacp.PDU) {
+	t.Helper()
+
+	pb, err := p.MarshalBinary()
+	if err != nil {
+		t.Fatalf("failed to marshal PDU: %v", err)
+	}
+
+	fb, err := (&ethernet.Frame{
+		Destination: lacp.SlowProtocolsAddr,
+		Source:      conn.LocalAddr().(*raw.Addr).HardwareAddr,
+		EtherType:   ethernet.EtherTypeSlowProtocols,
+		Payload:     pb,
+	}).MarshalBinary()
+	if err != nil {
+		t.Fatalf("failed to marshal frame: %v", err)
+	}
+
+	if _, err := conn.WriteTo(fb, nil); err != nil {
+		t.Fatalf("failed to write frame: %v", err)
+	}
+}
@@ -0,0 +1,253 @@
+package lacp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mdlayher/raw"
+	"github.com/mdlayher/raw/ethernet"
+	"github.com/mdlayher/raw/internal/frame"
+)
+
+// Periodic transmission intervals defined by IEEE 802.3ad. Information is
+// considered expired after three intervals.
+const (
+	fastPeriodicTime = 1 * time.Second
+	slowPeriodicTime = 30 * time.Second
+)
+
+// errNotLACPDU is returned when a frame does not carry an LACPDU.
+var errNotLACPDU = errors.New("lacp: not an LACPDU")
+
+// An EventType is the type of an Event reported by a Monitor.
+type EventType int
+
+// EventType values.
+const (
+	// EventPortAdded indicates that LACPDUs were received from a port which
+	// had not been observed, or whose information had expired.
+	EventPortAdded EventType = iota
+
+	// EventPortChanged indicates that the actor or partner information sent
+	// by a port changed.
+	EventPortChanged
+)
+
+// String returns the name of an EventType.
+func (e EventType) String() string {
+	switch e {
+	case EventPortAdded:
+		return "port added"
+	case EventPortChanged:
+		return "port changed"
+	default:
+		return fmt.Sprintf("unknown(%d)", int(e))
+	}
+}
+
+// An Event is a change in the state of a port observed by a Monitor.
+type Event struct {
+	Type EventType
+	Time time.Time
+	Port Port
+
+	// Previous is the port before an EventPortChanged, or nil for
+	// EventPortAdded.
+	Previous *Port
+}
+
+// A Port is the most recent state reported by a port participating in link
+// aggregation, identified by its actor system and port number.
+type Port struct {
+	// HardwareAddr is the source address of the LACPDUs.
+	HardwareAddr net.HardwareAddr
+
+	Actor             Info
+	Partner           Info
+	CollectorMaxDelay uint16
+
+	// Updated is the time at which the most recent LACPDU was received, and
+	// Expires is the time at which the information will be considered stale
+	// if no further LACPDUs are received.
+	Updated time.Time
+	Expires time.Time
+}
+
+// equal reports whether p and x carry the same actor and partner information.
+func (p *Port) equal(x *Port) bool {
+	return infoEqual(p.Actor, x.Actor) &&
+		infoEqual(p.Partner, x.Partner) &&
+		p.CollectorMaxDelay == x.CollectorMaxDelay
+}
+
+// infoEqual reports whether a and b are identical.
+func infoEqual(a, b Info) bool {
+	return a.SystemPriority == b.SystemPriority &&
+		bytes.Equal(a.System, b.System) &&
+		a.Key == b.Key &&
+		a.PortPriority == b.PortPriority &&
+		a.Port == b.Port &&
+		a.State == b.State
+}
+
+// A Monitor passively observes LACPDUs to report the state of aggregated
+// links.
+type Monitor struct {
+	ifi *net.Interface
+	p   net.PacketConn
+
+	mu    sync.Mutex
+	ports map[string]*Port
+}
+
+// Dial creates a new Monitor using the specified network interface. Dial
+// opens a *raw.Conn which receives slow protocols frames, and enables
+// promiscuous mode so that frames sent to SlowProtocolsAddr are delivered.
+//
+// Note that when ifi is a member of a Linux bond, the bonding driver may
+// consume LACPDUs before they are delivered to the *raw.Conn.
+func Dial(ifi *net.Interface) (*Monitor, error) {
+	c, err := raw.ListenPacket(ifi, uint16(ethernet.EtherTypeSlowProtocols), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.SetPromiscuous(true); err != nil {
+		_ = c.Close()
+		return nil, err
+	}
+
+	return New(ifi, c), nil
+}
+
+// New creates a new Monitor using the specified network interface and
+// net.PacketConn. p must receive complete Ethernet frames.
+func New(ifi *net.Interface, p net.PacketConn) *Monitor {
+	return &Monitor{
+		ifi:   ifi,
+		p:     p,
+		ports: make(map[string]*Port),
+	}
+}
+
+// Close closes the Monitor's connection.
+func (m *Monitor) Close() error {
+	return m.p.Close()
+}
+
+// Ports returns the ports whose information has not expired, ordered by actor
+// system and port number.
+func (m *Monitor) Ports() []Port {
+	now := time.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	keys := make([]string, 0, len(m.ports))
+	for k, p := range m.ports {
+		if now.Before(p.Expires) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	out := make([]Port, 0, len(keys))
+	for _, k := range keys {
+		out = append(out, *m.ports[k])
+	}
+
+	return out
+}
+
+// Run receives LACPDUs until ctx is canceled or an error occurs, calling fn
+// for each Event if fn is not nil. Marker PDUs are ignored. Run returns nil
+// when ctx is canceled.
+func (m *Monitor) Run(ctx context.Context, fn func(Event)) error {
+	defer frame.CancelReads(ctx, m.p)()
+
+	b := make([]byte, frame.BufferSize(m.ifi))
+	for {
+		n, _, err := m.p.ReadFrom(b)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			return err
+		}
+
+		f, pdu, err := parseFrame(b[:n])
+		if err != nil {
+			continue
+		}
+
+		e, ok := m.observe(f.Source, pdu, time.Now())
+		if ok && fn != nil {
+			fn(e)
+		}
+	}
+}
+
+// observe updates the Monitor's ports with an LACPDU received from src at now
+// and reports whether an Event occurred.
+func (m *Monitor) observe(src net.HardwareAddr, pdu *LACPDU, now time.Time) (Event, bool) {
+	// The sender transmits at the rate its partner requested.
+	period := slowPeriodicTime
+	if pdu.Partner.State&StateTimeout != 0 {
+		period = fastPeriodicTime
+	}
+
+	p := &Port{
+		HardwareAddr:      append(net.HardwareAddr(nil), src...),
+		Actor:             pdu.Actor,
+		Partner:           pdu.Partner,
+		CollectorMaxDelay: pdu.CollectorMaxDelay,
+		Updated:           now,
+		Expires:           now.Add(3 * period),
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := portKey(pdu.Actor)
+	prev, ok := m.ports[key]
+	m.ports[key] = p
+
+	switch {
+	case !ok || !now.Before(prev.Expires):
+		return Event{Type: EventPortAdded, Time: now, Port: *p}, true
+	case !p.equal(prev):
+		return Event{Type: EventPortChanged, Time: now, Port: *p, Previous: prev}, true
+	default:
+		return Event{}, false
+	}
+}
+
+// portKey identifies a port by its actor system and port number.
+func portKey(i Info) string {
+	return fmt.Sprintf("%04x/%s/%05d", i.SystemPriority, i.System, i.Port)
+}
+
+// parseFrame parses an LACPDU from a slow protocols frame.
+func parseFrame(b []byte) (*ethernet.Frame, *LACPDU, error) {
+	var f ethernet.Frame
+	if err := f.UnmarshalBinary(b); err != nil {
+		return nil, nil, err
+	}
+	if f.EtherType != ethernet.EtherTypeSlowProtocols {
+		return nil, nil, errNotLACPDU
+	}
+
+	pdu := new(LACPDU)
+	if err := pdu.UnmarshalBinary(f.Payload); err != nil {
+		return nil, nil, err
+	}
+
+	return &f, pdu, nil
+}
@@ -0,0 +1,205 @@
+// Package llc implements marshaling and unmarshaling of IEEE 802.2 Logical
+// Link Control headers and IEEE 802 SNAP headers, which are carried by IEEE
+// 802.3 frames with a length field instead of an EtherType.
+//
+// To receive such frames with a *raw.Conn, pass raw.ProtocolLLC to
+// raw.ListenPacket.
+package llc
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+
+	"github.com/mdlayher/raw/ethernet"
+)
+
+// MaxLength is the largest value of an IEEE 802.3 length field. Larger values
+// are EtherTypes.
+const MaxLength = 1500
+
+// ControlUI is the control field of an unnumbered information PDU, used by
+// nearly all connectionless protocols.
+const ControlUI = 0x03
+
+var (
+	// errNotLLC is returned when a frame carries an EtherType rather than a
+	// length field.
+	errNotLLC = errors.New("llc: frame does not carry an LLC header")
+)
+
+// A SAP is an LLC service access point address.
+type SAP uint8
+
+// SAP values for protocols commonly carried in LLC frames.
+const (
+	SAPNull    SAP = 0x00
+	SAPSTP     SAP = 0x42
+	SAPSNAP    SAP = 0xaa
+	SAPIPX     SAP = 0xe0
+	SAPNetBIOS SAP = 0xf0
+	SAPGlobal  SAP = 0xff
+)
+
+// A Header is an IEEE 802.2 LLC header.
+type Header struct {
+	// DSAP and SSAP are the destination and source service access points.
+	// The low bit of DSAP indicates a group address, and the low bit of
+	// SSAP indicates a response.
+	DSAP SAP
+	SSAP SAP
+
+	// Control is one byte for unnumbered (U-format) PDUs, identified by the
+	// two low bits being set, and two bytes for I-format and S-format PDUs.
+	Control uint16
+}
+
+// len returns the length of the Header in binary form.
+func (h *Header) len() int {
+	if h.Control&0x3 == 0x3 {
+		return 3
+	}
+
+	return 4
+}
+
+// A SNAP is an IEEE 802 Subnetwork Access Protocol header, which follows an
+// LLC header with both SAPs set to SAPSNAP to identify a protocol by
+// organization and protocol ID.
+type SNAP struct {
+	// OUI identifies the organization. An OUI of zero indicates that
+	// ProtocolID is an EtherType.
+	OUI        [3]byte
+	ProtocolID uint16
+}
+
+// snapLen is the length of a SNAP header.
+const snapLen = 5
+
+// A PDU is an LLC protocol data unit, with an optional SNAP header.
+type PDU struct {
+	Header
+
+	// SNAP is present when both SAPs are SAPSNAP and the PDU is an
+	// unnumbered information PDU.
+	SNAP *SNAP
+
+	Payload []byte
+}
+
+// isSNAP reports whether h is followed by a SNAP header.
+func (h *Header) isSNAP() bool {
+	return h.DSAP == SAPSNAP && h.SSAP&^1 == SAPSNAP && h.Control == ControlUI
+}
+
+// MarshalBinary allocates a byte slice and marshals a PDU into binary form.
+func (p *PDU) MarshalBinary() ([]byte, error) {
+	if (p.SNAP != nil) != p.isSNAP() {
+		return nil, errors.New("llc: SNAP header requires SNAP SAPs and UI control field")
+	}
+
+	n := p.len()
+	if p.SNAP != nil {
+		n += snapLen
+	}
+
+	b := make([]byte, n+len(p.Payload))
+	b[0] = uint8(p.DSAP)
+	b[1] = uint8(p.SSAP)
+	if p.len() == 3 {
+		if p.Control > 0xff {
+			return nil, fmt.Errorf("llc: invalid U-format control field: %#x", p.Control)
+		}
+
+		b[2] = uint8(p.Control)
+	} else {
+		// The first transmitted byte holds the low bits of the control field.
+		binary.LittleEndian.PutUint16(b[2:4], p.Control)
+	}
+
+	if s := p.SNAP; s != nil {
+		copy(b[n-snapLen:n-2], s.OUI[:])
+		binary.BigEndian.PutUint16(b[n-2:n], s.ProtocolID)
+	}
+
+	copy(b[n:], p.Payload)
+	return b, nil
+}
+
+// UnmarshalBinary unmarshals a byte slice into a PDU. Payload refers to the
+// input slice.
+func (p *PDU) UnmarshalBinary(b []byte) error {
+	if len(b) < 3 {
+		return io.ErrUnexpectedEOF
+	}
+
+	h := Header{
+		DSAP:    SAP(b[0]),
+		SSAP:    SAP(b[1]),
+		Control: uint16(b[2]),
+	}
+	if h.len() == 4 {
+		if len(b) < 4 {
+			return io.ErrUnexpectedEOF
+		}
+
+		h.Control = binary.LittleEndian.Uint16(b[2:4])
+	}
+
+	*p = PDU{Header: h}
+	b = b[h.len():]
+
+	if h.isSNAP() {
+		if len(b) < snapLen {
+			return io.ErrUnexpectedEOF
+		}
+
+		s := &SNAP{ProtocolID: binary.BigEndian.Uint16(b[3:5])}
+		copy(s.OUI[:], b[0:3])
+		p.SNAP = s
+		b = b[snapLen:]
+	}
+
+	p.Payload = b
+	return nil
+}
+
+// ParseFrame parses a PDU from an IEEE 802.3 frame with a length field. Any
+// padding beyond the length of the PDU is removed from the Payload.
+func ParseFrame(f *ethernet.Frame) (*PDU, error) {
+	l := int(f.EtherType)
+	if l > MaxLength {
+		return nil, errNotLLC
+	}
+	if l > len(f.Payload) {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	p := new(PDU)
+	if err := p.UnmarshalBinary(f.Payload[:l]); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// NewFrame creates an IEEE 802.3 frame from src to dst which carries p and a
+// length field in place of an EtherType.
+func NewFrame(dst, src net.HardwareAddr, p *PDU) (*ethernet.Frame, error) {
+	b, err := p.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > MaxLength {
+		return nil, fmt.Errorf("llc: PDU too long: %d bytes", len(b))
+	}
+
+	return &ethernet.Frame{
+		Destination: dst,
+		Source:      src,
+		EtherType:   ethernet.EtherType(len(b)),
+		Payload:     b,
+	}, nil
+}
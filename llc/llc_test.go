@@ -0,0 +1,135 @@
+package llc_test
+
+import (
+	"net"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/raw/ethernet"
+	"github.com/mdlayher/raw/llc"
+)
+
+func TestPDUMarshalUnmarshal(t *testing.T) {
+	tests := []struct {
+		name string
+		p    *llc.PDU
+		b    []byte
+	}{
+		{
+			name: "U-format",
+			p: &llc.PDU{
+				Header:  llc.Header{DSAP: llc.SAPSTP, SSAP: llc.SAPSTP, Control: llc.ControlUI},
+				Payload: []byte{0x00, 0x00},
+			},
+			b: []byte{0x42, 0x42, 0x03, 0x00, 0x00},
+		},
+		{
+			name: "I-format",
+			p: &llc.PDU{
+				Header:  llc.Header{DSAP: llc.SAPNetBIOS, SSAP: llc.SAPNetBIOS | 1, Control: 0x0102},
+				Payload: []byte{0xff},
+			},
+			b: []byte{0xf0, 0xf1, 0x02, 0x01, 0xff},
+		},
+		{
+			name: "SNAP",
+			p: &llc.PDU{
+				Header: llc.Header{DSAP: llc.SAPSNAP, SSAP: llc.SAPSNAP, Control: llc.ControlUI},
+				// Cisco Discovery Protocol.
+				SNAP:    &llc.SNAP{OUI: [3]byte{0x00, 0x00, 0x0c}, ProtocolID: 0x2000},
+				Payload: []byte{0x02},
+			},
+			b: []byte{0xaa, 0xaa, 0x03, 0x00, 0x00, 0x0c, 0x20, 0x00, 0x02},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := tt.p.MarshalBinary()
+			if err != nil {
+				t.Fatalf("failed to marshal: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.b, b); diff != "" {
+				t.Fatalf("unexpected bytes (-want +got):\n%s", diff)
+			}
+
+			var got llc.PDU
+			if err := got.UnmarshalBinary(b); err != nil {
+				t.Fatalf("failed to unmarshal: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.p, &got); diff != "" {
+				t.Fatalf("unexpected PDU (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestPDUErrors(t *testing.T) {
+	snap := &llc.PDU{
+		Header: llc.Header{DSAP: llc.SAPSTP, SSAP: llc.SAPSTP, Control: llc.ControlUI},
+		SNAP:   &llc.SNAP{},
+	}
+	if _, err := snap.MarshalBinary(); err == nil {
+		t.Fatal("expected SNAP header error, but none occurred")
+	}
+
+	for _, b := range [][]byte{
+		{0x42, 0x42},
+		{0xf0, 0xf0, 0x00},
+		{0xaa, 0xaa, 0x03, 0x00, 0x00},
+	} {
+		var p llc.PDU
+		if err := p.UnmarshalBinary(b); err == nil {
+			t.Fatalf("expected an error for % x, but none occurred", b)
+		}
+	}
+}
+
+func TestFrame(t *testing.T) {
+	var (
+		dst = net.HardwareAddr{0x01, 0x80, 0xc2, 0x00, 0x00, 0x00}
+		src = net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	)
+
+	p := &llc.PDU{
+		Header:  llc.Header{DSAP: llc.SAPSTP, SSAP: llc.SAPSTP, Control: llc.ControlUI},
+		Payload: []byte{0x00, 0x00, 0x00, 0x80},
+	}
+
+	f, err := llc.NewFrame(dst, src, p)
+	if err != nil {
+		t.Fatalf("failed to create frame: %v", err)
+	}
+
+	if diff := cmp.Diff(ethernet.EtherType(7), f.EtherType); diff != "" {
+		t.Fatalf("unexpected length field (-want +got):\n%s", diff)
+	}
+
+	// Round trip through binary form, which pads the frame to the Ethernet
+	// minimum length.
+	b, err := f.MarshalBinary()
+	if err != nil {
+		t.Fatalf("failed to marshal frame: %v", err)
+	}
+
+	var got ethernet.Frame
+	if err := got.UnmarshalBinary(b); err != nil {
+		t.Fatalf("failed to unmarshal frame: %v", err)
+	}
+
+	gp, err := llc.ParseFrame(&got)
+	if err != nil {
+		t.Fatalf("failed to parse frame: %v", err)
+	}
+
+	if diff := cmp.Diff(p, gp); diff != "" {
+		t.Fatalf("unexpected PDU (-want +got):\n%s", diff)
+	}
+
+	got.EtherType = ethernet.EtherTypeIPv4
+	if _, err := llc.ParseFrame(&got); err == nil {
+		t.Fatal("expected EtherType frame error, but none occurred")
+	}
+}
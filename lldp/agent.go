@@ -0,0 +1,345 @@
+package lldp
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mdlayher/raw"
+	"github.com/mdlayher/raw/ethernet"
+	"github.com/mdlayher/raw/internal/frame"
+)
+
+// Default timing values from IEEE 802.1AB.
+const (
+	defaultInterval = 30 * time.Second
+	defaultHold     = 4
+)
+
+// A Config specifies the information advertised by an Agent. The zero value
+// of any field selects a default value.
+type Config struct {
+	// Interval is the time between transmitted data units. If zero, 30
+	// seconds is used.
+	Interval time.Duration
+
+	// Hold is multiplied by Interval to produce the advertised TTL. If zero,
+	// 4 is used.
+	Hold int
+
+	// Destination is the multicast address data units are sent to. If nil,
+	// NearestBridge is used.
+	Destination net.HardwareAddr
+
+	// ChassisID identifies the local system. If nil, the hardware address of
+	// the interface is used.
+	ChassisID *ChassisID
+
+	// PortID identifies the local port. If nil, the name of the interface is
+	// used, or its hardware address if it has no name.
+	PortID *PortID
+
+	// Optional information advertised in each data unit.
+	PortDescription      string
+	SystemName           string
+	SystemDescription    string
+	SystemCapabilities   *SystemCapabilities
+	OrganizationSpecific []OrganizationSpecific
+}
+
+// A Neighbor is a remote system learned by an Agent.
+type Neighbor struct {
+	// DataUnit is the most recent data unit received from the neighbor.
+	DataUnit *DataUnit
+
+	// HardwareAddr is the source address of the most recent data unit.
+	HardwareAddr net.HardwareAddr
+
+	// Updated is the time the most recent data unit was received, and
+	// Expires is the time after which the neighbor is discarded.
+	Updated time.Time
+	Expires time.Time
+}
+
+// An Agent periodically advertises the local system using LLDP, and
+// maintains a table of neighbors learned from received data units.
+type Agent struct {
+	ifi      *net.Interface
+	p        net.PacketConn
+	interval time.Duration
+	dst      net.HardwareAddr
+	du       *DataUnit
+
+	mu        sync.Mutex
+	neighbors map[string]*Neighbor
+}
+
+// Dial creates a new Agent using the specified network interface. Dial opens
+// a *raw.Conn which receives LLDP frames, and enables promiscuous mode so
+// that frames sent to the LLDP multicast addresses are delivered. A nil
+// Config selects the default values.
+func Dial(ifi *net.Interface, cfg *Config) (*Agent, error) {
+	c, err := raw.ListenPacket(ifi, uint16(ethernet.EtherTypeLLDP), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.SetPromiscuous(true); err != nil {
+		_ = c.Close()
+		return nil, err
+	}
+
+	a, err := New(ifi, c, cfg)
+	if err != nil {
+		_ = c.Close()
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// New creates a new Agent using the specified network interface and
+// net.PacketConn. p must send and receive complete Ethernet frames.
+func New(ifi *net.Interface, p net.PacketConn, cfg *Config) (*Agent, error) {
+	if len(ifi.HardwareAddr) != 6 {
+		return nil, fmt.Errorf("lldp: invalid hardware address: %q", ifi.HardwareAddr)
+	}
+
+	if cfg == nil {
+		cfg = &Config{}
+	}
+
+	switch {
+	case cfg.Interval < 0:
+		return nil, fmt.Errorf("lldp: invalid interval: %s", cfg.Interval)
+	case cfg.Hold < 0:
+		return nil, fmt.Errorf("lldp: invalid hold multiplier: %d", cfg.Hold)
+	}
+
+	interval := cfg.Interval
+	if interval == 0 {
+		interval = defaultInterval
+	}
+	hold := cfg.Hold
+	if hold == 0 {
+		hold = defaultHold
+	}
+
+	// The advertised TTL is rounded up to whole seconds and capped at the
+	// maximum value of the TTL TLV.
+	ttl := (interval*time.Duration(hold) + time.Second - 1).Truncate(time.Second)
+	if ttl > maxTTL {
+		ttl = maxTTL
+	}
+
+	dst := cfg.Destination
+	if dst == nil {
+		dst = NearestBridge
+	}
+
+	chassis := ChassisID{Subtype: ChassisIDSubtypeMACAddress, ID: ifi.HardwareAddr}
+	if cfg.ChassisID != nil {
+		chassis = *cfg.ChassisID
+	}
+
+	port := PortID{Subtype: PortIDSubtypeMACAddress, ID: ifi.HardwareAddr}
+	switch {
+	case cfg.PortID != nil:
+		port = *cfg.PortID
+	case ifi.Name != "":
+		port = PortID{Subtype: PortIDSubtypeInterfaceName, ID: []byte(ifi.Name)}
+	}
+
+	du := &DataUnit{
+		ChassisID:            chassis,
+		PortID:               port,
+		TTL:                  ttl,
+		PortDescription:      cfg.PortDescription,
+		SystemName:           cfg.SystemName,
+		SystemDescription:    cfg.SystemDescription,
+		SystemCapabilities:   cfg.SystemCapabilities,
+		OrganizationSpecific: cfg.OrganizationSpecific,
+	}
+
+	// Catch invalid configuration before the Agent runs.
+	if _, err := du.MarshalBinary(); err != nil {
+		return nil, err
+	}
+
+	return &Agent{
+		ifi:       ifi,
+		p:         p,
+		interval:  interval,
+		dst:       dst,
+		du:        du,
+		neighbors: make(map[string]*Neighbor),
+	}, nil
+}
+
+// Close closes the Agent's connection.
+func (a *Agent) Close() error {
+	return a.p.Close()
+}
+
+// Run transmits a data unit immediately and then once per interval, and
+// receives data units from neighbors, until ctx is canceled or an error
+// occurs. When ctx is canceled, Run sends a final data unit with a TTL of
+// zero so neighbors discard the local system, and returns nil.
+func (a *Agent) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	txErrC := make(chan error, 1)
+	go func() {
+		err := a.transmit(ctx)
+		if err != nil {
+			// Stop the receiver so Run can report the error.
+			cancel()
+		}
+		txErrC <- err
+	}()
+
+	rxErr := a.receive(ctx)
+	cancel()
+	txErr := <-txErrC
+
+	if rxErr != nil {
+		return rxErr
+	}
+
+	return txErr
+}
+
+// transmit sends data units until ctx is canceled.
+func (a *Agent) transmit(ctx context.Context) error {
+	t := time.NewTicker(a.interval)
+	defer t.Stop()
+
+	for {
+		if err := a.send(a.du.TTL); err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			// Announce that the local system is going away.
+			return a.send(0)
+		case <-t.C:
+		}
+	}
+}
+
+// receive reads data units into the neighbor table until ctx is canceled or
+// an error occurs.
+func (a *Agent) receive(ctx context.Context) error {
+	defer frame.CancelReads(ctx, a.p)()
+
+	b := make([]byte, frame.BufferSize(a.ifi))
+	for {
+		n, _, err := a.p.ReadFrom(b)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			return err
+		}
+
+		var f ethernet.Frame
+		if err := f.UnmarshalBinary(b[:n]); err != nil || f.EtherType != ethernet.EtherTypeLLDP {
+			continue
+		}
+
+		du := new(DataUnit)
+		if err := du.UnmarshalBinary(f.Payload); err != nil {
+			continue
+		}
+
+		a.update(du, f.Source, time.Now())
+	}
+}
+
+// send transmits the Agent's data unit with the specified TTL.
+func (a *Agent) send(ttl time.Duration) error {
+	du := *a.du
+	du.TTL = ttl
+
+	pb, err := du.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	fb, err := (&ethernet.Frame{
+		Destination: a.dst,
+		Source:      a.ifi.HardwareAddr,
+		EtherType:   ethernet.EtherTypeLLDP,
+		Payload:     pb,
+	}).MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	_, err = a.p.WriteTo(fb, &raw.Addr{HardwareAddr: a.dst})
+	return err
+}
+
+// update stores or removes a neighbor after receiving du from src at now.
+func (a *Agent) update(du *DataUnit, src net.HardwareAddr, now time.Time) {
+	key := neighborKey(du)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	// Discard expired neighbors so the table does not grow without bound.
+	for k, n := range a.neighbors {
+		if !now.Before(n.Expires) {
+			delete(a.neighbors, k)
+		}
+	}
+
+	if du.TTL == 0 {
+		// The neighbor is shutting down.
+		delete(a.neighbors, key)
+		return
+	}
+
+	a.neighbors[key] = &Neighbor{
+		DataUnit:     du,
+		HardwareAddr: append(net.HardwareAddr(nil), src...),
+		Updated:      now,
+		Expires:      now.Add(du.TTL),
+	}
+}
+
+// Neighbors returns the neighbors which have not expired, ordered by chassis
+// ID and port ID.
+func (a *Agent) Neighbors() []Neighbor {
+	now := time.Now()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	keys := make([]string, 0, len(a.neighbors))
+	for k, n := range a.neighbors {
+		if now.Before(n.Expires) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	out := make([]Neighbor, 0, len(keys))
+	for _, k := range keys {
+		out = append(out, *a.neighbors[k])
+	}
+
+	return out
+}
+
+// neighborKey identifies a neighbor by its chassis ID and port ID.
+func neighborKey(du *DataUnit) string {
+	return fmt.Sprintf("%d/%x/%d/%x",
+		du.ChassisID.Subtype, du.ChassisID.ID, du.PortID.Subtype, du.PortID.ID)
+}
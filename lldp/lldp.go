@@ -0,0 +1,369 @@
+// Package lldp implements the Link Layer Discovery Protocol, as described in
+// IEEE 802.1AB, on top of a *raw.Conn. It can marshal and unmarshal LLDP data
+// units, including organizationally specific TLVs, and run an agent which
+// advertises the local system and maintains a table of neighbors.
+package lldp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// Multicast destination addresses used by LLDP agents.
+var (
+	// NearestBridge is the default destination address, which is not
+	// forwarded by any IEEE 802.1D compliant bridge.
+	NearestBridge = net.HardwareAddr{0x01, 0x80, 0xc2, 0x00, 0x00, 0x0e}
+
+	// NearestNonTPMRBridge is forwarded only by two-port MAC relays.
+	NearestNonTPMRBridge = net.HardwareAddr{0x01, 0x80, 0xc2, 0x00, 0x00, 0x03}
+
+	// NearestCustomerBridge is forwarded by provider bridges.
+	NearestCustomerBridge = net.HardwareAddr{0x01, 0x80, 0xc2, 0x00, 0x00, 0x00}
+)
+
+var (
+	// errMissingTLV is returned when a mandatory TLV is missing or out of
+	// order.
+	errMissingTLV = errors.New("lldp: missing mandatory TLV")
+
+	// errInvalidTLV is returned when a TLV has an invalid length.
+	errInvalidTLV = errors.New("lldp: invalid TLV")
+)
+
+const (
+	// tlvHeaderLen is the length of a TLV header: 7 bits of type and 9 bits
+	// of length.
+	tlvHeaderLen = 2
+
+	// maxTLVLen is the maximum length of a TLV value.
+	maxTLVLen = 511
+
+	// maxTTL is the largest time to live which may be advertised.
+	maxTTL = 65535 * time.Second
+)
+
+// A TLVType is the type of an LLDP TLV.
+type TLVType uint8
+
+// TLVType values defined by IEEE 802.1AB.
+const (
+	TLVTypeEnd                  TLVType = 0
+	TLVTypeChassisID            TLVType = 1
+	TLVTypePortID               TLVType = 2
+	TLVTypeTTL                  TLVType = 3
+	TLVTypePortDescription      TLVType = 4
+	TLVTypeSystemName           TLVType = 5
+	TLVTypeSystemDescription    TLVType = 6
+	TLVTypeSystemCapabilities   TLVType = 7
+	TLVTypeManagementAddress    TLVType = 8
+	TLVTypeOrganizationSpecific TLVType = 127
+)
+
+// A TLV is a raw LLDP type-length-value structure.
+type TLV struct {
+	Type  TLVType
+	Value []byte
+}
+
+// A ChassisIDSubtype indicates how a ChassisID is encoded.
+type ChassisIDSubtype uint8
+
+// ChassisIDSubtype values defined by IEEE 802.1AB.
+const (
+	ChassisIDSubtypeChassisComponent ChassisIDSubtype = 1
+	ChassisIDSubtypeInterfaceAlias   ChassisIDSubtype = 2
+	ChassisIDSubtypePortComponent    ChassisIDSubtype = 3
+	ChassisIDSubtypeMACAddress       ChassisIDSubtype = 4
+	ChassisIDSubtypeNetworkAddress   ChassisIDSubtype = 5
+	ChassisIDSubtypeInterfaceName    ChassisIDSubtype = 6
+	ChassisIDSubtypeLocallyAssigned  ChassisIDSubtype = 7
+)
+
+// A ChassisID identifies the system which sent a DataUnit.
+type ChassisID struct {
+	Subtype ChassisIDSubtype
+	ID      []byte
+}
+
+// String returns a readable form of a ChassisID.
+func (c ChassisID) String() string {
+	if c.Subtype == ChassisIDSubtypeMACAddress {
+		return formatID(c.ID, true)
+	}
+
+	return formatID(c.ID, false)
+}
+
+// A PortIDSubtype indicates how a PortID is encoded.
+type PortIDSubtype uint8
+
+// PortIDSubtype values defined by IEEE 802.1AB.
+const (
+	PortIDSubtypeInterfaceAlias  PortIDSubtype = 1
+	PortIDSubtypePortComponent   PortIDSubtype = 2
+	PortIDSubtypeMACAddress      PortIDSubtype = 3
+	PortIDSubtypeNetworkAddress  PortIDSubtype = 4
+	PortIDSubtypeInterfaceName   PortIDSubtype = 5
+	PortIDSubtypeAgentCircuitID  PortIDSubtype = 6
+	PortIDSubtypeLocallyAssigned PortIDSubtype = 7
+)
+
+// A PortID identifies the port which sent a DataUnit.
+type PortID struct {
+	Subtype PortIDSubtype
+	ID      []byte
+}
+
+// String returns a readable form of a PortID.
+func (p PortID) String() string {
+	if p.Subtype == PortIDSubtypeMACAddress {
+		return formatID(p.ID, true)
+	}
+
+	return formatID(p.ID, false)
+}
+
+// Capabilities is a bit mask of system capabilities.
+type Capabilities uint16
+
+// Capabilities values defined by IEEE 802.1AB.
+const (
+	CapabilityOther Capabilities = 1 << iota
+	CapabilityRepeater
+	CapabilityBridge
+	CapabilityWLANAccessPoint
+	CapabilityRouter
+	CapabilityTelephone
+	CapabilityDOCSISCableDevice
+	CapabilityStationOnly
+	CapabilityCVLANComponent
+	CapabilitySVLANComponent
+	CapabilityTwoPortMACRelay
+)
+
+// SystemCapabilities describes the capabilities a system supports, and those
+// which are currently enabled.
+type SystemCapabilities struct {
+	System  Capabilities
+	Enabled Capabilities
+}
+
+// An OrganizationSpecific is a TLV defined by the organization identified by
+// OUI.
+type OrganizationSpecific struct {
+	OUI     [3]byte
+	Subtype uint8
+	Info    []byte
+}
+
+// A DataUnit is an LLDP data unit, carried in the payload of an Ethernet frame
+// with EtherType LLDP.
+type DataUnit struct {
+	// ChassisID, PortID, and TTL are mandatory. ChassisID and PortID
+	// together identify the sender. A TTL of zero indicates that the sender
+	// is shutting down and its information should be discarded.
+	ChassisID ChassisID
+	PortID    PortID
+	TTL       time.Duration
+
+	// Optional descriptive TLVs, omitted when empty.
+	PortDescription   string
+	SystemName        string
+	SystemDescription string
+
+	// SystemCapabilities is omitted when nil.
+	SystemCapabilities *SystemCapabilities
+
+	// OrganizationSpecific contains any organizationally specific TLVs.
+	OrganizationSpecific []OrganizationSpecific
+
+	// Optional contains any other TLVs, such as management addresses.
+	Optional []TLV
+}
+
+// MarshalBinary allocates a byte slice and marshals a DataUnit into binary
+// form.
+func (d *DataUnit) MarshalBinary() ([]byte, error) {
+	if len(d.ChassisID.ID) == 0 || len(d.PortID.ID) == 0 {
+		return nil, errMissingTLV
+	}
+	if d.TTL < 0 || d.TTL > maxTTL {
+		return nil, fmt.Errorf("lldp: invalid TTL: %s", d.TTL)
+	}
+
+	ttl := make([]byte, 2)
+	binary.BigEndian.PutUint16(ttl, uint16(d.TTL/time.Second))
+
+	tlvs := []TLV{
+		{Type: TLVTypeChassisID, Value: append([]byte{uint8(d.ChassisID.Subtype)}, d.ChassisID.ID...)},
+		{Type: TLVTypePortID, Value: append([]byte{uint8(d.PortID.Subtype)}, d.PortID.ID...)},
+		{Type: TLVTypeTTL, Value: ttl},
+	}
+
+	strs := []struct {
+		t TLVType
+		s string
+	}{
+		{TLVTypePortDescription, d.PortDescription},
+		{TLVTypeSystemName, d.SystemName},
+		{TLVTypeSystemDescription, d.SystemDescription},
+	}
+	for _, s := range strs {
+		if s.s != "" {
+			tlvs = append(tlvs, TLV{Type: s.t, Value: []byte(s.s)})
+		}
+	}
+
+	if c := d.SystemCapabilities; c != nil {
+		b := make([]byte, 4)
+		binary.BigEndian.PutUint16(b[0:2], uint16(c.System))
+		binary.BigEndian.PutUint16(b[2:4], uint16(c.Enabled))
+		tlvs = append(tlvs, TLV{Type: TLVTypeSystemCapabilities, Value: b})
+	}
+
+	for _, o := range d.OrganizationSpecific {
+		b := make([]byte, 4+len(o.Info))
+		copy(b[0:3], o.OUI[:])
+		b[3] = o.Subtype
+		copy(b[4:], o.Info)
+		tlvs = append(tlvs, TLV{Type: TLVTypeOrganizationSpecific, Value: b})
+	}
+
+	for _, t := range d.Optional {
+		if t.Type == TLVTypeEnd {
+			return nil, fmt.Errorf("lldp: TLV type %d may not be used directly", t.Type)
+		}
+	}
+	tlvs = append(tlvs, d.Optional...)
+	tlvs = append(tlvs, TLV{Type: TLVTypeEnd})
+
+	var b []byte
+	for _, t := range tlvs {
+		if t.Type > 127 || len(t.Value) > maxTLVLen {
+			return nil, errInvalidTLV
+		}
+
+		var h [tlvHeaderLen]byte
+		binary.BigEndian.PutUint16(h[:], uint16(t.Type)<<9|uint16(len(t.Value)))
+		b = append(b, h[:]...)
+		b = append(b, t.Value...)
+	}
+
+	return b, nil
+}
+
+// UnmarshalBinary unmarshals a byte slice into a DataUnit. Any trailing
+// Ethernet padding after the end TLV is ignored.
+func (d *DataUnit) UnmarshalBinary(b []byte) error {
+	tlvs, err := parseTLVs(b)
+	if err != nil {
+		return err
+	}
+
+	// The chassis ID, port ID, and TTL TLVs must appear first and in order.
+	if len(tlvs) < 3 ||
+		tlvs[0].Type != TLVTypeChassisID ||
+		tlvs[1].Type != TLVTypePortID ||
+		tlvs[2].Type != TLVTypeTTL {
+		return errMissingTLV
+	}
+	if len(tlvs[0].Value) < 2 || len(tlvs[1].Value) < 2 || len(tlvs[2].Value) < 2 {
+		return errInvalidTLV
+	}
+
+	*d = DataUnit{
+		ChassisID: ChassisID{
+			Subtype: ChassisIDSubtype(tlvs[0].Value[0]),
+			ID:      tlvs[0].Value[1:],
+		},
+		PortID: PortID{
+			Subtype: PortIDSubtype(tlvs[1].Value[0]),
+			ID:      tlvs[1].Value[1:],
+		},
+		TTL: time.Duration(binary.BigEndian.Uint16(tlvs[2].Value)) * time.Second,
+	}
+
+	for _, t := range tlvs[3:] {
+		switch t.Type {
+		case TLVTypePortDescription:
+			d.PortDescription = string(t.Value)
+		case TLVTypeSystemName:
+			d.SystemName = string(t.Value)
+		case TLVTypeSystemDescription:
+			d.SystemDescription = string(t.Value)
+		case TLVTypeSystemCapabilities:
+			if len(t.Value) != 4 {
+				return errInvalidTLV
+			}
+
+			d.SystemCapabilities = &SystemCapabilities{
+				System:  Capabilities(binary.BigEndian.Uint16(t.Value[0:2])),
+				Enabled: Capabilities(binary.BigEndian.Uint16(t.Value[2:4])),
+			}
+		case TLVTypeOrganizationSpecific:
+			if len(t.Value) < 4 {
+				return errInvalidTLV
+			}
+
+			o := OrganizationSpecific{
+				Subtype: t.Value[3],
+				Info:    t.Value[4:],
+			}
+			copy(o.OUI[:], t.Value[0:3])
+			d.OrganizationSpecific = append(d.OrganizationSpecific, o)
+		default:
+			d.Optional = append(d.Optional, t)
+		}
+	}
+
+	return nil
+}
+
+// parseTLVs parses TLVs from b until the end TLV. TLV values are copied so
+// that b may be reused.
+func parseTLVs(b []byte) ([]TLV, error) {
+	var tlvs []TLV
+	for {
+		if len(b) < tlvHeaderLen {
+			return nil, io.ErrUnexpectedEOF
+		}
+
+		h := binary.BigEndian.Uint16(b[0:2])
+		t, l := TLVType(h>>9), int(h&maxTLVLen)
+		b = b[tlvHeaderLen:]
+
+		if len(b) < l {
+			return nil, io.ErrUnexpectedEOF
+		}
+		if t == TLVTypeEnd {
+			return tlvs, nil
+		}
+
+		v := make([]byte, l)
+		copy(v, b[:l])
+		b = b[l:]
+
+		tlvs = append(tlvs, TLV{Type: t, Value: v})
+	}
+}
+
+// formatID formats an identifier as a hardware address, as text if it is
+// printable, or as hexadecimal otherwise.
+func formatID(b []byte, mac bool) string {
+	if mac && len(b) == 6 {
+		return net.HardwareAddr(b).String()
+	}
+
+	for _, c := range b {
+		if c < 0x20 || c > 0x7e {
+			return fmt.Sprintf("%#x", b)
+		}
+	}
+
+	return string(b)
+}
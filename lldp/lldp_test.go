@@ -0,0 +1,309 @@
+package lldp_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/raw/ethernet"
+	"github.com/mdlayher/raw/internal/rawtest"
+	"github.com/mdlayher/raw/lldp"
+)
+
+var (
+	macA = net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x0a}
+	macB = net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x0b}
+)
+
+func TestDataUnitMarshalUnmarshal(t *testing.T) {
+	tests := []struct {
+		name string
+		du   *lldp.DataUnit
+	}{
+		{
+			name: "mandatory",
+			du: &lldp.DataUnit{
+				ChassisID: lldp.ChassisID{Subtype: lldp.ChassisIDSubtypeMACAddress, ID: macA},
+				PortID:    lldp.PortID{Subtype: lldp.PortIDSubtypeInterfaceName, ID: []byte("eth0")},
+				TTL:       120 * time.Second,
+			},
+		},
+		{
+			name: "optional",
+			du: &lldp.DataUnit{
+				ChassisID:         lldp.ChassisID{Subtype: lldp.ChassisIDSubtypeLocallyAssigned, ID: []byte("rack1")},
+				PortID:            lldp.PortID{Subtype: lldp.PortIDSubtypeMACAddress, ID: macB},
+				PortDescription:   "uplink",
+				SystemName:        "switch1",
+				SystemDescription: "Example Switch",
+				SystemCapabilities: &lldp.SystemCapabilities{
+					System:  lldp.CapabilityBridge | lldp.CapabilityRouter,
+					Enabled: lldp.CapabilityBridge,
+				},
+				OrganizationSpecific: []lldp.OrganizationSpecific{
+					// IEEE 802.1 port VLAN ID.
+					{OUI: [3]byte{0x00, 0x80, 0xc2}, Subtype: 1, Info: []byte{0x00, 0x0a}},
+				},
+				Optional: []lldp.TLV{{
+					Type:  lldp.TLVTypeManagementAddress,
+					Value: []byte{5, 1, 192, 0, 2, 1, 2, 0, 0, 0, 1, 0},
+				}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := tt.du.MarshalBinary()
+			if err != nil {
+				t.Fatalf("failed to marshal: %v", err)
+			}
+
+			// Trailing Ethernet padding must be ignored.
+			b = append(b, make([]byte, 8)...)
+
+			var got lldp.DataUnit
+			if err := got.UnmarshalBinary(b); err != nil {
+				t.Fatalf("failed to unmarshal: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.du, &got); diff != "" {
+				t.Fatalf("unexpected data unit (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDataUnitUnmarshalError(t *testing.T) {
+	tests := []struct {
+		name string
+		b    []byte
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name: "truncated TLV",
+			b:    []byte{0x02, 0x07, 0x04},
+		},
+		{
+			name: "missing TTL",
+			b: []byte{
+				0x02, 0x02, 0x07, 'a',
+				0x04, 0x02, 0x07, 'b',
+				0x00, 0x00,
+			},
+		},
+		{
+			name: "out of order",
+			b: []byte{
+				0x04, 0x02, 0x07, 'b',
+				0x02, 0x02, 0x07, 'a',
+				0x06, 0x02, 0x00, 0x78,
+				0x00, 0x00,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var du lldp.DataUnit
+			if err := du.UnmarshalBinary(tt.b); err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+		})
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		ifi  *net.Interface
+		cfg  *lldp.Config
+	}{
+		{
+			name: "hardware address",
+			ifi:  &net.Interface{Name: "eth0", MTU: 1500},
+		},
+		{
+			name: "negative interval",
+			ifi:  &net.Interface{Name: "eth0", MTU: 1500, HardwareAddr: macA},
+			cfg:  &lldp.Config{Interval: -time.Second},
+		},
+		{
+			name: "negative hold",
+			ifi:  &net.Interface{Name: "eth0", MTU: 1500, HardwareAddr: macA},
+			cfg:  &lldp.Config{Hold: -1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := lldp.New(tt.ifi, rawtest.NewHub().Conn(macA), tt.cfg); err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+		})
+	}
+}
+
+func TestAgentNeighbors(t *testing.T) {
+	hub := rawtest.NewHub()
+
+	a, cancelA := testAgent(t, hub, macA, "eth0")
+	b, _ := testAgent(t, hub, macB, "eth1")
+
+	na := waitNeighbors(t, a, 1)
+	nb := waitNeighbors(t, b, 1)
+
+	if diff := cmp.Diff("eth1", na[0].DataUnit.PortID.String()); diff != "" {
+		t.Fatalf("unexpected neighbor port (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(macA.String(), nb[0].DataUnit.ChassisID.String()); diff != "" {
+		t.Fatalf("unexpected neighbor chassis (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff("test", nb[0].DataUnit.SystemName); diff != "" {
+		t.Fatalf("unexpected neighbor system name (-want +got):\n%s", diff)
+	}
+
+	// A shut down agent must be removed from its neighbor's table.
+	cancelA()
+	waitNeighbors(t, b, 0)
+}
+
+func TestAgentNeighborExpires(t *testing.T) {
+	hub := rawtest.NewHub()
+	a, _ := testAgent(t, hub, macA, "eth0")
+
+	du := &lldp.DataUnit{
+		ChassisID: lldp.ChassisID{Subtype: lldp.ChassisIDSubtypeMACAddress, ID: macB},
+		PortID:    lldp.PortID{Subtype: lldp.PortIDSubtypeInterfaceName, ID: []byte("eth1")},
+		TTL:       1 * time.Second,
+	}
+	pb, err := du.MarshalBinary()
+	if err != nil {
+		t.Fatalf("failed to marshal data unit: %v", err)
+	}
+
+	fb, err := (&ethernet.Frame{
+		Destination: lldp.NearestBridge,
+		Source:      macB,
+		EtherType:   ethernet.EtherTypeLLDP,
+		Payload:     pb,
+	}).MarshalBinary()
+	if err != nil {
+		t.Fatalf("failed to marshal frame: %v", err)
+	}
+
+	conn := hub.Conn(macB)
+	defer conn.Close()
+
+	if _, err := conn.WriteTo(fb, nil); err != nil {
+		t.Fatalf("failed to write frame: %v", err)
+	}
+
+	waitNeighbors(t, a, 1)
+	time.Sleep(du.TTL)
+	waitNeighbors(t, a, 0)
+}
+
+func TestAgentRunClearsReadDeadline(t *testing.T) {
+	hub := rawtest.NewHub()
+	c := hub.Conn(macA)
+
+	a, err := lldp.New(
+		&net.Interface{Name: "eth0", MTU: 1500, HardwareAddr: macA},
+		c,
+		&lldp.Config{Interval: 20 * time.Millisecond},
+	)
+	if err != nil {
+		t.Fatalf("failed to create agent: %v", err)
+	}
+	defer a.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := a.Run(ctx); err != nil {
+		t.Fatalf("failed to run agent: %v", err)
+	}
+
+	// The connection must remain usable once Run returns.
+	peer := hub.Conn(macB)
+	defer peer.Close()
+
+	fb, err := (&ethernet.Frame{
+		Destination: lldp.NearestBridge,
+		Source:      macB,
+		EtherType:   ethernet.EtherTypeLLDP,
+	}).MarshalBinary()
+	if err != nil {
+		t.Fatalf("failed to marshal frame: %v", err)
+	}
+	if _, err := peer.WriteTo(fb, nil); err != nil {
+		t.Fatalf("failed to write frame: %v", err)
+	}
+
+	if _, _, err := c.ReadFrom(make([]byte, 1500)); err != nil {
+		t.Fatalf("failed to read after running agent: %v", err)
+	}
+}
+
+// testAgent runs an Agent on hub until the test completes or the returned
+// function is called.
+func testAgent(t *testing.T, hub *rawtest.Hub, mac net.HardwareAddr, name string) (*lldp.Agent, func()) {
+	t.Helper()
+
+	a, err := lldp.New(
+		&net.Interface{Name: name, MTU: 1500, HardwareAddr: mac},
+		hub.Conn(mac),
+		&lldp.Config{
+			Interval:   20 * time.Millisecond,
+			SystemName: "test",
+		},
+	)
+	if err != nil {
+		t.Fatalf("failed to create agent: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- a.Run(ctx) }()
+
+	var stopped bool
+	stop := func() {
+		if stopped {
+			return
+		}
+		stopped = true
+
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("failed to run agent: %v", err)
+		}
+	}
+
+	t.Cleanup(func() {
+		stop()
+		a.Close()
+	})
+
+	return a, stop
+}
+
+// waitNeighbors waits for a to report n neighbors.
+func waitNeighbors(t *testing.T, a *lldp.Agent, n int) []lldp.Neighbor {
+	t.Helper()
+
+	var ns []lldp.Neighbor
+	for i := 0; i < 100; i++ {
+		if ns = a.Neighbors(); len(ns) == n {
+			return ns
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatalf("expected %d neighbors, but got %d", n, len(ns))
+	return nil
+}
@@ -0,0 +1,332 @@
+package ndp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"time"
+
+	"github.com/mdlayher/raw"
+	"github.com/mdlayher/raw/ethernet"
+	"github.com/mdlayher/raw/inet"
+	"github.com/mdlayher/raw/internal/frame"
+	"golang.org/x/net/bpf"
+)
+
+// hopLimit is the required IPv6 hop limit for all NDP messages.
+const hopLimit = 255
+
+// Default timing values from RFC 4861, section 10.
+const (
+	defaultRetransmitTimer     = 1 * time.Second
+	defaultMaxMulticastSolicit = 3
+)
+
+// errNoResponse is returned when a neighbor does not respond to
+// solicitations.
+var errNoResponse = errors.New("ndp: no response from neighbor")
+
+// A Config specifies optional parameters for a Client.
+type Config struct {
+	// Addr is the IPv6 source address used for outgoing messages. If nil, a
+	// link-local address is derived from the interface's hardware address
+	// using the modified EUI-64 format, so a Client may be used on an
+	// interface which has no IPv6 address configured.
+	Addr net.IP
+
+	// RetransmitTimer is the time to wait for an advertisement after each
+	// solicitation. If zero, the default from RFC 4861 is used.
+	RetransmitTimer time.Duration
+
+	// MaxMulticastSolicit is the number of solicitations sent before giving
+	// up. If zero, the default from RFC 4861 is used.
+	MaxMulticastSolicit int
+}
+
+// A Client sends and receives NDP messages on a network interface.
+type Client struct {
+	ifi  *net.Interface
+	p    net.PacketConn
+	addr net.IP
+
+	retransmit time.Duration
+	solicits   int
+}
+
+// icmpv6Filter is a BPF filter which accepts only IPv6 frames which carry
+// ICMPv6 without extension headers.
+var icmpv6Filter = []bpf.Instruction{
+	// Load the IPv6 next header field.
+	bpf.LoadAbsolute{Off: 14 + 6, Size: 1},
+	bpf.JumpIf{Cond: bpf.JumpEqual, Val: uint32(inet.ProtocolICMPv6), SkipFalse: 1},
+	bpf.RetConstant{Val: math.MaxUint16},
+	bpf.RetConstant{Val: 0},
+}
+
+// Dial creates a new Client using the specified network interface. Dial
+// opens a *raw.Conn which receives ICMPv6 frames. A nil Config selects the
+// default values.
+func Dial(ifi *net.Interface, cfg *Config) (*Client, error) {
+	filter, err := bpf.Assemble(icmpv6Filter)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := raw.ListenPacket(ifi, uint16(ethernet.EtherTypeIPv6), &raw.Config{
+		Filter: filter,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := New(ifi, p, cfg)
+	if err != nil {
+		_ = p.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// New creates a new Client using the specified network interface and
+// net.PacketConn. p must send and receive complete Ethernet frames.
+func New(ifi *net.Interface, p net.PacketConn, cfg *Config) (*Client, error) {
+	if len(ifi.HardwareAddr) != 6 {
+		return nil, fmt.Errorf("ndp: invalid hardware address: %q", ifi.HardwareAddr)
+	}
+
+	if cfg == nil {
+		cfg = &Config{}
+	}
+
+	addr := cfg.Addr
+	if addr == nil {
+		addr = linkLocal(ifi.HardwareAddr)
+	}
+	if !isIPv6(addr) {
+		return nil, errInvalidIP
+	}
+
+	c := &Client{
+		ifi:        ifi,
+		p:          p,
+		addr:       addr,
+		retransmit: cfg.RetransmitTimer,
+		solicits:   cfg.MaxMulticastSolicit,
+	}
+
+	if c.retransmit == 0 {
+		c.retransmit = defaultRetransmitTimer
+	}
+	if c.solicits == 0 {
+		c.solicits = defaultMaxMulticastSolicit
+	}
+
+	return c, nil
+}
+
+// Close closes the Client's connection.
+func (c *Client) Close() error {
+	return c.p.Close()
+}
+
+// Addr returns the IPv6 source address used by the Client.
+func (c *Client) Addr() net.IP {
+	return c.addr
+}
+
+// SetReadDeadline sets the read deadline for the Client's connection.
+func (c *Client) SetReadDeadline(t time.Time) error {
+	return c.p.SetReadDeadline(t)
+}
+
+// WriteTo sends a Message to the IPv6 address dst. If dst is a multicast
+// address, hw may be nil and the destination hardware address is derived
+// from dst. Otherwise, hw must specify the hardware address of dst.
+func (c *Client) WriteTo(m Message, dst net.IP, hw net.HardwareAddr) error {
+	if !isIPv6(dst) {
+		return errInvalidIP
+	}
+
+	if hw == nil {
+		if !dst.IsMulticast() {
+			return fmt.Errorf("ndp: hardware address required for unicast destination %s", dst)
+		}
+
+		hw = multicastHardwareAddr(dst)
+	}
+
+	mb, err := MarshalMessageChecksum(m, c.addr, dst)
+	if err != nil {
+		return err
+	}
+
+	ipb, err := (&inet.IPv6Header{
+		NextHeader:  inet.ProtocolICMPv6,
+		HopLimit:    hopLimit,
+		Source:      c.addr,
+		Destination: dst,
+	}).Marshal(mb)
+	if err != nil {
+		return err
+	}
+
+	fb, err := (&ethernet.Frame{
+		Destination: hw,
+		Source:      c.ifi.HardwareAddr,
+		EtherType:   ethernet.EtherTypeIPv6,
+		Payload:     ipb,
+	}).MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	_, err = c.p.WriteTo(fb, &raw.Addr{HardwareAddr: hw})
+	return err
+}
+
+// ReadFrom reads a single NDP message from the Client's connection, along
+// with the IPv6 and hardware addresses of its sender. Frames which do not
+// carry a valid NDP message, including those with an invalid checksum or
+// hop limit, are skipped.
+func (c *Client) ReadFrom() (Message, net.IP, net.HardwareAddr, error) {
+	b := make([]byte, frame.BufferSize(c.ifi))
+	for {
+		n, _, err := c.p.ReadFrom(b)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		var f ethernet.Frame
+		if err := f.UnmarshalBinary(b[:n]); err != nil || f.EtherType != ethernet.EtherTypeIPv6 {
+			continue
+		}
+
+		// RFC 4861 requires a hop limit of 255 so that NDP messages cannot
+		// originate from outside the link.
+		h, payload, err := inet.ParseIPv6(f.Payload)
+		if err != nil || h.NextHeader != inet.ProtocolICMPv6 || h.HopLimit != hopLimit {
+			continue
+		}
+
+		m, err := ParseMessageChecksum(payload, h.Source, h.Destination)
+		if err != nil {
+			continue
+		}
+
+		hw := make(net.HardwareAddr, 6)
+		copy(hw, f.Source)
+
+		return m, h.Source, hw, nil
+	}
+}
+
+// Resolve determines the hardware address of the neighbor with IPv6
+// address ip by sending neighbor solicitations to its solicited-node
+// multicast address and waiting for a neighbor advertisement.
+func (c *Client) Resolve(ctx context.Context, ip net.IP) (net.HardwareAddr, error) {
+	if !isIPv6(ip) {
+		return nil, errInvalidIP
+	}
+
+	defer frame.CancelReads(ctx, c.p)()
+
+	ns := &NeighborSolicitation{
+		TargetAddress: ip,
+		Options: []Option{&LinkLayerAddress{
+			Direction: Source,
+			Addr:      c.ifi.HardwareAddr,
+		}},
+	}
+
+	for i := 0; i < c.solicits; i++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		if err := c.WriteTo(ns, SolicitedNodeMulticast(ip), nil); err != nil {
+			return nil, err
+		}
+
+		if err := c.p.SetReadDeadline(time.Now().Add(c.retransmit)); err != nil {
+			return nil, err
+		}
+
+		// The deadline may have replaced the one set when ctx was canceled.
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		hw, err := c.waitAdvertisement(ip)
+		switch {
+		case err == nil:
+			return hw, nil
+		case ctx.Err() != nil:
+			return nil, ctx.Err()
+		case frame.IsTimeout(err):
+			// Try again.
+		default:
+			return nil, err
+		}
+	}
+
+	return nil, errNoResponse
+}
+
+// waitAdvertisement reads messages until a neighbor advertisement for ip is
+// received, or the read deadline is exceeded.
+func (c *Client) waitAdvertisement(ip net.IP) (net.HardwareAddr, error) {
+	for {
+		m, _, src, err := c.ReadFrom()
+		if err != nil {
+			return nil, err
+		}
+
+		na, ok := m.(*NeighborAdvertisement)
+		if !ok || !na.TargetAddress.Equal(ip) {
+			continue
+		}
+
+		// Prefer the target link-layer address option, but fall back to the
+		// source of the frame.
+		for _, o := range na.Options {
+			if lla, ok := o.(*LinkLayerAddress); ok && lla.Direction == Target {
+				return lla.Addr, nil
+			}
+		}
+
+		return src, nil
+	}
+}
+
+// SolicitedNodeMulticast returns the solicited-node multicast address for
+// ip, as described in RFC 4291, section 2.7.1.
+func SolicitedNodeMulticast(ip net.IP) net.IP {
+	snm := net.ParseIP("ff02::1:ff00:0")
+	copy(snm[13:], ip.To16()[13:])
+	return snm
+}
+
+// multicastHardwareAddr returns the Ethernet multicast address for the IPv6
+// multicast address ip, as described in RFC 2464, section 7.
+func multicastHardwareAddr(ip net.IP) net.HardwareAddr {
+	hw := net.HardwareAddr{0x33, 0x33, 0, 0, 0, 0}
+	copy(hw[2:], ip.To16()[12:])
+	return hw
+}
+
+// linkLocal derives an IPv6 link-local address from a hardware address
+// using the modified EUI-64 format.
+func linkLocal(mac net.HardwareAddr) net.IP {
+	ip := net.ParseIP("fe80::")
+	ip[8] = mac[0] ^ 0x02
+	ip[9] = mac[1]
+	ip[10] = mac[2]
+	ip[11] = 0xff
+	ip[12] = 0xfe
+	copy(ip[13:], mac[3:6])
+
+	return ip
+}
@@ -0,0 +1,377 @@
+// Package ndp implements the IPv6 Neighbor Discovery Protocol, as described
+// in RFC 4861, on top of a *raw.Conn. It provides NDP message and option
+// types, and a Client which resolves IPv6 addresses to hardware addresses by
+// sending neighbor solicitations directly to solicited-node multicast
+// hardware addresses.
+package ndp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/mdlayher/raw/inet"
+)
+
+var (
+	// errInvalidIP is returned when an IP address is not a valid IPv6
+	// address.
+	errInvalidIP = errors.New("ndp: invalid IPv6 address")
+
+	// errChecksum is returned when an ICMPv6 checksum is invalid.
+	errChecksum = errors.New("ndp: invalid ICMPv6 checksum")
+)
+
+// An ICMPType is an ICMPv6 message type.
+type ICMPType uint8
+
+// ICMPType values for the NDP messages supported by this package.
+const (
+	ICMPTypeRouterSolicitation    ICMPType = 133
+	ICMPTypeRouterAdvertisement   ICMPType = 134
+	ICMPTypeNeighborSolicitation  ICMPType = 135
+	ICMPTypeNeighborAdvertisement ICMPType = 136
+)
+
+// String returns the name of an ICMPType.
+func (t ICMPType) String() string {
+	switch t {
+	case ICMPTypeRouterSolicitation:
+		return "router solicitation"
+	case ICMPTypeRouterAdvertisement:
+		return "router advertisement"
+	case ICMPTypeNeighborSolicitation:
+		return "neighbor solicitation"
+	case ICMPTypeNeighborAdvertisement:
+		return "neighbor advertisement"
+	default:
+		return fmt.Sprintf("unknown(%d)", uint8(t))
+	}
+}
+
+// icmpHeaderLen is the length of the ICMPv6 type, code, and checksum fields.
+const icmpHeaderLen = inet.ICMPHeaderLen
+
+// A Message is a Neighbor Discovery Protocol message.
+type Message interface {
+	// Type returns the ICMPv6 type of the Message.
+	Type() ICMPType
+
+	// marshal and unmarshal operate on the message body, which follows the
+	// ICMPv6 type, code, and checksum fields.
+	marshal() ([]byte, error)
+	unmarshal(b []byte) error
+}
+
+// MarshalMessage marshals a Message into its ICMPv6 binary form, with the
+// checksum field set to zero. Use MarshalMessageChecksum when the checksum
+// will not be computed by the operating system, as is the case when sending
+// frames with a *raw.Conn.
+func MarshalMessage(m Message) ([]byte, error) {
+	body, err := m.marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, icmpHeaderLen+len(body))
+	b[0] = byte(m.Type())
+	copy(b[icmpHeaderLen:], body)
+
+	return b, nil
+}
+
+// MarshalMessageChecksum marshals a Message into its ICMPv6 binary form,
+// computing the checksum over the IPv6 pseudo-header formed from the source
+// and destination addresses src and dst.
+func MarshalMessageChecksum(m Message, src, dst net.IP) ([]byte, error) {
+	if !isIPv6(src) || !isIPv6(dst) {
+		return nil, errInvalidIP
+	}
+
+	b, err := MarshalMessage(m)
+	if err != nil {
+		return nil, err
+	}
+
+	csum, err := inet.PseudoHeaderChecksum(inet.ProtocolICMPv6, src, dst, b)
+	if err != nil {
+		return nil, err
+	}
+
+	binary.BigEndian.PutUint16(b[2:4], csum)
+	return b, nil
+}
+
+// ParseMessage parses a Message from its ICMPv6 binary form. The checksum is
+// not verified.
+func ParseMessage(b []byte) (Message, error) {
+	if len(b) < icmpHeaderLen {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	var m Message
+	switch t := ICMPType(b[0]); t {
+	case ICMPTypeRouterSolicitation:
+		m = new(RouterSolicitation)
+	case ICMPTypeRouterAdvertisement:
+		m = new(RouterAdvertisement)
+	case ICMPTypeNeighborSolicitation:
+		m = new(NeighborSolicitation)
+	case ICMPTypeNeighborAdvertisement:
+		m = new(NeighborAdvertisement)
+	default:
+		return nil, fmt.Errorf("ndp: unrecognized ICMPv6 type: %d", t)
+	}
+
+	// All NDP messages use code 0.
+	if b[1] != 0 {
+		return nil, fmt.Errorf("ndp: invalid ICMPv6 code for %s: %d", m.Type(), b[1])
+	}
+
+	if err := m.unmarshal(b[icmpHeaderLen:]); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// ParseMessageChecksum is like ParseMessage, but also verifies the checksum
+// of the message using the IPv6 pseudo-header formed from src and dst.
+func ParseMessageChecksum(b []byte, src, dst net.IP) (Message, error) {
+	if !isIPv6(src) || !isIPv6(dst) {
+		return nil, errInvalidIP
+	}
+
+	if len(b) < icmpHeaderLen {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	// A valid checksum results in zero when the checksum field is included.
+	csum, err := inet.PseudoHeaderChecksum(inet.ProtocolICMPv6, src, dst, b)
+	if err != nil {
+		return nil, err
+	}
+	if csum != 0 {
+		return nil, errChecksum
+	}
+
+	return ParseMessage(b)
+}
+
+var _ Message = &NeighborSolicitation{}
+
+// A NeighborSolicitation is a Neighbor Solicitation message as described in
+// RFC 4861, section 4.3.
+type NeighborSolicitation struct {
+	TargetAddress net.IP
+	Options       []Option
+}
+
+// Type implements Message.
+func (ns *NeighborSolicitation) Type() ICMPType { return ICMPTypeNeighborSolicitation }
+
+func (ns *NeighborSolicitation) marshal() ([]byte, error) {
+	if !isIPv6(ns.TargetAddress) {
+		return nil, errInvalidIP
+	}
+
+	// 4 bytes reserved, then the target address.
+	b := make([]byte, 4+net.IPv6len)
+	copy(b[4:], ns.TargetAddress.To16())
+
+	return appendOptions(b, ns.Options)
+}
+
+func (ns *NeighborSolicitation) unmarshal(b []byte) error {
+	if len(b) < 4+net.IPv6len {
+		return io.ErrUnexpectedEOF
+	}
+
+	opts, err := parseOptions(b[4+net.IPv6len:])
+	if err != nil {
+		return err
+	}
+
+	*ns = NeighborSolicitation{
+		TargetAddress: copyIP(b[4 : 4+net.IPv6len]),
+		Options:       opts,
+	}
+
+	return nil
+}
+
+var _ Message = &NeighborAdvertisement{}
+
+// A NeighborAdvertisement is a Neighbor Advertisement message as described
+// in RFC 4861, section 4.4.
+type NeighborAdvertisement struct {
+	Router        bool
+	Solicited     bool
+	Override      bool
+	TargetAddress net.IP
+	Options       []Option
+}
+
+// Type implements Message.
+func (na *NeighborAdvertisement) Type() ICMPType { return ICMPTypeNeighborAdvertisement }
+
+// Flag bits for a NeighborAdvertisement.
+const (
+	naRouter    = 0x80
+	naSolicited = 0x40
+	naOverride  = 0x20
+)
+
+func (na *NeighborAdvertisement) marshal() ([]byte, error) {
+	if !isIPv6(na.TargetAddress) {
+		return nil, errInvalidIP
+	}
+
+	b := make([]byte, 4+net.IPv6len)
+	if na.Router {
+		b[0] |= naRouter
+	}
+	if na.Solicited {
+		b[0] |= naSolicited
+	}
+	if na.Override {
+		b[0] |= naOverride
+	}
+	copy(b[4:], na.TargetAddress.To16())
+
+	return appendOptions(b, na.Options)
+}
+
+func (na *NeighborAdvertisement) unmarshal(b []byte) error {
+	if len(b) < 4+net.IPv6len {
+		return io.ErrUnexpectedEOF
+	}
+
+	opts, err := parseOptions(b[4+net.IPv6len:])
+	if err != nil {
+		return err
+	}
+
+	*na = NeighborAdvertisement{
+		Router:        b[0]&naRouter != 0,
+		Solicited:     b[0]&naSolicited != 0,
+		Override:      b[0]&naOverride != 0,
+		TargetAddress: copyIP(b[4 : 4+net.IPv6len]),
+		Options:       opts,
+	}
+
+	return nil
+}
+
+var _ Message = &RouterSolicitation{}
+
+// A RouterSolicitation is a Router Solicitation message as described in
+// RFC 4861, section 4.1.
+type RouterSolicitation struct {
+	Options []Option
+}
+
+// Type implements Message.
+func (rs *RouterSolicitation) Type() ICMPType { return ICMPTypeRouterSolicitation }
+
+func (rs *RouterSolicitation) marshal() ([]byte, error) {
+	// 4 bytes reserved.
+	return appendOptions(make([]byte, 4), rs.Options)
+}
+
+func (rs *RouterSolicitation) unmarshal(b []byte) error {
+	if len(b) < 4 {
+		return io.ErrUnexpectedEOF
+	}
+
+	opts, err := parseOptions(b[4:])
+	if err != nil {
+		return err
+	}
+
+	*rs = RouterSolicitation{Options: opts}
+	return nil
+}
+
+var _ Message = &RouterAdvertisement{}
+
+// A RouterAdvertisement is a Router Advertisement message as described in
+// RFC 4861, section 4.2.
+type RouterAdvertisement struct {
+	CurrentHopLimit      uint8
+	ManagedConfiguration bool
+	OtherConfiguration   bool
+	RouterLifetime       time.Duration
+	ReachableTime        time.Duration
+	RetransmitTimer      time.Duration
+	Options              []Option
+}
+
+// Type implements Message.
+func (ra *RouterAdvertisement) Type() ICMPType { return ICMPTypeRouterAdvertisement }
+
+// Flag bits for a RouterAdvertisement.
+const (
+	raManaged = 0x80
+	raOther   = 0x40
+)
+
+func (ra *RouterAdvertisement) marshal() ([]byte, error) {
+	lifetime := ra.RouterLifetime.Seconds()
+	if lifetime < 0 || lifetime > 0xffff {
+		return nil, fmt.Errorf("ndp: invalid router lifetime: %s", ra.RouterLifetime)
+	}
+
+	b := make([]byte, 12)
+	b[0] = ra.CurrentHopLimit
+	if ra.ManagedConfiguration {
+		b[1] |= raManaged
+	}
+	if ra.OtherConfiguration {
+		b[1] |= raOther
+	}
+
+	binary.BigEndian.PutUint16(b[2:4], uint16(lifetime))
+	binary.BigEndian.PutUint32(b[4:8], uint32(ra.ReachableTime/time.Millisecond))
+	binary.BigEndian.PutUint32(b[8:12], uint32(ra.RetransmitTimer/time.Millisecond))
+
+	return appendOptions(b, ra.Options)
+}
+
+func (ra *RouterAdvertisement) unmarshal(b []byte) error {
+	if len(b) < 12 {
+		return io.ErrUnexpectedEOF
+	}
+
+	opts, err := parseOptions(b[12:])
+	if err != nil {
+		return err
+	}
+
+	*ra = RouterAdvertisement{
+		CurrentHopLimit:      b[0],
+		ManagedConfiguration: b[1]&raManaged != 0,
+		OtherConfiguration:   b[1]&raOther != 0,
+		RouterLifetime:       time.Duration(binary.BigEndian.Uint16(b[2:4])) * time.Second,
+		ReachableTime:        time.Duration(binary.BigEndian.Uint32(b[4:8])) * time.Millisecond,
+		RetransmitTimer:      time.Duration(binary.BigEndian.Uint32(b[8:12])) * time.Millisecond,
+		Options:              opts,
+	}
+
+	return nil
+}
+
+// isIPv6 reports whether ip is an IPv6 address.
+func isIPv6(ip net.IP) bool {
+	return len(ip) == net.IPv6len && ip.To4() == nil
+}
+
+// copyIP returns a copy of the IPv6 address in b.
+func copyIP(b []byte) net.IP {
+	ip := make(net.IP, net.IPv6len)
+	copy(ip, b)
+	return ip
+}
@@ -0,0 +1,328 @@
+package ndp_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/raw/internal/rawtest"
+	"github.com/mdlayher/raw/ndp"
+)
+
+var (
+	clientMAC = net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad}
+	peerMAC   = net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+
+	peerIP = net.ParseIP("2001:db8::1")
+)
+
+func TestMessageMarshalParse(t *testing.T) {
+	tests := []struct {
+		name string
+		m    ndp.Message
+	}{
+		{
+			name: "neighbor solicitation",
+			m: &ndp.NeighborSolicitation{
+				TargetAddress: peerIP,
+				Options: []ndp.Option{
+					&ndp.LinkLayerAddress{
+						Direction: ndp.Source,
+						Addr:      clientMAC,
+					},
+				},
+			},
+		},
+		{
+			name: "neighbor advertisement",
+			m: &ndp.NeighborAdvertisement{
+				Solicited:     true,
+				Override:      true,
+				TargetAddress: peerIP,
+				Options: []ndp.Option{
+					&ndp.LinkLayerAddress{
+						Direction: ndp.Target,
+						Addr:      peerMAC,
+					},
+				},
+			},
+		},
+		{
+			name: "router solicitation",
+			m:    &ndp.RouterSolicitation{},
+		},
+		{
+			name: "router advertisement",
+			m: &ndp.RouterAdvertisement{
+				CurrentHopLimit:      64,
+				ManagedConfiguration: true,
+				RouterLifetime:       30 * time.Minute,
+				ReachableTime:        30 * time.Second,
+				RetransmitTimer:      time.Second,
+				Options: []ndp.Option{
+					&ndp.PrefixInformation{
+						PrefixLength:                   64,
+						OnLink:                         true,
+						AutonomousAddressConfiguration: true,
+						ValidLifetime:                  ndp.Infinity,
+						PreferredLifetime:              24 * time.Hour,
+						Prefix:                         net.ParseIP("2001:db8::"),
+					},
+					ndp.NewMTU(1500),
+					&ndp.RawOption{
+						Type:   25,
+						Length: 1,
+						Value:  []byte{0, 0, 0, 0, 0, 1},
+					},
+				},
+			},
+		},
+	}
+
+	var (
+		src = net.ParseIP("fe80::1")
+		dst = net.ParseIP("ff02::1")
+	)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := ndp.MarshalMessageChecksum(tt.m, src, dst)
+			if err != nil {
+				t.Fatalf("failed to marshal: %v", err)
+			}
+
+			m, err := ndp.ParseMessageChecksum(b, src, dst)
+			if err != nil {
+				t.Fatalf("failed to parse: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.m, m); diff != "" {
+				t.Fatalf("unexpected message (-want +got):\n%s", diff)
+			}
+
+			// A different pseudo-header must invalidate the checksum.
+			if _, err := ndp.ParseMessageChecksum(b, src, net.ParseIP("ff02::2")); err == nil {
+				t.Fatal("expected checksum error, but none occurred")
+			}
+		})
+	}
+}
+
+func TestMarshalMessageChecksum(t *testing.T) {
+	// A neighbor solicitation with a checksum computed by hand.
+	var (
+		src = net.ParseIP("fe80::dcad:beff:feef:dead")
+		dst = net.ParseIP("ff02::1:ff00:1")
+	)
+
+	b, err := ndp.MarshalMessageChecksum(&ndp.NeighborSolicitation{
+		TargetAddress: peerIP,
+		Options: []ndp.Option{
+			&ndp.LinkLayerAddress{
+				Direction: ndp.Source,
+				Addr:      clientMAC,
+			},
+		},
+	}, src, dst)
+	if err != nil {
+		t.Fatalf("failed to marshal: %v", err)
+	}
+
+	want := []byte{
+		135, 0, 0x57, 0xcc,
+		0x00, 0x00, 0x00, 0x00,
+		0x20, 0x01, 0x0d, 0xb8, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01,
+		0x01, 0x01, 0xde, 0xad, 0xbe, 0xef, 0xde, 0xad,
+	}
+	if diff := cmp.Diff(want, b); diff != "" {
+		t.Fatalf("unexpected message bytes (-want +got):\n%s", diff)
+	}
+}
+
+func TestParseMessageErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		b    []byte
+	}{
+		{
+			name: "short",
+			b:    []byte{135, 0},
+		},
+		{
+			name: "unknown type",
+			b:    []byte{128, 0, 0, 0},
+		},
+		{
+			name: "bad code",
+			b:    []byte{133, 1, 0, 0, 0, 0, 0, 0},
+		},
+		{
+			name: "short neighbor solicitation",
+			b:    []byte{135, 0, 0, 0, 0, 0, 0, 0},
+		},
+		{
+			name: "zero length option",
+			b:    []byte{133, 0, 0, 0, 0, 0, 0, 0, 1, 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ndp.ParseMessage(tt.b); err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+		})
+	}
+}
+
+func TestSolicitedNodeMulticast(t *testing.T) {
+	got := ndp.SolicitedNodeMulticast(net.ParseIP("2001:db8::abcd:1234"))
+	if want := net.ParseIP("ff02::1:ffcd:1234"); !want.Equal(got) {
+		t.Fatalf("unexpected solicited-node address: want %s, got %s", want, got)
+	}
+}
+
+func TestClientResolve(t *testing.T) {
+	c, peer := testClients(t)
+
+	// The peer answers the first solicitation for its address.
+	go func() {
+		for {
+			m, src, hw, err := peer.ReadFrom()
+			if err != nil {
+				return
+			}
+
+			ns, ok := m.(*ndp.NeighborSolicitation)
+			if !ok || !ns.TargetAddress.Equal(peerIP) {
+				continue
+			}
+
+			na := &ndp.NeighborAdvertisement{
+				Solicited:     true,
+				Override:      true,
+				TargetAddress: peerIP,
+				Options: []ndp.Option{&ndp.LinkLayerAddress{
+					Direction: ndp.Target,
+					Addr:      peerMAC,
+				}},
+			}
+			if err := peer.WriteTo(na, src, hw); err != nil {
+				t.Errorf("failed to write advertisement: %v", err)
+			}
+			return
+		}
+	}()
+
+	hw, err := c.Resolve(context.Background(), peerIP)
+	if err != nil {
+		t.Fatalf("failed to resolve: %v", err)
+	}
+
+	if diff := cmp.Diff(peerMAC, hw); diff != "" {
+		t.Fatalf("unexpected hardware address (-want +got):\n%s", diff)
+	}
+}
+
+func TestClientResolveNoResponse(t *testing.T) {
+	c, _ := testClients(t)
+
+	if _, err := c.Resolve(context.Background(), peerIP); err == nil {
+		t.Fatal("expected an error, but none occurred")
+	}
+}
+
+func TestClientResolveContextCanceled(t *testing.T) {
+	c, _ := testClients(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := c.Resolve(ctx, peerIP); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context canceled, but got: %v", err)
+	}
+}
+
+func TestClientResolveCanceledDuringWrite(t *testing.T) {
+	conn := rawtest.NewHub().Conn(clientMAC)
+	c, err := ndp.New(
+		&net.Interface{MTU: 1500, HardwareAddr: clientMAC},
+		conn,
+		&ndp.Config{RetransmitTimer: time.Hour},
+	)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	// Cancel while the solicitation is written, and give the cancellation
+	// time to expire the deadline before Resolve sets its own.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	conn.OnWrite(func() {
+		cancel()
+		time.Sleep(10 * time.Millisecond)
+	})
+
+	errC := make(chan error, 1)
+	go func() {
+		_, err := c.Resolve(ctx, peerIP)
+		errC <- err
+	}()
+
+	select {
+	case err := <-errC:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected context canceled, but got: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Resolve did not return after cancellation")
+	}
+}
+
+func TestClientLinkLocal(t *testing.T) {
+	c, _ := testClients(t)
+
+	if want, got := net.ParseIP("fe80::dcad:beff:feef:dead"), c.Addr(); !want.Equal(got) {
+		t.Fatalf("unexpected link-local address: want %s, got %s", want, got)
+	}
+}
+
+// testClients creates a Client and a peer Client on the same in-memory
+// segment. The peer uses peerIP as its address.
+func testClients(t *testing.T) (*ndp.Client, *ndp.Client) {
+	t.Helper()
+
+	hub := rawtest.NewHub()
+
+	c, err := ndp.New(
+		&net.Interface{MTU: 1500, HardwareAddr: clientMAC},
+		hub.Conn(clientMAC),
+		&ndp.Config{
+			RetransmitTimer:     20 * time.Millisecond,
+			MaxMulticastSolicit: 2,
+		},
+	)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	peer, err := ndp.New(
+		&net.Interface{MTU: 1500, HardwareAddr: peerMAC},
+		hub.Conn(peerMAC),
+		&ndp.Config{Addr: peerIP},
+	)
+	if err != nil {
+		t.Fatalf("failed to create peer: %v", err)
+	}
+
+	t.Cleanup(func() {
+		c.Close()
+		peer.Close()
+	})
+
+	return c, peer
+}
@@ -0,0 +1,306 @@
+package ndp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"time"
+)
+
+// Option type values for the NDP options supported by this package.
+const (
+	optSourceLLA         = 1
+	optTargetLLA         = 2
+	optPrefixInformation = 3
+	optMTU               = 5
+)
+
+// errInvalidOptionLength is returned when an option's length field is zero
+// or exceeds the remaining message length.
+var errInvalidOptionLength = errors.New("ndp: invalid option length")
+
+// An Option is a Neighbor Discovery Protocol option.
+type Option interface {
+	// Code returns the NDP option type value.
+	Code() uint8
+
+	// marshal and unmarshal operate on the complete option, including its
+	// type and length fields.
+	marshal() ([]byte, error)
+	unmarshal(b []byte) error
+}
+
+// A Direction specifies the direction of a LinkLayerAddress Option as a
+// source or target.
+type Direction int
+
+// Possible Direction values.
+const (
+	Source Direction = optSourceLLA
+	Target Direction = optTargetLLA
+)
+
+var _ Option = &LinkLayerAddress{}
+
+// A LinkLayerAddress is a Source or Target Link-Layer Address option, as
+// described in RFC 4861, section 4.6.1.
+type LinkLayerAddress struct {
+	Direction Direction
+	Addr      net.HardwareAddr
+}
+
+// Code implements Option.
+func (lla *LinkLayerAddress) Code() uint8 { return uint8(lla.Direction) }
+
+func (lla *LinkLayerAddress) marshal() ([]byte, error) {
+	if d := lla.Direction; d != Source && d != Target {
+		return nil, fmt.Errorf("ndp: invalid link-layer address direction: %d", d)
+	}
+	if len(lla.Addr) != 6 {
+		return nil, fmt.Errorf("ndp: invalid link-layer address: %q", lla.Addr)
+	}
+
+	b := make([]byte, 8)
+	b[0] = lla.Code()
+	b[1] = 1
+	copy(b[2:], lla.Addr)
+
+	return b, nil
+}
+
+func (lla *LinkLayerAddress) unmarshal(b []byte) error {
+	// Only Ethernet addresses are supported.
+	if len(b) != 8 {
+		return errInvalidOptionLength
+	}
+
+	addr := make(net.HardwareAddr, 6)
+	copy(addr, b[2:8])
+
+	*lla = LinkLayerAddress{
+		Direction: Direction(b[0]),
+		Addr:      addr,
+	}
+
+	return nil
+}
+
+var _ Option = new(MTU)
+
+// MTU is an MTU option, as described in RFC 4861, section 4.6.4.
+type MTU uint32
+
+// NewMTU creates an MTU Option from an MTU value.
+func NewMTU(mtu uint32) *MTU {
+	m := MTU(mtu)
+	return &m
+}
+
+// Code implements Option.
+func (*MTU) Code() uint8 { return optMTU }
+
+func (m *MTU) marshal() ([]byte, error) {
+	b := make([]byte, 8)
+	b[0] = optMTU
+	b[1] = 1
+	binary.BigEndian.PutUint32(b[4:8], uint32(*m))
+
+	return b, nil
+}
+
+func (m *MTU) unmarshal(b []byte) error {
+	if len(b) != 8 {
+		return errInvalidOptionLength
+	}
+
+	*m = MTU(binary.BigEndian.Uint32(b[4:8]))
+	return nil
+}
+
+var _ Option = &PrefixInformation{}
+
+// A PrefixInformation is a Prefix Information option, as described in
+// RFC 4861, section 4.6.2.
+type PrefixInformation struct {
+	PrefixLength                   uint8
+	OnLink                         bool
+	AutonomousAddressConfiguration bool
+	ValidLifetime                  time.Duration
+	PreferredLifetime              time.Duration
+	Prefix                         net.IP
+}
+
+// Infinity is the lifetime value which indicates that a PrefixInformation
+// lifetime never expires.
+const Infinity = time.Duration(math.MaxUint32) * time.Second
+
+// Flag bits for a PrefixInformation.
+const (
+	piOnLink     = 0x80
+	piAutonomous = 0x40
+)
+
+// Code implements Option.
+func (*PrefixInformation) Code() uint8 { return optPrefixInformation }
+
+func (pi *PrefixInformation) marshal() ([]byte, error) {
+	if !isIPv6(pi.Prefix) || pi.PrefixLength > 128 {
+		return nil, errInvalidIP
+	}
+
+	b := make([]byte, 32)
+	b[0] = optPrefixInformation
+	b[1] = 4
+	b[2] = pi.PrefixLength
+	if pi.OnLink {
+		b[3] |= piOnLink
+	}
+	if pi.AutonomousAddressConfiguration {
+		b[3] |= piAutonomous
+	}
+
+	binary.BigEndian.PutUint32(b[4:8], lifetime(pi.ValidLifetime))
+	binary.BigEndian.PutUint32(b[8:12], lifetime(pi.PreferredLifetime))
+	copy(b[16:32], pi.Prefix.Mask(net.CIDRMask(int(pi.PrefixLength), 128)))
+
+	return b, nil
+}
+
+func (pi *PrefixInformation) unmarshal(b []byte) error {
+	if len(b) != 32 {
+		return errInvalidOptionLength
+	}
+
+	*pi = PrefixInformation{
+		PrefixLength:                   b[2],
+		OnLink:                         b[3]&piOnLink != 0,
+		AutonomousAddressConfiguration: b[3]&piAutonomous != 0,
+		ValidLifetime:                  time.Duration(binary.BigEndian.Uint32(b[4:8])) * time.Second,
+		PreferredLifetime:              time.Duration(binary.BigEndian.Uint32(b[8:12])) * time.Second,
+		Prefix:                         copyIP(b[16:32]),
+	}
+
+	return nil
+}
+
+// lifetime converts a time.Duration into a lifetime value in seconds,
+// saturating at Infinity.
+func lifetime(d time.Duration) uint32 {
+	if d >= Infinity {
+		return math.MaxUint32
+	}
+	if d < 0 {
+		return 0
+	}
+
+	return uint32(d / time.Second)
+}
+
+var _ Option = &RawOption{}
+
+// A RawOption is an Option in its raw, unprocessed form. Options which are
+// not recognized by this package are parsed as a RawOption.
+type RawOption struct {
+	Type uint8
+
+	// Length is the length of the option in units of 8 bytes, including the
+	// type and length fields.
+	Length uint8
+	Value  []byte
+}
+
+// Code implements Option.
+func (r *RawOption) Code() uint8 { return r.Type }
+
+func (r *RawOption) marshal() ([]byte, error) {
+	if int(r.Length)*8 != 2+len(r.Value) {
+		return nil, errInvalidOptionLength
+	}
+
+	b := make([]byte, 2+len(r.Value))
+	b[0] = r.Type
+	b[1] = r.Length
+	copy(b[2:], r.Value)
+
+	return b, nil
+}
+
+func (r *RawOption) unmarshal(b []byte) error {
+	if len(b) < 2 {
+		return io.ErrUnexpectedEOF
+	}
+
+	v := make([]byte, len(b)-2)
+	copy(v, b[2:])
+
+	*r = RawOption{
+		Type:   b[0],
+		Length: b[1],
+		Value:  v,
+	}
+
+	return nil
+}
+
+// appendOptions marshals options and appends them to b.
+func appendOptions(b []byte, options []Option) ([]byte, error) {
+	for _, o := range options {
+		ob, err := o.marshal()
+		if err != nil {
+			return nil, err
+		}
+
+		b = append(b, ob...)
+	}
+
+	return b, nil
+}
+
+// parseOptions parses a sequence of options from b.
+func parseOptions(b []byte) ([]Option, error) {
+	var options []Option
+	for len(b) > 0 {
+		if len(b) < 2 {
+			return nil, io.ErrUnexpectedEOF
+		}
+
+		// Length is in units of 8 bytes and must not be zero.
+		l := int(b[1]) * 8
+		if l == 0 || l > len(b) {
+			return nil, errInvalidOptionLength
+		}
+
+		var o Option
+		switch b[0] {
+		case optSourceLLA, optTargetLLA:
+			o = new(LinkLayerAddress)
+		case optMTU:
+			o = new(MTU)
+		case optPrefixInformation:
+			o = new(PrefixInformation)
+		default:
+			o = new(RawOption)
+		}
+
+		if err := o.unmarshal(b[:l]); err != nil {
+			// Options which are not in a supported form, such as non-Ethernet
+			// link-layer addresses, are retained as raw options.
+			if !errors.Is(err, errInvalidOptionLength) {
+				return nil, err
+			}
+
+			o = new(RawOption)
+			if err := o.unmarshal(b[:l]); err != nil {
+				return nil, err
+			}
+		}
+
+		options = append(options, o)
+		b = b[l:]
+	}
+
+	return options, nil
+}
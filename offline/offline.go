@@ -0,0 +1,476 @@
+// Package offline implements a read-only connection which reads frames from a
+// pcap or pcapng capture file, with the same method set as *raw.Conn.
+//
+// A Conn allows code built on package raw to be tested against recorded
+// traffic without privileges or network interfaces. Frames captured with
+// pcap.LinkTypeEthernet are returned with their Ethernet header, as by a
+// *raw.Conn opened with the default configuration. Frames captured with
+// pcap.LinkTypeLinuxSLL are returned without a link layer header, as by a
+// *raw.Conn opened with raw.Config.LinuxSockDGRAM. Frames with other link
+// types are skipped.
+package offline
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mdlayher/raw"
+	"github.com/mdlayher/raw/pcap"
+	"github.com/mdlayher/raw/pcapng"
+	"golang.org/x/net/bpf"
+)
+
+// ErrReadOnly is returned when writing to a Conn.
+var ErrReadOnly = errors.New("offline: connection is read-only")
+
+// A Config configures a Conn. The zero value of any field selects a default
+// value.
+type Config struct {
+	// Pace delays each frame until the time since the first frame of the
+	// file matches that of the original capture. If false, frames are
+	// returned as quickly as they are read.
+	Pace bool
+
+	// Speed is a multiplier for the rate at which frames are paced, such
+	// that 2 replays a capture in half of its original duration. If zero,
+	// 1 is used.
+	Speed float64
+
+	// HardwareAddr is the address returned by LocalAddr.
+	HardwareAddr net.HardwareAddr
+
+	// Filter is an initial BPF filter applied to frames, as if by SetBPF.
+	Filter []bpf.RawInstruction
+}
+
+var (
+	_ net.PacketConn = &Conn{}
+	_ bpf.Setter     = &Conn{}
+)
+
+// A Conn is a read-only connection which reads frames from a capture file.
+type Conn struct {
+	cfg Config
+	c   io.Closer
+
+	// rmu serializes reads from r, and protects the state used only by
+	// ReadFrom.
+	rmu     sync.Mutex
+	r       *Reader
+	pending *frame
+	start   time.Time
+	first   time.Time
+
+	mu sync.Mutex
+	// Closed and replaced whenever the read deadline changes or the Conn
+	// is closed.
+	changed   chan struct{}
+	closed    bool
+	rdeadline time.Time
+	vm        *bpf.VM
+	packets   uint64
+}
+
+// A frame is a frame read from a capture file.
+type frame struct {
+	ts   time.Time
+	src  net.HardwareAddr
+	data []byte
+}
+
+// Open opens the pcap or pcapng capture file with the specified name. A nil
+// Config selects the default values.
+func Open(name string, cfg *Config) (*Conn, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := New(f, cfg)
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// New creates a Conn which reads a pcap or pcapng capture file from r. The
+// format is detected automatically. If r is an io.Closer, it is closed by
+// Close. A nil Config selects the default values.
+func New(r io.Reader, cfg *Config) (*Conn, error) {
+	if cfg == nil {
+		cfg = &Config{}
+	}
+
+	conf := *cfg
+	switch {
+	case conf.Speed < 0:
+		return nil, fmt.Errorf("offline: invalid speed: %v", conf.Speed)
+	case conf.Speed == 0:
+		conf.Speed = 1
+	}
+
+	rd, err := NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Conn{
+		cfg:     conf,
+		r:       rd,
+		changed: make(chan struct{}),
+	}
+	if closer, ok := r.(io.Closer); ok {
+		c.c = closer
+	}
+
+	if conf.Filter != nil {
+		if err := c.SetBPF(conf.Filter); err != nil {
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+// ReadFrom implements the net.PacketConn ReadFrom method. The address
+// returned is a *raw.Addr containing the source hardware address of the
+// frame. ReadFrom returns io.EOF when no frames remain in the file.
+func (c *Conn) ReadFrom(b []byte) (int, net.Addr, error) {
+	c.rmu.Lock()
+	defer c.rmu.Unlock()
+
+	for {
+		if err := c.check(); err != nil {
+			return 0, nil, err
+		}
+
+		if c.pending == nil {
+			f, err := c.next()
+			if err != nil {
+				return 0, nil, err
+			}
+			c.pending = f
+		}
+
+		// A pending frame which is not yet due remains pending if the wait
+		// is interrupted.
+		f := c.pending
+		if c.cfg.Pace {
+			due := c.start.Add(time.Duration(float64(f.ts.Sub(c.first)) / c.cfg.Speed))
+			if err := c.wait(due); err != nil {
+				return 0, nil, err
+			}
+		}
+		c.pending = nil
+
+		c.mu.Lock()
+		vm := c.vm
+		c.mu.Unlock()
+
+		data := f.data
+		if vm != nil {
+			n, err := vm.Run(data)
+			if err != nil {
+				return 0, nil, err
+			}
+			if n == 0 {
+				continue
+			}
+			if n < len(data) {
+				data = data[:n]
+			}
+		}
+
+		c.mu.Lock()
+		c.packets++
+		c.mu.Unlock()
+
+		return copy(b, data), &raw.Addr{HardwareAddr: f.src}, nil
+	}
+}
+
+// WriteTo implements the net.PacketConn WriteTo method. WriteTo always
+// returns ErrReadOnly.
+func (c *Conn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	return 0, ErrReadOnly
+}
+
+// Close closes the connection, and the capture file if it was opened by
+// Open or is an io.Closer.
+func (c *Conn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return net.ErrClosed
+	}
+
+	c.closed = true
+	c.signal()
+
+	if c.c != nil {
+		return c.c.Close()
+	}
+
+	return nil
+}
+
+// LocalAddr returns a *raw.Addr containing Config.HardwareAddr.
+func (c *Conn) LocalAddr() net.Addr {
+	return &raw.Addr{HardwareAddr: c.cfg.HardwareAddr}
+}
+
+// SetDeadline implements the net.PacketConn SetDeadline method.
+func (c *Conn) SetDeadline(t time.Time) error {
+	return c.SetReadDeadline(t)
+}
+
+// SetReadDeadline implements the net.PacketConn SetReadDeadline method.
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.rdeadline = t
+	c.signal()
+	return nil
+}
+
+// SetWriteDeadline implements the net.PacketConn SetWriteDeadline method.
+// Writes are not permitted, so the deadline is ignored.
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+// SetBPF attaches an assembled BPF program to the connection, which is run in
+// userspace for each frame. A nil program removes the filter.
+func (c *Conn) SetBPF(filter []bpf.RawInstruction) error {
+	var vm *bpf.VM
+	if filter != nil {
+		insns, ok := bpf.Disassemble(filter)
+		if !ok {
+			return errors.New("offline: BPF program contains unknown instructions")
+		}
+
+		var err error
+		vm, err = bpf.NewVM(insns)
+		if err != nil {
+			return err
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.vm = vm
+	return nil
+}
+
+// SetPromiscuous has no effect, since the frames in the capture file were
+// already captured.
+func (c *Conn) SetPromiscuous(b bool) error {
+	return nil
+}
+
+// Stats returns the number of frames returned by ReadFrom. No frames are
+// dropped.
+func (c *Conn) Stats() (*raw.Stats, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return &raw.Stats{Packets: c.packets}, nil
+}
+
+// next reads the next frame with a supported link type. The caller must hold
+// c.rmu.
+func (c *Conn) next() (*frame, error) {
+	for {
+		p, err := c.r.ReadPacket()
+		if err != nil {
+			return nil, err
+		}
+
+		if c.start.IsZero() {
+			c.start, c.first = time.Now(), p.Timestamp
+		}
+
+		switch p.LinkType {
+		case pcap.LinkTypeEthernet:
+			if len(p.Data) < 14 {
+				continue
+			}
+
+			return &frame{ts: p.Timestamp, src: net.HardwareAddr(p.Data[6:12]), data: p.Data}, nil
+		case pcap.LinkTypeLinuxSLL:
+			var h pcap.SLLHeader
+			if err := h.UnmarshalBinary(p.Data); err != nil {
+				continue
+			}
+
+			return &frame{ts: p.Timestamp, src: h.Addr, data: p.Data[16:]}, nil
+		}
+	}
+}
+
+// check returns an error if the Conn is closed or its read deadline has
+// passed.
+func (c *Conn) check() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch {
+	case c.closed:
+		return net.ErrClosed
+	case !c.rdeadline.IsZero() && !time.Now().Before(c.rdeadline):
+		return os.ErrDeadlineExceeded
+	}
+
+	return nil
+}
+
+// wait blocks until due, and returns an error if the Conn is closed or its
+// read deadline passes first.
+func (c *Conn) wait(due time.Time) error {
+	for {
+		if err := c.check(); err != nil {
+			return err
+		}
+
+		d := time.Until(due)
+		if d <= 0 {
+			return nil
+		}
+
+		c.mu.Lock()
+		changed, deadline := c.changed, c.rdeadline
+		c.mu.Unlock()
+
+		if !deadline.IsZero() && deadline.Before(due) {
+			d = time.Until(deadline)
+		}
+
+		timer := time.NewTimer(d)
+		select {
+		case <-timer.C:
+		case <-changed:
+			timer.Stop()
+		}
+	}
+}
+
+// signal wakes a goroutine waiting in ReadFrom. The caller must hold c.mu.
+func (c *Conn) signal() {
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+// A Packet is a packet read from a capture file.
+type Packet struct {
+	// Timestamp is the time the packet was captured.
+	Timestamp time.Time
+
+	// LinkType is the link layer header type of Data.
+	LinkType pcap.LinkType
+
+	// Data is the captured packet, beginning with its link layer header.
+	Data []byte
+}
+
+// A Reader reads packets from a pcap or pcapng capture file.
+type Reader struct {
+	src source
+}
+
+// NewReader creates a Reader which reads a pcap or pcapng capture file from
+// r. The format is detected automatically.
+func NewReader(r io.Reader) (*Reader, error) {
+	src, err := newSource(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Reader{src: src}, nil
+}
+
+// ReadPacket reads the next packet. ReadPacket returns io.EOF when no packets
+// remain.
+func (r *Reader) ReadPacket() (*Packet, error) {
+	ts, lt, data, err := r.src.next()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Packet{Timestamp: ts, LinkType: lt, Data: data}, nil
+}
+
+// A source reads frames from a capture file.
+type source interface {
+	next() (time.Time, pcap.LinkType, []byte, error)
+}
+
+// newSource detects the format of the capture file read from r and creates a
+// source for it.
+func newSource(r io.Reader) (source, error) {
+	br := bufio.NewReader(r)
+	b, err := br.Peek(4)
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+
+	// The pcapng section header block type is the same in either byte order.
+	if binary.LittleEndian.Uint32(b) == 0x0a0d0d0a {
+		pr, err := pcapng.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+
+		return &pcapngSource{r: pr}, nil
+	}
+
+	pr, err := pcap.NewReader(br)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pcapSource{r: pr}, nil
+}
+
+// A pcapSource is a source for a pcap capture file.
+type pcapSource struct {
+	r *pcap.Reader
+}
+
+func (s *pcapSource) next() (time.Time, pcap.LinkType, []byte, error) {
+	ci, data, err := s.r.ReadPacket()
+	if err != nil {
+		return time.Time{}, 0, nil, err
+	}
+
+	return ci.Timestamp, s.r.LinkType(), data, nil
+}
+
+// A pcapngSource is a source for a pcapng capture file.
+type pcapngSource struct {
+	r *pcapng.Reader
+}
+
+func (s *pcapngSource) next() (time.Time, pcap.LinkType, []byte, error) {
+	ci, data, err := s.r.ReadPacket()
+	if err != nil {
+		return time.Time{}, 0, nil, err
+	}
+
+	// The reader only returns packets for interfaces it has described.
+	return ci.Timestamp, s.r.Interfaces()[ci.InterfaceID].LinkType, data, nil
+}
@@ -0,0 +1,239 @@
+package offline_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/raw"
+	"github.com/mdlayher/raw/ethernet"
+	"github.com/mdlayher/raw/internal/rawtest"
+	"github.com/mdlayher/raw/offline"
+	"github.com/mdlayher/raw/pcap"
+	"github.com/mdlayher/raw/pcapng"
+	"golang.org/x/net/bpf"
+)
+
+var (
+	macA = net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	macB = net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x02}
+)
+
+func TestConnReadFromPcap(t *testing.T) {
+	frames := [][]byte{
+		rawtest.Frame(t, ethernet.Broadcast, macA, ethernet.EtherTypeIPv4, []byte("hello")),
+		rawtest.Frame(t, ethernet.Broadcast, macB, ethernet.EtherTypeARP, []byte("hello")),
+	}
+
+	c, err := offline.New(rawtest.PcapFile(t, 0, frames...), &offline.Config{HardwareAddr: macB})
+	if err != nil {
+		t.Fatalf("failed to create conn: %v", err)
+	}
+	defer c.Close()
+
+	for i, want := range frames {
+		b := make([]byte, 1500)
+		n, addr, err := c.ReadFrom(b)
+		if err != nil {
+			t.Fatalf("failed to read frame %d: %v", i, err)
+		}
+
+		if diff := cmp.Diff(want, b[:n]); diff != "" {
+			t.Fatalf("unexpected frame %d (-want +got):\n%s", i, diff)
+		}
+		if diff := cmp.Diff(want[6:12], []byte(addr.(*raw.Addr).HardwareAddr)); diff != "" {
+			t.Fatalf("unexpected source %d (-want +got):\n%s", i, diff)
+		}
+	}
+
+	if _, _, err := c.ReadFrom(make([]byte, 1500)); err != io.EOF {
+		t.Fatalf("expected io.EOF, but got: %v", err)
+	}
+
+	stats, err := c.Stats()
+	if err != nil {
+		t.Fatalf("failed to get stats: %v", err)
+	}
+	if diff := cmp.Diff(&raw.Stats{Packets: 2}, stats); diff != "" {
+		t.Fatalf("unexpected stats (-want +got):\n%s", diff)
+	}
+
+	if diff := cmp.Diff(macB, c.LocalAddr().(*raw.Addr).HardwareAddr); diff != "" {
+		t.Fatalf("unexpected local address (-want +got):\n%s", diff)
+	}
+	if _, err := c.WriteTo(frames[0], &raw.Addr{}); !errors.Is(err, offline.ErrReadOnly) {
+		t.Fatalf("expected ErrReadOnly, but got: %v", err)
+	}
+}
+
+func TestConnReadFromPcapngDatagram(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := pcapng.NewWriter(&buf, nil)
+	if err != nil {
+		t.Fatalf("failed to create writer: %v", err)
+	}
+
+	id, err := w.AddInterface(&net.Interface{Name: "eth0"}, pcap.LinkTypeLinuxSLL)
+	if err != nil {
+		t.Fatalf("failed to add interface: %v", err)
+	}
+
+	h := &pcap.SLLHeader{Addr: macA, Protocol: ethernet.EtherTypeIPv4}
+	if err := w.WriteDatagram(pcapng.CaptureInfo{InterfaceID: id}, h, []byte("hello")); err != nil {
+		t.Fatalf("failed to write datagram: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "capture.pcapng")
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	c, err := offline.Open(path, nil)
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+	defer c.Close()
+
+	// Datagrams are returned without a link layer header.
+	b := make([]byte, 1500)
+	n, addr, err := c.ReadFrom(b)
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+
+	if diff := cmp.Diff("hello", string(b[:n])); diff != "" {
+		t.Fatalf("unexpected payload (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(macA, addr.(*raw.Addr).HardwareAddr); diff != "" {
+		t.Fatalf("unexpected source (-want +got):\n%s", diff)
+	}
+}
+
+func TestConnSetBPF(t *testing.T) {
+	frames := [][]byte{
+		rawtest.Frame(t, ethernet.Broadcast, macA, ethernet.EtherTypeIPv4, []byte("hello")),
+		rawtest.Frame(t, ethernet.Broadcast, macA, ethernet.EtherTypeARP, []byte("hello")),
+		rawtest.Frame(t, ethernet.Broadcast, macB, ethernet.EtherTypeIPv4, []byte("hello")),
+	}
+
+	// Accept the first 14 bytes of ARP frames only.
+	filter, err := bpf.Assemble([]bpf.Instruction{
+		bpf.LoadAbsolute{Off: 12, Size: 2},
+		bpf.JumpIf{Cond: bpf.JumpNotEqual, Val: uint32(ethernet.EtherTypeARP), SkipTrue: 1},
+		bpf.RetConstant{Val: 14},
+		bpf.RetConstant{Val: 0},
+	})
+	if err != nil {
+		t.Fatalf("failed to assemble filter: %v", err)
+	}
+
+	c, err := offline.New(rawtest.PcapFile(t, 0, frames...), &offline.Config{Filter: filter})
+	if err != nil {
+		t.Fatalf("failed to create conn: %v", err)
+	}
+	defer c.Close()
+
+	b := make([]byte, 1500)
+	n, _, err := c.ReadFrom(b)
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	if diff := cmp.Diff(frames[1][:14], b[:n]); diff != "" {
+		t.Fatalf("unexpected frame (-want +got):\n%s", diff)
+	}
+
+	// Removing the filter accepts all frames again.
+	if err := c.SetBPF(nil); err != nil {
+		t.Fatalf("failed to remove filter: %v", err)
+	}
+
+	n, _, err = c.ReadFrom(b)
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	if diff := cmp.Diff(frames[2], b[:n]); diff != "" {
+		t.Fatalf("unexpected frame (-want +got):\n%s", diff)
+	}
+}
+
+func TestConnPace(t *testing.T) {
+	f := rawtest.Frame(t, ethernet.Broadcast, macA, ethernet.EtherTypeIPv4, []byte("hello"))
+
+	// 10 seconds of capture are replayed in 100 milliseconds.
+	c, err := offline.New(rawtest.PcapFile(t, 10*time.Second, f, f), &offline.Config{Pace: true, Speed: 100})
+	if err != nil {
+		t.Fatalf("failed to create conn: %v", err)
+	}
+	defer c.Close()
+
+	b := make([]byte, 1500)
+	if _, _, err := c.ReadFrom(b); err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	now := time.Now()
+
+	// The deadline passes before the second frame is due, but the frame
+	// remains available.
+	if err := c.SetReadDeadline(time.Now().Add(10 * time.Millisecond)); err != nil {
+		t.Fatalf("failed to set deadline: %v", err)
+	}
+	if _, _, err := c.ReadFrom(b); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, but got: %v", err)
+	}
+
+	if err := c.SetReadDeadline(time.Time{}); err != nil {
+		t.Fatalf("failed to clear deadline: %v", err)
+	}
+	if _, _, err := c.ReadFrom(b); err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+
+	if d := time.Since(now); d < 50*time.Millisecond {
+		t.Fatalf("second frame was not paced: %v", d)
+	}
+}
+
+func TestConnClose(t *testing.T) {
+	f := rawtest.Frame(t, ethernet.Broadcast, macA, ethernet.EtherTypeIPv4, []byte("hello"))
+
+	c, err := offline.New(rawtest.PcapFile(t, time.Hour, f, f), &offline.Config{Pace: true})
+	if err != nil {
+		t.Fatalf("failed to create conn: %v", err)
+	}
+
+	b := make([]byte, 1500)
+	if _, _, err := c.ReadFrom(b); err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+
+	// The second frame is an hour away, so the read blocks until Close.
+	errC := make(chan error, 1)
+	go func() {
+		_, _, err := c.ReadFrom(b)
+		errC <- err
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	if err := c.Close(); err != nil {
+		t.Fatalf("failed to close: %v", err)
+	}
+
+	if err := <-errC; !errors.Is(err, net.ErrClosed) {
+		t.Fatalf("expected net.ErrClosed, but got: %v", err)
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	if _, err := offline.New(bytes.NewReader(make([]byte, 24)), nil); err == nil {
+		t.Fatal("expected an error for an invalid file, but none occurred")
+	}
+	if _, err := offline.New(rawtest.PcapFile(t, 0), &offline.Config{Speed: -1}); err == nil {
+		t.Fatal("expected an error for a negative speed, but none occurred")
+	}
+}
@@ -0,0 +1,135 @@
+// Package pcap implements a reader and writer for the libpcap capture file
+// format. The Writer records frames read from a *raw.Conn for later analysis
+// with tools such as Wireshark and tcpdump, and the Reader reads frames back
+// from files written by this package or by other tools.
+//
+// Frames read from a *raw.Conn opened with the default configuration include
+// an Ethernet header and are recorded with LinkTypeEthernet. Frames read with
+// raw.Config.LinuxSockDGRAM set do not, and are recorded with
+// LinkTypeLinuxSLL, prefixed with an SLLHeader which carries the information
+// the Ethernet header would have. LinkTypeFor selects the appropriate link
+// type for a raw.Config.
+package pcap
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+
+	"github.com/mdlayher/raw"
+	"github.com/mdlayher/raw/ethernet"
+)
+
+// A LinkType is the link layer header type of the packets in a capture file.
+type LinkType uint32
+
+// Possible LinkType values.
+const (
+	LinkTypeEthernet LinkType = 1
+	LinkTypeLinuxSLL LinkType = 113
+)
+
+// String returns the name of a LinkType.
+func (l LinkType) String() string {
+	switch l {
+	case LinkTypeEthernet:
+		return "Ethernet"
+	case LinkTypeLinuxSLL:
+		return "Linux SLL"
+	default:
+		return fmt.Sprintf("LinkType(%d)", uint32(l))
+	}
+}
+
+// LinkTypeFor returns the LinkType of the frames read from a *raw.Conn opened
+// with cfg. A nil Config selects the default values.
+func LinkTypeFor(cfg *raw.Config) LinkType {
+	if cfg != nil && cfg.LinuxSockDGRAM {
+		return LinkTypeLinuxSLL
+	}
+
+	return LinkTypeEthernet
+}
+
+// An SLLPacketType indicates the direction and addressing of a packet in an
+// SLLHeader.
+type SLLPacketType uint16
+
+// Possible SLLPacketType values.
+const (
+	SLLHost      SLLPacketType = 0
+	SLLBroadcast SLLPacketType = 1
+	SLLMulticast SLLPacketType = 2
+	SLLOtherHost SLLPacketType = 3
+	SLLOutgoing  SLLPacketType = 4
+)
+
+// sllLen is the length of an SLLHeader.
+const sllLen = 16
+
+// errInvalidSLL is returned when an SLLHeader is malformed.
+var errInvalidSLL = errors.New("pcap: invalid Linux SLL header")
+
+// An SLLHeader is a Linux "cooked" capture header, which precedes each packet
+// in a capture file with LinkTypeLinuxSLL.
+type SLLHeader struct {
+	// PacketType is the type of the packet, relative to the host.
+	PacketType SLLPacketType
+
+	// HardwareType is the ARPHRD_* type of the link. If zero,
+	// ARPHRD_ETHER (1) is used by MarshalBinary.
+	HardwareType uint16
+
+	// Addr is the link layer source address, of at most 8 bytes.
+	Addr net.HardwareAddr
+
+	// Protocol is the EtherType of the packet.
+	Protocol ethernet.EtherType
+}
+
+// MarshalBinary allocates a byte slice and marshals an SLLHeader into binary
+// form.
+func (h *SLLHeader) MarshalBinary() ([]byte, error) {
+	if len(h.Addr) > 8 {
+		return nil, errInvalidSLL
+	}
+
+	hw := h.HardwareType
+	if hw == 0 {
+		hw = 1
+	}
+
+	b := make([]byte, sllLen)
+	binary.BigEndian.PutUint16(b[0:2], uint16(h.PacketType))
+	binary.BigEndian.PutUint16(b[2:4], hw)
+	binary.BigEndian.PutUint16(b[4:6], uint16(len(h.Addr)))
+	copy(b[6:14], h.Addr)
+	binary.BigEndian.PutUint16(b[14:16], uint16(h.Protocol))
+
+	return b, nil
+}
+
+// UnmarshalBinary unmarshals a byte slice into an SLLHeader. Only the first
+// 16 bytes of b are used; the packet follows them.
+func (h *SLLHeader) UnmarshalBinary(b []byte) error {
+	if len(b) < sllLen {
+		return io.ErrUnexpectedEOF
+	}
+
+	l := int(binary.BigEndian.Uint16(b[4:6]))
+	if l > 8 {
+		return errInvalidSLL
+	}
+
+	*h = SLLHeader{
+		PacketType:   SLLPacketType(binary.BigEndian.Uint16(b[0:2])),
+		HardwareType: binary.BigEndian.Uint16(b[2:4]),
+		Addr:         make(net.HardwareAddr, l),
+		Protocol:     ethernet.EtherType(binary.BigEndian.Uint16(b[14:16])),
+	}
+	copy(h.Addr, b[6:6+l])
+
+	return nil
+}
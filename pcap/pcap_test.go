@@ -0,0 +1,279 @@
+package pcap_test
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/raw"
+	"github.com/mdlayher/raw/ethernet"
+	"github.com/mdlayher/raw/pcap"
+)
+
+func TestLinkTypeFor(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  *raw.Config
+		lt   pcap.LinkType
+	}{
+		{name: "nil", lt: pcap.LinkTypeEthernet},
+		{name: "raw", cfg: &raw.Config{}, lt: pcap.LinkTypeEthernet},
+		{name: "datagram", cfg: &raw.Config{LinuxSockDGRAM: true}, lt: pcap.LinkTypeLinuxSLL},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := cmp.Diff(tt.lt, pcap.LinkTypeFor(tt.cfg)); diff != "" {
+				t.Fatalf("unexpected link type (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestWriter(t *testing.T) {
+	ts := time.Unix(0x01020304, 5006007)
+
+	tests := []struct {
+		name string
+		cfg  *pcap.Config
+		ci   pcap.CaptureInfo
+		data []byte
+		b    []byte
+	}{
+		{
+			name: "microseconds",
+			ci:   pcap.CaptureInfo{Timestamp: ts},
+			data: []byte{0xde, 0xad, 0xbe, 0xef},
+			b: []byte{
+				// Header.
+				0xd4, 0xc3, 0xb2, 0xa1,
+				0x02, 0x00, 0x04, 0x00,
+				0x00, 0x00, 0x00, 0x00,
+				0x00, 0x00, 0x00, 0x00,
+				0x00, 0x00, 0x04, 0x00,
+				0x01, 0x00, 0x00, 0x00,
+				// Record.
+				0x04, 0x03, 0x02, 0x01,
+				0x8e, 0x13, 0x00, 0x00,
+				0x04, 0x00, 0x00, 0x00,
+				0x04, 0x00, 0x00, 0x00,
+				0xde, 0xad, 0xbe, 0xef,
+			},
+		},
+		{
+			name: "nanoseconds truncated",
+			cfg:  &pcap.Config{SnapLen: 2, Nanoseconds: true},
+			ci:   pcap.CaptureInfo{Timestamp: ts, Length: 60},
+			data: []byte{0xde, 0xad, 0xbe, 0xef},
+			b: []byte{
+				// Header.
+				0x4d, 0x3c, 0xb2, 0xa1,
+				0x02, 0x00, 0x04, 0x00,
+				0x00, 0x00, 0x00, 0x00,
+				0x00, 0x00, 0x00, 0x00,
+				0x02, 0x00, 0x00, 0x00,
+				0x01, 0x00, 0x00, 0x00,
+				// Record.
+				0x04, 0x03, 0x02, 0x01,
+				0xb7, 0x62, 0x4c, 0x00,
+				0x02, 0x00, 0x00, 0x00,
+				0x3c, 0x00, 0x00, 0x00,
+				0xde, 0xad,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			w, err := pcap.NewWriter(&buf, pcap.LinkTypeEthernet, tt.cfg)
+			if err != nil {
+				t.Fatalf("failed to create writer: %v", err)
+			}
+
+			if err := w.WritePacket(tt.ci, tt.data); err != nil {
+				t.Fatalf("failed to write packet: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.b, buf.Bytes()); diff != "" {
+				t.Fatalf("unexpected file (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestWriterErrors(t *testing.T) {
+	if _, err := pcap.NewWriter(&bytes.Buffer{}, pcap.LinkTypeEthernet, &pcap.Config{SnapLen: -1}); err == nil {
+		t.Fatal("expected an error for a negative snapshot length, but none occurred")
+	}
+
+	w, err := pcap.NewWriter(&bytes.Buffer{}, pcap.LinkTypeEthernet, nil)
+	if err != nil {
+		t.Fatalf("failed to create writer: %v", err)
+	}
+
+	if err := w.WritePacket(pcap.CaptureInfo{Length: 1}, []byte{0x00, 0x00}); err == nil {
+		t.Fatal("expected an error for a short original length, but none occurred")
+	}
+	if err := w.WriteDatagram(pcap.CaptureInfo{}, &pcap.SLLHeader{}, nil); err == nil {
+		t.Fatal("expected an error writing a datagram to an Ethernet file, but none occurred")
+	}
+}
+
+func TestWriterDatagram(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := pcap.NewWriter(&buf, pcap.LinkTypeLinuxSLL, nil)
+	if err != nil {
+		t.Fatalf("failed to create writer: %v", err)
+	}
+
+	h := &pcap.SLLHeader{
+		PacketType: pcap.SLLBroadcast,
+		Addr:       net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad},
+		Protocol:   ethernet.EtherTypeARP,
+	}
+
+	if err := w.WriteDatagram(pcap.CaptureInfo{Timestamp: time.Unix(1, 0)}, h, []byte{0xff}); err != nil {
+		t.Fatalf("failed to write datagram: %v", err)
+	}
+
+	want := []byte{
+		// Record.
+		0x01, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00,
+		0x11, 0x00, 0x00, 0x00,
+		0x11, 0x00, 0x00, 0x00,
+		// SLL header.
+		0x00, 0x01,
+		0x00, 0x01,
+		0x00, 0x06,
+		0xde, 0xad, 0xbe, 0xef, 0xde, 0xad, 0x00, 0x00,
+		0x08, 0x06,
+		// Payload.
+		0xff,
+	}
+
+	b := buf.Bytes()
+	if diff := cmp.Diff(uint8(pcap.LinkTypeLinuxSLL), b[20]); diff != "" {
+		t.Fatalf("unexpected link type (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(want, b[24:]); diff != "" {
+		t.Fatalf("unexpected record (-want +got):\n%s", diff)
+	}
+
+	var got pcap.SLLHeader
+	if err := got.UnmarshalBinary(want[16:]); err != nil {
+		t.Fatalf("failed to unmarshal SLL header: %v", err)
+	}
+
+	h.HardwareType = 1
+	if diff := cmp.Diff(h, &got); diff != "" {
+		t.Fatalf("unexpected SLL header (-want +got):\n%s", diff)
+	}
+}
+
+func TestReader(t *testing.T) {
+	tests := []struct {
+		name string
+		lt   pcap.LinkType
+		cfg  *pcap.Config
+		ts   time.Time
+	}{
+		{
+			name: "microseconds",
+			lt:   pcap.LinkTypeEthernet,
+			ts:   time.Unix(1, 2000),
+		},
+		{
+			name: "nanoseconds",
+			lt:   pcap.LinkTypeLinuxSLL,
+			cfg:  &pcap.Config{SnapLen: 2, Nanoseconds: true},
+			ts:   time.Unix(1, 2),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			w, err := pcap.NewWriter(&buf, tt.lt, tt.cfg)
+			if err != nil {
+				t.Fatalf("failed to create writer: %v", err)
+			}
+
+			data := []byte{0xde, 0xad, 0xbe, 0xef}
+			for i := 0; i < 2; i++ {
+				if err := w.WritePacket(pcap.CaptureInfo{Timestamp: tt.ts}, data); err != nil {
+					t.Fatalf("failed to write packet: %v", err)
+				}
+			}
+
+			r, err := pcap.NewReader(&buf)
+			if err != nil {
+				t.Fatalf("failed to create reader: %v", err)
+			}
+			if diff := cmp.Diff(tt.lt, r.LinkType()); diff != "" {
+				t.Fatalf("unexpected link type (-want +got):\n%s", diff)
+			}
+
+			want := data
+			if tt.cfg != nil {
+				want = data[:tt.cfg.SnapLen]
+			}
+
+			for i := 0; i < 2; i++ {
+				ci, got, err := r.ReadPacket()
+				if err != nil {
+					t.Fatalf("failed to read packet: %v", err)
+				}
+
+				if diff := cmp.Diff(want, got); diff != "" {
+					t.Fatalf("unexpected packet (-want +got):\n%s", diff)
+				}
+				if !ci.Timestamp.Equal(tt.ts) || ci.Length != len(data) {
+					t.Fatalf("unexpected capture info: %+v", ci)
+				}
+			}
+
+			if _, _, err := r.ReadPacket(); err != io.EOF {
+				t.Fatalf("expected io.EOF, but got: %v", err)
+			}
+		})
+	}
+}
+
+func TestReaderBigEndian(t *testing.T) {
+	b := []byte{
+		// Header.
+		0xa1, 0xb2, 0xc3, 0xd4,
+		0x00, 0x02, 0x00, 0x04,
+		0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0xff, 0xff,
+		0x00, 0x00, 0x00, 0x01,
+		// Truncated record.
+		0x00, 0x00, 0x00, 0x01,
+		0x00, 0x00, 0x00, 0x02,
+		0x00, 0x00, 0x00, 0x04,
+		0x00, 0x00, 0x00, 0x04,
+		0xde, 0xad,
+	}
+
+	r, err := pcap.NewReader(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("failed to create reader: %v", err)
+	}
+	if diff := cmp.Diff(0xffff, r.SnapLen()); diff != "" {
+		t.Fatalf("unexpected snapshot length (-want +got):\n%s", diff)
+	}
+
+	if _, _, err := r.ReadPacket(); err != io.ErrUnexpectedEOF {
+		t.Fatalf("expected io.ErrUnexpectedEOF, but got: %v", err)
+	}
+
+	if _, err := pcap.NewReader(bytes.NewReader(make([]byte, 24))); err == nil {
+		t.Fatal("expected an error for an invalid magic number, but none occurred")
+	}
+}
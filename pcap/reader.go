@@ -0,0 +1,110 @@
+package pcap
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// maxRecordLen is the largest packet record accepted by a Reader, which
+// guards against allocating memory for a corrupt length.
+const maxRecordLen = 64 << 20
+
+// A Reader reads packets from a pcap capture file.
+type Reader struct {
+	r     io.Reader
+	order binary.ByteOrder
+	nanos bool
+	lt    LinkType
+	snap  int
+	hb    [recordLen]byte
+}
+
+// NewReader creates a Reader which reads packets from r, and reads the file
+// header immediately. Files in either byte order, with microsecond or
+// nanosecond timestamps, are supported.
+func NewReader(r io.Reader) (*Reader, error) {
+	b := make([]byte, headerLen)
+	if _, err := io.ReadFull(r, b); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+
+	rd := &Reader{r: r}
+
+	// The magic number is written in the byte order of the file.
+	var ok bool
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		switch order.Uint32(b[0:4]) {
+		case magicMicroseconds:
+			rd.order, ok = order, true
+		case magicNanoseconds:
+			rd.order, rd.nanos, ok = order, true, true
+		}
+		if ok {
+			break
+		}
+	}
+	if !ok {
+		return nil, fmt.Errorf("pcap: invalid magic number: %#08x", binary.BigEndian.Uint32(b[0:4]))
+	}
+
+	if major := rd.order.Uint16(b[4:6]); major != 2 {
+		return nil, fmt.Errorf("pcap: unsupported version: %d.%d", major, rd.order.Uint16(b[6:8]))
+	}
+
+	rd.snap = int(rd.order.Uint32(b[16:20]))
+	// The upper bits of the link type field may carry FCS information.
+	rd.lt = LinkType(rd.order.Uint32(b[20:24]) & 0xffff)
+
+	return rd, nil
+}
+
+// LinkType returns the LinkType of the packets in the file.
+func (r *Reader) LinkType() LinkType {
+	return r.lt
+}
+
+// SnapLen returns the snapshot length of the file.
+func (r *Reader) SnapLen() int {
+	return r.snap
+}
+
+// ReadPacket reads the next packet and its capture information. ReadPacket
+// returns io.EOF when no packets remain.
+func (r *Reader) ReadPacket() (CaptureInfo, []byte, error) {
+	// A file which ends cleanly between records returns io.EOF.
+	if _, err := io.ReadFull(r.r, r.hb[:]); err != nil {
+		return CaptureInfo{}, nil, err
+	}
+
+	sec := int64(r.order.Uint32(r.hb[0:4]))
+	frac := int64(r.order.Uint32(r.hb[4:8]))
+	if !r.nanos {
+		frac *= 1000
+	}
+
+	capLen := r.order.Uint32(r.hb[8:12])
+	if capLen > maxRecordLen {
+		return CaptureInfo{}, nil, fmt.Errorf("pcap: invalid record length: %d", capLen)
+	}
+
+	data := make([]byte, capLen)
+	if _, err := io.ReadFull(r.r, data); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return CaptureInfo{}, nil, err
+	}
+
+	ci := CaptureInfo{
+		Timestamp: time.Unix(sec, frac),
+		Length:    int(r.order.Uint32(r.hb[12:16])),
+	}
+
+	return ci, data, nil
+}
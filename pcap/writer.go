@@ -0,0 +1,163 @@
+package pcap
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Capture file magic numbers, which also indicate timestamp resolution.
+const (
+	magicMicroseconds = 0xa1b2c3d4
+	magicNanoseconds  = 0xa1b23c4d
+)
+
+const (
+	// headerLen and recordLen are the lengths of the file header and of
+	// each packet record header.
+	headerLen = 24
+	recordLen = 16
+
+	// defaultSnapLen matches the default of tcpdump.
+	defaultSnapLen = 262144
+)
+
+// A Config configures a Writer. The zero value of any field selects a default
+// value.
+type Config struct {
+	// SnapLen is the maximum number of bytes of each packet recorded.
+	// Longer packets are truncated, but their original length is recorded.
+	// If zero, 262144 is used.
+	SnapLen int
+
+	// Nanoseconds records timestamps with nanosecond rather than
+	// microsecond resolution. Most, but not all, tools support this.
+	Nanoseconds bool
+}
+
+// CaptureInfo contains information about a captured packet.
+type CaptureInfo struct {
+	// Timestamp is the time the packet was captured.
+	Timestamp time.Time
+
+	// Length is the original length of the packet. If zero, the length of
+	// the data written is used.
+	Length int
+}
+
+// A Writer writes packets to a pcap capture file. A Writer is safe for
+// concurrent use.
+type Writer struct {
+	lt  LinkType
+	cfg Config
+
+	mu sync.Mutex
+	w  io.Writer
+	b  []byte
+}
+
+// NewWriter creates a Writer which writes packets with the specified
+// LinkType to w, and writes the file header immediately. A nil Config selects
+// the default values.
+//
+// Files are written in little-endian byte order.
+func NewWriter(w io.Writer, lt LinkType, cfg *Config) (*Writer, error) {
+	if cfg == nil {
+		cfg = &Config{}
+	}
+
+	conf := *cfg
+	switch {
+	case conf.SnapLen < 0:
+		return nil, fmt.Errorf("pcap: invalid snapshot length: %d", conf.SnapLen)
+	case conf.SnapLen == 0:
+		conf.SnapLen = defaultSnapLen
+	}
+
+	magic := uint32(magicMicroseconds)
+	if conf.Nanoseconds {
+		magic = magicNanoseconds
+	}
+
+	// Version 2.4, with a zero timezone offset and timestamp accuracy.
+	b := make([]byte, headerLen)
+	binary.LittleEndian.PutUint32(b[0:4], magic)
+	binary.LittleEndian.PutUint16(b[4:6], 2)
+	binary.LittleEndian.PutUint16(b[6:8], 4)
+	binary.LittleEndian.PutUint32(b[16:20], uint32(conf.SnapLen))
+	binary.LittleEndian.PutUint32(b[20:24], uint32(lt))
+
+	if _, err := w.Write(b); err != nil {
+		return nil, err
+	}
+
+	return &Writer{
+		lt:  lt,
+		cfg: conf,
+		w:   w,
+	}, nil
+}
+
+// LinkType returns the LinkType of the packets written by w.
+func (w *Writer) LinkType() LinkType {
+	return w.lt
+}
+
+// WritePacket writes a packet and its capture information. data must begin
+// with the link layer header indicated by the Writer's LinkType, and is
+// truncated to the snapshot length.
+func (w *Writer) WritePacket(ci CaptureInfo, data []byte) error {
+	length := ci.Length
+	if length == 0 {
+		length = len(data)
+	}
+	if length < len(data) {
+		return fmt.Errorf("pcap: original length %d is less than captured length %d", length, len(data))
+	}
+	if len(data) > w.cfg.SnapLen {
+		data = data[:w.cfg.SnapLen]
+	}
+
+	frac := ci.Timestamp.Nanosecond()
+	if !w.cfg.Nanoseconds {
+		frac /= 1000
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	// Reuse a buffer so the record is written with a single call, which
+	// keeps the file consistent if w.w is shared or fails partway.
+	w.b = append(w.b[:0], make([]byte, recordLen)...)
+	binary.LittleEndian.PutUint32(w.b[0:4], uint32(ci.Timestamp.Unix()))
+	binary.LittleEndian.PutUint32(w.b[4:8], uint32(frac))
+	binary.LittleEndian.PutUint32(w.b[8:12], uint32(len(data)))
+	binary.LittleEndian.PutUint32(w.b[12:16], uint32(length))
+	w.b = append(w.b, data...)
+
+	_, err := w.w.Write(w.b)
+	return err
+}
+
+// WriteDatagram writes a packet read from a *raw.Conn opened with
+// raw.Config.LinuxSockDGRAM, which has no link layer header, by prefixing
+// it with h. The Writer's LinkType must be LinkTypeLinuxSLL.
+func (w *Writer) WriteDatagram(ci CaptureInfo, h *SLLHeader, payload []byte) error {
+	if w.lt != LinkTypeLinuxSLL {
+		return fmt.Errorf("pcap: cannot write datagram to %s capture file", w.lt)
+	}
+
+	hb, err := h.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	if ci.Length == 0 {
+		ci.Length = len(payload)
+	}
+	ci.Length += len(hb)
+
+	return w.WritePacket(ci, append(hb, payload...))
+}
@@ -0,0 +1,135 @@
+// Package pcapng implements a reader and writer for the pcapng capture file
+// format.
+//
+// Unlike the libpcap format implemented by package pcap, pcapng can record
+// packets captured on multiple interfaces in a single file, along with the
+// direction of each packet and the interface statistics reported by
+// raw.Conn.Stats.
+//
+// Files are written with a single section, in little-endian byte order, with
+// nanosecond timestamp resolution for every interface. The Reader accepts
+// files with multiple sections in either byte order, and reads enhanced and
+// simple packet blocks.
+package pcapng
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Block types.
+const (
+	blockSectionHeader        = 0x0a0d0d0a
+	blockInterfaceDescription = 0x00000001
+	blockInterfaceStatistics  = 0x00000005
+	blockEnhancedPacket       = 0x00000006
+)
+
+// Option codes. Codes are only unique within the block types which use them.
+const (
+	optEndOfOpt = 0
+
+	optSHBHardware = 2
+	optSHBOS       = 3
+	optSHBUserAppl = 4
+
+	optIFName    = 2
+	optIFMAC     = 6
+	optIFTSResol = 9
+
+	optEPBFlags = 2
+
+	optISBIfRecv = 4
+	optISBIfDrop = 5
+)
+
+// byteOrderMagic identifies the byte order of a section.
+const byteOrderMagic = 0x1a2b3c4d
+
+// A Direction is the direction of a packet relative to the interface on
+// which it was captured.
+type Direction uint8
+
+// Possible Direction values.
+const (
+	DirectionUnknown  Direction = 0
+	DirectionInbound  Direction = 1
+	DirectionOutbound Direction = 2
+)
+
+// String returns the name of a Direction.
+func (d Direction) String() string {
+	switch d {
+	case DirectionUnknown:
+		return "unknown"
+	case DirectionInbound:
+		return "inbound"
+	case DirectionOutbound:
+		return "outbound"
+	default:
+		return fmt.Sprintf("Direction(%d)", uint8(d))
+	}
+}
+
+// options builds the options of a block.
+type options []byte
+
+// add appends an option with value v, padded to a 32-bit boundary.
+func (o *options) add(code uint16, v []byte) {
+	var b [4]byte
+	binary.LittleEndian.PutUint16(b[0:2], code)
+	binary.LittleEndian.PutUint16(b[2:4], uint16(len(v)))
+
+	*o = append(*o, b[:]...)
+	*o = append(*o, v...)
+	*o = append(*o, make([]byte, pad(len(v)))...)
+}
+
+// addString appends a string option if s is not empty.
+func (o *options) addString(code uint16, s string) {
+	if s != "" {
+		o.add(code, []byte(s))
+	}
+}
+
+// addUint32 appends a 32-bit option.
+func (o *options) addUint32(code uint16, v uint32) {
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], v)
+	o.add(code, b[:])
+}
+
+// addUint64 appends a 64-bit option.
+func (o *options) addUint64(code uint16, v uint64) {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], v)
+	o.add(code, b[:])
+}
+
+// end terminates the options, if any were added.
+func (o *options) end() {
+	if len(*o) > 0 {
+		o.add(optEndOfOpt, nil)
+	}
+}
+
+// appendBlock appends a block of type typ with the specified body, and the
+// options which follow it, to b.
+func appendBlock(b []byte, typ uint32, body []byte, opts options) []byte {
+	l := 12 + len(body) + pad(len(body)) + len(opts)
+
+	var h [8]byte
+	binary.LittleEndian.PutUint32(h[0:4], typ)
+	binary.LittleEndian.PutUint32(h[4:8], uint32(l))
+
+	b = append(b, h[:]...)
+	b = append(b, body...)
+	b = append(b, make([]byte, pad(len(body)))...)
+	b = append(b, opts...)
+	return append(b, h[4:8]...)
+}
+
+// pad returns the number of bytes needed to pad n bytes to a 32-bit boundary.
+func pad(n int) int {
+	return (4 - n%4) % 4
+}
@@ -0,0 +1,317 @@
+package pcapng_test
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/raw"
+	"github.com/mdlayher/raw/pcap"
+	"github.com/mdlayher/raw/pcapng"
+)
+
+func TestWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := pcapng.NewWriter(&buf, &pcapng.Config{Application: "test"})
+	if err != nil {
+		t.Fatalf("failed to create writer: %v", err)
+	}
+
+	ifi := &net.Interface{
+		Index:        1,
+		Name:         "eth0",
+		HardwareAddr: net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad},
+	}
+
+	// The interface is only described once.
+	for i := 0; i < 2; i++ {
+		id, err := w.AddInterface(ifi, pcap.LinkTypeEthernet)
+		if err != nil {
+			t.Fatalf("failed to add interface: %v", err)
+		}
+		if diff := cmp.Diff(0, id); diff != "" {
+			t.Fatalf("unexpected interface ID (-want +got):\n%s", diff)
+		}
+	}
+
+	ts := time.Unix(1, 2)
+	ci := pcapng.CaptureInfo{
+		Timestamp: ts,
+		Direction: pcapng.DirectionOutbound,
+	}
+	if err := w.WritePacket(ci, []byte{0x01, 0x02, 0x03}); err != nil {
+		t.Fatalf("failed to write packet: %v", err)
+	}
+
+	if err := w.WriteStats(0, ts, &raw.Stats{Packets: 10, Drops: 2}); err != nil {
+		t.Fatalf("failed to write stats: %v", err)
+	}
+
+	want := []byte{
+		// Section header block.
+		0x0a, 0x0d, 0x0d, 0x0a,
+		0x28, 0x00, 0x00, 0x00,
+		0x4d, 0x3c, 0x2b, 0x1a,
+		0x01, 0x00, 0x00, 0x00,
+		0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+		0x04, 0x00, 0x04, 0x00, 't', 'e', 's', 't',
+		0x00, 0x00, 0x00, 0x00,
+		0x28, 0x00, 0x00, 0x00,
+
+		// Interface description block.
+		0x01, 0x00, 0x00, 0x00,
+		0x34, 0x00, 0x00, 0x00,
+		0x01, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x04, 0x00,
+		0x02, 0x00, 0x04, 0x00, 'e', 't', 'h', '0',
+		0x06, 0x00, 0x06, 0x00, 0xde, 0xad, 0xbe, 0xef, 0xde, 0xad, 0x00, 0x00,
+		0x09, 0x00, 0x01, 0x00, 0x09, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00,
+		0x34, 0x00, 0x00, 0x00,
+
+		// Enhanced packet block.
+		0x06, 0x00, 0x00, 0x00,
+		0x30, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00,
+		0x02, 0xca, 0x9a, 0x3b,
+		0x03, 0x00, 0x00, 0x00,
+		0x03, 0x00, 0x00, 0x00,
+		0x01, 0x02, 0x03, 0x00,
+		0x02, 0x00, 0x04, 0x00, 0x02, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00,
+		0x30, 0x00, 0x00, 0x00,
+
+		// Interface statistics block.
+		0x05, 0x00, 0x00, 0x00,
+		0x34, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00,
+		0x02, 0xca, 0x9a, 0x3b,
+		0x04, 0x00, 0x08, 0x00, 0x0a, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x05, 0x00, 0x08, 0x00, 0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00,
+		0x34, 0x00, 0x00, 0x00,
+	}
+
+	if diff := cmp.Diff(want, buf.Bytes()); diff != "" {
+		t.Fatalf("unexpected file (-want +got):\n%s", diff)
+	}
+}
+
+func TestWriterMultipleInterfaces(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := pcapng.NewWriter(&buf, nil)
+	if err != nil {
+		t.Fatalf("failed to create writer: %v", err)
+	}
+
+	var ids []int
+	for _, ifi := range []*net.Interface{
+		{Index: 1, Name: "eth0"},
+		{Index: 2, Name: "eth1"},
+	} {
+		id, err := w.AddInterface(ifi, pcap.LinkTypeLinuxSLL)
+		if err != nil {
+			t.Fatalf("failed to add interface: %v", err)
+		}
+		ids = append(ids, id)
+	}
+
+	if diff := cmp.Diff([]int{0, 1}, ids); diff != "" {
+		t.Fatalf("unexpected interface IDs (-want +got):\n%s", diff)
+	}
+
+	n := buf.Len()
+	h := &pcap.SLLHeader{Addr: net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad}}
+	if err := w.WriteDatagram(pcapng.CaptureInfo{InterfaceID: 1}, h, []byte{0xff}); err != nil {
+		t.Fatalf("failed to write datagram: %v", err)
+	}
+
+	// The packet refers to the second interface and includes the SLL header.
+	b := buf.Bytes()[n:]
+	if diff := cmp.Diff(uint8(1), b[8]); diff != "" {
+		t.Fatalf("unexpected interface ID (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(uint8(17), b[20]); diff != "" {
+		t.Fatalf("unexpected captured length (-want +got):\n%s", diff)
+	}
+}
+
+func TestWriterErrors(t *testing.T) {
+	if _, err := pcapng.NewWriter(&bytes.Buffer{}, &pcapng.Config{SnapLen: -1}); err == nil {
+		t.Fatal("expected an error for a negative snapshot length, but none occurred")
+	}
+
+	w, err := pcapng.NewWriter(&bytes.Buffer{}, nil)
+	if err != nil {
+		t.Fatalf("failed to create writer: %v", err)
+	}
+
+	if err := w.WritePacket(pcapng.CaptureInfo{}, []byte{0x00}); err == nil {
+		t.Fatal("expected an error for an unknown interface, but none occurred")
+	}
+	if err := w.WriteStats(0, time.Now(), &raw.Stats{}); err == nil {
+		t.Fatal("expected an error for an unknown interface, but none occurred")
+	}
+
+	if _, err := w.AddInterface(&net.Interface{Name: "eth0"}, pcap.LinkTypeEthernet); err != nil {
+		t.Fatalf("failed to add interface: %v", err)
+	}
+	if err := w.WriteDatagram(pcapng.CaptureInfo{}, &pcap.SLLHeader{}, nil); err == nil {
+		t.Fatal("expected an error writing a datagram to an Ethernet interface, but none occurred")
+	}
+	if err := w.WritePacket(pcapng.CaptureInfo{Length: 1}, []byte{0x00, 0x00}); err == nil {
+		t.Fatal("expected an error for a short original length, but none occurred")
+	}
+}
+
+func TestReader(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := pcapng.NewWriter(&buf, &pcapng.Config{SnapLen: 3})
+	if err != nil {
+		t.Fatalf("failed to create writer: %v", err)
+	}
+
+	ifis := []pcapng.Interface{
+		{
+			Name:         "eth0",
+			HardwareAddr: net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad},
+			LinkType:     pcap.LinkTypeEthernet,
+			SnapLen:      3,
+		},
+		{
+			Name:     "eth1",
+			LinkType: pcap.LinkTypeLinuxSLL,
+			SnapLen:  3,
+		},
+	}
+
+	for _, ifi := range ifis {
+		if _, err := w.AddInterface(&net.Interface{Name: ifi.Name, HardwareAddr: ifi.HardwareAddr}, ifi.LinkType); err != nil {
+			t.Fatalf("failed to add interface: %v", err)
+		}
+	}
+
+	cis := []pcapng.CaptureInfo{
+		{Timestamp: time.Unix(1, 2), Length: 4, InterfaceID: 0, Direction: pcapng.DirectionInbound},
+		{Timestamp: time.Unix(3, 4), Length: 4, InterfaceID: 1, Direction: pcapng.DirectionOutbound},
+	}
+
+	data := []byte{0xde, 0xad, 0xbe, 0xef}
+	for _, ci := range cis {
+		if err := w.WritePacket(ci, data); err != nil {
+			t.Fatalf("failed to write packet: %v", err)
+		}
+	}
+	if err := w.WriteStats(0, time.Unix(5, 0), &raw.Stats{}); err != nil {
+		t.Fatalf("failed to write stats: %v", err)
+	}
+
+	r, err := pcapng.NewReader(&buf)
+	if err != nil {
+		t.Fatalf("failed to create reader: %v", err)
+	}
+
+	for _, want := range cis {
+		ci, got, err := r.ReadPacket()
+		if err != nil {
+			t.Fatalf("failed to read packet: %v", err)
+		}
+
+		if diff := cmp.Diff(want, ci); diff != "" {
+			t.Fatalf("unexpected capture info (-want +got):\n%s", diff)
+		}
+		if diff := cmp.Diff(data[:3], got); diff != "" {
+			t.Fatalf("unexpected packet (-want +got):\n%s", diff)
+		}
+	}
+
+	if _, _, err := r.ReadPacket(); err != io.EOF {
+		t.Fatalf("expected io.EOF, but got: %v", err)
+	}
+
+	if diff := cmp.Diff(ifis, r.Interfaces()); diff != "" {
+		t.Fatalf("unexpected interfaces (-want +got):\n%s", diff)
+	}
+}
+
+func TestReaderBigEndian(t *testing.T) {
+	b := []byte{
+		// Section header block.
+		0x0a, 0x0d, 0x0d, 0x0a,
+		0x00, 0x00, 0x00, 0x1c,
+		0x1a, 0x2b, 0x3c, 0x4d,
+		0x00, 0x01, 0x00, 0x00,
+		0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+		0x00, 0x00, 0x00, 0x1c,
+
+		// Interface description block, with the default microsecond
+		// resolution.
+		0x00, 0x00, 0x00, 0x01,
+		0x00, 0x00, 0x00, 0x14,
+		0x00, 0x01, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x14,
+
+		// Unknown block.
+		0x00, 0x00, 0x0b, 0xad,
+		0x00, 0x00, 0x00, 0x10,
+		0xff, 0xff, 0xff, 0xff,
+		0x00, 0x00, 0x00, 0x10,
+
+		// Enhanced packet block.
+		0x00, 0x00, 0x00, 0x06,
+		0x00, 0x00, 0x00, 0x24,
+		0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00,
+		0x00, 0x0f, 0x42, 0x41,
+		0x00, 0x00, 0x00, 0x02,
+		0x00, 0x00, 0x00, 0x02,
+		0xde, 0xad, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x24,
+
+		// Simple packet block.
+		0x00, 0x00, 0x00, 0x03,
+		0x00, 0x00, 0x00, 0x14,
+		0x00, 0x00, 0x00, 0x01,
+		0xff, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x14,
+	}
+
+	r, err := pcapng.NewReader(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("failed to create reader: %v", err)
+	}
+
+	ci, data, err := r.ReadPacket()
+	if err != nil {
+		t.Fatalf("failed to read packet: %v", err)
+	}
+
+	want := pcapng.CaptureInfo{Timestamp: time.Unix(1, 1000), Length: 2}
+	if diff := cmp.Diff(want, ci); diff != "" {
+		t.Fatalf("unexpected capture info (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]byte{0xde, 0xad}, data); diff != "" {
+		t.Fatalf("unexpected packet (-want +got):\n%s", diff)
+	}
+
+	ci, data, err = r.ReadPacket()
+	if err != nil {
+		t.Fatalf("failed to read packet: %v", err)
+	}
+	if diff := cmp.Diff(pcapng.CaptureInfo{Length: 1}, ci); diff != "" {
+		t.Fatalf("unexpected capture info (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]byte{0xff}, data); diff != "" {
+		t.Fatalf("unexpected packet (-want +got):\n%s", diff)
+	}
+
+	if _, err := pcapng.NewReader(bytes.NewReader(b[28:])); err == nil {
+		t.Fatal("expected an error for a missing section header, but none occurred")
+	}
+}
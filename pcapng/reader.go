@@ -0,0 +1,322 @@
+package pcapng
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/mdlayher/raw/pcap"
+)
+
+// Block types which are only read.
+const (
+	blockSimplePacket = 0x00000003
+)
+
+// Option codes which are only read.
+const (
+	optIFTSOffset = 14
+)
+
+// maxBlockLen is the largest block accepted by a Reader, which guards against
+// allocating memory for a corrupt length.
+const maxBlockLen = 64 << 20
+
+// An Interface describes an interface on which packets were captured.
+type Interface struct {
+	Name         string
+	HardwareAddr net.HardwareAddr
+	LinkType     pcap.LinkType
+	SnapLen      int
+}
+
+// An iface is an Interface and the information needed to interpret the
+// timestamps of its packets.
+type iface struct {
+	Interface
+	resol  byte
+	offset int64
+}
+
+// A Reader reads packets from a pcapng capture file.
+type Reader struct {
+	r     io.Reader
+	order binary.ByteOrder
+	ifs   []iface
+}
+
+// NewReader creates a Reader which reads packets from r, and reads the first
+// section header immediately. Files with multiple sections, in either byte
+// order, are supported.
+func NewReader(r io.Reader) (*Reader, error) {
+	rd := &Reader{r: r}
+
+	if _, _, err := rd.readBlock(); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+
+	return rd, nil
+}
+
+// Interfaces returns the interfaces described so far in the current section.
+// The index of an Interface is its ID in CaptureInfo.
+func (r *Reader) Interfaces() []Interface {
+	out := make([]Interface, 0, len(r.ifs))
+	for _, ifi := range r.ifs {
+		out = append(out, ifi.Interface)
+	}
+	return out
+}
+
+// ReadPacket reads the next packet and its capture information, processing
+// any other blocks which precede it. ReadPacket returns io.EOF when no
+// packets remain.
+func (r *Reader) ReadPacket() (CaptureInfo, []byte, error) {
+	for {
+		typ, body, err := r.readBlock()
+		if err != nil {
+			return CaptureInfo{}, nil, err
+		}
+
+		switch typ {
+		case blockSectionHeader:
+			// Interface IDs are scoped to a section.
+			r.ifs = nil
+		case blockInterfaceDescription:
+			ifi, err := r.parseInterface(body)
+			if err != nil {
+				return CaptureInfo{}, nil, err
+			}
+			r.ifs = append(r.ifs, ifi)
+		case blockEnhancedPacket:
+			return r.parseEnhancedPacket(body)
+		case blockSimplePacket:
+			return r.parseSimplePacket(body)
+		}
+	}
+}
+
+// readBlock reads the next block and returns its type and body, which
+// includes any options.
+func (r *Reader) readBlock() (uint32, []byte, error) {
+	var h [12]byte
+	if _, err := io.ReadFull(r.r, h[:8]); err != nil {
+		return 0, nil, err
+	}
+
+	// The section header block type is the same in either byte order, and
+	// its byte order magic determines the order of the section.
+	order := r.order
+	if binary.LittleEndian.Uint32(h[0:4]) == blockSectionHeader {
+		if _, err := io.ReadFull(r.r, h[8:12]); err != nil {
+			return 0, nil, unexpectedEOF(err)
+		}
+
+		switch {
+		case binary.LittleEndian.Uint32(h[8:12]) == byteOrderMagic:
+			order = binary.LittleEndian
+		case binary.BigEndian.Uint32(h[8:12]) == byteOrderMagic:
+			order = binary.BigEndian
+		default:
+			return 0, nil, errors.New("pcapng: invalid byte order magic")
+		}
+		r.order = order
+	}
+	if order == nil {
+		return 0, nil, errors.New("pcapng: file does not begin with a section header")
+	}
+
+	typ := order.Uint32(h[0:4])
+	l := order.Uint32(h[4:8])
+	if l < 12 || l%4 != 0 || l > maxBlockLen {
+		return 0, nil, fmt.Errorf("pcapng: invalid block length: %d", l)
+	}
+
+	// The block is followed by a repeat of its length, which is ignored.
+	b := make([]byte, l-8)
+	n := 0
+	if typ == blockSectionHeader {
+		n = copy(b, h[8:12])
+	}
+	if _, err := io.ReadFull(r.r, b[n:]); err != nil {
+		return 0, nil, unexpectedEOF(err)
+	}
+
+	return typ, b[:len(b)-4], nil
+}
+
+// parseInterface parses the body of an interface description block.
+func (r *Reader) parseInterface(b []byte) (iface, error) {
+	if len(b) < 8 {
+		return iface{}, io.ErrUnexpectedEOF
+	}
+
+	ifi := iface{
+		Interface: Interface{
+			LinkType: pcap.LinkType(r.order.Uint16(b[0:2])),
+			SnapLen:  int(r.order.Uint32(b[4:8])),
+		},
+		// Microsecond resolution unless specified.
+		resol: 6,
+	}
+
+	err := r.parseOptions(b[8:], func(code uint16, v []byte) {
+		switch code {
+		case optIFName:
+			ifi.Name = string(v)
+		case optIFMAC:
+			if len(v) == 6 {
+				ifi.HardwareAddr = append(net.HardwareAddr(nil), v...)
+			}
+		case optIFTSResol:
+			if len(v) == 1 {
+				ifi.resol = v[0]
+			}
+		case optIFTSOffset:
+			if len(v) == 8 {
+				ifi.offset = int64(r.order.Uint64(v))
+			}
+		}
+	})
+
+	return ifi, err
+}
+
+// parseEnhancedPacket parses the body of an enhanced packet block.
+func (r *Reader) parseEnhancedPacket(b []byte) (CaptureInfo, []byte, error) {
+	if len(b) < 20 {
+		return CaptureInfo{}, nil, io.ErrUnexpectedEOF
+	}
+
+	// Compare lengths before converting to int, which may be 32 bits.
+	rawID := r.order.Uint32(b[0:4])
+	if uint64(rawID) >= uint64(len(r.ifs)) {
+		return CaptureInfo{}, nil, fmt.Errorf("pcapng: unknown interface ID: %d", rawID)
+	}
+	id := int(rawID)
+
+	ts := uint64(r.order.Uint32(b[4:8]))<<32 | uint64(r.order.Uint32(b[8:12]))
+	rawCapLen := r.order.Uint32(b[12:16])
+	if uint64(rawCapLen) > uint64(len(b)-20) {
+		return CaptureInfo{}, nil, io.ErrUnexpectedEOF
+	}
+	capLen := int(rawCapLen)
+
+	ci := CaptureInfo{
+		Timestamp:   r.ifs[id].timestamp(ts),
+		Length:      int(r.order.Uint32(b[16:20])),
+		InterfaceID: id,
+	}
+
+	err := r.parseOptions(b[20+capLen+pad(capLen):], func(code uint16, v []byte) {
+		if code == optEPBFlags && len(v) == 4 {
+			ci.Direction = Direction(r.order.Uint32(v) & 0x3)
+		}
+	})
+	if err != nil {
+		return CaptureInfo{}, nil, err
+	}
+
+	return ci, b[20 : 20+capLen], nil
+}
+
+// parseSimplePacket parses the body of a simple packet block, which has no
+// timestamp and belongs to the first interface.
+func (r *Reader) parseSimplePacket(b []byte) (CaptureInfo, []byte, error) {
+	if len(b) < 4 {
+		return CaptureInfo{}, nil, io.ErrUnexpectedEOF
+	}
+	if len(r.ifs) == 0 {
+		return CaptureInfo{}, nil, errors.New("pcapng: simple packet without an interface")
+	}
+
+	// Compare lengths before converting to int, which may be 32 bits.
+	rawLen := r.order.Uint32(b[0:4])
+	capLen := uint64(rawLen)
+	if snap := r.ifs[0].SnapLen; snap > 0 && capLen > uint64(snap) {
+		capLen = uint64(snap)
+	}
+	if capLen > uint64(len(b)-4) {
+		return CaptureInfo{}, nil, io.ErrUnexpectedEOF
+	}
+
+	return CaptureInfo{Length: int(rawLen)}, b[4 : 4+capLen], nil
+}
+
+// parseOptions calls fn for each option in b.
+func (r *Reader) parseOptions(b []byte, fn func(code uint16, v []byte)) error {
+	for len(b) >= 4 {
+		code := r.order.Uint16(b[0:2])
+		l := int(r.order.Uint16(b[2:4]))
+		if code == optEndOfOpt {
+			return nil
+		}
+		if len(b) < 4+l {
+			return io.ErrUnexpectedEOF
+		}
+
+		fn(code, b[4:4+l])
+
+		n := 4 + l + pad(l)
+		if n > len(b) {
+			n = len(b)
+		}
+		b = b[n:]
+	}
+
+	return nil
+}
+
+// timestamp converts a timestamp in the units of the interface to a
+// time.Time.
+func (ifi *iface) timestamp(ts uint64) time.Time {
+	n := uint(ifi.resol & 0x7f)
+
+	var sec, nsec uint64
+	if ifi.resol&0x80 == 0 {
+		// A negative power of 10.
+		div := uint64(1)
+		for i := uint(0); i < n && i < 19; i++ {
+			div *= 10
+		}
+
+		sec = ts / div
+		frac := ts % div
+		switch {
+		case n <= 9:
+			for i := n; i < 9; i++ {
+				frac *= 10
+			}
+			nsec = frac
+		default:
+			for i := uint(9); i < n && i < 19; i++ {
+				frac /= 10
+			}
+			nsec = frac
+		}
+	} else {
+		// A negative power of 2.
+		if n > 63 {
+			n = 63
+		}
+
+		sec = ts >> n
+		frac := ts & (1<<n - 1)
+		nsec = uint64(float64(frac) / float64(uint64(1)<<n) * 1e9)
+	}
+
+	return time.Unix(int64(sec)+ifi.offset, int64(nsec))
+}
+
+// unexpectedEOF converts io.EOF to io.ErrUnexpectedEOF, for reads which must
+// not end a file.
+func unexpectedEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+
+	return err
+}
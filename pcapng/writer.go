@@ -0,0 +1,262 @@
+package pcapng
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/mdlayher/raw"
+	"github.com/mdlayher/raw/pcap"
+)
+
+// defaultSnapLen matches the default of tcpdump.
+const defaultSnapLen = 262144
+
+// A Config configures a Writer. The zero value of any field selects a default
+// value.
+type Config struct {
+	// SnapLen is the maximum number of bytes of each packet recorded.
+	// Longer packets are truncated, but their original length is recorded.
+	// If zero, 262144 is used.
+	SnapLen int
+
+	// Application, Hardware, and OS optionally describe the application
+	// which wrote the file and the system it ran on.
+	Application string
+	Hardware    string
+	OS          string
+}
+
+// CaptureInfo contains information about a captured packet.
+type CaptureInfo struct {
+	// Timestamp is the time the packet was captured.
+	Timestamp time.Time
+
+	// Length is the original length of the packet. If zero, the length of
+	// the data written is used.
+	Length int
+
+	// InterfaceID identifies the interface on which the packet was
+	// captured, as returned by Writer.AddInterface.
+	InterfaceID int
+
+	// Direction is the direction of the packet.
+	Direction Direction
+}
+
+// An interfaceKey identifies an interface described in a file.
+type interfaceKey struct {
+	index int
+	name  string
+	lt    pcap.LinkType
+}
+
+// A Writer writes packets to a pcapng capture file. A Writer is safe for
+// concurrent use.
+type Writer struct {
+	cfg Config
+
+	mu  sync.Mutex
+	w   io.Writer
+	ifs map[interfaceKey]int
+	lts []pcap.LinkType
+	b   []byte
+}
+
+// NewWriter creates a Writer which writes to w, and writes the section header
+// immediately. A nil Config selects the default values.
+func NewWriter(w io.Writer, cfg *Config) (*Writer, error) {
+	if cfg == nil {
+		cfg = &Config{}
+	}
+
+	conf := *cfg
+	switch {
+	case conf.SnapLen < 0:
+		return nil, fmt.Errorf("pcapng: invalid snapshot length: %d", conf.SnapLen)
+	case conf.SnapLen == 0:
+		conf.SnapLen = defaultSnapLen
+	}
+
+	// Version 1.0, with an unspecified section length.
+	body := make([]byte, 16)
+	binary.LittleEndian.PutUint32(body[0:4], byteOrderMagic)
+	binary.LittleEndian.PutUint16(body[4:6], 1)
+	binary.LittleEndian.PutUint16(body[6:8], 0)
+	binary.LittleEndian.PutUint64(body[8:16], 0xffffffffffffffff)
+
+	var opts options
+	opts.addString(optSHBHardware, conf.Hardware)
+	opts.addString(optSHBOS, conf.OS)
+	opts.addString(optSHBUserAppl, conf.Application)
+	opts.end()
+
+	if _, err := w.Write(appendBlock(nil, blockSectionHeader, body, opts)); err != nil {
+		return nil, err
+	}
+
+	return &Writer{
+		cfg: conf,
+		w:   w,
+		ifs: make(map[interfaceKey]int),
+	}, nil
+}
+
+// AddInterface describes an interface whose packets have the specified
+// LinkType, and returns its ID for use in CaptureInfo. An interface is only
+// described once: adding the same interface and LinkType again returns the
+// existing ID.
+func (w *Writer) AddInterface(ifi *net.Interface, lt pcap.LinkType) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	key := interfaceKey{index: ifi.Index, name: ifi.Name, lt: lt}
+	if id, ok := w.ifs[key]; ok {
+		return id, nil
+	}
+
+	if lt > 0xffff {
+		return 0, fmt.Errorf("pcapng: invalid link type: %s", lt)
+	}
+
+	body := make([]byte, 8)
+	binary.LittleEndian.PutUint16(body[0:2], uint16(lt))
+	binary.LittleEndian.PutUint32(body[4:8], uint32(w.cfg.SnapLen))
+
+	var opts options
+	opts.addString(optIFName, ifi.Name)
+	if len(ifi.HardwareAddr) == 6 {
+		opts.add(optIFMAC, ifi.HardwareAddr)
+	}
+	// Nanosecond resolution, as a power of 10.
+	opts.add(optIFTSResol, []byte{9})
+	opts.end()
+
+	if err := w.write(blockInterfaceDescription, body, opts); err != nil {
+		return 0, err
+	}
+
+	id := len(w.lts)
+	w.ifs[key] = id
+	w.lts = append(w.lts, lt)
+
+	return id, nil
+}
+
+// WritePacket writes a packet and its capture information. data must begin
+// with the link layer header indicated by the LinkType of its interface, and
+// is truncated to the snapshot length.
+func (w *Writer) WritePacket(ci CaptureInfo, data []byte) error {
+	length := ci.Length
+	if length == 0 {
+		length = len(data)
+	}
+	if length < len(data) {
+		return fmt.Errorf("pcapng: original length %d is less than captured length %d", length, len(data))
+	}
+	if len(data) > w.cfg.SnapLen {
+		data = data[:w.cfg.SnapLen]
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.checkInterface(ci.InterfaceID); err != nil {
+		return err
+	}
+
+	body := make([]byte, 20, 20+len(data))
+	binary.LittleEndian.PutUint32(body[0:4], uint32(ci.InterfaceID))
+	putTimestamp(body[4:12], ci.Timestamp)
+	binary.LittleEndian.PutUint32(body[12:16], uint32(len(data)))
+	binary.LittleEndian.PutUint32(body[16:20], uint32(length))
+	body = append(body, data...)
+
+	var opts options
+	if ci.Direction != DirectionUnknown {
+		// The direction occupies the low bits of the flags.
+		opts.addUint32(optEPBFlags, uint32(ci.Direction)&0x3)
+	}
+	opts.end()
+
+	return w.write(blockEnhancedPacket, body, opts)
+}
+
+// WriteDatagram writes a packet read from a *raw.Conn opened with
+// raw.Config.LinuxSockDGRAM, which has no link layer header, by prefixing
+// it with h. The packet's interface must have pcap.LinkTypeLinuxSLL.
+func (w *Writer) WriteDatagram(ci CaptureInfo, h *pcap.SLLHeader, payload []byte) error {
+	w.mu.Lock()
+	err := w.checkInterface(ci.InterfaceID)
+	if err == nil && w.lts[ci.InterfaceID] != pcap.LinkTypeLinuxSLL {
+		err = fmt.Errorf("pcapng: cannot write datagram to %s interface", w.lts[ci.InterfaceID])
+	}
+	w.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	hb, err := h.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	if ci.Length == 0 {
+		ci.Length = len(payload)
+	}
+	ci.Length += len(hb)
+
+	return w.WritePacket(ci, append(hb, payload...))
+}
+
+// WriteStats writes the statistics of an interface at time t, such as those
+// returned by raw.Conn.Stats.
+func (w *Writer) WriteStats(id int, t time.Time, stats *raw.Stats) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.checkInterface(id); err != nil {
+		return err
+	}
+
+	body := make([]byte, 12)
+	binary.LittleEndian.PutUint32(body[0:4], uint32(id))
+	putTimestamp(body[4:12], t)
+
+	var opts options
+	opts.addUint64(optISBIfRecv, stats.Packets)
+	opts.addUint64(optISBIfDrop, stats.Drops)
+	opts.end()
+
+	return w.write(blockInterfaceStatistics, body, opts)
+}
+
+// write writes a single block. The caller must hold w.mu.
+func (w *Writer) write(typ uint32, body []byte, opts options) error {
+	// Reuse a buffer so the block is written with a single call, which keeps
+	// the file consistent if w.w fails partway.
+	w.b = appendBlock(w.b[:0], typ, body, opts)
+	_, err := w.w.Write(w.b)
+	return err
+}
+
+// checkInterface verifies that an interface with the specified ID was added.
+// The caller must hold w.mu.
+func (w *Writer) checkInterface(id int) error {
+	if id < 0 || id >= len(w.lts) {
+		return fmt.Errorf("pcapng: unknown interface ID: %d", id)
+	}
+
+	return nil
+}
+
+// putTimestamp stores t in b as a 64-bit count of nanoseconds, high 32 bits
+// first.
+func putTimestamp(b []byte, t time.Time) {
+	ns := uint64(t.UnixNano())
+	binary.LittleEndian.PutUint32(b[0:4], uint32(ns>>32))
+	binary.LittleEndian.PutUint32(b[4:8], uint32(ns))
+}
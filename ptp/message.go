@@ -0,0 +1,284 @@
+package ptp
+
+import (
+	"encoding/binary"
+)
+
+var _ Message = &Sync{}
+
+// A Sync is a Sync message, sent periodically by a master clock. A two-step
+// clock sets FlagTwoStep and sends the precise origin timestamp in a FollowUp.
+type Sync struct {
+	OriginTimestamp Timestamp
+}
+
+// MessageType implements Message.
+func (*Sync) MessageType() MessageType { return MessageTypeSync }
+
+func (s *Sync) marshal() ([]byte, error) { return marshalTimestamp(s.OriginTimestamp) }
+
+func (s *Sync) unmarshal(b []byte) (err error) {
+	s.OriginTimestamp, err = unmarshalTimestamp(b)
+	return err
+}
+
+var _ Message = &DelayRequest{}
+
+// A DelayRequest is a Delay_Req message, sent by a slave clock to measure the
+// delay to its master.
+type DelayRequest struct {
+	OriginTimestamp Timestamp
+}
+
+// MessageType implements Message.
+func (*DelayRequest) MessageType() MessageType { return MessageTypeDelayRequest }
+
+func (dr *DelayRequest) marshal() ([]byte, error) { return marshalTimestamp(dr.OriginTimestamp) }
+
+func (dr *DelayRequest) unmarshal(b []byte) (err error) {
+	dr.OriginTimestamp, err = unmarshalTimestamp(b)
+	return err
+}
+
+var _ Message = &FollowUp{}
+
+// A FollowUp is a Follow_Up message, which carries the time at which the
+// preceding Sync with the same sequence number was sent.
+type FollowUp struct {
+	PreciseOriginTimestamp Timestamp
+}
+
+// MessageType implements Message.
+func (*FollowUp) MessageType() MessageType { return MessageTypeFollowUp }
+
+func (fu *FollowUp) marshal() ([]byte, error) { return marshalTimestamp(fu.PreciseOriginTimestamp) }
+
+func (fu *FollowUp) unmarshal(b []byte) (err error) {
+	fu.PreciseOriginTimestamp, err = unmarshalTimestamp(b)
+	return err
+}
+
+var _ Message = &DelayResponse{}
+
+// A DelayResponse is a Delay_Resp message, which carries the time at which
+// the master received a DelayRequest from RequestingPort.
+type DelayResponse struct {
+	ReceiveTimestamp Timestamp
+	RequestingPort   PortIdentity
+}
+
+// MessageType implements Message.
+func (*DelayResponse) MessageType() MessageType { return MessageTypeDelayResponse }
+
+func (dr *DelayResponse) marshal() ([]byte, error) {
+	return marshalTimestampPort(dr.ReceiveTimestamp, dr.RequestingPort)
+}
+
+func (dr *DelayResponse) unmarshal(b []byte) (err error) {
+	dr.ReceiveTimestamp, dr.RequestingPort, err = unmarshalTimestampPort(b)
+	return err
+}
+
+var _ Message = &PeerDelayRequest{}
+
+// A PeerDelayRequest is a Pdelay_Req message, sent to measure the link
+// delay to a peer.
+type PeerDelayRequest struct {
+	OriginTimestamp Timestamp
+}
+
+// MessageType implements Message.
+func (*PeerDelayRequest) MessageType() MessageType { return MessageTypePeerDelayRequest }
+
+func (pr *PeerDelayRequest) marshal() ([]byte, error) {
+	// The origin timestamp is followed by 10 reserved bytes, so that the
+	// request is as long as the response.
+	b := make([]byte, timestampLen+portIdentityLen)
+	if err := pr.OriginTimestamp.marshal(b); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+func (pr *PeerDelayRequest) unmarshal(b []byte) error {
+	if len(b) < timestampLen+portIdentityLen {
+		return errInvalidLength
+	}
+
+	pr.OriginTimestamp = parseTimestamp(b)
+	return nil
+}
+
+var _ Message = &PeerDelayResponse{}
+
+// A PeerDelayResponse is a Pdelay_Resp message, which carries the time at
+// which a PeerDelayRequest from RequestingPort was received.
+type PeerDelayResponse struct {
+	RequestReceiptTimestamp Timestamp
+	RequestingPort          PortIdentity
+}
+
+// MessageType implements Message.
+func (*PeerDelayResponse) MessageType() MessageType { return MessageTypePeerDelayResponse }
+
+func (pr *PeerDelayResponse) marshal() ([]byte, error) {
+	return marshalTimestampPort(pr.RequestReceiptTimestamp, pr.RequestingPort)
+}
+
+func (pr *PeerDelayResponse) unmarshal(b []byte) (err error) {
+	pr.RequestReceiptTimestamp, pr.RequestingPort, err = unmarshalTimestampPort(b)
+	return err
+}
+
+var _ Message = &PeerDelayResponseFollowUp{}
+
+// A PeerDelayResponseFollowUp is a Pdelay_Resp_Follow_Up message, which
+// carries the time at which the preceding PeerDelayResponse was sent.
+type PeerDelayResponseFollowUp struct {
+	ResponseOriginTimestamp Timestamp
+	RequestingPort          PortIdentity
+}
+
+// MessageType implements Message.
+func (*PeerDelayResponseFollowUp) MessageType() MessageType {
+	return MessageTypePeerDelayResponseFollowUp
+}
+
+func (pf *PeerDelayResponseFollowUp) marshal() ([]byte, error) {
+	return marshalTimestampPort(pf.ResponseOriginTimestamp, pf.RequestingPort)
+}
+
+func (pf *PeerDelayResponseFollowUp) unmarshal(b []byte) (err error) {
+	pf.ResponseOriginTimestamp, pf.RequestingPort, err = unmarshalTimestampPort(b)
+	return err
+}
+
+// A TimeSource identifies the source of time used by a grandmaster clock.
+type TimeSource uint8
+
+// TimeSource values defined by IEEE 1588-2008.
+const (
+	TimeSourceAtomicClock        TimeSource = 0x10
+	TimeSourceGPS                TimeSource = 0x20
+	TimeSourceTerrestrialRadio   TimeSource = 0x30
+	TimeSourcePTP                TimeSource = 0x40
+	TimeSourceNTP                TimeSource = 0x50
+	TimeSourceHandSet            TimeSource = 0x60
+	TimeSourceOther              TimeSource = 0x90
+	TimeSourceInternalOscillator TimeSource = 0xa0
+)
+
+// A ClockQuality describes the quality of a clock.
+type ClockQuality struct {
+	Class                   uint8
+	Accuracy                uint8
+	OffsetScaledLogVariance uint16
+}
+
+// announceLen is the length of the fixed fields of an Announce message.
+const announceLen = timestampLen + 20
+
+var _ Message = &Announce{}
+
+// An Announce is an Announce message, sent by master clocks to describe their
+// grandmaster for the best master clock algorithm.
+type Announce struct {
+	OriginTimestamp Timestamp
+
+	// CurrentUTCOffset is the offset in seconds between TAI and UTC.
+	CurrentUTCOffset int16
+
+	GrandmasterPriority1    uint8
+	GrandmasterClockQuality ClockQuality
+	GrandmasterPriority2    uint8
+	GrandmasterIdentity     ClockIdentity
+	StepsRemoved            uint16
+	TimeSource              TimeSource
+}
+
+// MessageType implements Message.
+func (*Announce) MessageType() MessageType { return MessageTypeAnnounce }
+
+func (a *Announce) marshal() ([]byte, error) {
+	b := make([]byte, announceLen)
+	if err := a.OriginTimestamp.marshal(b[0:10]); err != nil {
+		return nil, err
+	}
+
+	binary.BigEndian.PutUint16(b[10:12], uint16(a.CurrentUTCOffset))
+	b[13] = a.GrandmasterPriority1
+	b[14] = a.GrandmasterClockQuality.Class
+	b[15] = a.GrandmasterClockQuality.Accuracy
+	binary.BigEndian.PutUint16(b[16:18], a.GrandmasterClockQuality.OffsetScaledLogVariance)
+	b[18] = a.GrandmasterPriority2
+	copy(b[19:27], a.GrandmasterIdentity[:])
+	binary.BigEndian.PutUint16(b[27:29], a.StepsRemoved)
+	b[29] = uint8(a.TimeSource)
+
+	return b, nil
+}
+
+func (a *Announce) unmarshal(b []byte) error {
+	if len(b) < announceLen {
+		return errInvalidLength
+	}
+
+	*a = Announce{
+		OriginTimestamp:      parseTimestamp(b[0:10]),
+		CurrentUTCOffset:     int16(binary.BigEndian.Uint16(b[10:12])),
+		GrandmasterPriority1: b[13],
+		GrandmasterClockQuality: ClockQuality{
+			Class:                   b[14],
+			Accuracy:                b[15],
+			OffsetScaledLogVariance: binary.BigEndian.Uint16(b[16:18]),
+		},
+		GrandmasterPriority2: b[18],
+		StepsRemoved:         binary.BigEndian.Uint16(b[27:29]),
+		TimeSource:           TimeSource(b[29]),
+	}
+	copy(a.GrandmasterIdentity[:], b[19:27])
+
+	return nil
+}
+
+// marshalTimestamp marshals a body consisting of a single Timestamp.
+func marshalTimestamp(ts Timestamp) ([]byte, error) {
+	b := make([]byte, timestampLen)
+	if err := ts.marshal(b); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// unmarshalTimestamp unmarshals a body consisting of a single Timestamp.
+func unmarshalTimestamp(b []byte) (Timestamp, error) {
+	if len(b) < timestampLen {
+		return Timestamp{}, errInvalidLength
+	}
+
+	return parseTimestamp(b), nil
+}
+
+// marshalTimestampPort marshals a body consisting of a Timestamp and a
+// PortIdentity.
+func marshalTimestampPort(ts Timestamp, p PortIdentity) ([]byte, error) {
+	b := make([]byte, timestampLen+portIdentityLen)
+	if err := ts.marshal(b[:timestampLen]); err != nil {
+		return nil, err
+	}
+
+	p.marshal(b[timestampLen:])
+	return b, nil
+}
+
+// unmarshalTimestampPort unmarshals a body consisting of a Timestamp and a
+// PortIdentity.
+func unmarshalTimestampPort(b []byte) (Timestamp, PortIdentity, error) {
+	if len(b) < timestampLen+portIdentityLen {
+		return Timestamp{}, PortIdentity{}, errInvalidLength
+	}
+
+	return parseTimestamp(b), parsePortIdentity(b[timestampLen:]), nil
+}
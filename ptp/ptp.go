@@ -0,0 +1,358 @@
+// Package ptp implements marshaling and unmarshaling of IEEE 1588-2008
+// Precision Time Protocol version 2 messages carried directly in Ethernet
+// frames, as described in IEEE 1588 Annex F.
+//
+// To receive PTP messages with a *raw.Conn, pass ethernet.EtherTypePTP to
+// raw.ListenPacket and enable promiscuous mode so that frames sent to
+// GroupAddr and PeerDelayGroupAddr are delivered.
+//
+// A *raw.Conn does not report hardware or kernel timestamps for the frames it
+// sends and receives. Timestamps taken with time.Now around calls to ReadFrom
+// and WriteTo include scheduling and system call latency, typically several
+// to hundreds of microseconds, so they are suitable for monitoring the
+// messages exchanged between PTP clocks and for coarse offset estimates, but
+// not for synchronizing a clock.
+package ptp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+var (
+	// GroupAddr is the multicast address to which all PTP messages other
+	// than peer delay messages are sent.
+	GroupAddr = net.HardwareAddr{0x01, 0x1b, 0x19, 0x00, 0x00, 0x00}
+
+	// PeerDelayGroupAddr is the multicast address to which peer delay
+	// messages are sent. It is not forwarded by IEEE 802.1D bridges.
+	PeerDelayGroupAddr = net.HardwareAddr{0x01, 0x80, 0xc2, 0x00, 0x00, 0x0e}
+)
+
+const (
+	// headerLen is the length of the common PTP header.
+	headerLen = 34
+
+	// Lengths of fields which appear in several message bodies.
+	timestampLen    = 10
+	portIdentityLen = 10
+
+	// version is the PTP version implemented by this package.
+	version = 2
+
+	// maxSeconds is the largest value of the 48-bit seconds field of a
+	// Timestamp.
+	maxSeconds = 1<<48 - 1
+)
+
+// errInvalidLength is returned when a message body has an invalid length.
+var errInvalidLength = errors.New("ptp: invalid message length")
+
+// A MessageType identifies the type of a PTP Message.
+type MessageType uint8
+
+// MessageType values defined by IEEE 1588-2008.
+const (
+	MessageTypeSync                      MessageType = 0x0
+	MessageTypeDelayRequest              MessageType = 0x1
+	MessageTypePeerDelayRequest          MessageType = 0x2
+	MessageTypePeerDelayResponse         MessageType = 0x3
+	MessageTypeFollowUp                  MessageType = 0x8
+	MessageTypeDelayResponse             MessageType = 0x9
+	MessageTypePeerDelayResponseFollowUp MessageType = 0xa
+	MessageTypeAnnounce                  MessageType = 0xb
+	MessageTypeSignaling                 MessageType = 0xc
+	MessageTypeManagement                MessageType = 0xd
+)
+
+// String returns the name of a MessageType as it appears in IEEE 1588.
+func (t MessageType) String() string {
+	switch t {
+	case MessageTypeSync:
+		return "Sync"
+	case MessageTypeDelayRequest:
+		return "Delay_Req"
+	case MessageTypePeerDelayRequest:
+		return "Pdelay_Req"
+	case MessageTypePeerDelayResponse:
+		return "Pdelay_Resp"
+	case MessageTypeFollowUp:
+		return "Follow_Up"
+	case MessageTypeDelayResponse:
+		return "Delay_Resp"
+	case MessageTypePeerDelayResponseFollowUp:
+		return "Pdelay_Resp_Follow_Up"
+	case MessageTypeAnnounce:
+		return "Announce"
+	case MessageTypeSignaling:
+		return "Signaling"
+	case MessageTypeManagement:
+		return "Management"
+	default:
+		return fmt.Sprintf("unknown(%d)", uint8(t))
+	}
+}
+
+// Event reports whether messages of type t are event messages, which are
+// timestamped when they are sent and received.
+func (t MessageType) Event() bool {
+	return t <= MessageTypePeerDelayResponse
+}
+
+// controlField returns the value of the deprecated control field for
+// messages of type t.
+func (t MessageType) controlField() uint8 {
+	switch t {
+	case MessageTypeSync:
+		return 0
+	case MessageTypeDelayRequest:
+		return 1
+	case MessageTypeFollowUp:
+		return 2
+	case MessageTypeDelayResponse:
+		return 3
+	case MessageTypeManagement:
+		return 4
+	default:
+		return 5
+	}
+}
+
+// Flags are the flags carried in the PTP header.
+type Flags uint16
+
+// Flags values defined by IEEE 1588-2008. The flags in the low byte are only
+// meaningful in Announce messages.
+const (
+	FlagLeap61             Flags = 1 << 0
+	FlagLeap59             Flags = 1 << 1
+	FlagUTCOffsetValid     Flags = 1 << 2
+	FlagPTPTimescale       Flags = 1 << 3
+	FlagTimeTraceable      Flags = 1 << 4
+	FlagFrequencyTraceable Flags = 1 << 5
+	FlagAlternateMaster    Flags = 1 << 8
+	FlagTwoStep            Flags = 1 << 9
+	FlagUnicast            Flags = 1 << 10
+	FlagProfileSpecific1   Flags = 1 << 13
+	FlagProfileSpecific2   Flags = 1 << 14
+)
+
+// A TimeInterval is a duration in nanoseconds multiplied by 2^16, as carried
+// in the correction field.
+type TimeInterval int64
+
+// NewTimeInterval returns the TimeInterval for d.
+func NewTimeInterval(d time.Duration) TimeInterval {
+	return TimeInterval(d) << 16
+}
+
+// Duration returns ti truncated to nanosecond precision.
+func (ti TimeInterval) Duration() time.Duration {
+	return time.Duration(ti >> 16)
+}
+
+// A Timestamp is a PTP timestamp, with 48 bits of seconds.
+type Timestamp struct {
+	Seconds     uint64
+	Nanoseconds uint32
+}
+
+// NewTimestamp returns the Timestamp for t, measured from the Unix epoch.
+//
+// The PTP timescale is TAI, which is ahead of UTC by the offset carried in
+// Announce messages. NewTimestamp does not apply this offset.
+func NewTimestamp(t time.Time) Timestamp {
+	return Timestamp{
+		Seconds:     uint64(t.Unix()),
+		Nanoseconds: uint32(t.Nanosecond()),
+	}
+}
+
+// Time returns the time.Time for ts, measured from the Unix epoch. As with
+// NewTimestamp, no offset between TAI and UTC is applied.
+func (ts Timestamp) Time() time.Time {
+	return time.Unix(int64(ts.Seconds), int64(ts.Nanoseconds))
+}
+
+func (ts Timestamp) marshal(b []byte) error {
+	if ts.Seconds > maxSeconds || ts.Nanoseconds >= 1e9 {
+		return fmt.Errorf("ptp: invalid timestamp: %d.%09d", ts.Seconds, ts.Nanoseconds)
+	}
+
+	binary.BigEndian.PutUint16(b[0:2], uint16(ts.Seconds>>32))
+	binary.BigEndian.PutUint32(b[2:6], uint32(ts.Seconds))
+	binary.BigEndian.PutUint32(b[6:10], ts.Nanoseconds)
+	return nil
+}
+
+func parseTimestamp(b []byte) Timestamp {
+	return Timestamp{
+		Seconds:     uint64(binary.BigEndian.Uint16(b[0:2]))<<32 | uint64(binary.BigEndian.Uint32(b[2:6])),
+		Nanoseconds: binary.BigEndian.Uint32(b[6:10]),
+	}
+}
+
+// A ClockIdentity identifies a PTP clock, and is usually derived from a
+// hardware address.
+type ClockIdentity [8]byte
+
+// NewClockIdentity returns the ClockIdentity derived from a 6 byte hardware
+// address by inserting 0xfffe in its center.
+func NewClockIdentity(mac net.HardwareAddr) (ClockIdentity, error) {
+	if len(mac) != 6 {
+		return ClockIdentity{}, fmt.Errorf("ptp: invalid hardware address: %q", mac)
+	}
+
+	return ClockIdentity{mac[0], mac[1], mac[2], 0xff, 0xfe, mac[3], mac[4], mac[5]}, nil
+}
+
+// String returns the conventional form of a ClockIdentity, such as
+// "001122.fffe.334455".
+func (c ClockIdentity) String() string {
+	return fmt.Sprintf("%x.%x.%x", c[0:3], c[3:5], c[5:8])
+}
+
+// A PortIdentity identifies a port of a PTP clock.
+type PortIdentity struct {
+	Clock ClockIdentity
+	Port  uint16
+}
+
+// String returns the conventional form of a PortIdentity, such as
+// "001122.fffe.334455-1".
+func (p PortIdentity) String() string {
+	return fmt.Sprintf("%s-%d", p.Clock, p.Port)
+}
+
+func (p PortIdentity) marshal(b []byte) {
+	copy(b[0:8], p.Clock[:])
+	binary.BigEndian.PutUint16(b[8:10], p.Port)
+}
+
+func parsePortIdentity(b []byte) PortIdentity {
+	var p PortIdentity
+	copy(p.Clock[:], b[0:8])
+	p.Port = binary.BigEndian.Uint16(b[8:10])
+	return p
+}
+
+// A Header contains the fields of the common PTP header which are not
+// determined by the Message it carries.
+type Header struct {
+	// TransportSpecific is a 4-bit value, set to 1 by IEEE 802.1AS.
+	TransportSpecific uint8
+
+	Domain     uint8
+	Flags      Flags
+	Correction TimeInterval
+	SourcePort PortIdentity
+	Sequence   uint16
+
+	// LogMessageInterval is the base 2 logarithm of the interval between
+	// messages, in seconds.
+	LogMessageInterval int8
+}
+
+// A Message is a PTP message body.
+type Message interface {
+	// MessageType returns the MessageType of the Message.
+	MessageType() MessageType
+
+	// marshal returns the body of the Message which follows the header.
+	// unmarshal is its inverse.
+	marshal() ([]byte, error)
+	unmarshal(b []byte) error
+}
+
+// MarshalMessage marshals a Message with the specified Header into its
+// binary form.
+func MarshalMessage(h *Header, m Message) ([]byte, error) {
+	if h.TransportSpecific > 0xf {
+		return nil, fmt.Errorf("ptp: invalid transport specific value: %d", h.TransportSpecific)
+	}
+
+	body, err := m.marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, headerLen+len(body))
+	b[0] = h.TransportSpecific<<4 | uint8(m.MessageType())
+	b[1] = version
+	binary.BigEndian.PutUint16(b[2:4], uint16(len(b)))
+	b[4] = h.Domain
+	binary.BigEndian.PutUint16(b[6:8], uint16(h.Flags))
+	binary.BigEndian.PutUint64(b[8:16], uint64(h.Correction))
+	h.SourcePort.marshal(b[20:30])
+	binary.BigEndian.PutUint16(b[30:32], h.Sequence)
+	b[32] = m.MessageType().controlField()
+	b[33] = uint8(h.LogMessageInterval)
+	copy(b[headerLen:], body)
+
+	return b, nil
+}
+
+// ParseMessage parses a Message and its Header from its binary form. Any
+// trailing Ethernet padding beyond the message length is ignored, as are
+// any TLVs which follow the fixed fields of the Message.
+func ParseMessage(b []byte) (*Header, Message, error) {
+	if len(b) < headerLen {
+		return nil, nil, io.ErrUnexpectedEOF
+	}
+
+	// The high bits of the version field hold the minor version in IEEE
+	// 1588-2019, which remains compatible.
+	if v := b[1] & 0x0f; v != version {
+		return nil, nil, fmt.Errorf("ptp: unsupported version: %d", v)
+	}
+
+	l := int(binary.BigEndian.Uint16(b[2:4]))
+	if l < headerLen {
+		return nil, nil, errInvalidLength
+	}
+	if len(b) < l {
+		return nil, nil, io.ErrUnexpectedEOF
+	}
+
+	var m Message
+	switch t := MessageType(b[0] & 0x0f); t {
+	case MessageTypeSync:
+		m = new(Sync)
+	case MessageTypeDelayRequest:
+		m = new(DelayRequest)
+	case MessageTypePeerDelayRequest:
+		m = new(PeerDelayRequest)
+	case MessageTypePeerDelayResponse:
+		m = new(PeerDelayResponse)
+	case MessageTypeFollowUp:
+		m = new(FollowUp)
+	case MessageTypeDelayResponse:
+		m = new(DelayResponse)
+	case MessageTypePeerDelayResponseFollowUp:
+		m = new(PeerDelayResponseFollowUp)
+	case MessageTypeAnnounce:
+		m = new(Announce)
+	default:
+		return nil, nil, fmt.Errorf("ptp: unsupported message type: %s", t)
+	}
+
+	if err := m.unmarshal(b[headerLen:l]); err != nil {
+		return nil, nil, err
+	}
+
+	h := &Header{
+		TransportSpecific:  b[0] >> 4,
+		Domain:             b[4],
+		Flags:              Flags(binary.BigEndian.Uint16(b[6:8])),
+		Correction:         TimeInterval(binary.BigEndian.Uint64(b[8:16])),
+		SourcePort:         parsePortIdentity(b[20:30]),
+		Sequence:           binary.BigEndian.Uint16(b[30:32]),
+		LogMessageInterval: int8(b[33]),
+	}
+
+	return h, m, nil
+}
@@ -0,0 +1,207 @@
+package ptp_test
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/raw/ptp"
+)
+
+var (
+	clock = ptp.ClockIdentity{0x00, 0x11, 0x22, 0xff, 0xfe, 0x33, 0x44, 0x55}
+	port  = ptp.PortIdentity{Clock: clock, Port: 1}
+	ts    = ptp.Timestamp{Seconds: 1 << 40, Nanoseconds: 999999999}
+)
+
+func TestParseMessageSync(t *testing.T) {
+	// A two-step Sync, with Ethernet padding.
+	b := []byte{
+		0x10, 0x02, 0x00, 0x2c, 0x18, 0x00, 0x02, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x80, 0x00,
+		0x00, 0x00, 0x00, 0x00,
+		0x00, 0x11, 0x22, 0xff, 0xfe, 0x33, 0x44, 0x55, 0x00, 0x01,
+		0x00, 0x2a, 0x00, 0xfd,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00,
+	}
+
+	wantH := &ptp.Header{
+		TransportSpecific:  1,
+		Domain:             24,
+		Flags:              ptp.FlagTwoStep,
+		Correction:         ptp.NewTimeInterval(time.Nanosecond) + 1<<15,
+		SourcePort:         port,
+		Sequence:           42,
+		LogMessageInterval: -3,
+	}
+
+	h, m, err := ptp.ParseMessage(b)
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+
+	if diff := cmp.Diff(wantH, h); diff != "" {
+		t.Fatalf("unexpected header (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(&ptp.Sync{}, m); diff != "" {
+		t.Fatalf("unexpected message (-want +got):\n%s", diff)
+	}
+	if d := h.Correction.Duration(); d != time.Nanosecond {
+		t.Fatalf("unexpected correction: %s", d)
+	}
+
+	out, err := ptp.MarshalMessage(h, m)
+	if err != nil {
+		t.Fatalf("failed to marshal: %v", err)
+	}
+
+	if diff := cmp.Diff(b[:44], out); diff != "" {
+		t.Fatalf("unexpected bytes (-want +got):\n%s", diff)
+	}
+}
+
+func TestMessageMarshalParse(t *testing.T) {
+	tests := []struct {
+		m ptp.Message
+		n int
+	}{
+		{m: &ptp.Sync{OriginTimestamp: ts}, n: 44},
+		{m: &ptp.DelayRequest{OriginTimestamp: ts}, n: 44},
+		{m: &ptp.FollowUp{PreciseOriginTimestamp: ts}, n: 44},
+		{m: &ptp.DelayResponse{ReceiveTimestamp: ts, RequestingPort: port}, n: 54},
+		{m: &ptp.PeerDelayRequest{OriginTimestamp: ts}, n: 54},
+		{m: &ptp.PeerDelayResponse{RequestReceiptTimestamp: ts, RequestingPort: port}, n: 54},
+		{m: &ptp.PeerDelayResponseFollowUp{ResponseOriginTimestamp: ts, RequestingPort: port}, n: 54},
+		{
+			m: &ptp.Announce{
+				OriginTimestamp:      ts,
+				CurrentUTCOffset:     37,
+				GrandmasterPriority1: 128,
+				GrandmasterClockQuality: ptp.ClockQuality{
+					Class:                   6,
+					Accuracy:                0x21,
+					OffsetScaledLogVariance: 0x4e5d,
+				},
+				GrandmasterPriority2: 128,
+				GrandmasterIdentity:  clock,
+				StepsRemoved:         1,
+				TimeSource:           ptp.TimeSourceGPS,
+			},
+			n: 64,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.m.MessageType().String(), func(t *testing.T) {
+			h := &ptp.Header{SourcePort: port, Sequence: 1}
+
+			b, err := ptp.MarshalMessage(h, tt.m)
+			if err != nil {
+				t.Fatalf("failed to marshal: %v", err)
+			}
+			if len(b) != tt.n {
+				t.Fatalf("unexpected message length: %d", len(b))
+			}
+
+			gotH, m, err := ptp.ParseMessage(b)
+			if err != nil {
+				t.Fatalf("failed to parse: %v", err)
+			}
+
+			if diff := cmp.Diff(h, gotH); diff != "" {
+				t.Fatalf("unexpected header (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.m, m); diff != "" {
+				t.Fatalf("unexpected message (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestParseMessageError(t *testing.T) {
+	valid, err := ptp.MarshalMessage(&ptp.Header{}, &ptp.DelayResponse{})
+	if err != nil {
+		t.Fatalf("failed to marshal: %v", err)
+	}
+
+	// The length covers only the timestamp of a Delay_Resp.
+	short := append([]byte(nil), valid...)
+	short[3] = 44
+
+	tests := []struct {
+		name string
+		b    []byte
+	}{
+		{
+			name: "short header",
+			b:    valid[:20],
+		},
+		{
+			name: "version 1",
+			b:    append([]byte{0x09, 0x01}, valid[2:]...),
+		},
+		{
+			name: "unsupported type",
+			b:    append([]byte{0x0d}, valid[1:]...),
+		},
+		{
+			name: "truncated",
+			b:    valid[:50],
+		},
+		{
+			name: "short body",
+			b:    short,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := ptp.ParseMessage(tt.b); err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+		})
+	}
+}
+
+func TestMarshalMessageInvalidTimestamp(t *testing.T) {
+	_, err := ptp.MarshalMessage(&ptp.Header{}, &ptp.Sync{
+		OriginTimestamp: ptp.Timestamp{Nanoseconds: 1e9},
+	})
+	if err == nil {
+		t.Fatal("expected an error, but none occurred")
+	}
+}
+
+func TestTimestamp(t *testing.T) {
+	now := time.Unix(1700000000, 123456789)
+
+	ts := ptp.NewTimestamp(now)
+	if diff := cmp.Diff(ptp.Timestamp{Seconds: 1700000000, Nanoseconds: 123456789}, ts); diff != "" {
+		t.Fatalf("unexpected timestamp (-want +got):\n%s", diff)
+	}
+
+	if got := ts.Time(); !got.Equal(now) {
+		t.Fatalf("unexpected time: %v", got)
+	}
+}
+
+func TestClockIdentity(t *testing.T) {
+	c, err := ptp.NewClockIdentity(net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55})
+	if err != nil {
+		t.Fatalf("failed to create clock identity: %v", err)
+	}
+
+	if diff := cmp.Diff(clock, c); diff != "" {
+		t.Fatalf("unexpected clock identity (-want +got):\n%s", diff)
+	}
+
+	if got := port.String(); got != "001122.fffe.334455-1" {
+		t.Fatalf("unexpected port identity string: %q", got)
+	}
+
+	if _, err := ptp.NewClockIdentity(net.HardwareAddr{0x00}); err == nil {
+		t.Fatal("expected an error, but none occurred")
+	}
+}
@@ -31,6 +31,17 @@ import (
 // implemented for the host operating system.
 var ErrNotImplemented = errors.New("raw: not implemented")
 
+// ProtocolAll is a special value for the proto parameter of ListenPacket which
+// captures frames of every protocol, regardless of their EtherType or length
+// field. It is equal to ETH_P_ALL on Linux.
+const ProtocolAll = 0x0003
+
+// ProtocolLLC is a special value for the proto parameter of ListenPacket which
+// captures IEEE 802.3 frames carrying a length field and an IEEE 802.2 LLC
+// header, rather than frames with a specific EtherType. It is equal to
+// ETH_P_802_2 on Linux.
+const ProtocolLLC = 0x0004
+
 var _ net.Addr = &Addr{}
 
 // Addr is a network address which can be used to contact other machines, using
@@ -133,6 +144,10 @@ func (c *Conn) Stats() (*Stats, error) {
 // captured and transmitted.  proto, if needed, is automatically converted to
 // network byte order (big endian), akin to the htons() function in C.
 //
+// To capture IEEE 802.3 frames which carry a length field and an IEEE 802.2
+// LLC header instead of an EtherType, specify ProtocolLLC as proto. To capture
+// frames of every protocol, specify ProtocolAll as proto.
+//
 // cfg specifies optional configuration which may be operating system-specific.
 // A nil Config is equivalent to the default configuration: send and receive
 // data at the network interface device driver level (usually raw Ethernet frames).
@@ -307,33 +307,56 @@ func baseInterfaceFilter(proto uint16, mtu int) []bpf.Instruction {
 	)
 }
 
+// maxLength is the largest value of an IEEE 802.3 length field. Larger values
+// in the same position are EtherTypes.
+const maxLength = 1500
+
 // baseFilter creates a base BPF filter which filters traffic based on its
-// EtherType.  baseFilter can be prepended to other filters to handle common
-// filtering tasks.
+// EtherType, or accepts all frames with an IEEE 802.3 length field if proto
+// is ProtocolLLC.  baseFilter can be prepended to other filters to handle
+// common filtering tasks.  If proto is ProtocolAll, no filtering is needed
+// and baseFilter returns no instructions.
 func baseFilter(proto uint16) []bpf.Instruction {
+	if proto == ProtocolAll {
+		return nil
+	}
+
 	// Offset | Length | Comment
 	// -------------------------
 	//   00   |   06   | Ethernet destination MAC address
 	//   06   |   06   | Ethernet source MAC address
-	//   12   |   02   | Ethernet EtherType
+	//   12   |   02   | Ethernet EtherType or length
 	const (
 		etherTypeOffset = 12
 		etherTypeLength = 2
 	)
 
+	// Load EtherType value from Ethernet header
+	load := bpf.LoadAbsolute{
+		Off:  etherTypeOffset,
+		Size: etherTypeLength,
+	}
+
+	// If EtherType is equal to the protocol we are using, jump to instructions
+	// added outside of this function.
+	match := bpf.JumpIf{
+		Cond:     bpf.JumpEqual,
+		Val:      uint32(proto),
+		SkipTrue: 1,
+	}
+	if proto == ProtocolLLC {
+		// Any length field is a match, and jumps to instructions added
+		// outside of this function.
+		match = bpf.JumpIf{
+			Cond:      bpf.JumpGreaterThan,
+			Val:       maxLength,
+			SkipFalse: 1,
+		}
+	}
+
 	return []bpf.Instruction{
-		// Load EtherType value from Ethernet header
-		bpf.LoadAbsolute{
-			Off:  etherTypeOffset,
-			Size: etherTypeLength,
-		},
-		// If EtherType is equal to the protocol we are using, jump to instructions
-		// added outside of this function.
-		bpf.JumpIf{
-			Cond:     bpf.JumpEqual,
-			Val:      uint32(proto),
-			SkipTrue: 1,
-		},
+		load,
+		match,
 		// EtherType does not match our protocol
 		bpf.RetConstant{
 			Val: 0,
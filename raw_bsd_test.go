@@ -0,0 +1,92 @@
+//go:build darwin || dragonfly || freebsd || netbsd || openbsd
+// +build darwin dragonfly freebsd netbsd openbsd
+
+package raw
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"golang.org/x/net/bpf"
+)
+
+func TestBaseFilter(t *testing.T) {
+	const etherTypeIPv4 = 0x0800
+
+	tests := []struct {
+		name  string
+		proto uint16
+		field uint16
+		ok    bool
+	}{
+		{
+			name:  "EtherType match",
+			proto: etherTypeIPv4,
+			field: etherTypeIPv4,
+			ok:    true,
+		},
+		{
+			name:  "EtherType mismatch",
+			proto: etherTypeIPv4,
+			field: 0x86dd,
+		},
+		{
+			name:  "EtherType length field",
+			proto: etherTypeIPv4,
+			field: 38,
+		},
+		{
+			name:  "LLC length field",
+			proto: ProtocolLLC,
+			field: 38,
+			ok:    true,
+		},
+		{
+			name:  "LLC maximum length field",
+			proto: ProtocolLLC,
+			field: maxLength,
+			ok:    true,
+		},
+		{
+			name:  "LLC EtherType",
+			proto: ProtocolLLC,
+			field: etherTypeIPv4,
+		},
+		{
+			name:  "all EtherType",
+			proto: ProtocolAll,
+			field: etherTypeIPv4,
+			ok:    true,
+		},
+		{
+			name:  "all length field",
+			proto: ProtocolAll,
+			field: 38,
+			ok:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Accept the entire frame after the base filter, as SetBPF does
+			// with a user filter.
+			vm, err := bpf.NewVM(append(baseFilter(tt.proto), bpf.RetConstant{Val: math.MaxUint16}))
+			if err != nil {
+				t.Fatalf("failed to create VM: %v", err)
+			}
+
+			frame := make([]byte, 60)
+			binary.BigEndian.PutUint16(frame[12:14], tt.field)
+
+			n, err := vm.Run(frame)
+			if err != nil {
+				t.Fatalf("failed to run filter: %v", err)
+			}
+
+			if ok := n > 0; ok != tt.ok {
+				t.Fatalf("unexpected filter result: want %v, got %v", tt.ok, ok)
+			}
+		})
+	}
+}
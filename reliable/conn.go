@@ -0,0 +1,454 @@
+package reliable
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mdlayher/raw"
+)
+
+var _ net.Conn = &Conn{}
+
+// A Conn is a reliable, ordered byte stream to a single peer. A Conn is safe
+// for concurrent use.
+type Conn struct {
+	t       *Transport
+	peer    net.HardwareAddr
+	localID uint32
+
+	mu sync.Mutex
+	// Closed and replaced whenever the state of the stream changes.
+	changed chan struct{}
+	peerID  uint32
+
+	// err is the terminal error of the stream, and closed reports whether
+	// Close was called.
+	err    error
+	closed bool
+
+	// Send state. queue holds unacknowledged segments in order, of which
+	// the first sent have been transmitted at least once.
+	queue      []*segment
+	sent       int
+	sndNext    uint32
+	peerWindow int
+	rto        time.Duration
+	rtoAt      time.Time
+	retries    int
+
+	// Receive state.
+	rcvNext    uint32
+	ooo        map[uint32]*segment
+	buf        bytes.Buffer
+	eof        bool
+	advertised int
+
+	rdeadline time.Time
+	wdeadline time.Time
+}
+
+// Read reads data from the stream. Read returns io.EOF after the peer closes
+// the stream and all of its data has been read.
+func (c *Conn) Read(b []byte) (int, error) {
+	for {
+		c.mu.Lock()
+		if c.closed {
+			c.mu.Unlock()
+			return 0, net.ErrClosed
+		}
+
+		if c.buf.Len() > 0 {
+			n, _ := c.buf.Read(b)
+
+			// Tell the peer when a closed window opens again.
+			var update *segment
+			if c.advertised == 0 && c.window() > 0 {
+				update = c.ackSegment()
+			}
+			c.mu.Unlock()
+
+			if update != nil {
+				c.t.send(c.peer, update)
+			}
+			return n, nil
+		}
+
+		switch {
+		case c.eof:
+			c.mu.Unlock()
+			return 0, io.EOF
+		case c.err != nil:
+			err := c.err
+			c.mu.Unlock()
+			return 0, err
+		case expired(c.rdeadline):
+			c.mu.Unlock()
+			return 0, os.ErrDeadlineExceeded
+		}
+
+		changed, deadline := c.changed, c.rdeadline
+		c.mu.Unlock()
+		wait(changed, deadline)
+	}
+}
+
+// Write writes data to the stream. Write returns once all of b is queued for
+// transmission, which may require the peer to acknowledge earlier data.
+func (c *Conn) Write(b []byte) (int, error) {
+	max := c.t.MaxSegment()
+
+	var n int
+	for len(b) > 0 {
+		c.mu.Lock()
+		switch {
+		case c.closed:
+			c.mu.Unlock()
+			return n, net.ErrClosed
+		case c.err != nil:
+			err := c.err
+			c.mu.Unlock()
+			return n, err
+		case expired(c.wdeadline):
+			c.mu.Unlock()
+			return n, os.ErrDeadlineExceeded
+		}
+
+		if len(c.queue) < c.t.cfg.Window {
+			l := len(b)
+			if l > max {
+				l = max
+			}
+
+			c.enqueue(&segment{Payload: append([]byte(nil), b[:l]...)})
+			c.mu.Unlock()
+
+			n += l
+			b = b[l:]
+			continue
+		}
+
+		changed, deadline := c.changed, c.wdeadline
+		c.mu.Unlock()
+		wait(changed, deadline)
+	}
+
+	return n, nil
+}
+
+// Close closes the stream. Data already written is still delivered to the
+// peer, followed by an indication that the stream is closed, but Close does
+// not wait for it to be acknowledged.
+func (c *Conn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return net.ErrClosed
+	}
+
+	c.closed = true
+	if c.err == nil {
+		c.enqueue(&segment{Flags: flagFIN})
+	}
+
+	c.signal()
+	return nil
+}
+
+// LocalAddr returns the local hardware address as a *raw.Addr.
+func (c *Conn) LocalAddr() net.Addr {
+	return c.t.Addr()
+}
+
+// RemoteAddr returns the peer's hardware address as a *raw.Addr.
+func (c *Conn) RemoteAddr() net.Addr {
+	return &raw.Addr{HardwareAddr: c.peer}
+}
+
+// SetDeadline implements the net.Conn SetDeadline method.
+func (c *Conn) SetDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.rdeadline, c.wdeadline = t, t
+	c.signal()
+	return nil
+}
+
+// SetReadDeadline implements the net.Conn SetReadDeadline method.
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.rdeadline = t
+	c.signal()
+	return nil
+}
+
+// SetWriteDeadline implements the net.Conn SetWriteDeadline method.
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.wdeadline = t
+	c.signal()
+	return nil
+}
+
+// run transmits and retransmits segments until the stream fails or is closed
+// and all of its data is acknowledged.
+func (c *Conn) run() {
+	for {
+		c.mu.Lock()
+		if c.err != nil || (c.closed && len(c.queue) == 0) {
+			peerID := c.peerID
+			c.mu.Unlock()
+
+			c.t.remove(c, peerID)
+			return
+		}
+
+		var out []*segment
+		now := time.Now()
+
+		if c.sent > 0 && !now.Before(c.rtoAt) {
+			if c.retries == c.t.cfg.MaxRetransmits {
+				c.fail(ErrUnreachable)
+				c.mu.Unlock()
+				continue
+			}
+
+			// Retransmit the oldest segment and back off.
+			c.retries++
+			c.rto *= 2
+			if c.rto > c.t.cfg.MaxRetransmitTimeout {
+				c.rto = c.t.cfg.MaxRetransmitTimeout
+			}
+			c.rtoAt = now.Add(c.rto)
+			out = append(out, c.dataSegment(c.queue[0]))
+		}
+
+		// Always allow one segment in flight so that a closed window is
+		// probed until it opens.
+		window := c.peerWindow
+		if window < 1 {
+			window = 1
+		}
+		for c.sent < len(c.queue) && c.sent < window {
+			if c.sent == 0 {
+				c.rtoAt = now.Add(c.rto)
+			}
+
+			out = append(out, c.dataSegment(c.queue[c.sent]))
+			c.sent++
+		}
+
+		changed := c.changed
+		deadline := c.rtoAt
+		if c.sent == 0 {
+			deadline = time.Time{}
+		}
+		c.mu.Unlock()
+
+		for _, s := range out {
+			c.t.send(c.peer, s)
+		}
+
+		wait(changed, deadline)
+	}
+}
+
+// handle processes a segment received from the peer and returns an
+// acknowledgement to send, if any.
+func (c *Conn) handle(s *segment) *segment {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if s.Flags&flagRST != 0 {
+		if s.DstID == c.localID {
+			c.fail(ErrReset)
+		}
+
+		return nil
+	}
+
+	if s.Flags&flagACK != 0 && s.DstID == c.localID {
+		c.acknowledge(s.Ack, int(s.Window))
+	}
+
+	if !s.sequenced() {
+		return nil
+	}
+
+	// Acknowledge every sequenced segment, even duplicates, so that the
+	// peer learns of the current state after a lost acknowledgement.
+	d := int32(s.Seq - c.rcvNext)
+	switch {
+	case d == 0:
+		if c.deliver(s) {
+			c.drain()
+		}
+	case d > 0 && int(d) < c.t.cfg.Window:
+		if _, ok := c.ooo[s.Seq]; !ok {
+			c.ooo[s.Seq] = &segment{
+				Flags:   s.Flags,
+				Payload: append([]byte(nil), s.Payload...),
+			}
+		}
+	}
+
+	c.signal()
+	return c.ackSegment()
+}
+
+// acknowledge removes the segments acknowledged by ack from the queue and
+// records the peer's receive window. The caller must hold c.mu.
+func (c *Conn) acknowledge(ack uint32, window int) {
+	// The window may have opened, and any acknowledgement shows that the
+	// peer is reachable.
+	c.peerWindow = window
+	c.retries = 0
+	c.signal()
+
+	var n int
+	for n < c.sent && seqLess(c.queue[n].Seq, ack) {
+		n++
+	}
+	if n == 0 {
+		return
+	}
+
+	c.queue = c.queue[n:]
+	c.sent -= n
+	c.rto = c.t.cfg.RetransmitTimeout
+	c.rtoAt = time.Now().Add(c.rto)
+}
+
+// deliver delivers the next in-order segment s, and reports whether it was
+// accepted. The caller must hold c.mu.
+func (c *Conn) deliver(s *segment) bool {
+	if c.eof {
+		// No data may follow a FIN.
+		return false
+	}
+
+	switch {
+	case s.Flags&flagFIN != 0:
+		c.eof = true
+	case c.closed:
+		// Data is discarded after Close, but still acknowledged.
+	case c.buf.Len() >= c.t.cfg.ReadBuffer:
+		// No room until the application reads.
+		return false
+	default:
+		c.buf.Write(s.Payload)
+	}
+
+	c.rcvNext++
+	return true
+}
+
+// drain delivers held segments which are now in order. The caller must hold
+// c.mu.
+func (c *Conn) drain() {
+	for {
+		s, ok := c.ooo[c.rcvNext]
+		if !ok {
+			return
+		}
+
+		seq := c.rcvNext
+		if !c.deliver(s) {
+			return
+		}
+		delete(c.ooo, seq)
+	}
+}
+
+// enqueue assigns the next sequence number to s and queues it for
+// transmission. The caller must hold c.mu.
+func (c *Conn) enqueue(s *segment) {
+	s.Seq = c.sndNext
+	c.sndNext++
+	c.queue = append(c.queue, s)
+	c.signal()
+}
+
+// dataSegment returns a copy of the queued segment s with the current
+// acknowledgement. The caller must hold c.mu.
+func (c *Conn) dataSegment(s *segment) *segment {
+	out := c.ackSegment()
+	out.Flags |= s.Flags
+	out.Seq = s.Seq
+	out.Payload = s.Payload
+	return out
+}
+
+// ackSegment returns an acknowledgement of the data received so far. The
+// caller must hold c.mu.
+func (c *Conn) ackSegment() *segment {
+	c.advertised = c.window()
+
+	return &segment{
+		Flags:  flagACK,
+		Window: uint16(c.advertised),
+		SrcID:  c.localID,
+		DstID:  c.peerID,
+		Ack:    c.rcvNext,
+	}
+}
+
+// window returns the number of segments the peer may send. The caller must
+// hold c.mu.
+func (c *Conn) window() int {
+	free := (c.t.cfg.ReadBuffer - c.buf.Len()) / c.t.MaxSegment()
+	switch {
+	case free < 0:
+		return 0
+	case free > c.t.cfg.Window:
+		return c.t.cfg.Window
+	default:
+		return free
+	}
+}
+
+// fail sets the terminal error of the stream, if it is not already set. The
+// caller must hold c.mu.
+func (c *Conn) fail(err error) {
+	if c.err == nil {
+		c.err = err
+	}
+	c.signal()
+}
+
+// signal wakes all goroutines waiting for a change in the stream's state. The
+// caller must hold c.mu.
+func (c *Conn) signal() {
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+// wait blocks until changed is closed or the deadline passes.
+func wait(changed <-chan struct{}, deadline time.Time) {
+	if deadline.IsZero() {
+		<-changed
+		return
+	}
+
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+
+	select {
+	case <-changed:
+	case <-timer.C:
+	}
+}
+
+// expired reports whether a non-zero deadline has passed.
+func expired(deadline time.Time) bool {
+	return !deadline.IsZero() && !time.Now().Before(deadline)
+}
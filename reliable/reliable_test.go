@@ -0,0 +1,340 @@
+package reliable_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mdlayher/raw/ethernet"
+	"github.com/mdlayher/raw/internal/rawtest"
+	"github.com/mdlayher/raw/reliable"
+)
+
+const etherType ethernet.EtherType = 0x88b6
+
+var (
+	macA = net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	macB = net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x02}
+)
+
+func TestConnLossy(t *testing.T) {
+	hub := rawtest.NewHub()
+	cfg := &reliable.Config{RetransmitTimeout: 5 * time.Millisecond, MaxRetransmits: 20}
+
+	// Drop every fourth frame in both directions.
+	a := testTransport(t, &lossyConn{PacketConn: hub.Conn(macA), drop: 4}, macA, cfg)
+	b := testTransport(t, &lossyConn{PacketConn: hub.Conn(macB), drop: 4}, macB, cfg)
+
+	want := make([]byte, 64*1024)
+	rand.Read(want)
+
+	c, err := a.Dial(macB)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+
+	go func() {
+		_, _ = c.Write(want)
+		_ = c.Close()
+	}()
+
+	got := readAll(t, b)
+	if !bytes.Equal(want, got) {
+		t.Fatalf("unexpected data: got %d bytes, want %d bytes", len(got), len(want))
+	}
+}
+
+func TestConnEcho(t *testing.T) {
+	hub := rawtest.NewHub()
+	a := testTransport(t, hub.Conn(macA), macA, nil)
+	b := testTransport(t, hub.Conn(macB), macB, nil)
+
+	go func() {
+		nc, err := b.Accept()
+		if err != nil {
+			return
+		}
+		defer nc.Close()
+
+		_, _ = io.Copy(nc, nc)
+	}()
+
+	c, err := a.Dial(macB)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer c.Close()
+
+	for _, s := range []string{"hello", "world"} {
+		if _, err := c.Write([]byte(s)); err != nil {
+			t.Fatalf("failed to write: %v", err)
+		}
+
+		buf := make([]byte, len(s))
+		if _, err := io.ReadFull(c, buf); err != nil {
+			t.Fatalf("failed to read: %v", err)
+		}
+		if string(buf) != s {
+			t.Fatalf("unexpected echo: %q", buf)
+		}
+	}
+
+	if _, err := a.Dial(macB); err == nil {
+		t.Fatal("expected an error dialing twice, but none occurred")
+	}
+}
+
+func TestConnSlowReader(t *testing.T) {
+	hub := rawtest.NewHub()
+	cfg := &reliable.Config{
+		RetransmitTimeout:    5 * time.Millisecond,
+		MaxRetransmitTimeout: 20 * time.Millisecond,
+		ReadBuffer:           4096,
+	}
+
+	a := testTransport(t, hub.Conn(macA), macA, cfg)
+	b := testTransport(t, hub.Conn(macB), macB, cfg)
+
+	want := make([]byte, 32*1024)
+	rand.Read(want)
+
+	c, err := a.Dial(macB)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+
+	go func() {
+		_, _ = c.Write(want)
+		_ = c.Close()
+	}()
+
+	nc, err := b.Accept()
+	if err != nil {
+		t.Fatalf("failed to accept: %v", err)
+	}
+	defer nc.Close()
+
+	// Let the receive buffer fill and the window close.
+	time.Sleep(50 * time.Millisecond)
+
+	got, err := io.ReadAll(nc)
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	if !bytes.Equal(want, got) {
+		t.Fatalf("unexpected data: got %d bytes, want %d bytes", len(got), len(want))
+	}
+}
+
+func TestConnUnreachable(t *testing.T) {
+	hub := rawtest.NewHub()
+	a := testTransport(t, hub.Conn(macA), macA, &reliable.Config{
+		RetransmitTimeout: time.Millisecond,
+		MaxRetransmits:    3,
+	})
+
+	c, err := a.Dial(macB)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer c.Close()
+
+	if _, err := c.Write([]byte("hello")); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+
+	if _, err := c.Read(make([]byte, 1)); !errors.Is(err, reliable.ErrUnreachable) {
+		t.Fatalf("expected ErrUnreachable, but got: %v", err)
+	}
+
+	// The failed stream is removed, so the peer may be dialed again.
+	var derr error
+	for i := 0; i < 100; i++ {
+		var c2 *reliable.Conn
+		if c2, derr = a.Dial(macB); derr == nil {
+			_ = c2.Close()
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if derr != nil {
+		t.Fatalf("failed to dial again: %v", derr)
+	}
+}
+
+func TestConnPeerRestart(t *testing.T) {
+	hub := rawtest.NewHub()
+	a := testTransport(t, hub.Conn(macA), macA, nil)
+	b := testTransport(t, hub.Conn(macB), macB, nil)
+
+	c, err := a.Dial(macB)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer c.Close()
+
+	if _, err := c.Write([]byte("hello")); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+
+	nc, err := b.Accept()
+	if err != nil {
+		t.Fatalf("failed to accept: %v", err)
+	}
+	if _, err := io.ReadFull(nc, make([]byte, 5)); err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+
+	// Replace the peer with a new Transport, which has no record of the
+	// stream.
+	if err := b.Close(); err != nil {
+		t.Fatalf("failed to close: %v", err)
+	}
+	testTransport(t, hub.Conn(macB), macB, nil)
+
+	if _, err := c.Write([]byte("world")); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+
+	if _, err := c.Read(make([]byte, 1)); !errors.Is(err, reliable.ErrReset) {
+		t.Fatalf("expected ErrReset, but got: %v", err)
+	}
+}
+
+func TestConnReadDeadline(t *testing.T) {
+	hub := rawtest.NewHub()
+	a := testTransport(t, hub.Conn(macA), macA, nil)
+
+	c, err := a.Dial(macB)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer c.Close()
+
+	if err := c.SetReadDeadline(time.Now().Add(10 * time.Millisecond)); err != nil {
+		t.Fatalf("failed to set deadline: %v", err)
+	}
+
+	_, err = c.Read(make([]byte, 1))
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, but got: %v", err)
+	}
+
+	var nerr net.Error
+	if !errors.As(err, &nerr) || !nerr.Timeout() {
+		t.Fatalf("expected a timeout error, but got: %v", err)
+	}
+}
+
+func TestTransportClose(t *testing.T) {
+	hub := rawtest.NewHub()
+	a := testTransport(t, hub.Conn(macA), macA, nil)
+
+	errC := make(chan error, 1)
+	go func() {
+		_, err := a.Accept()
+		errC <- err
+	}()
+
+	if err := a.Close(); err != nil {
+		t.Fatalf("failed to close: %v", err)
+	}
+
+	if err := <-errC; !errors.Is(err, net.ErrClosed) {
+		t.Fatalf("expected net.ErrClosed, but got: %v", err)
+	}
+	if _, err := a.Dial(macB); !errors.Is(err, net.ErrClosed) {
+		t.Fatalf("expected net.ErrClosed, but got: %v", err)
+	}
+}
+
+func TestNewInvalidConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  reliable.Config
+	}{
+		{name: "negative window", cfg: reliable.Config{Window: -1}},
+		{name: "window too large", cfg: reliable.Config{Window: 0x10000}},
+		{name: "negative retransmit timeout", cfg: reliable.Config{RetransmitTimeout: -1}},
+		{name: "negative maximum retransmit timeout", cfg: reliable.Config{MaxRetransmitTimeout: -1}},
+		{name: "negative maximum retransmits", cfg: reliable.Config{MaxRetransmits: -1}},
+		{name: "negative read buffer", cfg: reliable.Config{ReadBuffer: -1}},
+		{name: "negative backlog", cfg: reliable.Config{Backlog: -1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := reliable.New(
+				&net.Interface{MTU: 1500, HardwareAddr: macA},
+				rawtest.NewHub().Conn(macA),
+				etherType,
+				&tt.cfg,
+			)
+			if err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+		})
+	}
+}
+
+func testTransport(t *testing.T, p net.PacketConn, mac net.HardwareAddr, cfg *reliable.Config) *reliable.Transport {
+	t.Helper()
+
+	tr, err := reliable.New(&net.Interface{MTU: 1500, HardwareAddr: mac}, p, etherType, cfg)
+	if err != nil {
+		t.Fatalf("failed to create transport: %v", err)
+	}
+	t.Cleanup(func() { _ = tr.Close() })
+
+	return tr
+}
+
+// readAll accepts a stream from tr and reads it until EOF.
+func readAll(t *testing.T, tr *reliable.Transport) []byte {
+	t.Helper()
+
+	nc, err := tr.Accept()
+	if err != nil {
+		t.Fatalf("failed to accept: %v", err)
+	}
+	defer nc.Close()
+
+	if err := nc.SetReadDeadline(time.Now().Add(10 * time.Second)); err != nil {
+		t.Fatalf("failed to set deadline: %v", err)
+	}
+
+	b, err := io.ReadAll(nc)
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+
+	return b
+}
+
+// A lossyConn is a net.PacketConn which drops every nth frame written.
+type lossyConn struct {
+	net.PacketConn
+	drop int
+
+	mu sync.Mutex
+	n  int
+}
+
+func (c *lossyConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	c.mu.Lock()
+	c.n++
+	drop := c.n%c.drop == 0
+	c.mu.Unlock()
+
+	if drop {
+		return len(b), nil
+	}
+
+	return c.PacketConn.WriteTo(b, addr)
+}
@@ -0,0 +1,130 @@
+// Package reliable implements a reliable, ordered byte stream transport over
+// a user-chosen EtherType on top of a *raw.Conn, for hosts on a layer 2
+// segment without IP.
+//
+// A Transport multiplexes one stream per peer hardware address. Data is
+// split into segments which carry sequence numbers and cumulative
+// acknowledgements; lost segments are retransmitted with exponential
+// backoff, and segments received out of order are held until they can be
+// delivered in order. Receivers advertise a window so that a slow reader
+// does not cause its peer to give up.
+//
+// There is no handshake: a stream is accepted by the peer when its first
+// segment arrives. Each end of a stream chooses a random ID, so that a peer
+// which restarts is detected and the stale stream is reset.
+package reliable
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+const (
+	// headerLen is the length of a segment header.
+	headerLen = 22
+
+	// version is the segment format version implemented by this package.
+	version = 1
+)
+
+// flags are the flags carried in a segment header.
+type flags uint8
+
+const (
+	// flagACK indicates that the ack and window fields are valid.
+	flagACK flags = 1 << 0
+
+	// flagFIN indicates that the sender will send no more data. A FIN
+	// occupies a sequence number.
+	flagFIN flags = 1 << 1
+
+	// flagRST indicates that the receiver has no stream matching a
+	// segment, and that the stream should be reset.
+	flagRST flags = 1 << 2
+)
+
+// errInvalidSegment is returned when a segment is malformed.
+var errInvalidSegment = errors.New("reliable: invalid segment")
+
+// A segment is the unit of transmission of a stream.
+//
+// The binary form is a version, flags, the payload length, the receive
+// window, the sender's and receiver's stream IDs, the sequence number, and
+// the acknowledgement number, followed by the payload.
+type segment struct {
+	Flags  flags
+	Window uint16
+
+	// SrcID identifies the sender's end of the stream, and DstID identifies
+	// the receiver's end, or is zero if the sender has not yet learned it.
+	SrcID uint32
+	DstID uint32
+
+	// Seq is the sequence number of a segment which carries data or a FIN.
+	// Ack is the next sequence number the sender expects to receive.
+	Seq uint32
+	Ack uint32
+
+	Payload []byte
+}
+
+// sequenced reports whether s occupies a sequence number.
+func (s *segment) sequenced() bool {
+	return len(s.Payload) > 0 || s.Flags&flagFIN != 0
+}
+
+// MarshalBinary allocates a byte slice and marshals a segment into binary
+// form.
+func (s *segment) MarshalBinary() ([]byte, error) {
+	if len(s.Payload) > 0xffff {
+		return nil, errInvalidSegment
+	}
+
+	b := make([]byte, headerLen+len(s.Payload))
+	b[0] = version
+	b[1] = uint8(s.Flags)
+	binary.BigEndian.PutUint16(b[2:4], uint16(len(s.Payload)))
+	binary.BigEndian.PutUint16(b[4:6], s.Window)
+	binary.BigEndian.PutUint32(b[6:10], s.SrcID)
+	binary.BigEndian.PutUint32(b[10:14], s.DstID)
+	binary.BigEndian.PutUint32(b[14:18], s.Seq)
+	binary.BigEndian.PutUint32(b[18:22], s.Ack)
+	copy(b[headerLen:], s.Payload)
+
+	return b, nil
+}
+
+// UnmarshalBinary unmarshals a byte slice into a segment. Any trailing
+// Ethernet padding is removed, and Payload refers to the input slice.
+func (s *segment) UnmarshalBinary(b []byte) error {
+	if len(b) < headerLen {
+		return io.ErrUnexpectedEOF
+	}
+	if b[0] != version {
+		return errInvalidSegment
+	}
+
+	l := int(binary.BigEndian.Uint16(b[2:4]))
+	if len(b) < headerLen+l {
+		return io.ErrUnexpectedEOF
+	}
+
+	*s = segment{
+		Flags:   flags(b[1]),
+		Window:  binary.BigEndian.Uint16(b[4:6]),
+		SrcID:   binary.BigEndian.Uint32(b[6:10]),
+		DstID:   binary.BigEndian.Uint32(b[10:14]),
+		Seq:     binary.BigEndian.Uint32(b[14:18]),
+		Ack:     binary.BigEndian.Uint32(b[18:22]),
+		Payload: b[headerLen : headerLen+l],
+	}
+
+	return nil
+}
+
+// seqLess reports whether sequence number a precedes b, allowing for
+// wraparound.
+func seqLess(a, b uint32) bool {
+	return int32(a-b) < 0
+}
@@ -0,0 +1,471 @@
+package reliable
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/mdlayher/raw"
+	"github.com/mdlayher/raw/ethernet"
+	"github.com/mdlayher/raw/internal/frame"
+)
+
+// Default configuration values.
+const (
+	defaultWindow               = 32
+	defaultRetransmitTimeout    = 200 * time.Millisecond
+	defaultMaxRetransmitTimeout = 5 * time.Second
+	defaultMaxRetransmits       = 8
+	defaultReadBuffer           = 256 * 1024
+	defaultBacklog              = 16
+
+	// maxWindow is the largest window which fits in a segment header.
+	maxWindow = 0xffff
+)
+
+var (
+	// ErrReset is returned when the peer resets a stream, usually because
+	// it restarted.
+	ErrReset = errors.New("reliable: connection reset by peer")
+
+	// ErrUnreachable is returned when the peer does not acknowledge a
+	// segment after the maximum number of retransmissions.
+	ErrUnreachable = errors.New("reliable: peer unreachable")
+)
+
+// A Config configures a Transport. The zero value of any field selects a
+// default value.
+type Config struct {
+	// Window is the maximum number of unacknowledged segments sent, and
+	// the maximum number of out of order segments held, per stream. If
+	// zero, 32 is used. Window must not exceed 65535, the largest window
+	// which can be advertised to a peer.
+	Window int
+
+	// RetransmitTimeout is the initial time to wait for an acknowledgement
+	// before retransmitting a segment. The timeout doubles with each
+	// retransmission, up to MaxRetransmitTimeout. If zero, 200 milliseconds
+	// and 5 seconds are used.
+	RetransmitTimeout    time.Duration
+	MaxRetransmitTimeout time.Duration
+
+	// MaxRetransmits is the number of retransmissions without any
+	// acknowledgement from the peer after which a stream fails with
+	// ErrUnreachable. If zero, 8 is used.
+	MaxRetransmits int
+
+	// ReadBuffer is the number of bytes buffered per stream which have not
+	// been read. If zero, 256 KiB is used.
+	ReadBuffer int
+
+	// Backlog is the number of streams opened by peers which may wait for
+	// Accept. If zero, 16 is used.
+	Backlog int
+}
+
+var _ net.Listener = &Transport{}
+
+// A Transport sends and receives streams over a single EtherType. A
+// Transport is also a net.Listener which accepts streams opened by peers.
+type Transport struct {
+	ifi       *net.Interface
+	p         net.PacketConn
+	etherType ethernet.EtherType
+	cfg       Config
+
+	accept    chan *Conn
+	done      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+
+	mu     sync.Mutex
+	conns  map[string]*Conn
+	recent map[string]uint32
+	closed bool
+}
+
+// Listen creates a new Transport using the specified network interface and
+// EtherType. Listen opens a *raw.Conn which receives frames with the
+// EtherType. A nil Config selects the default values.
+func Listen(ifi *net.Interface, etherType ethernet.EtherType, cfg *Config) (*Transport, error) {
+	p, err := raw.ListenPacket(ifi, uint16(etherType), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := New(ifi, p, etherType, cfg)
+	if err != nil {
+		_ = p.Close()
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// New creates a new Transport using the specified network interface,
+// net.PacketConn, and EtherType. p must send and receive complete Ethernet
+// frames. The Transport reads from p until it is closed.
+func New(ifi *net.Interface, p net.PacketConn, etherType ethernet.EtherType, cfg *Config) (*Transport, error) {
+	if len(ifi.HardwareAddr) != 6 {
+		return nil, fmt.Errorf("reliable: invalid hardware address: %q", ifi.HardwareAddr)
+	}
+	if etherType <= 1500 {
+		return nil, fmt.Errorf("reliable: invalid EtherType: %s", etherType)
+	}
+
+	if cfg == nil {
+		cfg = &Config{}
+	}
+
+	conf := *cfg
+	switch {
+	case conf.Window < 0 || conf.Window > maxWindow:
+		return nil, fmt.Errorf("reliable: invalid window: %d", conf.Window)
+	case conf.RetransmitTimeout < 0 || conf.MaxRetransmitTimeout < 0:
+		return nil, errors.New("reliable: retransmit timeouts must not be negative")
+	case conf.MaxRetransmits < 0:
+		return nil, fmt.Errorf("reliable: invalid maximum retransmissions: %d", conf.MaxRetransmits)
+	case conf.ReadBuffer < 0:
+		return nil, fmt.Errorf("reliable: invalid read buffer size: %d", conf.ReadBuffer)
+	case conf.Backlog < 0:
+		return nil, fmt.Errorf("reliable: invalid backlog: %d", conf.Backlog)
+	}
+
+	if conf.Window == 0 {
+		conf.Window = defaultWindow
+	}
+	if conf.RetransmitTimeout == 0 {
+		conf.RetransmitTimeout = defaultRetransmitTimeout
+	}
+	if conf.MaxRetransmitTimeout == 0 {
+		conf.MaxRetransmitTimeout = defaultMaxRetransmitTimeout
+	}
+	if conf.MaxRetransmits == 0 {
+		conf.MaxRetransmits = defaultMaxRetransmits
+	}
+	if conf.ReadBuffer == 0 {
+		conf.ReadBuffer = defaultReadBuffer
+	}
+	if conf.Backlog == 0 {
+		conf.Backlog = defaultBacklog
+	}
+
+	t := &Transport{
+		ifi:       ifi,
+		p:         p,
+		etherType: etherType,
+		cfg:       conf,
+		accept:    make(chan *Conn, conf.Backlog),
+		done:      make(chan struct{}),
+		conns:     make(map[string]*Conn),
+		recent:    make(map[string]uint32),
+	}
+
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+		t.readLoop()
+	}()
+
+	return t, nil
+}
+
+// Addr returns the Transport's hardware address as a *raw.Addr.
+func (t *Transport) Addr() net.Addr {
+	return &raw.Addr{HardwareAddr: t.ifi.HardwareAddr}
+}
+
+// Close closes the Transport's connection. Pending calls to Accept and all
+// streams fail with net.ErrClosed.
+func (t *Transport) Close() error {
+	var err error
+	t.closeOnce.Do(func() {
+		close(t.done)
+		err = t.p.Close()
+
+		t.mu.Lock()
+		t.closed = true
+		for _, c := range t.conns {
+			c.mu.Lock()
+			c.fail(net.ErrClosed)
+			c.mu.Unlock()
+		}
+		t.mu.Unlock()
+
+		t.wg.Wait()
+	})
+
+	return err
+}
+
+// Accept waits for a peer to open a stream and returns it. Accept
+// implements net.Listener, and the returned net.Conn is a *Conn.
+func (t *Transport) Accept() (net.Conn, error) {
+	select {
+	case c := <-t.accept:
+		return c, nil
+	case <-t.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// Dial opens a stream to peer. Only one stream to each peer may be open at a
+// time. The peer accepts the stream when the first data is written.
+func (t *Transport) Dial(peer net.HardwareAddr) (*Conn, error) {
+	if len(peer) != 6 || peer[0]&0x01 != 0 {
+		return nil, fmt.Errorf("reliable: invalid peer address: %q", peer)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return nil, net.ErrClosed
+	}
+
+	key := peer.String()
+	if _, ok := t.conns[key]; ok {
+		return nil, fmt.Errorf("reliable: stream to %s already open", peer)
+	}
+
+	c, err := t.newConn(peer, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	t.conns[key] = c
+	return c, nil
+}
+
+// MaxSegment returns the largest payload carried in a single segment.
+func (t *Transport) MaxSegment() int {
+	mtu := t.ifi.MTU
+	if mtu <= 0 {
+		mtu = 1500
+	}
+
+	return mtu - headerLen
+}
+
+// newConn creates a stream to peer and starts its sender. The caller must
+// hold t.mu.
+func (t *Transport) newConn(peer net.HardwareAddr, peerID uint32) (*Conn, error) {
+	var idb [4]byte
+	var id uint32
+	for id == 0 {
+		if _, err := rand.Read(idb[:]); err != nil {
+			return nil, err
+		}
+		id = binary.BigEndian.Uint32(idb[:])
+	}
+
+	c := &Conn{
+		t:          t,
+		peer:       append(net.HardwareAddr(nil), peer...),
+		localID:    id,
+		changed:    make(chan struct{}),
+		peerID:     peerID,
+		sndNext:    1,
+		rcvNext:    1,
+		peerWindow: t.cfg.Window,
+		rto:        t.cfg.RetransmitTimeout,
+		ooo:        make(map[uint32]*segment),
+		advertised: t.cfg.Window,
+	}
+
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+		c.run()
+	}()
+
+	return c, nil
+}
+
+// remove removes the stream c, whose peer used peerID, from the Transport.
+func (t *Transport) remove(c *Conn, peerID uint32) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := c.peer.String()
+	if t.conns[key] == c {
+		delete(t.conns, key)
+	}
+
+	// Segments which arrive late for this stream must not open a new one.
+	if peerID != 0 {
+		t.recent[key] = peerID
+	}
+}
+
+// readLoop receives segments until the connection is closed and delivers
+// them to their streams.
+func (t *Transport) readLoop() {
+	b := make([]byte, frame.BufferSize(t.ifi))
+	for {
+		n, _, err := t.p.ReadFrom(b)
+		if err != nil {
+			select {
+			case <-t.done:
+				return
+			default:
+			}
+
+			// Fail all streams, as no further segments can be received.
+			t.mu.Lock()
+			for _, c := range t.conns {
+				c.mu.Lock()
+				c.fail(err)
+				c.mu.Unlock()
+			}
+			t.mu.Unlock()
+			return
+		}
+
+		src, s, err := t.parseFrame(b[:n])
+		if err != nil {
+			continue
+		}
+
+		c, rst := t.lookup(src, s)
+		if rst {
+			t.send(src, &segment{
+				Flags: flagRST,
+				DstID: s.SrcID,
+			})
+			continue
+		}
+		if c == nil {
+			continue
+		}
+
+		if ack := c.handle(s); ack != nil {
+			t.send(src, ack)
+		}
+	}
+}
+
+// lookup returns the stream to which s from src belongs, creating it if s
+// opens a new stream. If no stream matches, lookup reports whether the
+// sender should be reset.
+func (t *Transport) lookup(src net.HardwareAddr, s *segment) (*Conn, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return nil, false
+	}
+
+	// Only the first segment of a stream may open it.
+	opening := s.sequenced() && s.Seq == 1 && s.Flags&flagRST == 0
+
+	key := src.String()
+	c, ok := t.conns[key]
+	if ok {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		switch {
+		case s.Flags&flagRST != 0:
+			// A reset identifies only the stream it resets.
+			if s.DstID != c.localID {
+				return nil, false
+			}
+
+			return c, false
+		case c.peerID == s.SrcID:
+			return c, false
+		case c.peerID == 0 && (s.DstID == c.localID || opening):
+			// The first segment from the peer of a dialed stream.
+			c.peerID = s.SrcID
+			return c, false
+		case !opening:
+			// A late segment from a previous stream.
+			return nil, false
+		}
+
+		// The peer restarted and opened a new stream.
+		c.fail(ErrReset)
+		t.recent[key] = c.peerID
+		delete(t.conns, key)
+	}
+
+	if s.Flags&flagRST != 0 || !s.sequenced() {
+		// Nothing to reset, or only an acknowledgement for a stream which
+		// no longer exists.
+		return nil, false
+	}
+	if !opening || t.recent[key] == s.SrcID {
+		return nil, true
+	}
+
+	c, err := t.newConn(src, s.SrcID)
+	if err != nil {
+		return nil, false
+	}
+
+	select {
+	case t.accept <- c:
+		t.conns[key] = c
+		return c, false
+	default:
+		// The backlog is full, so drop the segment and let the peer
+		// retransmit it. The stream was never seen by the peer, so its
+		// segments must not be treated as late.
+		c.mu.Lock()
+		c.peerID = 0
+		c.fail(net.ErrClosed)
+		c.mu.Unlock()
+		return nil, false
+	}
+}
+
+// send sends s to dst. Errors are ignored, as lost segments are
+// retransmitted.
+func (t *Transport) send(dst net.HardwareAddr, s *segment) {
+	sb, err := s.MarshalBinary()
+	if err != nil {
+		return
+	}
+
+	fb, err := (&ethernet.Frame{
+		Destination: dst,
+		Source:      t.ifi.HardwareAddr,
+		EtherType:   t.etherType,
+		Payload:     sb,
+	}).MarshalBinary()
+	if err != nil {
+		return
+	}
+
+	_, _ = t.p.WriteTo(fb, &raw.Addr{HardwareAddr: dst})
+}
+
+// parseFrame parses a segment and its source address from an Ethernet frame.
+func (t *Transport) parseFrame(b []byte) (net.HardwareAddr, *segment, error) {
+	var f ethernet.Frame
+	if err := f.UnmarshalBinary(b); err != nil {
+		return nil, nil, err
+	}
+
+	ok := f.EtherType == t.etherType &&
+		len(f.Source) == 6 &&
+		f.Source[0]&0x01 == 0 &&
+		bytes.Equal(f.Destination, t.ifi.HardwareAddr)
+	if !ok {
+		return nil, nil, errInvalidSegment
+	}
+
+	s := new(segment)
+	if err := s.UnmarshalBinary(f.Payload); err != nil {
+		return nil, nil, err
+	}
+
+	// Copy the source so that b may be reused.
+	return append(net.HardwareAddr(nil), f.Source...), s, nil
+}
@@ -0,0 +1,282 @@
+// Package replay transmits the Ethernet frames recorded in a pcap or pcapng
+// capture file through a net.PacketConn such as a *raw.Conn, with control
+// over timing, repetition, and hardware addresses.
+package replay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"time"
+
+	"github.com/mdlayher/raw"
+	"github.com/mdlayher/raw/offline"
+	"github.com/mdlayher/raw/pcap"
+)
+
+// A Timing determines when frames are transmitted.
+type Timing int
+
+// Possible Timing values.
+const (
+	// TimingOriginal preserves the intervals between frames in the capture
+	// file, scaled by Config.Speed.
+	TimingOriginal Timing = iota
+
+	// TimingRate transmits Config.Rate frames per second.
+	TimingRate
+
+	// TimingNone transmits frames as quickly as possible.
+	TimingNone
+)
+
+// String returns the name of a Timing.
+func (t Timing) String() string {
+	switch t {
+	case TimingOriginal:
+		return "original"
+	case TimingRate:
+		return "rate"
+	case TimingNone:
+		return "none"
+	default:
+		return fmt.Sprintf("Timing(%d)", int(t))
+	}
+}
+
+// A Config configures a replay. The zero value of any field selects a
+// default value.
+type Config struct {
+	// Timing determines when frames are transmitted. If zero,
+	// TimingOriginal is used.
+	Timing Timing
+
+	// Speed is a multiplier for TimingOriginal, such that 2 replays a
+	// capture in half of its original duration. If zero, 1 is used.
+	Speed float64
+
+	// Rate is the number of frames per second transmitted with TimingRate.
+	Rate float64
+
+	// Loop is the number of times the capture file is replayed. If zero,
+	// the file is replayed once. If negative, the file is replayed until
+	// the context is canceled.
+	Loop int
+
+	// Rewrite replaces the source and destination hardware addresses of
+	// frames which appear as keys, in the form returned by
+	// net.HardwareAddr.String, with the corresponding values.
+	Rewrite map[string]net.HardwareAddr
+
+	// Source and Destination, if set, replace the source and destination
+	// hardware addresses of every frame, after Rewrite is applied.
+	Source      net.HardwareAddr
+	Destination net.HardwareAddr
+}
+
+// Stats contains statistics about a replay.
+type Stats struct {
+	// Frames and Bytes are the number of frames and bytes transmitted.
+	Frames uint64
+	Bytes  uint64
+
+	// Skipped is the number of packets which were not transmitted because
+	// they are not Ethernet frames.
+	Skipped uint64
+
+	// Errors is the number of frames which were not transmitted because the
+	// connection rejected them, such as frames larger than the interface's
+	// MTU.
+	Errors uint64
+}
+
+// Replay reads a pcap or pcapng capture file from r and writes each Ethernet
+// frame to p. The file is read from its start on each loop, so r must be
+// positioned at the start of the file. A nil Config selects the default
+// values.
+//
+// Replay returns when the file has been replayed the configured number of
+// times, when the connection is closed, or when ctx is canceled. Frames which
+// the connection rejects are counted in Stats.Errors and the replay
+// continues. The Stats returned are valid in each case.
+func Replay(ctx context.Context, p net.PacketConn, r io.ReadSeeker, cfg *Config) (*Stats, error) {
+	if cfg == nil {
+		cfg = &Config{}
+	}
+
+	conf := *cfg
+	switch {
+	case conf.Speed < 0, math.IsNaN(conf.Speed), math.IsInf(conf.Speed, 0):
+		return nil, fmt.Errorf("replay: invalid speed: %v", conf.Speed)
+	case conf.Speed == 0:
+		conf.Speed = 1
+	}
+	switch conf.Timing {
+	case TimingOriginal, TimingNone:
+	case TimingRate:
+		if !(conf.Rate > 0) || math.IsInf(conf.Rate, 0) {
+			return nil, fmt.Errorf("replay: invalid rate: %v", conf.Rate)
+		}
+	default:
+		return nil, fmt.Errorf("replay: invalid timing: %s", conf.Timing)
+	}
+	for _, addr := range append([]net.HardwareAddr{conf.Source, conf.Destination}, values(conf.Rewrite)...) {
+		if addr != nil && len(addr) != 6 {
+			return nil, fmt.Errorf("replay: invalid hardware address: %q", addr)
+		}
+	}
+
+	rp := &replayer{
+		ctx:   ctx,
+		p:     p,
+		cfg:   conf,
+		stats: &Stats{},
+		start: time.Now(),
+	}
+
+	for i := 0; conf.Loop < 0 || i < conf.Loop || i == 0; i++ {
+		if i > 0 {
+			if _, err := r.Seek(0, io.SeekStart); err != nil {
+				return rp.stats, err
+			}
+		}
+
+		before := rp.stats.Frames
+		if err := rp.replay(r); err != nil {
+			return rp.stats, err
+		}
+
+		// Stop rather than loop forever over a file with nothing to send.
+		if rp.stats.Frames == before {
+			break
+		}
+	}
+
+	return rp.stats, nil
+}
+
+// A replayer replays a capture file.
+type replayer struct {
+	ctx   context.Context
+	p     net.PacketConn
+	cfg   Config
+	stats *Stats
+
+	// start is the time the replay started, used by TimingRate.
+	start time.Time
+}
+
+// replay replays the capture file read from r once.
+func (rp *replayer) replay(r io.Reader) error {
+	rd, err := offline.NewReader(r)
+	if err != nil {
+		return err
+	}
+
+	var start, first time.Time
+	for {
+		pkt, err := rd.ReadPacket()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+
+		if pkt.LinkType != pcap.LinkTypeEthernet || len(pkt.Data) < 14 {
+			rp.stats.Skipped++
+			continue
+		}
+
+		var due time.Time
+		switch rp.cfg.Timing {
+		case TimingOriginal:
+			// Each loop preserves the original timing from its first frame.
+			if start.IsZero() {
+				start, first = time.Now(), pkt.Timestamp
+			}
+			due = start.Add(time.Duration(float64(pkt.Timestamp.Sub(first)) / rp.cfg.Speed))
+		case TimingRate:
+			due = rp.start.Add(time.Duration(float64(rp.stats.Frames) / rp.cfg.Rate * float64(time.Second)))
+		}
+
+		if err := rp.wait(due); err != nil {
+			return err
+		}
+
+		f := rp.rewrite(pkt.Data)
+		if _, err := rp.p.WriteTo(f, &raw.Addr{HardwareAddr: net.HardwareAddr(f[0:6])}); err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return err
+			}
+
+			// A single frame rejected by the connection does not stop the
+			// replay.
+			rp.stats.Errors++
+			continue
+		}
+
+		rp.stats.Frames++
+		rp.stats.Bytes += uint64(len(f))
+	}
+}
+
+// rewrite applies the configured hardware address changes to the frame f,
+// which is modified in place and returned.
+func (rp *replayer) rewrite(f []byte) []byte {
+	dst, src := f[0:6], f[6:12]
+
+	if len(rp.cfg.Rewrite) > 0 {
+		if addr, ok := rp.cfg.Rewrite[net.HardwareAddr(dst).String()]; ok {
+			copy(dst, addr)
+		}
+		if addr, ok := rp.cfg.Rewrite[net.HardwareAddr(src).String()]; ok {
+			copy(src, addr)
+		}
+	}
+
+	if rp.cfg.Destination != nil {
+		copy(dst, rp.cfg.Destination)
+	}
+	if rp.cfg.Source != nil {
+		copy(src, rp.cfg.Source)
+	}
+
+	return f
+}
+
+// wait blocks until due, or returns an error if the replay's context is
+// canceled first.
+func (rp *replayer) wait(due time.Time) error {
+	if err := rp.ctx.Err(); err != nil {
+		return err
+	}
+
+	d := time.Until(due)
+	if due.IsZero() || d <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-rp.ctx.Done():
+		return rp.ctx.Err()
+	}
+}
+
+// values returns the values of m.
+func values(m map[string]net.HardwareAddr) []net.HardwareAddr {
+	out := make([]net.HardwareAddr, 0, len(m))
+	for _, v := range m {
+		out = append(out, v)
+	}
+
+	return out
+}
@@ -0,0 +1,247 @@
+package replay_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/raw/ethernet"
+	"github.com/mdlayher/raw/internal/rawtest"
+	"github.com/mdlayher/raw/replay"
+)
+
+var (
+	macA = net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	macB = net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x02}
+	macC = net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x03}
+)
+
+func TestReplay(t *testing.T) {
+	frames := [][]byte{
+		rawtest.Frame(t, macB, macA, ethernet.EtherTypeIPv4, []byte("hello")),
+		rawtest.Frame(t, macA, macB, ethernet.EtherTypeIPv4, []byte("hello")),
+	}
+
+	tests := []struct {
+		name  string
+		cfg   *replay.Config
+		want  [][]byte
+		stats *replay.Stats
+	}{
+		{
+			name:  "once",
+			cfg:   &replay.Config{Timing: replay.TimingNone},
+			want:  frames,
+			stats: &replay.Stats{Frames: 2, Bytes: 120, Skipped: 1},
+		},
+		{
+			name:  "loop",
+			cfg:   &replay.Config{Timing: replay.TimingNone, Loop: 2},
+			want:  append(frames, frames...),
+			stats: &replay.Stats{Frames: 4, Bytes: 240, Skipped: 2},
+		},
+		{
+			name: "rewrite",
+			cfg: &replay.Config{
+				Timing:  replay.TimingNone,
+				Rewrite: map[string]net.HardwareAddr{macA.String(): macC},
+			},
+			want: [][]byte{
+				rawtest.Frame(t, macB, macC, ethernet.EtherTypeIPv4, []byte("hello")),
+				rawtest.Frame(t, macC, macB, ethernet.EtherTypeIPv4, []byte("hello")),
+			},
+			stats: &replay.Stats{Frames: 2, Bytes: 120, Skipped: 1},
+		},
+		{
+			name: "source and destination",
+			cfg: &replay.Config{
+				Timing:      replay.TimingNone,
+				Rewrite:     map[string]net.HardwareAddr{macA.String(): macC},
+				Source:      macA,
+				Destination: ethernet.Broadcast,
+			},
+			want: [][]byte{
+				rawtest.Frame(t, ethernet.Broadcast, macA, ethernet.EtherTypeIPv4, []byte("hello")),
+				rawtest.Frame(t, ethernet.Broadcast, macA, ethernet.EtherTypeIPv4, []byte("hello")),
+			},
+			stats: &replay.Stats{Frames: 2, Bytes: 120, Skipped: 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := rawtest.NewHub().Conn(macA)
+
+			stats, err := replay.Replay(context.Background(), p, pcapFile(t, time.Millisecond, frames...), tt.cfg)
+			if err != nil {
+				t.Fatalf("failed to replay: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.want, p.Written()); diff != "" {
+				t.Fatalf("unexpected frames (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.stats, stats); diff != "" {
+				t.Fatalf("unexpected stats (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestReplayTiming(t *testing.T) {
+	frames := [][]byte{
+		rawtest.Frame(t, macB, macA, ethernet.EtherTypeIPv4, []byte("hello")),
+		rawtest.Frame(t, macB, macA, ethernet.EtherTypeIPv4, []byte("hello")),
+		rawtest.Frame(t, macB, macA, ethernet.EtherTypeIPv4, []byte("hello")),
+	}
+
+	tests := []struct {
+		name     string
+		interval time.Duration
+		cfg      *replay.Config
+		min, max time.Duration
+	}{
+		{
+			name:     "original",
+			interval: 50 * time.Millisecond,
+			min:      100 * time.Millisecond,
+			max:      time.Second,
+		},
+		{
+			name:     "speed",
+			interval: time.Second,
+			cfg:      &replay.Config{Speed: 20},
+			min:      100 * time.Millisecond,
+			max:      time.Second,
+		},
+		{
+			name:     "rate",
+			interval: time.Hour,
+			cfg:      &replay.Config{Timing: replay.TimingRate, Rate: 20},
+			min:      100 * time.Millisecond,
+			max:      time.Second,
+		},
+		{
+			name:     "none",
+			interval: time.Hour,
+			cfg:      &replay.Config{Timing: replay.TimingNone},
+			max:      100 * time.Millisecond,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := rawtest.NewHub().Conn(macA)
+
+			start := time.Now()
+			if _, err := replay.Replay(context.Background(), p, pcapFile(t, tt.interval, frames...), tt.cfg); err != nil {
+				t.Fatalf("failed to replay: %v", err)
+			}
+
+			if d := time.Since(start); d < tt.min || d > tt.max {
+				t.Fatalf("replay took %v, want between %v and %v", d, tt.min, tt.max)
+			}
+		})
+	}
+}
+
+func TestReplayCancel(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	p := rawtest.NewHub().Conn(macA)
+	r := pcapFile(t, time.Millisecond, rawtest.Frame(t, macB, macA, ethernet.EtherTypeIPv4, []byte("hello")))
+
+	stats, err := replay.Replay(ctx, p, r, &replay.Config{
+		Timing: replay.TimingRate,
+		Rate:   1000,
+		Loop:   -1,
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context deadline exceeded, but got: %v", err)
+	}
+	if stats.Frames == 0 || int(stats.Frames) != len(p.Written()) {
+		t.Fatalf("unexpected frames: stats %d, written %d", stats.Frames, len(p.Written()))
+	}
+}
+
+func TestReplayWriteError(t *testing.T) {
+	frames := [][]byte{
+		rawtest.Frame(t, macB, macA, ethernet.EtherTypeIPv4, []byte("hello")),
+		rawtest.Frame(t, macC, macA, ethernet.EtherTypeIPv4, []byte("hello")),
+		rawtest.Frame(t, macB, macA, ethernet.EtherTypeIPv4, []byte("hello")),
+	}
+
+	// The connection rejects frames sent to macC, and is then closed.
+	p := &rejectConn{Conn: rawtest.NewHub().Conn(macA), reject: macC}
+
+	stats, err := replay.Replay(context.Background(), p, pcapFile(t, 0, frames...), &replay.Config{
+		Timing: replay.TimingNone,
+	})
+	if err != nil {
+		t.Fatalf("failed to replay: %v", err)
+	}
+
+	want := &replay.Stats{Frames: 2, Bytes: 120, Skipped: 1, Errors: 1}
+	if diff := cmp.Diff(want, stats); diff != "" {
+		t.Fatalf("unexpected stats (-want +got):\n%s", diff)
+	}
+
+	_ = p.Close()
+	if _, err := replay.Replay(context.Background(), p, pcapFile(t, 0, frames...), &replay.Config{
+		Timing: replay.TimingNone,
+	}); !errors.Is(err, net.ErrClosed) {
+		t.Fatalf("expected net.ErrClosed, but got: %v", err)
+	}
+}
+
+func TestReplayInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  *replay.Config
+	}{
+		{name: "speed", cfg: &replay.Config{Speed: -1}},
+		{name: "speed NaN", cfg: &replay.Config{Speed: math.NaN()}},
+		{name: "speed infinite", cfg: &replay.Config{Speed: math.Inf(1)}},
+		{name: "rate", cfg: &replay.Config{Timing: replay.TimingRate}},
+		{name: "rate NaN", cfg: &replay.Config{Timing: replay.TimingRate, Rate: math.NaN()}},
+		{name: "rate infinite", cfg: &replay.Config{Timing: replay.TimingRate, Rate: math.Inf(1)}},
+		{name: "timing", cfg: &replay.Config{Timing: replay.TimingNone + 1}},
+		{name: "source", cfg: &replay.Config{Source: net.HardwareAddr{0x00}}},
+		{name: "rewrite", cfg: &replay.Config{Rewrite: map[string]net.HardwareAddr{macA.String(): {0x00}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := rawtest.NewHub().Conn(macA)
+			if _, err := replay.Replay(context.Background(), p, pcapFile(t, 0), tt.cfg); err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+		})
+	}
+}
+
+// A rejectConn is a *rawtest.Conn which rejects frames sent to one address.
+type rejectConn struct {
+	*rawtest.Conn
+	reject net.HardwareAddr
+}
+
+func (c *rejectConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	if bytes.Equal(b[0:6], c.reject) {
+		return 0, errors.New("frame rejected")
+	}
+
+	return c.Conn.WriteTo(b, addr)
+}
+
+// pcapFile returns an Ethernet pcap capture file containing frames at the
+// specified interval, followed by a packet which is too short to be a frame.
+func pcapFile(t *testing.T, interval time.Duration, frames ...[]byte) *bytes.Reader {
+	t.Helper()
+	return rawtest.PcapFile(t, interval, append(frames, []byte{0xff})...)
+}
@@ -0,0 +1,361 @@
+package seal
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/mdlayher/raw"
+	"github.com/mdlayher/raw/ethernet"
+	"github.com/mdlayher/raw/internal/frame"
+)
+
+// defaultReplayWindow is the default number of counters tracked per source.
+const defaultReplayWindow = 1024
+
+// A Config configures a Conn. The zero value of any field selects a default
+// value.
+type Config struct {
+	// ReplayWindow is the number of counters tracked per source to detect
+	// replayed messages. Messages may be reordered by at most this many
+	// positions before they are discarded. ReplayWindow is rounded up to a
+	// multiple of 64. If zero, 1024 is used.
+	ReplayWindow int
+}
+
+// Stats contains statistics about received frames.
+type Stats struct {
+	// Opened is the number of messages successfully authenticated and
+	// decrypted.
+	Opened uint64
+
+	// NoKey is the number of frames discarded because no key was configured
+	// for them.
+	NoKey uint64
+
+	// Invalid is the number of frames discarded because they were malformed
+	// or failed authentication.
+	Invalid uint64
+
+	// Replayed is the number of frames discarded because their counter was
+	// already received or too old to check.
+	Replayed uint64
+}
+
+var _ net.PacketConn = &Conn{}
+
+// A Conn is a net.PacketConn which seals messages written to it and opens
+// messages read from it. Unlike a *raw.Conn, the data read from and written
+// to a Conn does not include an Ethernet header, and its addresses are
+// *raw.Addr values.
+type Conn struct {
+	ifi       *net.Interface
+	p         net.PacketConn
+	etherType ethernet.EtherType
+	cfg       Config
+	salt      [16]byte
+
+	wmu     sync.Mutex
+	counter uint64
+
+	mu    sync.Mutex
+	keys  map[string]*key
+	stats Stats
+}
+
+// A key is an AEAD and the replay windows of messages opened with it.
+type key struct {
+	aead    cipher.AEAD
+	windows map[string]*window
+}
+
+// ListenPacket creates a new Conn using the specified network interface and
+// EtherType. ListenPacket opens a *raw.Conn which receives frames with the
+// EtherType. A nil Config selects the default values.
+func ListenPacket(ifi *net.Interface, etherType ethernet.EtherType, cfg *Config) (*Conn, error) {
+	p, err := raw.ListenPacket(ifi, uint16(etherType), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := New(ifi, p, etherType, cfg)
+	if err != nil {
+		_ = p.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// New creates a new Conn using the specified network interface,
+// net.PacketConn, and EtherType. p must send and receive complete Ethernet
+// frames.
+func New(ifi *net.Interface, p net.PacketConn, etherType ethernet.EtherType, cfg *Config) (*Conn, error) {
+	if len(ifi.HardwareAddr) != 6 {
+		return nil, fmt.Errorf("seal: invalid hardware address: %q", ifi.HardwareAddr)
+	}
+	if etherType <= 1500 {
+		return nil, fmt.Errorf("seal: invalid EtherType: %s", etherType)
+	}
+
+	if cfg == nil {
+		cfg = &Config{}
+	}
+
+	conf := *cfg
+	switch {
+	case conf.ReplayWindow < 0:
+		return nil, fmt.Errorf("seal: invalid replay window: %d", conf.ReplayWindow)
+	case conf.ReplayWindow == 0:
+		conf.ReplayWindow = defaultReplayWindow
+	default:
+		conf.ReplayWindow = (conf.ReplayWindow + 63) / 64 * 64
+	}
+
+	c := &Conn{
+		ifi:       ifi,
+		p:         p,
+		etherType: etherType,
+		cfg:       conf,
+		// Counters start from the current time so that they continue to
+		// increase after a restart.
+		counter: uint64(time.Now().UnixNano()),
+		keys:    make(map[string]*key),
+	}
+
+	// The salt distinguishes the nonces of senders which share a key.
+	if _, err := rand.Read(c.salt[:]); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// SetKey sets the AEAD used for messages exchanged with addr, which is either
+// a peer's unicast address or a group address. The AEAD's nonce size must be
+// between 12 and 24 bytes. If aead is nil, the key for addr is removed.
+// Replacing a key discards its replay state, since messages sealed with the
+// previous key can no longer be opened.
+func (c *Conn) SetKey(addr net.HardwareAddr, aead cipher.AEAD) error {
+	if len(addr) != 6 {
+		return fmt.Errorf("seal: invalid hardware address: %q", addr)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if aead == nil {
+		delete(c.keys, addr.String())
+		return nil
+	}
+
+	if ns := aead.NonceSize(); ns < minNonceSize || ns-counterLen > len(c.salt) {
+		return fmt.Errorf("seal: unsupported AEAD nonce size: %d", ns)
+	}
+
+	c.keys[addr.String()] = &key{
+		aead:    aead,
+		windows: make(map[string]*window),
+	}
+
+	return nil
+}
+
+// MaxPayload returns the largest message which may be sealed for addr, or 0
+// if no key is set for addr.
+func (c *Conn) MaxPayload(addr net.HardwareAddr) int {
+	c.mu.Lock()
+	k, ok := c.keys[addr.String()]
+	c.mu.Unlock()
+	if !ok {
+		return 0
+	}
+
+	return c.maxPayload(k.aead)
+}
+
+// ReadFrom implements the net.PacketConn ReadFrom method. ReadFrom returns
+// the next message which is authenticated and not replayed, and the
+// *raw.Addr which sent it. If b is too small to hold the message, the message
+// is truncated and io.ErrShortBuffer is returned.
+func (c *Conn) ReadFrom(b []byte) (int, net.Addr, error) {
+	buf := make([]byte, frame.BufferSize(c.ifi))
+	for {
+		n, _, err := c.p.ReadFrom(buf)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		src, msg, ok := c.receive(buf[:n])
+		if !ok {
+			continue
+		}
+
+		n = copy(b, msg)
+		if n < len(msg) {
+			err = io.ErrShortBuffer
+		}
+
+		return n, &raw.Addr{HardwareAddr: src}, err
+	}
+}
+
+// WriteTo implements the net.PacketConn WriteTo method. addr must be a
+// *raw.Addr for which a key is set.
+func (c *Conn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	ra, ok := addr.(*raw.Addr)
+	if !ok || len(ra.HardwareAddr) != 6 {
+		return 0, fmt.Errorf("seal: invalid address: %v", addr)
+	}
+
+	c.mu.Lock()
+	k, ok := c.keys[ra.HardwareAddr.String()]
+	c.mu.Unlock()
+	if !ok {
+		return 0, fmt.Errorf("seal: no key for %s", ra.HardwareAddr)
+	}
+
+	if max := c.maxPayload(k.aead); len(b) > max {
+		return 0, fmt.Errorf("seal: message too long: %d bytes, maximum is %d", len(b), max)
+	}
+
+	f := &ethernet.Frame{
+		Destination: ra.HardwareAddr,
+		Source:      c.ifi.HardwareAddr,
+		EtherType:   c.etherType,
+	}
+
+	// Hold the lock until the frame is written so that frames are sent in
+	// counter order, and are not discarded as too old by the peer.
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	c.counter++
+	ns := k.aead.NonceSize()
+	f.Payload = seal(k.aead, c.salt[:ns-counterLen], c.counter, b, c.additionalData(f))
+
+	fb, err := f.MarshalBinary()
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := c.p.WriteTo(fb, ra); err != nil {
+		return 0, err
+	}
+
+	return len(b), nil
+}
+
+// Close closes the Conn's connection.
+func (c *Conn) Close() error {
+	return c.p.Close()
+}
+
+// LocalAddr returns the local network address.
+func (c *Conn) LocalAddr() net.Addr {
+	return c.p.LocalAddr()
+}
+
+// SetDeadline implements the net.PacketConn SetDeadline method.
+func (c *Conn) SetDeadline(t time.Time) error {
+	return c.p.SetDeadline(t)
+}
+
+// SetReadDeadline implements the net.PacketConn SetReadDeadline method.
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	return c.p.SetReadDeadline(t)
+}
+
+// SetWriteDeadline implements the net.PacketConn SetWriteDeadline method.
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	return c.p.SetWriteDeadline(t)
+}
+
+// Stats returns statistics about received frames.
+func (c *Conn) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.stats
+}
+
+// receive processes a received frame, and returns its source and message if
+// it is authentic and not replayed.
+func (c *Conn) receive(b []byte) (net.HardwareAddr, []byte, bool) {
+	var f ethernet.Frame
+	if err := f.UnmarshalBinary(b); err != nil {
+		return nil, nil, false
+	}
+
+	group := f.Destination[0]&0x01 != 0
+	ok := f.EtherType == c.etherType &&
+		len(f.Source) == 6 &&
+		f.Source[0]&0x01 == 0 &&
+		!bytes.Equal(f.Source, c.ifi.HardwareAddr) &&
+		(group || bytes.Equal(f.Destination, c.ifi.HardwareAddr))
+	if !ok {
+		return nil, nil, false
+	}
+
+	addr := f.Source
+	if group {
+		addr = f.Destination
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	k, ok := c.keys[addr.String()]
+	if !ok {
+		c.stats.NoKey++
+		return nil, nil, false
+	}
+
+	msg, counter, err := open(k.aead, f.Payload, c.additionalData(&f))
+	if err != nil {
+		c.stats.Invalid++
+		return nil, nil, false
+	}
+
+	// Only authentic messages may affect the replay window, or a forged
+	// message could advance it past genuine ones.
+	w, ok := k.windows[f.Source.String()]
+	if !ok {
+		w = newWindow(c.cfg.ReplayWindow)
+		k.windows[f.Source.String()] = w
+	}
+	if !w.Check(counter) {
+		c.stats.Replayed++
+		return nil, nil, false
+	}
+	w.Update(counter)
+
+	c.stats.Opened++
+	return append(net.HardwareAddr(nil), f.Source...), append([]byte(nil), msg...), true
+}
+
+// additionalData returns the data authenticated along with the payload of f:
+// its destination, source, and EtherType.
+func (c *Conn) additionalData(f *ethernet.Frame) []byte {
+	b := make([]byte, 14)
+	copy(b[0:6], f.Destination)
+	copy(b[6:12], f.Source)
+	binary.BigEndian.PutUint16(b[12:14], uint16(f.EtherType))
+	return b
+}
+
+// maxPayload returns the largest message which may be sealed with aead.
+func (c *Conn) maxPayload(aead cipher.AEAD) int {
+	mtu := c.ifi.MTU
+	if mtu <= 0 {
+		mtu = 1500
+	}
+
+	return mtu - 3 - aead.NonceSize() - aead.Overhead()
+}
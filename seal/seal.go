@@ -0,0 +1,188 @@
+// Package seal implements a net.PacketConn which authenticates and encrypts
+// messages sent over a user-chosen EtherType using an AEAD, for use where
+// MACsec is not available.
+//
+// Keys are configured per peer with Conn.SetKey. A frame sent to a unicast
+// address is sealed with the key of its destination, and a frame sent to a
+// group address is sealed with the key configured for that group address.
+// Received frames are opened with the key of their destination if it is a
+// group address, or of their source otherwise. Frames for which no key is
+// configured, or which fail authentication, are discarded.
+//
+// Each message carries its nonce: a random salt chosen when a Conn is created,
+// followed by a 64-bit counter which starts at the current time in
+// nanoseconds and increments with each message. Counters therefore increase
+// across restarts of a sender, which allows receivers to reject replayed
+// messages using a sliding window of counters per source. Replay state is
+// held in memory, so a receiver which restarts cannot detect a single replay
+// of each message sent before it started; rotate keys to bound this
+// exposure.
+//
+// The salt fills the part of the nonce before the counter: 32 bits for AEADs
+// with a 12 byte nonce such as AES-GCM and ChaCha20-Poly1305, and 128 bits for
+// XChaCha20-Poly1305. Conns which share a key, such as a group key, rely on
+// the salt alone to keep their nonces apart. If two of them choose the same
+// salt and one has sent more messages than there were nanoseconds between
+// their creation, a nonce is reused, which breaks both the confidentiality and
+// the authenticity of messages sealed with the key. With a 32-bit salt, the
+// chance of a shared salt among n Conns created over the lifetime of a key is
+// about n^2/2^33: roughly one in a million for 100 Conns. Use
+// XChaCha20-Poly1305 for keys shared by many senders, or give each sender a
+// key of its own.
+//
+// The Ethernet addresses and EtherType of each frame are authenticated along
+// with the message, so sealed messages cannot be redirected to other peers.
+package seal
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+const (
+	// version is the sealed message format version implemented by this
+	// package.
+	version = 1
+
+	// counterLen is the length of the counter at the end of each nonce.
+	counterLen = 8
+
+	// minNonceSize is the smallest AEAD nonce size supported, leaving room
+	// for a 32-bit salt before the counter.
+	minNonceSize = 12
+)
+
+// errInvalidMessage is returned when a sealed message is malformed.
+var errInvalidMessage = errors.New("seal: invalid message")
+
+// NewAESGCM creates an AES-GCM AEAD using key, which must be 16, 24, or 32
+// bytes long to select AES-128, AES-192, or AES-256.
+//
+// Other AEADs with a nonce size between 12 and 24 bytes may be used with a
+// Conn as well.
+func NewAESGCM(key []byte) (cipher.AEAD, error) {
+	b, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(b)
+}
+
+// NewChaCha20Poly1305 creates a ChaCha20-Poly1305 AEAD using key, which must
+// be 32 bytes long. ChaCha20-Poly1305 is faster than AES-GCM on hardware
+// without AES instructions.
+func NewChaCha20Poly1305(key []byte) (cipher.AEAD, error) {
+	return chacha20poly1305.New(key)
+}
+
+// NewXChaCha20Poly1305 creates an XChaCha20-Poly1305 AEAD using key, which
+// must be 32 bytes long. Its 24 byte nonce leaves room for a 128-bit salt, so
+// it is the best choice for group keys shared by many senders.
+func NewXChaCha20Poly1305(key []byte) (cipher.AEAD, error) {
+	return chacha20poly1305.NewX(key)
+}
+
+// seal seals plaintext using aead with the nonce formed from salt and
+// counter. The binary form is a version, the length of the sealed plaintext,
+// the nonce, and the sealed plaintext. ad is authenticated but not included.
+func seal(aead cipher.AEAD, salt []byte, counter uint64, plaintext, ad []byte) []byte {
+	ns := aead.NonceSize()
+	hl := 3 + ns
+
+	b := make([]byte, hl, hl+len(plaintext)+aead.Overhead())
+	b[0] = version
+	binary.BigEndian.PutUint16(b[1:3], uint16(len(plaintext)+aead.Overhead()))
+	nonce := b[3:hl]
+	copy(nonce, salt)
+	binary.BigEndian.PutUint64(nonce[ns-counterLen:], counter)
+
+	return aead.Seal(b, nonce, plaintext, ad)
+}
+
+// open authenticates and decrypts the sealed message b using aead and ad, and
+// returns its plaintext and counter. Any trailing Ethernet padding is ignored,
+// and the plaintext refers to b.
+func open(aead cipher.AEAD, b, ad []byte) ([]byte, uint64, error) {
+	ns := aead.NonceSize()
+	hl := 3 + ns
+	if len(b) < hl || b[0] != version {
+		return nil, 0, errInvalidMessage
+	}
+
+	l := int(binary.BigEndian.Uint16(b[1:3]))
+	if l < aead.Overhead() || len(b) < hl+l {
+		return nil, 0, errInvalidMessage
+	}
+
+	nonce := b[3:hl]
+	out, err := aead.Open(b[hl:hl], nonce, b[hl:hl+l], ad)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return out, binary.BigEndian.Uint64(nonce[ns-counterLen:]), nil
+}
+
+// A window is a sliding window of recently received counters, used to detect
+// replayed messages.
+type window struct {
+	// init reports whether any counter has been received.
+	init bool
+	top  uint64
+	// bits is a ring of size bits, where the bit for counter n is at
+	// position n % size.
+	bits []uint64
+	size uint64
+}
+
+// newWindow creates a window which tracks size counters. size must be a
+// positive multiple of 64.
+func newWindow(size int) *window {
+	return &window{
+		bits: make([]uint64, size/64),
+		size: uint64(size),
+	}
+}
+
+// Check reports whether counter n has not been received, and is not too old
+// to tell.
+func (w *window) Check(n uint64) bool {
+	switch {
+	case !w.init, n > w.top:
+		return true
+	case w.top-n >= w.size:
+		return false
+	default:
+		i := n % w.size
+		return w.bits[i/64]&(1<<(i%64)) == 0
+	}
+}
+
+// Update records the receipt of counter n, which must have passed Check.
+func (w *window) Update(n uint64) {
+	switch {
+	case !w.init:
+		w.init = true
+		w.top = n
+	case n > w.top:
+		if n-w.top >= w.size {
+			for i := range w.bits {
+				w.bits[i] = 0
+			}
+		} else {
+			for c := w.top + 1; c <= n; c++ {
+				i := c % w.size
+				w.bits[i/64] &^= 1 << (i % 64)
+			}
+		}
+		w.top = n
+	}
+
+	i := n % w.size
+	w.bits[i/64] |= 1 << (i % 64)
+}
@@ -0,0 +1,336 @@
+package seal_test
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/raw"
+	"github.com/mdlayher/raw/ethernet"
+	"github.com/mdlayher/raw/internal/rawtest"
+	"github.com/mdlayher/raw/seal"
+)
+
+const etherType ethernet.EtherType = 0x88b8
+
+var (
+	macA  = net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	macB  = net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x02}
+	macC  = net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x03}
+	group = net.HardwareAddr{0x01, 0x00, 0x5e, 0x00, 0x00, 0x01}
+
+	keyAB = bytes.Repeat([]byte{0xab}, 32)
+	keyAC = bytes.Repeat([]byte{0xac}, 32)
+	keyG  = bytes.Repeat([]byte{0x99}, 16)
+)
+
+func TestConnRoundTrip(t *testing.T) {
+	hub := rawtest.NewHub()
+	a := testConn(t, hub.Conn(macA), macA, nil)
+	b := testConn(t, hub.Conn(macB), macB, nil)
+	c := testConn(t, hub.Conn(macC), macC, nil)
+
+	setKey(t, a, macB, keyAB)
+	setKey(t, b, macA, keyAB)
+	setKey(t, a, macC, keyAC)
+	setKey(t, c, macA, keyAC)
+	for _, conn := range []*seal.Conn{a, b, c} {
+		setKey(t, conn, group, keyG)
+	}
+
+	tests := []struct {
+		name string
+		dst  net.HardwareAddr
+		msg  []byte
+		to   []*seal.Conn
+	}{
+		{name: "empty", dst: macB, msg: []byte{}, to: []*seal.Conn{b}},
+		{name: "short", dst: macB, msg: []byte("hello"), to: []*seal.Conn{b}},
+		{name: "max", dst: macC, msg: bytes.Repeat([]byte{0x01}, a.MaxPayload(macC)), to: []*seal.Conn{c}},
+		{name: "group", dst: group, msg: []byte("everyone"), to: []*seal.Conn{b, c}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := a.WriteTo(tt.msg, &raw.Addr{HardwareAddr: tt.dst}); err != nil {
+				t.Fatalf("failed to write: %v", err)
+			}
+
+			for _, conn := range tt.to {
+				got, addr := rawtest.ReadMessage(t, conn)
+				if diff := cmp.Diff(tt.msg, got); diff != "" {
+					t.Fatalf("unexpected message (-want +got):\n%s", diff)
+				}
+				if diff := cmp.Diff(macA, addr.(*raw.Addr).HardwareAddr); diff != "" {
+					t.Fatalf("unexpected source (-want +got):\n%s", diff)
+				}
+			}
+		})
+	}
+}
+
+func TestConnAEADs(t *testing.T) {
+	tests := []struct {
+		name string
+		fn   func(key []byte) (cipher.AEAD, error)
+		key  []byte
+	}{
+		{name: "AES-128-GCM", fn: seal.NewAESGCM, key: keyG},
+		{name: "AES-256-GCM", fn: seal.NewAESGCM, key: keyAB},
+		{name: "ChaCha20-Poly1305", fn: seal.NewChaCha20Poly1305, key: keyAB},
+		{name: "XChaCha20-Poly1305", fn: seal.NewXChaCha20Poly1305, key: keyAB},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.fn(keyAB[:15]); err == nil {
+				t.Fatal("expected an invalid key error, but none occurred")
+			}
+
+			hub := rawtest.NewHub()
+			a := testConn(t, hub.Conn(macA), macA, nil)
+			b := testConn(t, hub.Conn(macB), macB, nil)
+
+			for _, c := range []struct {
+				conn *seal.Conn
+				peer net.HardwareAddr
+			}{{a, macB}, {b, macA}} {
+				aead, err := tt.fn(tt.key)
+				if err != nil {
+					t.Fatalf("failed to create AEAD: %v", err)
+				}
+				if err := c.conn.SetKey(c.peer, aead); err != nil {
+					t.Fatalf("failed to set key: %v", err)
+				}
+			}
+
+			msg := bytes.Repeat([]byte{0x01}, a.MaxPayload(macB))
+			if _, err := a.WriteTo(msg, &raw.Addr{HardwareAddr: macB}); err != nil {
+				t.Fatalf("failed to write: %v", err)
+			}
+
+			got, _ := rawtest.ReadMessage(t, b)
+			if diff := cmp.Diff(msg, got); diff != "" {
+				t.Fatalf("unexpected message (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestConnWriteErrors(t *testing.T) {
+	a := testConn(t, rawtest.NewHub().Conn(macA), macA, nil)
+	setKey(t, a, macB, keyAB)
+
+	if _, err := a.WriteTo([]byte("hello"), &raw.Addr{HardwareAddr: macC}); err == nil {
+		t.Fatal("expected an error writing without a key, but none occurred")
+	}
+
+	long := make([]byte, a.MaxPayload(macB)+1)
+	if _, err := a.WriteTo(long, &raw.Addr{HardwareAddr: macB}); err == nil {
+		t.Fatal("expected an error writing a long message, but none occurred")
+	}
+}
+
+func TestConnDiscard(t *testing.T) {
+	tests := []struct {
+		name  string
+		key   []byte
+		frame func(b []byte) []byte
+		stats seal.Stats
+	}{
+		{
+			name:  "wrong key",
+			key:   keyAC,
+			frame: func(b []byte) []byte { return b },
+			stats: seal.Stats{Invalid: 1},
+		},
+		{
+			name:  "no key",
+			frame: func(b []byte) []byte { return b },
+			stats: seal.Stats{NoKey: 1},
+		},
+		{
+			name: "tampered",
+			key:  keyAB,
+			frame: func(b []byte) []byte {
+				// Flip a bit of the ciphertext, which follows the Ethernet
+				// header, the sealed message header, and the nonce.
+				b[14+3+12] ^= 0x01
+				return b
+			},
+			stats: seal.Stats{Invalid: 1},
+		},
+		{
+			name: "redirected",
+			key:  keyAB,
+			frame: func(b []byte) []byte {
+				// Claim to be from C, although the message was sealed by A
+				// with the key B shares with C.
+				copy(b[6:12], macC)
+				return b
+			},
+			stats: seal.Stats{Invalid: 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frames := sealFrames(t, 1, []byte("hello"))
+
+			hub := rawtest.NewHub()
+			inject := hub.Conn(macA)
+			b := testConn(t, hub.Conn(macB), macB, nil)
+			switch tt.name {
+			case "redirected":
+				setKey(t, b, macC, tt.key)
+			case "no key":
+			default:
+				setKey(t, b, macA, tt.key)
+			}
+
+			rawtest.WriteFrames(t, inject, tt.frame(frames[0]))
+
+			if _, err := rawtest.Read(b, 20*time.Millisecond); !errors.Is(err, os.ErrDeadlineExceeded) {
+				t.Fatalf("expected deadline exceeded, but got: %v", err)
+			}
+			if diff := cmp.Diff(tt.stats, b.Stats()); diff != "" {
+				t.Fatalf("unexpected stats (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestConnReplay(t *testing.T) {
+	frames := sealFrames(t, 66, []byte("hello"))
+
+	hub := rawtest.NewHub()
+	inject := hub.Conn(macA)
+	b := testConn(t, hub.Conn(macB), macB, &seal.Config{ReplayWindow: 64})
+	setKey(t, b, macA, keyAB)
+
+	// Reordering within the window is accepted, and every message is
+	// accepted only once.
+	rawtest.WriteFrames(t, inject, frames[3], frames[1], frames[2], frames[1], frames[3])
+	for i := 0; i < 3; i++ {
+		rawtest.ReadMessage(t, b)
+	}
+	if _, err := rawtest.Read(b, 20*time.Millisecond); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, but got: %v", err)
+	}
+
+	// Messages which fall behind the window are discarded, even if they were
+	// never received.
+	rawtest.WriteFrames(t, inject, frames[65], frames[0], frames[2], frames[1])
+	rawtest.ReadMessage(t, b)
+	if _, err := rawtest.Read(b, 20*time.Millisecond); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, but got: %v", err)
+	}
+
+	want := seal.Stats{Opened: 4, Replayed: 5}
+	if diff := cmp.Diff(want, b.Stats()); diff != "" {
+		t.Fatalf("unexpected stats (-want +got):\n%s", diff)
+	}
+}
+
+func TestConnShortBuffer(t *testing.T) {
+	hub := rawtest.NewHub()
+	a := testConn(t, hub.Conn(macA), macA, nil)
+	b := testConn(t, hub.Conn(macB), macB, nil)
+	setKey(t, a, macB, keyAB)
+	setKey(t, b, macA, keyAB)
+
+	if _, err := a.WriteTo([]byte("hello world"), &raw.Addr{HardwareAddr: macB}); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+
+	buf := make([]byte, 5)
+	n, _, err := b.ReadFrom(buf)
+	if !errors.Is(err, io.ErrShortBuffer) {
+		t.Fatalf("expected io.ErrShortBuffer, but got: %v", err)
+	}
+	if diff := cmp.Diff("hello", string(buf[:n])); diff != "" {
+		t.Fatalf("unexpected message (-want +got):\n%s", diff)
+	}
+}
+
+func TestConnSetKeyInvalid(t *testing.T) {
+	a := testConn(t, rawtest.NewHub().Conn(macA), macA, nil)
+
+	if err := a.SetKey(net.HardwareAddr{0x00}, mustAESGCM(t, keyAB)); err == nil {
+		t.Fatal("expected an error for an invalid address, but none occurred")
+	}
+	if err := a.SetKey(macB, shortNonce{mustAESGCM(t, keyAB)}); err == nil {
+		t.Fatal("expected an error for a short nonce, but none occurred")
+	}
+
+	// Removing a key makes the peer unreachable.
+	setKey(t, a, macB, keyAB)
+	if err := a.SetKey(macB, nil); err != nil {
+		t.Fatalf("failed to remove key: %v", err)
+	}
+	if diff := cmp.Diff(0, a.MaxPayload(macB)); diff != "" {
+		t.Fatalf("unexpected maximum payload (-want +got):\n%s", diff)
+	}
+}
+
+func testConn(t *testing.T, p net.PacketConn, mac net.HardwareAddr, cfg *seal.Config) *seal.Conn {
+	t.Helper()
+
+	c, err := seal.New(&net.Interface{MTU: 1500, HardwareAddr: mac}, p, etherType, cfg)
+	if err != nil {
+		t.Fatalf("failed to create conn: %v", err)
+	}
+	t.Cleanup(func() { _ = c.Close() })
+
+	return c
+}
+
+func setKey(t *testing.T, c *seal.Conn, addr net.HardwareAddr, key []byte) {
+	t.Helper()
+
+	if err := c.SetKey(addr, mustAESGCM(t, key)); err != nil {
+		t.Fatalf("failed to set key: %v", err)
+	}
+}
+
+func mustAESGCM(t *testing.T, key []byte) cipher.AEAD {
+	t.Helper()
+
+	aead, err := seal.NewAESGCM(key)
+	if err != nil {
+		t.Fatalf("failed to create AEAD: %v", err)
+	}
+
+	return aead
+}
+
+// sealFrames returns n frames sealed by A for B, each carrying msg.
+func sealFrames(t *testing.T, n int, msg []byte) [][]byte {
+	t.Helper()
+
+	p := rawtest.NewHub().Conn(macA)
+	a := testConn(t, p, macA, nil)
+	setKey(t, a, macB, keyAB)
+
+	for i := 0; i < n; i++ {
+		if _, err := a.WriteTo(msg, &raw.Addr{HardwareAddr: macB}); err != nil {
+			t.Fatalf("failed to write: %v", err)
+		}
+	}
+
+	return p.Written()
+}
+
+// A shortNonce is a cipher.AEAD which reports a nonce size too small for a
+// Conn.
+type shortNonce struct {
+	cipher.AEAD
+}
+
+func (shortNonce) NonceSize() int { return 8 }
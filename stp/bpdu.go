@@ -0,0 +1,367 @@
+// Package stp implements decoding of IEEE 802.1D Spanning Tree Protocol,
+// IEEE 802.1w Rapid Spanning Tree Protocol, and IEEE 802.1s Multiple Spanning
+// Tree Protocol bridge protocol data units, and a Monitor which reports root
+// bridge changes and topology changes observed on a *raw.Conn.
+package stp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// GroupAddr is the multicast address to which bridges send BPDUs.
+var GroupAddr = net.HardwareAddr{0x01, 0x80, 0xc2, 0x00, 0x00, 0x00}
+
+var (
+	// errInvalidProtocol is returned when a BPDU has an unknown protocol
+	// identifier.
+	errInvalidProtocol = errors.New("stp: invalid protocol identifier")
+)
+
+const (
+	// Lengths of the BPDU types.
+	tcnLen    = 4
+	configLen = 35
+	rstLen    = 36
+	mstLen    = rstLen + 2 + mstConfigIDLen + 4 + bridgeIDLen + 1
+
+	bridgeIDLen    = 8
+	mstConfigIDLen = 1 + 32 + 2 + 16
+	mstiLen        = 16
+)
+
+// A Version is the protocol version of a BPDU.
+type Version uint8
+
+// Version values for the spanning tree protocols.
+const (
+	VersionSTP  Version = 0
+	VersionRSTP Version = 2
+	VersionMSTP Version = 3
+)
+
+// String returns the name of a Version.
+func (v Version) String() string {
+	switch v {
+	case VersionSTP:
+		return "STP"
+	case VersionRSTP:
+		return "RSTP"
+	case VersionMSTP:
+		return "MSTP"
+	default:
+		return fmt.Sprintf("unknown(%d)", uint8(v))
+	}
+}
+
+// A Type is the type of a BPDU.
+type Type uint8
+
+// Type values for the BPDUs supported by this package.
+const (
+	TypeConfig Type = 0x00
+	TypeRST    Type = 0x02
+	TypeTCN    Type = 0x80
+)
+
+// String returns the name of a Type.
+func (t Type) String() string {
+	switch t {
+	case TypeConfig:
+		return "configuration"
+	case TypeRST:
+		return "RST"
+	case TypeTCN:
+		return "topology change notification"
+	default:
+		return fmt.Sprintf("unknown(%#02x)", uint8(t))
+	}
+}
+
+// Flags are the flags carried in a BPDU.
+type Flags uint8
+
+// Flags values. The port role and the flags other than TopologyChange and
+// TopologyChangeAck are only used by RSTP and MSTP.
+const (
+	FlagTopologyChange    Flags = 1 << 0
+	FlagProposal          Flags = 1 << 1
+	FlagLearning          Flags = 1 << 4
+	FlagForwarding        Flags = 1 << 5
+	FlagAgreement         Flags = 1 << 6
+	FlagTopologyChangeAck Flags = 1 << 7
+)
+
+// A PortRole is the role of the port which sent a BPDU.
+type PortRole uint8
+
+// PortRole values encoded in Flags.
+const (
+	PortRoleUnknown PortRole = iota
+	PortRoleAlternateBackup
+	PortRoleRoot
+	PortRoleDesignated
+)
+
+// Role returns the port role encoded in f.
+func (f Flags) Role() PortRole {
+	return PortRole(f>>2) & 0x3
+}
+
+// WithRole returns f with the port role set to r.
+func (f Flags) WithRole(r PortRole) Flags {
+	return f&^(0x3<<2) | Flags(r&0x3)<<2
+}
+
+// A BridgeID identifies a bridge by its priority and hardware address.
+type BridgeID struct {
+	// Priority is a multiple of 4096.
+	Priority uint16
+
+	// SystemIDExtension is usually the VLAN or MST instance, a 12-bit
+	// value.
+	SystemIDExtension uint16
+
+	Addr net.HardwareAddr
+}
+
+// String returns the conventional form of a BridgeID, the combined priority
+// and system ID extension followed by the hardware address.
+func (id BridgeID) String() string {
+	return fmt.Sprintf("%d.%s", id.Priority+id.SystemIDExtension, id.Addr)
+}
+
+// Equal reports whether id and x identify the same bridge.
+func (id BridgeID) Equal(x BridgeID) bool {
+	return id.Priority == x.Priority &&
+		id.SystemIDExtension == x.SystemIDExtension &&
+		bytes.Equal(id.Addr, x.Addr)
+}
+
+func (id BridgeID) marshal(b []byte) {
+	binary.BigEndian.PutUint16(b[0:2], id.Priority&0xf000|id.SystemIDExtension&0x0fff)
+	copy(b[2:8], id.Addr)
+}
+
+func parseBridgeID(b []byte) BridgeID {
+	v := binary.BigEndian.Uint16(b[0:2])
+	addr := make(net.HardwareAddr, 6)
+	copy(addr, b[2:8])
+
+	return BridgeID{
+		Priority:          v & 0xf000,
+		SystemIDExtension: v & 0x0fff,
+		Addr:              addr,
+	}
+}
+
+// A BPDU is a spanning tree bridge protocol data unit.
+type BPDU struct {
+	Version Version
+	Type    Type
+
+	// The remaining fields are not present in topology change
+	// notifications.
+	Flags        Flags
+	RootID       BridgeID
+	RootPathCost uint32
+	BridgeID     BridgeID
+	PortID       uint16
+
+	// Timers, encoded with a resolution of 1/256 second.
+	MessageAge   time.Duration
+	MaxAge       time.Duration
+	HelloTime    time.Duration
+	ForwardDelay time.Duration
+
+	// MST is present only in MSTP BPDUs.
+	MST *MST
+}
+
+// An MST contains the fields specific to MSTP BPDUs.
+type MST struct {
+	ConfigID                 MSTConfigID
+	CISTInternalRootPathCost uint32
+	CISTBridgeID             BridgeID
+	CISTRemainingHops        uint8
+	MSTIs                    []MSTI
+}
+
+// An MSTConfigID identifies an MST region.
+type MSTConfigID struct {
+	FormatSelector uint8
+	Name           string
+	Revision       uint16
+	Digest         [16]byte
+}
+
+// An MSTI is the configuration message for a single MST instance.
+type MSTI struct {
+	Flags                Flags
+	RegionalRootID       BridgeID
+	InternalRootPathCost uint32
+	BridgePriority       uint8
+	PortPriority         uint8
+	RemainingHops        uint8
+}
+
+// TopologyChange reports whether the BPDU signals a topology change, either
+// as a topology change notification or with the topology change flag set.
+func (b *BPDU) TopologyChange() bool {
+	return b.Type == TypeTCN || b.Flags&FlagTopologyChange != 0
+}
+
+// MarshalBinary allocates a byte slice and marshals a BPDU into binary form.
+func (b *BPDU) MarshalBinary() ([]byte, error) {
+	switch {
+	case b.Type == TypeTCN:
+		return []byte{0, 0, uint8(b.Version), uint8(b.Type)}, nil
+	case b.Type == TypeConfig && b.MST == nil:
+	case b.Type == TypeRST && b.Version == VersionRSTP && b.MST == nil:
+	case b.Type == TypeRST && b.Version == VersionMSTP && b.MST != nil:
+	default:
+		return nil, fmt.Errorf("stp: invalid combination of version %s and type %s", b.Version, b.Type)
+	}
+
+	n := configLen
+	if b.Type == TypeRST {
+		n = rstLen
+	}
+	if b.MST != nil {
+		if len(b.MST.ConfigID.Name) > 32 {
+			return nil, errors.New("stp: MST configuration name too long")
+		}
+
+		n = mstLen + mstiLen*len(b.MST.MSTIs)
+	}
+
+	out := make([]byte, n)
+	out[2] = uint8(b.Version)
+	out[3] = uint8(b.Type)
+	out[4] = uint8(b.Flags)
+	b.RootID.marshal(out[5:13])
+	binary.BigEndian.PutUint32(out[13:17], b.RootPathCost)
+	b.BridgeID.marshal(out[17:25])
+	binary.BigEndian.PutUint16(out[25:27], b.PortID)
+
+	timers := []time.Duration{b.MessageAge, b.MaxAge, b.HelloTime, b.ForwardDelay}
+	for i, t := range timers {
+		binary.BigEndian.PutUint16(out[27+2*i:29+2*i], uint16(t*256/time.Second))
+	}
+
+	// The version 1 length at offset 35 is always zero.
+	if b.MST == nil {
+		return out, nil
+	}
+
+	m := b.MST
+	binary.BigEndian.PutUint16(out[36:38], uint16(n-38))
+	out[38] = m.ConfigID.FormatSelector
+	copy(out[39:71], m.ConfigID.Name)
+	binary.BigEndian.PutUint16(out[71:73], m.ConfigID.Revision)
+	copy(out[73:89], m.ConfigID.Digest[:])
+	binary.BigEndian.PutUint32(out[89:93], m.CISTInternalRootPathCost)
+	m.CISTBridgeID.marshal(out[93:101])
+	out[101] = m.CISTRemainingHops
+
+	for i, msti := range m.MSTIs {
+		mb := out[mstLen+mstiLen*i:]
+		mb[0] = uint8(msti.Flags)
+		msti.RegionalRootID.marshal(mb[1:9])
+		binary.BigEndian.PutUint32(mb[9:13], msti.InternalRootPathCost)
+		mb[13] = msti.BridgePriority
+		mb[14] = msti.PortPriority
+		mb[15] = msti.RemainingHops
+	}
+
+	return out, nil
+}
+
+// UnmarshalBinary unmarshals a byte slice into a BPDU. Any trailing Ethernet
+// padding is ignored.
+func (b *BPDU) UnmarshalBinary(in []byte) error {
+	if len(in) < tcnLen {
+		return io.ErrUnexpectedEOF
+	}
+	if binary.BigEndian.Uint16(in[0:2]) != 0 {
+		return errInvalidProtocol
+	}
+
+	*b = BPDU{
+		Version: Version(in[2]),
+		Type:    Type(in[3]),
+	}
+
+	switch b.Type {
+	case TypeTCN:
+		return nil
+	case TypeConfig:
+		if len(in) < configLen {
+			return io.ErrUnexpectedEOF
+		}
+	case TypeRST:
+		if len(in) < rstLen {
+			return io.ErrUnexpectedEOF
+		}
+	default:
+		return fmt.Errorf("stp: unsupported BPDU type: %s", b.Type)
+	}
+
+	b.Flags = Flags(in[4])
+	b.RootID = parseBridgeID(in[5:13])
+	b.RootPathCost = binary.BigEndian.Uint32(in[13:17])
+	b.BridgeID = parseBridgeID(in[17:25])
+	b.PortID = binary.BigEndian.Uint16(in[25:27])
+
+	timers := []*time.Duration{&b.MessageAge, &b.MaxAge, &b.HelloTime, &b.ForwardDelay}
+	for i, t := range timers {
+		*t = time.Duration(binary.BigEndian.Uint16(in[27+2*i:29+2*i])) * time.Second / 256
+	}
+
+	if b.Type != TypeRST || b.Version < VersionMSTP {
+		return nil
+	}
+
+	// Treat MSTP BPDUs which are too short to carry the MST fields as RSTP,
+	// as IEEE 802.1Q requires.
+	if len(in) < mstLen {
+		return nil
+	}
+
+	v3 := int(binary.BigEndian.Uint16(in[36:38]))
+	if v3 < mstLen-38 || (v3-(mstLen-38))%mstiLen != 0 || len(in) < 38+v3 {
+		return errors.New("stp: invalid MST BPDU length")
+	}
+
+	m := &MST{
+		ConfigID: MSTConfigID{
+			FormatSelector: in[38],
+			Name:           string(bytes.TrimRight(in[39:71], "\x00")),
+			Revision:       binary.BigEndian.Uint16(in[71:73]),
+		},
+		CISTInternalRootPathCost: binary.BigEndian.Uint32(in[89:93]),
+		CISTBridgeID:             parseBridgeID(in[93:101]),
+		CISTRemainingHops:        in[101],
+	}
+	copy(m.ConfigID.Digest[:], in[73:89])
+
+	for off := mstLen; off < 38+v3; off += mstiLen {
+		mb := in[off : off+mstiLen]
+		m.MSTIs = append(m.MSTIs, MSTI{
+			Flags:                Flags(mb[0]),
+			RegionalRootID:       parseBridgeID(mb[1:9]),
+			InternalRootPathCost: binary.BigEndian.Uint32(mb[9:13]),
+			BridgePriority:       mb[13],
+			PortPriority:         mb[14],
+			RemainingHops:        mb[15],
+		})
+	}
+
+	b.MST = m
+	return nil
+}
@@ -0,0 +1,234 @@
+package stp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/mdlayher/raw"
+	"github.com/mdlayher/raw/ethernet"
+	"github.com/mdlayher/raw/internal/frame"
+	"github.com/mdlayher/raw/llc"
+)
+
+// errNotBPDU is returned when a frame does not carry a BPDU.
+var errNotBPDU = errors.New("stp: not a BPDU")
+
+// An EventType is the type of an Event reported by a Monitor.
+type EventType int
+
+// EventType values.
+const (
+	// EventRootChanged indicates that the root bridge changed, or was
+	// observed for the first time.
+	EventRootChanged EventType = iota
+
+	// EventTopologyChange indicates that a bridge began signaling a
+	// topology change.
+	EventTopologyChange
+)
+
+// String returns the name of an EventType.
+func (e EventType) String() string {
+	switch e {
+	case EventRootChanged:
+		return "root changed"
+	case EventTopologyChange:
+		return "topology change"
+	default:
+		return fmt.Sprintf("unknown(%d)", int(e))
+	}
+}
+
+// An Event is a change in the spanning tree observed by a Monitor.
+type Event struct {
+	Type EventType
+	Time time.Time
+
+	// Source is the hardware address which sent BPDU.
+	Source net.HardwareAddr
+	BPDU   *BPDU
+
+	// PreviousRoot is the root bridge before an EventRootChanged, or nil if
+	// no root had been observed.
+	PreviousRoot *BridgeID
+}
+
+// A Status summarizes the spanning tree observed by a Monitor.
+type Status struct {
+	// Root is the current root bridge. Root is the zero value until a
+	// configuration or RST BPDU is observed.
+	Root BridgeID
+
+	// BPDUs is the number of BPDUs received.
+	BPDUs int
+
+	// RootChanges counts changes of the root bridge after the first was
+	// observed.
+	RootChanges int
+
+	// TopologyChanges counts topology change notifications and the start of
+	// each period in which a bridge set the topology change flag.
+	TopologyChanges int
+
+	// LastBPDU and LastTopologyChange are the times at which the most recent
+	// BPDU and topology change were observed.
+	LastBPDU           time.Time
+	LastTopologyChange time.Time
+}
+
+// A Monitor passively observes BPDUs to detect spanning tree instability.
+type Monitor struct {
+	ifi *net.Interface
+	p   net.PacketConn
+
+	mu       sync.Mutex
+	status   Status
+	haveRoot bool
+
+	// tc tracks which bridges are currently setting the topology change flag.
+	tc map[string]bool
+}
+
+// Dial creates a new Monitor using the specified network interface. Dial
+// opens a *raw.Conn which receives IEEE 802.3 frames carrying an LLC header,
+// and enables promiscuous mode so that frames sent to GroupAddr are
+// delivered.
+func Dial(ifi *net.Interface) (*Monitor, error) {
+	c, err := raw.ListenPacket(ifi, raw.ProtocolLLC, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.SetPromiscuous(true); err != nil {
+		_ = c.Close()
+		return nil, err
+	}
+
+	return New(ifi, c), nil
+}
+
+// New creates a new Monitor using the specified network interface and
+// net.PacketConn. p must receive complete Ethernet frames.
+func New(ifi *net.Interface, p net.PacketConn) *Monitor {
+	return &Monitor{
+		ifi: ifi,
+		p:   p,
+		tc:  make(map[string]bool),
+	}
+}
+
+// Close closes the Monitor's connection.
+func (m *Monitor) Close() error {
+	return m.p.Close()
+}
+
+// Status returns a summary of the spanning tree observed so far.
+func (m *Monitor) Status() Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.status
+}
+
+// Run receives BPDUs until ctx is canceled or an error occurs, calling fn
+// for each Event if fn is not nil. Run returns nil when ctx is canceled.
+func (m *Monitor) Run(ctx context.Context, fn func(Event)) error {
+	defer frame.CancelReads(ctx, m.p)()
+
+	b := make([]byte, frame.BufferSize(m.ifi))
+	for {
+		n, _, err := m.p.ReadFrom(b)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			return err
+		}
+
+		f, bpdu, err := parseFrame(b[:n])
+		if err != nil {
+			continue
+		}
+
+		events := m.observe(f.Source, bpdu, time.Now())
+		if fn == nil {
+			continue
+		}
+		for _, e := range events {
+			fn(e)
+		}
+	}
+}
+
+// observe updates the Monitor's status with a BPDU received from src at now
+// and returns any resulting events.
+func (m *Monitor) observe(src net.HardwareAddr, b *BPDU, now time.Time) []Event {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	src = append(net.HardwareAddr(nil), src...)
+	newEvent := func(t EventType) Event {
+		return Event{Type: t, Time: now, Source: src, BPDU: b}
+	}
+
+	s := &m.status
+	s.BPDUs++
+	s.LastBPDU = now
+
+	var events []Event
+	if b.Type != TypeTCN && (!m.haveRoot || !s.Root.Equal(b.RootID)) {
+		e := newEvent(EventRootChanged)
+		if m.haveRoot {
+			prev := s.Root
+			e.PreviousRoot = &prev
+			s.RootChanges++
+		}
+
+		m.haveRoot = true
+		s.Root = b.RootID
+		events = append(events, e)
+	}
+
+	// Notifications are counted individually, but the topology change flag
+	// is set in every BPDU for a period, so only count when it is first set.
+	key := src.String()
+	tc := b.TopologyChange()
+	if b.Type == TypeTCN || (tc && !m.tc[key]) {
+		s.TopologyChanges++
+		s.LastTopologyChange = now
+		events = append(events, newEvent(EventTopologyChange))
+	}
+	if b.Type != TypeTCN {
+		m.tc[key] = tc
+	}
+
+	return events
+}
+
+// parseFrame parses a BPDU from an IEEE 802.3 frame with an LLC header.
+func parseFrame(b []byte) (*ethernet.Frame, *BPDU, error) {
+	var f ethernet.Frame
+	if err := f.UnmarshalBinary(b); err != nil {
+		return nil, nil, err
+	}
+
+	p, err := llc.ParseFrame(&f)
+	if err != nil {
+		return nil, nil, err
+	}
+	if p.DSAP != llc.SAPSTP || p.SSAP != llc.SAPSTP || p.Control != llc.ControlUI {
+		return nil, nil, errNotBPDU
+	}
+
+	bpdu := new(BPDU)
+	if err := bpdu.UnmarshalBinary(p.Payload); err != nil {
+		return nil, nil, err
+	}
+
+	return &f, bpdu, nil
+}
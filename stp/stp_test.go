@@ -0,0 +1,341 @@
+package stp_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/raw"
+	"github.com/mdlayher/raw/internal/rawtest"
+	"github.com/mdlayher/raw/llc"
+	"github.com/mdlayher/raw/stp"
+)
+
+var (
+	bridgeA = stp.BridgeID{
+		Priority:          32768,
+		SystemIDExtension: 1,
+		Addr:              net.HardwareAddr{0x00, 0x00, 0x5e, 0x00, 0x53, 0x01},
+	}
+	bridgeB = stp.BridgeID{
+		Priority: 4096,
+		Addr:     net.HardwareAddr{0x00, 0x00, 0x5e, 0x00, 0x53, 0x02},
+	}
+)
+
+func TestBPDUUnmarshalConfig(t *testing.T) {
+	b := []byte{
+		// Protocol, version, type, flags.
+		0x00, 0x00, 0x00, 0x00, 0x01,
+		// Root ID.
+		0x80, 0x01, 0x00, 0x00, 0x5e, 0x00, 0x53, 0x01,
+		// Root path cost.
+		0x00, 0x00, 0x00, 0x04,
+		// Bridge ID.
+		0x80, 0x01, 0x00, 0x00, 0x5e, 0x00, 0x53, 0x01,
+		// Port ID.
+		0x80, 0x02,
+		// Message age, max age, hello time, forward delay.
+		0x01, 0x00, 0x14, 0x00, 0x02, 0x00, 0x0f, 0x00,
+		// Ethernet padding.
+		0x00, 0x00, 0x00, 0x00,
+	}
+
+	var got stp.BPDU
+	if err := got.UnmarshalBinary(b); err != nil {
+		t.Fatalf("failed to unmarshal: %v", err)
+	}
+
+	want := stp.BPDU{
+		Version:      stp.VersionSTP,
+		Type:         stp.TypeConfig,
+		Flags:        stp.FlagTopologyChange,
+		RootID:       bridgeA,
+		RootPathCost: 4,
+		BridgeID:     bridgeA,
+		PortID:       0x8002,
+		MessageAge:   1 * time.Second,
+		MaxAge:       20 * time.Second,
+		HelloTime:    2 * time.Second,
+		ForwardDelay: 15 * time.Second,
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected BPDU (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff("32769.00:00:5e:00:53:01", got.RootID.String()); diff != "" {
+		t.Fatalf("unexpected root ID (-want +got):\n%s", diff)
+	}
+}
+
+func TestBPDUMarshalUnmarshal(t *testing.T) {
+	timers := func(b stp.BPDU) *stp.BPDU {
+		b.RootID = bridgeB
+		b.BridgeID = bridgeA
+		b.RootPathCost = 20000
+		b.PortID = 0x8001
+		b.MaxAge = 20 * time.Second
+		b.HelloTime = 2 * time.Second
+		b.ForwardDelay = 15 * time.Second
+		return &b
+	}
+
+	tests := []struct {
+		name string
+		b    *stp.BPDU
+	}{
+		{
+			name: "TCN",
+			b:    &stp.BPDU{Version: stp.VersionSTP, Type: stp.TypeTCN},
+		},
+		{
+			name: "config",
+			b:    timers(stp.BPDU{Version: stp.VersionSTP, Type: stp.TypeConfig}),
+		},
+		{
+			name: "RST",
+			b: timers(stp.BPDU{
+				Version: stp.VersionRSTP,
+				Type:    stp.TypeRST,
+				Flags:   stp.FlagForwarding | stp.FlagLearning | stp.Flags(0).WithRole(stp.PortRoleDesignated),
+			}),
+		},
+		{
+			name: "MST",
+			b: timers(stp.BPDU{
+				Version: stp.VersionMSTP,
+				Type:    stp.TypeRST,
+				MST: &stp.MST{
+					ConfigID: stp.MSTConfigID{
+						Name:     "region1",
+						Revision: 1,
+						Digest:   [16]byte{0xac, 0x36},
+					},
+					CISTInternalRootPathCost: 2000,
+					CISTBridgeID:             bridgeA,
+					CISTRemainingHops:        20,
+					MSTIs: []stp.MSTI{{
+						Flags:                stp.FlagAgreement,
+						RegionalRootID:       bridgeB,
+						InternalRootPathCost: 200,
+						BridgePriority:       0x80,
+						PortPriority:         0x80,
+						RemainingHops:        19,
+					}},
+				},
+			}),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := tt.b.MarshalBinary()
+			if err != nil {
+				t.Fatalf("failed to marshal: %v", err)
+			}
+
+			var got stp.BPDU
+			if err := got.UnmarshalBinary(b); err != nil {
+				t.Fatalf("failed to unmarshal: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.b, &got); diff != "" {
+				t.Fatalf("unexpected BPDU (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestFlagsRole(t *testing.T) {
+	f := stp.FlagTopologyChange.WithRole(stp.PortRoleRoot)
+	if diff := cmp.Diff(stp.PortRoleRoot, f.Role()); diff != "" {
+		t.Fatalf("unexpected role (-want +got):\n%s", diff)
+	}
+	if f&stp.FlagTopologyChange == 0 {
+		t.Fatal("topology change flag was cleared")
+	}
+}
+
+func TestMonitor(t *testing.T) {
+	hub := rawtest.NewHub()
+	bridge := hub.Conn(net.HardwareAddr{0x00, 0x00, 0x5e, 0x00, 0x53, 0xff})
+	defer bridge.Close()
+
+	m := stp.New(
+		&net.Interface{MTU: 1500, HardwareAddr: net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}},
+		hub.Conn(net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}),
+	)
+	defer m.Close()
+
+	events := make(chan stp.Event, 16)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- m.Run(ctx, func(e stp.Event) { events <- e }) }()
+
+	config := func(root stp.BridgeID, flags stp.Flags) *stp.BPDU {
+		return &stp.BPDU{
+			Version:  stp.VersionSTP,
+			Type:     stp.TypeConfig,
+			Flags:    flags,
+			RootID:   root,
+			BridgeID: bridgeA,
+		}
+	}
+
+	bpdus := []*stp.BPDU{
+		config(bridgeA, 0),
+		config(bridgeA, 0),
+		config(bridgeA, stp.FlagTopologyChange),
+		config(bridgeA, stp.FlagTopologyChange),
+		{Version: stp.VersionSTP, Type: stp.TypeTCN},
+		config(bridgeB, 0),
+	}
+	for _, b := range bpdus {
+		writeBPDU(t, bridge, b)
+	}
+
+	want := []stp.EventType{
+		stp.EventRootChanged,
+		stp.EventTopologyChange,
+		stp.EventTopologyChange,
+		stp.EventRootChanged,
+	}
+
+	var got []stp.EventType
+	var last stp.Event
+	for range want {
+		select {
+		case e := <-events:
+			got = append(got, e.Type)
+			last = e
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for events, got: %v", got)
+		}
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected events (-want +got):\n%s", diff)
+	}
+	if last.PreviousRoot == nil || !last.PreviousRoot.Equal(bridgeA) {
+		t.Fatalf("unexpected previous root: %v", last.PreviousRoot)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("failed to run monitor: %v", err)
+	}
+
+	s := m.Status()
+	if !s.Root.Equal(bridgeB) || s.BPDUs != len(bpdus) || s.RootChanges != 1 || s.TopologyChanges != 2 {
+		t.Fatalf("unexpected status: %+v", s)
+	}
+}
+
+func TestMonitorTCNFirst(t *testing.T) {
+	hub := rawtest.NewHub()
+	bridge := hub.Conn(net.HardwareAddr{0x00, 0x00, 0x5e, 0x00, 0x53, 0xff})
+	defer bridge.Close()
+
+	m := stp.New(
+		&net.Interface{MTU: 1500, HardwareAddr: net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}},
+		hub.Conn(net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}),
+	)
+	defer m.Close()
+
+	events := make(chan stp.Event, 16)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- m.Run(ctx, func(e stp.Event) { events <- e }) }()
+
+	// A TCN carries no root, so the first root is learned from the
+	// configuration BPDU which follows it.
+	writeBPDU(t, bridge, &stp.BPDU{Version: stp.VersionSTP, Type: stp.TypeTCN})
+	writeBPDU(t, bridge, &stp.BPDU{
+		Version:  stp.VersionSTP,
+		Type:     stp.TypeConfig,
+		RootID:   bridgeB,
+		BridgeID: bridgeB,
+	})
+
+	for {
+		var e stp.Event
+		select {
+		case e = <-events:
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for root change")
+		}
+
+		if e.Type != stp.EventRootChanged {
+			continue
+		}
+		if e.PreviousRoot != nil {
+			t.Fatalf("unexpected previous root: %v", e.PreviousRoot)
+		}
+		break
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("failed to run monitor: %v", err)
+	}
+
+	s := m.Status()
+	if !s.Root.Equal(bridgeB) || s.BPDUs != 2 || s.RootChanges != 0 {
+		t.Fatalf("unexpected status: %+v", s)
+	}
+}
+
+func TestMonitorRunClearsReadDeadline(t *testing.T) {
+	hub := rawtest.NewHub()
+	bridge := hub.Conn(net.HardwareAddr{0x00, 0x00, 0x5e, 0x00, 0x53, 0xff})
+	defer bridge.Close()
+
+	c := hub.Conn(net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01})
+	m := stp.New(&net.Interface{MTU: 1500, HardwareAddr: net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}}, c)
+	defer m.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := m.Run(ctx, nil); err != nil {
+		t.Fatalf("failed to run monitor: %v", err)
+	}
+
+	// The connection must remain usable once Run returns.
+	writeBPDU(t, bridge, &stp.BPDU{Version: stp.VersionSTP, Type: stp.TypeTCN})
+	if _, _, err := c.ReadFrom(make([]byte, 1500)); err != nil {
+		t.Fatalf("failed to read after running monitor: %v", err)
+	}
+}
+
+// writeBPDU writes b in an IEEE 802.3 frame with an LLC header.
+func writeBPDU(t *testing.T, conn *rawtest.Conn, b *stp.BPDU) {
+	t.Helper()
+
+	bb, err := b.MarshalBinary()
+	if err != nil {
+		t.Fatalf("failed to marshal BPDU: %v", err)
+	}
+
+	f, err := llc.NewFrame(stp.GroupAddr, conn.LocalAddr().(*raw.Addr).HardwareAddr, &llc.PDU{
+		Header: llc.Header{
+			DSAP:    llc.SAPSTP,
+			SSAP:    llc.SAPSTP,
+			Control: llc.ControlUI,
+		},
+		Payload: bb,
+	})
+	if err != nil {
+		t.Fatalf("failed to create frame: %v", err)
+	}
+
+	fb, err := f.MarshalBinary()
+	if err != nil {
+		t.Fatalf("failed to marshal frame: %v", err)
+	}
+
+	if _, err := conn.WriteTo(fb, nil); err != nil {
+		t.Fatalf("failed to write frame: %v", err)
+	}
+}
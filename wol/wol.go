@@ -0,0 +1,252 @@
+// Package wol implements Wake-on-LAN magic packets, including the optional
+// SecureOn password, and sends them on top of a *raw.Conn.
+package wol
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/mdlayher/raw"
+	"github.com/mdlayher/raw/ethernet"
+	"github.com/mdlayher/raw/inet"
+)
+
+// Port is the UDP port conventionally used for magic packets. Port 7 is also
+// commonly accepted.
+const Port = 9
+
+const (
+	// syncLen is the length of the synchronization stream which begins a
+	// magic packet.
+	syncLen = 6
+
+	// repeat is the number of times the target hardware address is repeated.
+	repeat = 16
+
+	// magicLen is the length of a magic packet without a password.
+	magicLen = syncLen + repeat*6
+)
+
+var (
+	// errInvalidPacket is returned when a MagicPacket cannot be parsed.
+	errInvalidPacket = errors.New("wol: invalid magic packet")
+
+	// errInvalidPassword is returned when a SecureOn password has an invalid
+	// length.
+	errInvalidPassword = errors.New("wol: SecureOn password must be 0, 4, or 6 bytes")
+)
+
+// A MagicPacket is a Wake-on-LAN magic packet: a synchronization stream of
+// six 0xff bytes followed by sixteen repetitions of the target hardware
+// address and an optional SecureOn password.
+type MagicPacket struct {
+	// Target is the hardware address of the machine to wake.
+	Target net.HardwareAddr
+
+	// Password is an optional 4 or 6 byte SecureOn password.
+	Password []byte
+}
+
+// MarshalBinary allocates a byte slice and marshals a MagicPacket into
+// binary form.
+func (p *MagicPacket) MarshalBinary() ([]byte, error) {
+	if len(p.Target) != 6 {
+		return nil, fmt.Errorf("wol: invalid target hardware address: %q", p.Target)
+	}
+	if !validPassword(p.Password) {
+		return nil, errInvalidPassword
+	}
+
+	b := make([]byte, 0, magicLen+len(p.Password))
+	b = append(b, bytes.Repeat([]byte{0xff}, syncLen)...)
+	for i := 0; i < repeat; i++ {
+		b = append(b, p.Target...)
+	}
+
+	return append(b, p.Password...), nil
+}
+
+// UnmarshalBinary unmarshals a byte slice into a MagicPacket. Because a magic
+// packet carries no length, any trailing data which is not exactly the length
+// of a SecureOn password must first be removed by the caller.
+func (p *MagicPacket) UnmarshalBinary(b []byte) error {
+	if len(b) < magicLen {
+		return io.ErrUnexpectedEOF
+	}
+	if !validPassword(b[magicLen:]) {
+		return errInvalidPassword
+	}
+
+	if !bytes.Equal(b[:syncLen], bytes.Repeat([]byte{0xff}, syncLen)) {
+		return errInvalidPacket
+	}
+
+	target := b[syncLen : syncLen+6]
+	for i := 1; i < repeat; i++ {
+		off := syncLen + i*6
+		if !bytes.Equal(target, b[off:off+6]) {
+			return errInvalidPacket
+		}
+	}
+
+	p.Target = make(net.HardwareAddr, 6)
+	copy(p.Target, target)
+
+	p.Password = nil
+	if len(b) > magicLen {
+		p.Password = make([]byte, len(b)-magicLen)
+		copy(p.Password, b[magicLen:])
+	}
+
+	return nil
+}
+
+// ParsePassword parses a SecureOn password written as a hardware address,
+// such as "01:02:03:04:05:06", or as an IPv4 address, such as "1.2.3.4". An
+// empty string produces no password.
+func ParsePassword(s string) ([]byte, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	if strings.Count(s, ".") == 3 {
+		if ip := net.ParseIP(s).To4(); ip != nil {
+			return []byte(ip), nil
+		}
+	}
+
+	if mac, err := net.ParseMAC(s); err == nil && len(mac) == 6 {
+		return []byte(mac), nil
+	}
+
+	return nil, fmt.Errorf("wol: invalid SecureOn password: %q", s)
+}
+
+// validPassword reports whether b is a valid SecureOn password length.
+func validPassword(b []byte) bool {
+	switch len(b) {
+	case 0, 4, 6:
+		return true
+	default:
+		return false
+	}
+}
+
+// A Client sends magic packets on a network interface.
+type Client struct {
+	ifi *net.Interface
+	p   net.PacketConn
+}
+
+// Dial creates a new Client using the specified network interface. Dial
+// opens a *raw.Conn bound to the Wake-on-LAN EtherType.
+func Dial(ifi *net.Interface) (*Client, error) {
+	p, err := raw.ListenPacket(ifi, uint16(ethernet.EtherTypeWOL), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := New(ifi, p)
+	if err != nil {
+		_ = p.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// New creates a new Client using the specified network interface and
+// net.PacketConn. p must send complete Ethernet frames.
+func New(ifi *net.Interface, p net.PacketConn) (*Client, error) {
+	if len(ifi.HardwareAddr) != 6 {
+		return nil, fmt.Errorf("wol: invalid hardware address: %q", ifi.HardwareAddr)
+	}
+
+	return &Client{
+		ifi: ifi,
+		p:   p,
+	}, nil
+}
+
+// Close closes the Client's connection.
+func (c *Client) Close() error {
+	return c.p.Close()
+}
+
+// Wake sends a magic packet for target with the optional SecureOn password,
+// in an Ethernet frame with the Wake-on-LAN EtherType. The frame is sent to
+// dst, or to the broadcast address if dst is nil.
+func (c *Client) Wake(dst, target net.HardwareAddr, password []byte) error {
+	pb, err := (&MagicPacket{Target: target, Password: password}).MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	return c.send(dst, ethernet.EtherTypeWOL, pb)
+}
+
+// WakeUDP sends a magic packet for target with the optional SecureOn
+// password, in an IPv4 UDP datagram addressed to addr. If addr is nil, the
+// datagram is sent to the limited broadcast address on Port. The frame is
+// sent to dst, or to the broadcast address if dst is nil.
+//
+// The datagram uses the unspecified address as its source, because the
+// interface need not have an IPv4 address.
+func (c *Client) WakeUDP(dst net.HardwareAddr, addr *net.UDPAddr, target net.HardwareAddr, password []byte) error {
+	if addr == nil {
+		addr = &net.UDPAddr{IP: net.IPv4bcast, Port: Port}
+	}
+	if addr.IP.To4() == nil || addr.Port <= 0 || addr.Port > 0xffff {
+		return fmt.Errorf("wol: invalid UDP address: %s", addr)
+	}
+
+	pb, err := (&MagicPacket{Target: target, Password: password}).MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	src := net.IPv4zero.To4()
+	ub, err := (&inet.UDPHeader{
+		SourcePort:      uint16(addr.Port),
+		DestinationPort: uint16(addr.Port),
+	}).Marshal(pb, src, addr.IP)
+	if err != nil {
+		return err
+	}
+
+	ipb, err := (&inet.IPv4Header{
+		TTL:         64,
+		Protocol:    inet.ProtocolUDP,
+		Source:      src,
+		Destination: addr.IP,
+	}).Marshal(ub)
+	if err != nil {
+		return err
+	}
+
+	return c.send(dst, ethernet.EtherTypeIPv4, ipb)
+}
+
+// send sends an Ethernet frame carrying payload to dst.
+func (c *Client) send(dst net.HardwareAddr, et ethernet.EtherType, payload []byte) error {
+	if dst == nil {
+		dst = ethernet.Broadcast
+	}
+
+	fb, err := (&ethernet.Frame{
+		Destination: dst,
+		Source:      c.ifi.HardwareAddr,
+		EtherType:   et,
+		Payload:     payload,
+	}).MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	_, err = c.p.WriteTo(fb, &raw.Addr{HardwareAddr: dst})
+	return err
+}
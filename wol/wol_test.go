@@ -0,0 +1,246 @@
+package wol_test
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/raw/ethernet"
+	"github.com/mdlayher/raw/inet"
+	"github.com/mdlayher/raw/internal/rawtest"
+	"github.com/mdlayher/raw/wol"
+)
+
+var (
+	senderMAC = net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	targetMAC = net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad}
+)
+
+func TestMagicPacketMarshalUnmarshal(t *testing.T) {
+	tests := []struct {
+		name     string
+		password []byte
+		n        int
+	}{
+		{
+			name: "no password",
+			n:    102,
+		},
+		{
+			name:     "4 byte password",
+			password: []byte{192, 0, 2, 1},
+			n:        106,
+		},
+		{
+			name:     "6 byte password",
+			password: []byte{1, 2, 3, 4, 5, 6},
+			n:        108,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &wol.MagicPacket{Target: targetMAC, Password: tt.password}
+
+			b, err := p.MarshalBinary()
+			if err != nil {
+				t.Fatalf("failed to marshal: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.n, len(b)); diff != "" {
+				t.Fatalf("unexpected length (-want +got):\n%s", diff)
+			}
+			if !bytes.Equal(b[:6], bytes.Repeat([]byte{0xff}, 6)) {
+				t.Fatalf("invalid synchronization stream: % x", b[:6])
+			}
+
+			var got wol.MagicPacket
+			if err := got.UnmarshalBinary(b); err != nil {
+				t.Fatalf("failed to unmarshal: %v", err)
+			}
+
+			if diff := cmp.Diff(p, &got); diff != "" {
+				t.Fatalf("unexpected magic packet (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestMagicPacketErrors(t *testing.T) {
+	if _, err := (&wol.MagicPacket{Target: targetMAC, Password: []byte{1, 2}}).MarshalBinary(); err == nil {
+		t.Fatal("expected invalid password error, but none occurred")
+	}
+
+	b, err := (&wol.MagicPacket{Target: targetMAC}).MarshalBinary()
+	if err != nil {
+		t.Fatalf("failed to marshal: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		b    []byte
+	}{
+		{
+			name: "short",
+			b:    b[:101],
+		},
+		{
+			name: "bad synchronization stream",
+			b:    append([]byte{0x00}, b[1:]...),
+		},
+		{
+			name: "bad repetition",
+			b:    append(append([]byte(nil), b[:101]...), 0x00),
+		},
+		{
+			name: "bad password length",
+			b:    append(append([]byte(nil), b...), 0x01),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var p wol.MagicPacket
+			if err := p.UnmarshalBinary(tt.b); err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+		})
+	}
+}
+
+func TestParsePassword(t *testing.T) {
+	tests := []struct {
+		s    string
+		want []byte
+		ok   bool
+	}{
+		{s: "", ok: true},
+		{s: "192.0.2.1", want: []byte{192, 0, 2, 1}, ok: true},
+		{s: "01:02:03:04:05:06", want: []byte{1, 2, 3, 4, 5, 6}, ok: true},
+		{s: "foo"},
+		{s: "2001:db8::1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			got, err := wol.ParsePassword(tt.s)
+			if tt.ok && err != nil {
+				t.Fatalf("failed to parse: %v", err)
+			}
+			if !tt.ok {
+				if err == nil {
+					t.Fatal("expected an error, but none occurred")
+				}
+				return
+			}
+
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Fatalf("unexpected password (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestClientWake(t *testing.T) {
+	c, conn := testClient(t)
+
+	password := []byte{1, 2, 3, 4}
+	if err := c.Wake(nil, targetMAC, password); err != nil {
+		t.Fatalf("failed to wake: %v", err)
+	}
+
+	f := readFrame(t, conn)
+	if diff := cmp.Diff(ethernet.EtherTypeWOL, f.EtherType); diff != "" {
+		t.Fatalf("unexpected EtherType (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(ethernet.Broadcast, f.Destination); diff != "" {
+		t.Fatalf("unexpected destination (-want +got):\n%s", diff)
+	}
+
+	// Remove Ethernet padding before parsing.
+	var p wol.MagicPacket
+	if err := p.UnmarshalBinary(f.Payload[:106]); err != nil {
+		t.Fatalf("failed to unmarshal magic packet: %v", err)
+	}
+
+	want := &wol.MagicPacket{Target: targetMAC, Password: password}
+	if diff := cmp.Diff(want, &p); diff != "" {
+		t.Fatalf("unexpected magic packet (-want +got):\n%s", diff)
+	}
+}
+
+func TestClientWakeUDP(t *testing.T) {
+	c, conn := testClient(t)
+
+	addr := &net.UDPAddr{IP: net.IPv4(192, 0, 2, 255), Port: 7}
+	if err := c.WakeUDP(targetMAC, addr, targetMAC, nil); err != nil {
+		t.Fatalf("failed to wake: %v", err)
+	}
+
+	f := readFrame(t, conn)
+	if diff := cmp.Diff(targetMAC, f.Destination); diff != "" {
+		t.Fatalf("unexpected destination (-want +got):\n%s", diff)
+	}
+
+	iph, ipp, err := inet.ParseIPv4(f.Payload)
+	if err != nil {
+		t.Fatalf("failed to parse IPv4: %v", err)
+	}
+
+	uh, up, err := inet.ParseUDP(ipp, iph.Source, iph.Destination)
+	if err != nil {
+		t.Fatalf("failed to parse UDP: %v", err)
+	}
+	if diff := cmp.Diff(uint16(7), uh.DestinationPort); diff != "" {
+		t.Fatalf("unexpected port (-want +got):\n%s", diff)
+	}
+
+	var p wol.MagicPacket
+	if err := p.UnmarshalBinary(up); err != nil {
+		t.Fatalf("failed to unmarshal magic packet: %v", err)
+	}
+	if diff := cmp.Diff(targetMAC, p.Target); diff != "" {
+		t.Fatalf("unexpected target (-want +got):\n%s", diff)
+	}
+}
+
+// testClient creates a Client and a promiscuous listener on the same
+// in-memory segment.
+func testClient(t *testing.T) (*wol.Client, *rawtest.Conn) {
+	t.Helper()
+
+	hub := rawtest.NewHub()
+	conn := hub.Conn(net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x02})
+	conn.SetPromiscuous(true)
+
+	c, err := wol.New(&net.Interface{MTU: 1500, HardwareAddr: senderMAC}, hub.Conn(senderMAC))
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	t.Cleanup(func() {
+		c.Close()
+		conn.Close()
+	})
+
+	return c, conn
+}
+
+// readFrame reads a single Ethernet frame from conn.
+func readFrame(t *testing.T, conn *rawtest.Conn) *ethernet.Frame {
+	t.Helper()
+
+	b := make([]byte, 1514)
+	n, _, err := conn.ReadFrom(b)
+	if err != nil {
+		t.Fatalf("failed to read frame: %v", err)
+	}
+
+	var f ethernet.Frame
+	if err := f.UnmarshalBinary(b[:n]); err != nil {
+		t.Fatalf("failed to unmarshal frame: %v", err)
+	}
+
+	return &f
+}